@@ -1,6 +1,7 @@
 package ampel
 
 import (
+	"errors"
 	"fmt"
 	"path"
 	"strconv"
@@ -21,10 +22,13 @@ import (
 //
 // Options:
 //   - WithCatalog: Include catalog data to enrich tenet descriptions
+//   - WithCatalogs / WithCatalogIndex: Look requirements up in several catalogs
 //   - WithCELTemplates: Custom CEL code templates for method types
 //   - WithAttestationTypes: Specify expected attestation types
 //   - WithScopeFilters: Generate scope-based CEL filters
 //   - WithDefaultRule: Set overall policy rule (default: "all(tenets)")
+//   - WithTrace: Record how each tenet was generated
+//   - WithContextValues: Choose runtime values for Policy.Context
 func FromPolicy(policy *gemara.Policy, opts ...TransformOption) (*Policy, error) {
 	options := &TransformOptions{}
 	for _, opt := range opts {
@@ -32,6 +36,16 @@ func FromPolicy(policy *gemara.Policy, opts ...TransformOption) (*Policy, error)
 	}
 	options.applyDefaults()
 
+	index, err := buildCatalogIndex(options)
+	if err != nil {
+		return nil, fmt.Errorf("error indexing catalogs: %w", err)
+	}
+	options.CatalogIndex = index
+
+	if options.Trace != nil && options.Trace.PolicyID == "" {
+		options.Trace.PolicyID = policy.Metadata.Id
+	}
+
 	ampelPolicy := &Policy{
 		Id: policy.Metadata.Id,
 		Meta: &Meta{
@@ -48,7 +62,8 @@ func FromPolicy(policy *gemara.Policy, opts ...TransformOption) (*Policy, error)
 	}
 
 	// Build Policy.Context from Gemara parameters
-	if err := buildContextFromParameters(policy, ampelPolicy); err != nil {
+	conflicts := findParameterConflicts(policy)
+	if err := buildContextFromParameters(policy, ampelPolicy, conflicts, options); err != nil {
 		return nil, fmt.Errorf("error building context from parameters: %w", err)
 	}
 
@@ -57,7 +72,7 @@ func FromPolicy(policy *gemara.Policy, opts ...TransformOption) (*Policy, error)
 
 	// Convert assessment plans to tenets
 	for _, plan := range policy.Adherence.AssessmentPlans {
-		tenets, enrichments, err := assessmentPlanToTenets(plan, policy, options)
+		tenets, enrichments, err := assessmentPlanToTenets(plan, policy, conflicts, options)
 		if err != nil {
 			return nil, fmt.Errorf("error converting assessment plan %s: %w", plan.Id, err)
 		}
@@ -67,7 +82,7 @@ func FromPolicy(policy *gemara.Policy, opts ...TransformOption) (*Policy, error)
 
 	// Add control references to policy metadata if catalog enrichment was used
 	if len(allEnrichments) > 0 {
-		controls := collectControlReferences(allEnrichments)
+		controls := collectControlReferences(allEnrichments, options.FrameworkNames)
 		if len(controls) > 0 {
 			ampelPolicy.Meta.Controls = controls
 		}
@@ -113,22 +128,66 @@ func buildMetadata(policy *gemara.Policy, ampelPolicy *Policy) error {
 
 // buildContextFromParameters collects all parameters from assessment plans and
 // creates Policy.Context with ContextVal entries for each parameter.
-func buildContextFromParameters(policy *gemara.Policy, ampelPolicy *Policy) error {
+// Parameters defined differently by several plans are handled according to
+// options.ParameterConflicts.
+func buildContextFromParameters(
+	policy *gemara.Policy,
+	ampelPolicy *Policy,
+	conflicts []ParameterConflict,
+	options *TransformOptions,
+) error {
+	conflicting := make(map[string]bool, len(conflicts))
+	for _, conflict := range conflicts {
+		conflicting[conflict.ParameterID] = true
+		for _, def := range conflict.Definitions[1:] {
+			loc := SourceLocation{PolicyID: policy.Metadata.Id, PlanID: def.PlanID}
+			switch options.ParameterConflicts {
+			case ParameterConflictNamespace:
+				options.report(SeverityInfo, DiagParameterConflict, loc,
+					"parameter %s conflicts with plan %s; namespaced as %s",
+					conflict.ParameterID, conflict.Definitions[0].PlanID, namespacedContextKey(def.PlanID, conflict.ParameterID))
+			case ParameterConflictFail:
+				options.report(SeverityError, DiagParameterConflict, loc,
+					"parameter %s accepts [%s] but plan %s defines [%s]",
+					conflict.ParameterID, strings.Join(def.AcceptedValues, ", "),
+					conflict.Definitions[0].PlanID, strings.Join(conflict.Definitions[0].AcceptedValues, ", "))
+			default:
+				options.report(SeverityWarning, DiagParameterConflict, loc,
+					"parameter %s accepts [%s] but plan %s defines [%s]; CEL for this plan checks the first definition",
+					conflict.ParameterID, strings.Join(def.AcceptedValues, ", "),
+					conflict.Definitions[0].PlanID, strings.Join(conflict.Definitions[0].AcceptedValues, ", "))
+			}
+		}
+	}
+	if len(conflicts) > 0 && options.ParameterConflicts == ParameterConflictFail {
+		return &ParameterConflictError{PolicyID: policy.Metadata.Id, Conflicts: conflicts}
+	}
+
 	// Collect all unique parameters from all assessment plans
 	parametersMap := make(map[string]gemara.Parameter)
+	definedBy := make(map[string]string)
 
 	for _, plan := range policy.Adherence.AssessmentPlans {
+		contextKeys := planContextKeys(plan, conflicts, options)
 		for _, param := range plan.Parameters {
-			// Use parameter ID as the key to avoid duplicates
-			if _, exists := parametersMap[param.Id]; !exists {
-				parametersMap[param.Id] = param
+			// Use the context key to avoid duplicates
+			key := contextKeys[param.Id]
+			if _, exists := parametersMap[key]; !exists {
+				parametersMap[key] = param
+				definedBy[key] = plan.Id
+				continue
+			}
+			if !conflicting[param.Id] {
+				options.report(SeverityInfo, DiagDuplicateParameter, planLocation(policy, plan),
+					"parameter %s is also defined by plan %s with the same accepted values",
+					param.Id, definedBy[key])
 			}
 		}
 	}
 
 	// If no parameters, skip context creation
 	if len(parametersMap) == 0 {
-		return nil
+		return applyContextValues(policy, ampelPolicy, parametersMap, definedBy, options)
 	}
 
 	// Initialize Policy.Context if needed
@@ -145,7 +204,8 @@ func buildContextFromParameters(policy *gemara.Policy, ampelPolicy *Policy) erro
 		ampelPolicy.Context[paramId] = contextVal
 	}
 
-	return nil
+	// Apply runtime values chosen by the caller
+	return applyContextValues(policy, ampelPolicy, parametersMap, definedBy, options)
 }
 
 // parameterToContextVal converts a Gemara Parameter to an Ampel ContextVal.
@@ -188,16 +248,23 @@ func parameterToContextVal(param gemara.Parameter) (*ContextVal, error) {
 
 // buildCELParams creates a parameter map for CEL template substitution.
 // It generates context references for parameters to be used in CEL expressions.
-func buildCELParams(parameters []gemara.Parameter) map[string]interface{} {
+// contextKeys maps parameter IDs to their Policy.Context key; parameters
+// missing from it are referenced by ID.
+func buildCELParams(parameters []gemara.Parameter, contextKeys map[string]string) map[string]interface{} {
 	celParams := make(map[string]interface{})
 
 	for _, param := range parameters {
 		// Use the original parameter ID as the key
 		paramKey := param.Id
 
+		contextKey := param.Id
+		if key, ok := contextKeys[param.Id]; ok {
+			contextKey = key
+		}
+
 		if len(param.AcceptedValues) > 0 {
 			// Generate context reference: context["param-id"]
-			contextRef := fmt.Sprintf("context[\"%s\"]", param.Id)
+			contextRef := fmt.Sprintf("context[\"%s\"]", contextKey)
 			celParams[paramKey] = contextRef
 
 			// For multiple accepted values, create a comma-separated list
@@ -213,7 +280,7 @@ func buildCELParams(parameters []gemara.Parameter) map[string]interface{} {
 		} else {
 			// For parameters without accepted values (runtime-provided),
 			// still generate context reference
-			contextRef := fmt.Sprintf("context[\"%s\"]", param.Id)
+			contextRef := fmt.Sprintf("context[\"%s\"]", contextKey)
 			celParams[paramKey] = contextRef
 		}
 	}
@@ -226,6 +293,7 @@ func buildCELParams(parameters []gemara.Parameter) map[string]interface{} {
 func assessmentPlanToTenets(
 	plan gemara.AssessmentPlan,
 	policy *gemara.Policy,
+	conflicts []ParameterConflict,
 	options *TransformOptions,
 ) ([]*Tenet, []*CatalogEnrichment, error) {
 	var tenets []*Tenet
@@ -233,8 +301,18 @@ func assessmentPlanToTenets(
 
 	// Look up requirement in catalog if available
 	var enrichment *CatalogEnrichment
-	if options.Catalog != nil && plan.RequirementId != "" {
-		enrichment = lookupRequirement(options.Catalog, plan.RequirementId)
+	if options.CatalogIndex != nil && plan.RequirementId != "" {
+		var ambiguous *AmbiguousRequirementError
+		var err error
+		enrichment, err = lookupPlanRequirement(options.CatalogIndex, policy, plan.RequirementId)
+		switch {
+		case errors.As(err, &ambiguous):
+			options.report(SeverityWarning, DiagAmbiguousRequirement, planLocation(policy, plan),
+				"%v; tenets are not enriched", err)
+		case err != nil:
+			options.report(SeverityWarning, DiagRequirementNotInCatalog, planLocation(policy, plan),
+				"requirement %s was not found in the catalog; tenets are not enriched", plan.RequirementId)
+		}
 	}
 
 	// Get evidence requirements
@@ -242,25 +320,32 @@ func assessmentPlanToTenets(
 
 	// Process each evaluation method
 	methodIndex := 0
-	for _, method := range plan.EvaluationMethods {
+	for sourceIndex, method := range plan.EvaluationMethods {
 		// Only process automated methods
 		if !isAutomatedMethod(method.Type) {
+			options.report(SeverityInfo, DiagMethodSkipped, methodLocation(policy, plan, sourceIndex),
+				"evaluation method type %q is not automated; no tenet generated", method.Type)
 			continue
 		}
 
 		// Build CEL parameters for template substitution
 		// Parameters are now stored in Policy.Context and referenced in CEL as context["param-id"]
-		celParams := buildCELParams(plan.Parameters)
+		celParams := buildCELParams(plan.Parameters, planContextKeys(plan, conflicts, options))
 
 		// Generate CEL expression
-		celCode, attestationTypes, err := GenerateCELFromMethod(method, evidenceReq, celParams, options.CELTemplates)
+		gen, err := generateCELFromMethod(method, evidenceReq, celParams, options.CELTemplates)
 		if err != nil {
 			return nil, nil, fmt.Errorf("error generating CEL for method %d: %w", methodIndex, err)
 		}
+		celCode, attestationTypes := gen.Code, gen.AttestationTypes
+		genLocation := methodLocation(policy, plan, sourceIndex)
+		genLocation.TenetID = generatedTenetID(plan, methodIndex)
+		reportCELGeneration(options, genLocation, gen)
 
 		// Apply scope filters if enabled
+		var scopeFilter string
 		if options.IncludeScopeFilters {
-			scopeFilter := ScopeFilterToCEL(policy.Scope.In)
+			scopeFilter = ScopeFilterToCEL(policy.Scope.In)
 			if scopeFilter != "" {
 				celCode = fmt.Sprintf("(%s) && (%s)", scopeFilter, celCode)
 			}
@@ -272,7 +357,7 @@ func assessmentPlanToTenets(
 
 		// Create tenet with official Ampel format
 		tenet := &Tenet{
-			Id:      fmt.Sprintf("%s-%s-%d", plan.RequirementId, plan.Id, methodIndex),
+			Id:      generatedTenetID(plan, methodIndex),
 			Title:   title,
 			Runtime: "cel@v14.0",
 			Code:    celCode,
@@ -287,6 +372,11 @@ func assessmentPlanToTenets(
 
 		tenets = append(tenets, tenet)
 
+		if options.Trace != nil {
+			options.Trace.Tenets = append(options.Trace.Tenets,
+				newTenetTrace(policy.Metadata.Id, tenet, plan, sourceIndex, methodIndex, method, gen, scopeFilter, enrichment))
+		}
+
 		// Track enrichment if found (one per tenet)
 		if enrichment != nil {
 			enrichments = append(enrichments, enrichment)
@@ -298,6 +388,25 @@ func assessmentPlanToTenets(
 	return tenets, enrichments, nil
 }
 
+// reportCELGeneration records diagnostics about a generated CEL expression.
+func reportCELGeneration(options *TransformOptions, location SourceLocation, gen *celGeneration) {
+	if gen.Fallback {
+		if gen.MissingTemplate != "" {
+			options.report(SeverityWarning, DiagUnknownTemplate, location,
+				"CEL template %q does not exist; generated a basic expression", gen.MissingTemplate)
+		} else {
+			options.report(SeverityWarning, DiagUnknownTemplate, location,
+				"no CEL template matches the method; generated a basic expression")
+		}
+	}
+
+	// text/template renders missing map keys as "<no value>"
+	if strings.Contains(gen.Code, "<no value>") {
+		options.report(SeverityError, DiagMissingTemplateParameter, location,
+			"CEL template %q references a parameter the plan does not define", gen.TemplateName)
+	}
+}
+
 // getTenetName determines an appropriate name for a tenet based on the method and evidence.
 func getTenetName(method gemara.AcceptedMethod, evidenceReq string) string {
 	if method.Description != "" {
@@ -318,6 +427,12 @@ func getTenetName(method gemara.AcceptedMethod, evidenceReq string) string {
 	return fmt.Sprintf("%s verification", method.Type)
 }
 
+// generatedTenetID returns the ID of the tenet generated from the automated
+// method at methodIndex (counting automated methods only) of a plan.
+func generatedTenetID(plan gemara.AssessmentPlan, methodIndex int) string {
+	return fmt.Sprintf("%s-%s-%d", plan.RequirementId, plan.Id, methodIndex)
+}
+
 // isAutomatedMethod checks if an evaluation method type can be automated.
 func isAutomatedMethod(methodType string) bool {
 	automatedTypes := map[string]bool{
@@ -336,6 +451,8 @@ func isAutomatedMethod(methodType string) bool {
 //
 // Options:
 //   - WithPolicySetMetadata: Set name, description, and version for the PolicySet
+//   - WithPolicySetCustomMetadata: Set runtime, enforce, expiration, frameworks or origin
+//   - WithHoistedContext: Move shared context entries into the PolicySet common context
 //   - WithCatalog: Include catalog data to enrich tenet descriptions
 //   - WithCELTemplates: Custom CEL code templates for method types
 //   - WithAttestationTypes: Specify expected attestation types
@@ -390,6 +507,10 @@ func FromPolicies(policies []*gemara.Policy, opts ...PolicySetOption) (*PolicySe
 		policySet.Policies = append(policySet.Policies, ampelPolicy)
 	}
 
+	if err := finishPolicySet(policySet, psOptions); err != nil {
+		return nil, err
+	}
+
 	// Validate the generated policy set
 	if err := policySet.Validate(); err != nil {
 		return nil, fmt.Errorf("generated policy set validation failed: %w", err)
@@ -398,16 +519,26 @@ func FromPolicies(policies []*gemara.Policy, opts ...PolicySetOption) (*PolicySe
 	return policySet, nil
 }
 
+// DefaultPolicySetID returns the ID of the PolicySet FromPolicyWithImports
+// generates from policy when WithPolicySetMetadata sets no name.
+func DefaultPolicySetID(policy *gemara.Policy) string {
+	return policy.Metadata.Id + "-set"
+}
+
 // FromPolicyWithImports converts a Gemara Layer-3 Policy and its imports to an Ampel PolicySet.
 //
 // This function creates a PolicySet where:
 //   - The main policy is converted to an inline Ampel policy
-//   - Imported policies are added as external references
+//   - Imported policies are added as external references, or converted
+//     inline when a PolicyResolver is configured
 //
 // Options:
 //   - WithPolicySetMetadata: Set name, description, and version for the PolicySet
+//   - WithPolicySetCustomMetadata: Set runtime, enforce, expiration, frameworks or origin
+//   - WithHoistedContext: Move shared context entries into the PolicySet common context
 //   - WithCatalog: Include catalog data to enrich tenet descriptions
 //   - WithCELTemplates: Custom CEL code templates for method types
+//   - WithPolicyResolver: Load and convert imported policies inline
 func FromPolicyWithImports(policy *gemara.Policy, opts ...PolicySetOption) (*PolicySet, error) {
 	// Apply policy set options
 	psOptions := &PolicySetOptions{}
@@ -418,7 +549,7 @@ func FromPolicyWithImports(policy *gemara.Policy, opts ...PolicySetOption) (*Pol
 	// Set PolicySet metadata (default to main policy metadata if not provided)
 	policySetId := psOptions.Name
 	if policySetId == "" {
-		policySetId = policy.Metadata.Id + "-set"
+		policySetId = DefaultPolicySetID(policy)
 	}
 
 	policySetDesc := psOptions.Description
@@ -466,27 +597,40 @@ func FromPolicyWithImports(policy *gemara.Policy, opts ...PolicySetOption) (*Pol
 
 	policySet.Policies = append(policySet.Policies, ampelPolicy)
 
-	// Add imported policies as external references
-	for _, importedPolicyRef := range policy.Imports.Policies {
-		// Create a Policy with Source reference for external policies
-		extPolicy := &Policy{
-			Id: extractPolicyIdFromReference(importedPolicyRef),
-			Source: &PolicyRef{
+	if psOptions.Resolver != nil {
+		// Convert imported policies inline, following their own imports
+		imported, err := convertImportedPolicies(policy, psOptions)
+		if err != nil {
+			return nil, err
+		}
+		policySet.Policies = append(policySet.Policies, imported...)
+	} else {
+		// Add imported policies as external references
+		for _, importedPolicyRef := range policy.Imports.Policies {
+			// Create a Policy with Source reference for external policies
+			extPolicy := &Policy{
 				Id: extractPolicyIdFromReference(importedPolicyRef),
-				Location: &ResourceDescriptor{
-					Uri: importedPolicyRef,
+				Source: &PolicyRef{
+					Id: extractPolicyIdFromReference(importedPolicyRef),
+					Location: &ResourceDescriptor{
+						Uri: importedPolicyRef,
+					},
 				},
-			},
-		}
+			}
 
-		// Add metadata for imported policy if provided
-		if psOptions.Meta != nil {
-			if meta, ok := psOptions.Meta[extPolicy.Id]; ok {
-				extPolicy.Meta = meta
+			// Add metadata for imported policy if provided
+			if psOptions.Meta != nil {
+				if meta, ok := psOptions.Meta[extPolicy.Id]; ok {
+					extPolicy.Meta = meta
+				}
 			}
+
+			policySet.Policies = append(policySet.Policies, extPolicy)
 		}
+	}
 
-		policySet.Policies = append(policySet.Policies, extPolicy)
+	if err := finishPolicySet(policySet, psOptions); err != nil {
+		return nil, err
 	}
 
 	// Validate the generated policy set
@@ -79,7 +79,7 @@ func TestAssessmentPlanToTenets(t *testing.T) {
 	policy := createTestPolicy()
 	plan := createTestAssessmentPlan()
 
-	tenets, enrichments, err := assessmentPlanToTenets(plan, policy, &TransformOptions{
+	tenets, enrichments, err := assessmentPlanToTenets(plan, policy, nil, &TransformOptions{
 		CELTemplates: DefaultCELTemplates,
 		DefaultRule:  "all(tenets)",
 	})
@@ -156,6 +156,9 @@ func TestInferAttestationType(t *testing.T) {
 		{"Vulnerability scan results", "https://in-toto.io/Statement/v0.1"},
 		{"CVE scanning with no critical issues", "https://in-toto.io/Statement/v0.1"},
 		{"Generic attestation", "https://in-toto.io/Statement/v0.1"},
+		{"Attestation of predicate type https://example.com/custom/v1", "https://example.com/custom/v1"},
+		{"Attestations of predicate types https://example.com/a, https://example.com/b.", "https://example.com/a"},
+		{"Provenance whose predicate type is checked", "https://slsa.dev/provenance/v1"},
 		{"Unknown requirement", ""},
 	}
 
@@ -1,6 +1,7 @@
 package ampel
 
 import (
+	"regexp"
 	"strings"
 
 	"github.com/gemaraproj/go-gemara"
@@ -59,29 +60,62 @@ func InferAttestationTypes(policy *gemara.Policy) AttestationTypeInference {
 // InferAttestationType infers a single attestation predicate type URL from
 // an evidence requirement string.
 func InferAttestationType(evidenceReq string) string {
+	attestationType, _ := inferAttestationType(evidenceReq)
+	return attestationType
+}
+
+// predicateTypesPattern matches the predicate type URIs named by evidence
+// requirements such as "Attestation of predicate type https://slsa.dev/provenance/v1",
+// the form ToGemaraPolicy writes.
+var predicateTypesPattern = regexp.MustCompile(`(?i)\bpredicate types?\s+([^\s,]+(?:\s*,\s*[^\s,]+)*)`)
+
+// explicitPredicateTypes returns the predicate type URIs an evidence
+// requirement names after "predicate type" or "predicate types". Words
+// without a URI scheme are not predicate types.
+func explicitPredicateTypes(evidenceReq string) []string {
+	match := predicateTypesPattern.FindStringSubmatch(evidenceReq)
+	if match == nil {
+		return nil
+	}
+
+	var types []string
+	for _, item := range strings.Split(match[1], ",") {
+		item = strings.TrimRight(strings.TrimSpace(item), ".;")
+		if !strings.Contains(item, "://") {
+			return nil
+		}
+		types = append(types, item)
+	}
+	return types
+}
+
+// inferAttestationType implements InferAttestationType and also returns the
+// keyword that determined the type.
+func inferAttestationType(evidenceReq string) (string, string) {
+	// Predicate types named explicitly win over keywords
+	if types := explicitPredicateTypes(evidenceReq); len(types) > 0 {
+		return types[0], "predicate type"
+	}
+
 	lowerReq := strings.ToLower(evidenceReq)
 
 	// Check for SLSA provenance keywords
-	for _, keyword := range []string{"slsa", "provenance", "builder", "build provenance"} {
-		if strings.Contains(lowerReq, keyword) {
-			return "https://slsa.dev/provenance/v1"
-		}
+	if kw := firstKeyword(lowerReq, "slsa", "provenance", "builder", "build provenance"); kw != "" {
+		return "https://slsa.dev/provenance/v1", kw
 	}
 
 	// Check for vulnerability scan keywords
-	for _, keyword := range []string{"vulnerabilit", "cve", "security scan", "vuln scan"} {
-		if strings.Contains(lowerReq, keyword) {
-			return "https://in-toto.io/Statement/v0.1"
-		}
+	if kw := firstKeyword(lowerReq, "vulnerabilit", "cve", "security scan", "vuln scan"); kw != "" {
+		return "https://in-toto.io/Statement/v0.1", kw
 	}
 
 	// Check for in-toto attestation keywords
-	if strings.Contains(lowerReq, "in-toto") || strings.Contains(lowerReq, "attestation") {
-		return "https://in-toto.io/Statement/v0.1"
+	if kw := firstKeyword(lowerReq, "in-toto", "attestation"); kw != "" {
+		return "https://in-toto.io/Statement/v0.1", kw
 	}
 
 	// No specific type detected
-	return ""
+	return "", ""
 }
 
 // analyzeEvidenceRequirement updates the inference based on an evidence requirement string.
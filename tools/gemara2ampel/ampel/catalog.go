@@ -1,9 +1,19 @@
 package ampel
 
-import "github.com/gemaraproj/go-gemara"
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/gemaraproj/go-gemara"
+)
 
 // CatalogEnrichment contains enriched information from a catalog lookup.
 type CatalogEnrichment struct {
+	// Catalog is the catalog the requirement was found in
+	Catalog *gemara.Catalog
+
 	// Control is the control that contains the requirement
 	Control *gemara.Control
 
@@ -14,39 +24,190 @@ type CatalogEnrichment struct {
 	Family *gemara.Family
 }
 
-// lookupRequirement finds a requirement in the catalog by its ID.
-// Returns the control containing the requirement, the requirement itself,
-// and the control family, or nil if not found.
-func lookupRequirement(catalog *gemara.Catalog, requirementID string) *CatalogEnrichment {
-	if catalog == nil || requirementID == "" {
-		return nil
+// CatalogQualifierSeparator separates the catalog ID from the requirement ID
+// in a catalog-qualified requirement ID such as "osps-baseline:OSPS-AC-01.01".
+const CatalogQualifierSeparator = ":"
+
+// ErrRequirementNotFound is returned by CatalogIndex.Lookup when no indexed
+// catalog contains the requirement.
+var ErrRequirementNotFound = errors.New("requirement not found in catalogs")
+
+// AmbiguousRequirementError is returned by CatalogIndex.Lookup when an
+// unqualified requirement ID exists in more than one catalog.
+type AmbiguousRequirementError struct {
+	RequirementID string
+
+	// CatalogIDs lists the catalogs defining the requirement, in index order
+	CatalogIDs []string
+}
+
+// Error describes the ambiguity and how to resolve it.
+func (e *AmbiguousRequirementError) Error() string {
+	return fmt.Sprintf("requirement %s is defined by catalogs %s; qualify it as <catalog-id>%s%s",
+		e.RequirementID, strings.Join(e.CatalogIDs, ", "), CatalogQualifierSeparator, e.RequirementID)
+}
+
+// CatalogIndex maps requirement IDs to their control and family across one or
+// more catalogs. Build it once with NewCatalogIndex and share it between
+// transformations with WithCatalogIndex.
+type CatalogIndex struct {
+	catalogs []*gemara.Catalog
+
+	// byRequirement maps an unqualified requirement ID to its definition in
+	// each catalog, in catalog order
+	byRequirement map[string][]*CatalogEnrichment
+
+	// byCatalog maps a catalog ID and requirement ID to the definition
+	byCatalog map[string]map[string]*CatalogEnrichment
+}
+
+// NewCatalogIndex indexes the requirements of the given catalogs. Catalogs are
+// identified by their metadata ID, which must be unique among the catalogs
+// that have one. When a catalog defines a requirement ID more than once, the
+// first definition is indexed.
+func NewCatalogIndex(catalogs ...*gemara.Catalog) (*CatalogIndex, error) {
+	index := &CatalogIndex{
+		byRequirement: make(map[string][]*CatalogEnrichment),
+		byCatalog:     make(map[string]map[string]*CatalogEnrichment),
 	}
 
-	// Search through all controls for the requirement
-	for i := range catalog.Controls {
-		control := &catalog.Controls[i]
-		for j := range control.AssessmentRequirements {
-			req := &control.AssessmentRequirements[j]
-			if req.Id == requirementID {
-				// Find the family for this control
-				var family *gemara.Family
-				for k := range catalog.Families {
-					if catalog.Families[k].Id == control.Family {
-						family = &catalog.Families[k]
-						break
-					}
-				}
+	for _, catalog := range catalogs {
+		if catalog == nil {
+			continue
+		}
 
-				return &CatalogEnrichment{
+		catalogID := catalog.Metadata.Id
+		requirements := make(map[string]*CatalogEnrichment)
+		if catalogID != "" {
+			if _, exists := index.byCatalog[catalogID]; exists {
+				return nil, fmt.Errorf("catalog ID %s is used by more than one catalog", catalogID)
+			}
+			index.byCatalog[catalogID] = requirements
+		}
+		index.catalogs = append(index.catalogs, catalog)
+
+		families := make(map[string]*gemara.Family, len(catalog.Families))
+		for i := range catalog.Families {
+			if _, exists := families[catalog.Families[i].Id]; !exists {
+				families[catalog.Families[i].Id] = &catalog.Families[i]
+			}
+		}
+
+		for i := range catalog.Controls {
+			control := &catalog.Controls[i]
+			for j := range control.AssessmentRequirements {
+				req := &control.AssessmentRequirements[j]
+				if _, exists := requirements[req.Id]; exists {
+					continue
+				}
+				enrichment := &CatalogEnrichment{
+					Catalog:     catalog,
 					Control:     control,
 					Requirement: req,
-					Family:      family,
+					Family:      families[control.Family],
 				}
+				requirements[req.Id] = enrichment
+				index.byRequirement[req.Id] = append(index.byRequirement[req.Id], enrichment)
 			}
 		}
 	}
 
-	return nil
+	return index, nil
+}
+
+// Catalogs returns the indexed catalogs in the order they were given.
+func (idx *CatalogIndex) Catalogs() []*gemara.Catalog {
+	return idx.catalogs
+}
+
+// Candidates returns every definition of a requirement. A catalog-qualified ID
+// ("catalog-id:requirement-id") only matches the named catalog; an ID whose
+// prefix is not an indexed catalog ID is looked up unqualified.
+func (idx *CatalogIndex) Candidates(requirementID string) []*CatalogEnrichment {
+	if catalogID, reqID, ok := strings.Cut(requirementID, CatalogQualifierSeparator); ok {
+		if requirements, known := idx.byCatalog[catalogID]; known {
+			if enrichment, found := requirements[reqID]; found {
+				return []*CatalogEnrichment{enrichment}
+			}
+			return nil
+		}
+	}
+	return idx.byRequirement[requirementID]
+}
+
+// Lookup finds a requirement by its unqualified or catalog-qualified ID. It
+// returns ErrRequirementNotFound when no catalog defines the requirement and
+// an *AmbiguousRequirementError when several catalogs do.
+func (idx *CatalogIndex) Lookup(requirementID string) (*CatalogEnrichment, error) {
+	return pickCandidate(requirementID, idx.Candidates(requirementID))
+}
+
+// AmbiguousRequirements returns the unqualified requirement IDs defined by
+// more than one catalog, sorted.
+func (idx *CatalogIndex) AmbiguousRequirements() []string {
+	var ambiguous []string
+	for reqID, candidates := range idx.byRequirement {
+		if len(candidates) > 1 {
+			ambiguous = append(ambiguous, reqID)
+		}
+	}
+	sort.Strings(ambiguous)
+	return ambiguous
+}
+
+// pickCandidate returns the single candidate or the lookup error.
+func pickCandidate(requirementID string, candidates []*CatalogEnrichment) (*CatalogEnrichment, error) {
+	switch len(candidates) {
+	case 0:
+		return nil, fmt.Errorf("%w: %s", ErrRequirementNotFound, requirementID)
+	case 1:
+		return candidates[0], nil
+	default:
+		catalogIDs := make([]string, 0, len(candidates))
+		for _, candidate := range candidates {
+			catalogIDs = append(catalogIDs, candidate.Catalog.Metadata.Id)
+		}
+		return nil, &AmbiguousRequirementError{RequirementID: requirementID, CatalogIDs: catalogIDs}
+	}
+}
+
+// lookupPlanRequirement finds the requirement of an assessment plan. When an
+// unqualified ID is ambiguous, only the catalogs imported by the policy are
+// considered.
+func lookupPlanRequirement(index *CatalogIndex, policy *gemara.Policy, requirementID string) (*CatalogEnrichment, error) {
+	candidates := index.Candidates(requirementID)
+	if len(candidates) > 1 && len(policy.Imports.Catalogs) > 0 {
+		var imported []*CatalogEnrichment
+		for _, candidate := range candidates {
+			for _, catalogImport := range policy.Imports.Catalogs {
+				if catalogImport.ReferenceId == candidate.Catalog.Metadata.Id {
+					imported = append(imported, candidate)
+					break
+				}
+			}
+		}
+		if len(imported) > 0 {
+			candidates = imported
+		}
+	}
+	return pickCandidate(requirementID, candidates)
+}
+
+// buildCatalogIndex returns the catalog index to use for a transformation,
+// indexing the configured catalogs if no index was given.
+func buildCatalogIndex(options *TransformOptions) (*CatalogIndex, error) {
+	if options.CatalogIndex != nil {
+		return options.CatalogIndex, nil
+	}
+
+	catalogs := options.Catalogs
+	if options.Catalog != nil {
+		catalogs = append([]*gemara.Catalog{options.Catalog}, catalogs...)
+	}
+	if len(catalogs) == 0 {
+		return nil, nil
+	}
+	return NewCatalogIndex(catalogs...)
 }
 
 // enrichTenetTitle creates an enriched tenet title using catalog data.
@@ -94,28 +255,68 @@ func createControlReference(enrichment *CatalogEnrichment) *Control {
 	return control
 }
 
+// guidelineControlReferences creates a Control reference for every guideline
+// mapping entry of a catalog control, such as the NIST 800-53 or OSPS
+// Baseline entries a control maps to. The mapping's reference ID is used as
+// the framework unless frameworkNames renames it; a reference renamed to ""
+// is skipped. The reference ID is kept as the class, so renamed frameworks
+// still name their mapping reference, and the full entry ID, such as
+// "OSPS-QA-07", is the control ID.
+func guidelineControlReferences(control *gemara.Control, frameworkNames map[string]string) []*Control {
+	var controls []*Control
+	for _, mapping := range control.GuidelineMappings {
+		framework := mapping.ReferenceId
+		if name, ok := frameworkNames[mapping.ReferenceId]; ok {
+			if name == "" {
+				continue
+			}
+			framework = name
+		}
+
+		for _, entry := range mapping.Entries {
+			if entry.ReferenceId == "" {
+				continue
+			}
+			controls = append(controls, &Control{
+				Framework: framework,
+				Class:     mapping.ReferenceId,
+				Id:        entry.ReferenceId,
+			})
+		}
+	}
+	return controls
+}
+
 // collectControlReferences collects all unique control references from tenets
-// that were enriched with catalog data. This is used to populate the policy-level
-// Meta.Controls field.
-func collectControlReferences(enrichments []*CatalogEnrichment) []*Control {
-	// Use a map to deduplicate controls
-	controlsMap := make(map[string]*Control)
+// that were enriched with catalog data, in the order they were first seen.
+// Each catalog control is followed by the framework references of its
+// guideline mappings. This is used to populate the policy-level Meta.Controls
+// field.
+func collectControlReferences(enrichments []*CatalogEnrichment, frameworkNames map[string]string) []*Control {
+	seen := make(map[string]bool)
+	var controls []*Control
+	add := func(key string, control *Control) {
+		if !seen[key] {
+			seen[key] = true
+			controls = append(controls, control)
+		}
+	}
 
 	for _, enrichment := range enrichments {
 		if enrichment == nil || enrichment.Control == nil {
 			continue
 		}
 
-		controlID := enrichment.Control.Id
-		if _, exists := controlsMap[controlID]; !exists {
-			controlsMap[controlID] = createControlReference(enrichment)
+		// Deduplicate catalog controls per catalog, since control IDs are only unique within one
+		key := enrichment.Control.Id
+		if enrichment.Catalog != nil {
+			key = enrichment.Catalog.Metadata.Id + CatalogQualifierSeparator + key
 		}
-	}
+		add(key, createControlReference(enrichment))
 
-	// Convert map to slice
-	controls := make([]*Control, 0, len(controlsMap))
-	for _, control := range controlsMap {
-		controls = append(controls, control)
+		for _, control := range guidelineControlReferences(enrichment.Control, frameworkNames) {
+			add(fmt.Sprintf("guideline\x00%s\x00%s\x00%s", control.Framework, control.Class, control.Id), control)
+		}
 	}
 
 	return controls
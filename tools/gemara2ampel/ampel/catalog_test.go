@@ -0,0 +1,154 @@
+package ampel
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/gemaraproj/go-gemara"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// createSecondTestCatalog returns a catalog sharing REQ-01 with createTestCatalog.
+func createSecondTestCatalog() *gemara.Catalog {
+	return &gemara.Catalog{
+		Title:    "Second Catalog",
+		Metadata: gemara.Metadata{Id: "catalog-002"},
+		Families: []gemara.Family{{Id: "SF-01", Title: "Second Family"}},
+		Controls: []gemara.Control{
+			{
+				Id:     "CTRL-A",
+				Title:  "Second Control",
+				Family: "SF-01",
+				AssessmentRequirements: []gemara.AssessmentRequirement{
+					{Id: "REQ-01", Text: "Second catalog requirement"},
+					{Id: "REQ-02", Text: "Only in the second catalog"},
+				},
+			},
+		},
+	}
+}
+
+// TestCatalogIndex_Lookup verifies unqualified, qualified, missing and ambiguous lookups.
+func TestCatalogIndex_Lookup(t *testing.T) {
+	index, err := NewCatalogIndex(createTestCatalog(), createSecondTestCatalog())
+	require.NoError(t, err)
+	assert.Len(t, index.Catalogs(), 2)
+
+	enrichment, err := index.Lookup("REQ-02")
+	require.NoError(t, err)
+	assert.Equal(t, "CTRL-A", enrichment.Control.Id)
+	assert.Equal(t, "SF-01", enrichment.Family.Id)
+	assert.Equal(t, "catalog-002", enrichment.Catalog.Metadata.Id)
+
+	enrichment, err = index.Lookup("catalog-001:REQ-01")
+	require.NoError(t, err)
+	assert.Equal(t, "CTRL-01", enrichment.Control.Id)
+	assert.Equal(t, "CF-01", enrichment.Family.Id)
+
+	_, err = index.Lookup("catalog-001:REQ-02")
+	assert.True(t, errors.Is(err, ErrRequirementNotFound))
+	_, err = index.Lookup("REQ-404")
+	assert.True(t, errors.Is(err, ErrRequirementNotFound))
+
+	_, err = index.Lookup("REQ-01")
+	var ambiguous *AmbiguousRequirementError
+	require.True(t, errors.As(err, &ambiguous))
+	assert.Equal(t, []string{"catalog-001", "catalog-002"}, ambiguous.CatalogIDs)
+	assert.Equal(t, []string{"REQ-01"}, index.AmbiguousRequirements())
+}
+
+// TestNewCatalogIndex_DuplicateCatalogID verifies catalogs must be distinguishable.
+func TestNewCatalogIndex_DuplicateCatalogID(t *testing.T) {
+	_, err := NewCatalogIndex(createTestCatalog(), createTestCatalog())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "catalog-001")
+}
+
+// TestFromPolicy_WithCatalogs verifies qualified IDs, import-based disambiguation and ambiguity reporting.
+func TestFromPolicy_WithCatalogs(t *testing.T) {
+	policy := createTestPolicy()
+
+	// Ambiguous without qualification or imports
+	ampelPolicy, diags, err := FromPolicyWithDiagnostics(policy,
+		WithCatalog(createTestCatalog()), WithCatalogs(createSecondTestCatalog()))
+	require.NoError(t, err)
+	ambiguous := findDiagnostics(diags, DiagAmbiguousRequirement)
+	require.Len(t, ambiguous, 1)
+	assert.Contains(t, ambiguous[0].Message, "catalog-001, catalog-002")
+	assert.Empty(t, findDiagnostics(diags, DiagRequirementNotInCatalog))
+	assert.Empty(t, ampelPolicy.Meta.Controls)
+
+	// A catalog-qualified requirement ID picks the catalog
+	policy.Adherence.AssessmentPlans[0].RequirementId = "catalog-002:REQ-01"
+	ampelPolicy, err = FromPolicy(policy, WithCatalogs(createTestCatalog(), createSecondTestCatalog()))
+	require.NoError(t, err)
+	assert.Equal(t, "Second catalog requirement", ampelPolicy.Tenets[0].Title)
+	require.Len(t, ampelPolicy.Meta.Controls, 1)
+	assert.Equal(t, "CTRL-A", ampelPolicy.Meta.Controls[0].Id)
+
+	// Catalogs imported by the policy disambiguate unqualified IDs
+	policy.Adherence.AssessmentPlans[0].RequirementId = "REQ-01"
+	policy.Imports.Catalogs = []gemara.CatalogImport{{ReferenceId: "catalog-001"}}
+	index, err := NewCatalogIndex(createTestCatalog(), createSecondTestCatalog())
+	require.NoError(t, err)
+	ampelPolicy, err = FromPolicy(policy, WithCatalogIndex(index))
+	require.NoError(t, err)
+	assert.Equal(t, "Verify build provenance is present and valid", ampelPolicy.Tenets[0].Title)
+}
+
+// createMappedTestCatalog returns createTestCatalog with guideline mappings on its control.
+func createMappedTestCatalog() *gemara.Catalog {
+	catalog := createTestCatalog()
+	catalog.Metadata.MappingReferences = []gemara.MappingReference{
+		{Id: "OSPS-B", Title: "Open Source Project Security Baseline", Version: "2025-02-25"},
+		{Id: "800-53", Title: "NIST SP 800-53", Version: "5"},
+	}
+	catalog.Controls[0].GuidelineMappings = []gemara.MultiMapping{
+		{ReferenceId: "OSPS-B", Entries: []gemara.MappingEntry{{ReferenceId: "OSPS-QA-07"}}},
+		{ReferenceId: "800-53", Entries: []gemara.MappingEntry{{ReferenceId: "SA-10"}, {ReferenceId: "CM3"}}},
+	}
+	return catalog
+}
+
+// TestFromPolicy_GuidelineMappings verifies guideline mappings become framework references in Meta.Controls.
+func TestFromPolicy_GuidelineMappings(t *testing.T) {
+	policy := createTestPolicy()
+	second := policy.Adherence.AssessmentPlans[0]
+	second.Id = "plan-02"
+	policy.Adherence.AssessmentPlans = append(policy.Adherence.AssessmentPlans, second)
+
+	ampelPolicy, err := FromPolicy(policy, WithCatalog(createMappedTestCatalog()))
+	require.NoError(t, err)
+
+	// Both plans enrich from CTRL-01, which is listed once with its mappings
+	require.Len(t, ampelPolicy.Meta.Controls, 4)
+	assert.Equal(t, "CTRL-01", ampelPolicy.Meta.Controls[0].Id)
+	assert.Equal(t, "Test Control Family", ampelPolicy.Meta.Controls[0].Framework)
+
+	osps := ampelPolicy.Meta.Controls[1]
+	assert.Equal(t, "OSPS-B", osps.Framework)
+	assert.Equal(t, "OSPS-B", osps.Class)
+	assert.Equal(t, "OSPS-QA-07", osps.Id)
+
+	// Entry IDs are kept whole, whatever their dashes
+	assert.Equal(t, "800-53", ampelPolicy.Meta.Controls[2].Class)
+	assert.Equal(t, "SA-10", ampelPolicy.Meta.Controls[2].Id)
+	assert.Equal(t, "800-53", ampelPolicy.Meta.Controls[3].Class)
+	assert.Equal(t, "CM3", ampelPolicy.Meta.Controls[3].Id)
+}
+
+// TestFromPolicy_WithFrameworkNames verifies mapping references can be renamed or omitted.
+func TestFromPolicy_WithFrameworkNames(t *testing.T) {
+	ampelPolicy, err := FromPolicy(createTestPolicy(),
+		WithCatalog(createMappedTestCatalog()),
+		WithFrameworkNames(map[string]string{"OSPS-B": "OSPS"}),
+		WithFrameworkNames(map[string]string{"800-53": ""}),
+	)
+	require.NoError(t, err)
+
+	require.Len(t, ampelPolicy.Meta.Controls, 2)
+	assert.Equal(t, "OSPS", ampelPolicy.Meta.Controls[1].Framework)
+	assert.Equal(t, "OSPS-B", ampelPolicy.Meta.Controls[1].Class)
+	assert.Equal(t, "OSPS-QA-07", ampelPolicy.Meta.Controls[1].Id)
+}
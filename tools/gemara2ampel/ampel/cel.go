@@ -3,8 +3,11 @@ package ampel
 import (
 	"bytes"
 	"fmt"
+	"slices"
+	"strconv"
 	"strings"
 	"text/template"
+	"text/template/parse"
 
 	"github.com/gemaraproj/go-gemara"
 )
@@ -54,17 +57,81 @@ var MethodTypeToCELTemplate = map[string]string{
 // GenerateCEL creates a CEL expression from a template and parameters.
 // The template should use Go text/template syntax.
 func GenerateCEL(templateStr string, params map[string]interface{}) (string, error) {
+	code, _, err := generateCEL(templateStr, params)
+	return code, err
+}
+
+// generateCEL implements GenerateCEL and also returns the keys of params
+// that the template references.
+func generateCEL(templateStr string, params map[string]interface{}) (string, []string, error) {
 	tmpl, err := template.New("cel").Parse(templateStr)
 	if err != nil {
-		return "", fmt.Errorf("failed to parse CEL template: %w", err)
+		return "", nil, fmt.Errorf("failed to parse CEL template: %w", err)
 	}
 
 	var buf bytes.Buffer
 	if err := tmpl.Execute(&buf, params); err != nil {
-		return "", fmt.Errorf("failed to execute CEL template: %w", err)
+		return "", nil, fmt.Errorf("failed to execute CEL template: %w", err)
 	}
 
-	return strings.TrimSpace(buf.String()), nil
+	var keys []string
+	walkTemplateKeys(tmpl.Root, func(key string) {
+		if _, ok := params[key]; ok && !slices.Contains(keys, key) {
+			keys = append(keys, key)
+		}
+	})
+	return strings.TrimSpace(buf.String()), keys, nil
+}
+
+// walkTemplateKeys calls visit with each top-level data key a template
+// reads, either as {{.Key}} or as {{index . "key"}}.
+func walkTemplateKeys(node parse.Node, visit func(string)) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			walkTemplateKeys(child, visit)
+		}
+	case *parse.ActionNode:
+		walkTemplateKeys(n.Pipe, visit)
+	case *parse.IfNode:
+		walkTemplateKeys(n.Pipe, visit)
+		walkTemplateKeys(n.List, visit)
+		walkTemplateKeys(n.ElseList, visit)
+	case *parse.RangeNode:
+		walkTemplateKeys(n.Pipe, visit)
+		walkTemplateKeys(n.List, visit)
+		walkTemplateKeys(n.ElseList, visit)
+	case *parse.WithNode:
+		walkTemplateKeys(n.Pipe, visit)
+		walkTemplateKeys(n.List, visit)
+		walkTemplateKeys(n.ElseList, visit)
+	case *parse.TemplateNode:
+		walkTemplateKeys(n.Pipe, visit)
+	case *parse.PipeNode:
+		if n == nil {
+			return
+		}
+		for _, cmd := range n.Cmds {
+			walkTemplateKeys(cmd, visit)
+		}
+	case *parse.CommandNode:
+		if len(n.Args) >= 3 {
+			ident, isIdent := n.Args[0].(*parse.IdentifierNode)
+			_, isDot := n.Args[1].(*parse.DotNode)
+			key, isString := n.Args[2].(*parse.StringNode)
+			if isIdent && ident.Ident == "index" && isDot && isString {
+				visit(key.Text)
+			}
+		}
+		for _, arg := range n.Args {
+			walkTemplateKeys(arg, visit)
+		}
+	case *parse.FieldNode:
+		visit(n.Ident[0])
+	}
 }
 
 // GenerateCELFromMethod creates a CEL expression based on the evaluation
@@ -75,19 +142,79 @@ func GenerateCELFromMethod(
 	params map[string]interface{},
 	templates map[string]string,
 ) (string, []string, error) {
+	gen, err := generateCELFromMethod(method, evidenceReq, params, templates)
+	if err != nil {
+		return "", gen.AttestationTypes, err
+	}
+	return gen.Code, gen.AttestationTypes, nil
+}
+
+// Template selection sources recorded in TenetTrace.TemplateSelection.
+const (
+	TemplateFromEvidence   = "evidence"
+	TemplateFromMethodType = "method-type"
+	TemplateFallback       = "fallback"
+)
+
+// celGeneration holds a generated CEL expression together with the decisions
+// that produced it.
+type celGeneration struct {
+	Code             string
+	AttestationTypes []string
+
+	// PredicateKeyword is the evidence keyword that selected the predicate type
+	PredicateKeyword string
+
+	// TemplateName is the selected template, empty when none was selected
+	TemplateName string
+
+	// TemplateSelection records how the template was chosen
+	TemplateSelection string
+
+	// MatchedKeywords are the evidence keywords that selected the template
+	MatchedKeywords []string
+
+	// Fallback is set when no template was available and a basic
+	// expression was generated instead
+	Fallback bool
+
+	// MissingTemplate is the selected template name that was not found in
+	// the template set, if any
+	MissingTemplate string
+
+	// Parameters maps the parameters the template read to their values
+	Parameters map[string]string
+}
+
+// generateCELFromMethod implements GenerateCELFromMethod and records how the
+// expression was generated.
+func generateCELFromMethod(
+	method gemara.AcceptedMethod,
+	evidenceReq string,
+	params map[string]interface{},
+	templates map[string]string,
+) (*celGeneration, error) {
+	gen := &celGeneration{AttestationTypes: []string{}}
+
 	// Infer attestation type from evidence requirements
-	attestationType := InferAttestationType(evidenceReq)
-	attestationTypes := []string{}
-	if attestationType != "" {
-		attestationTypes = append(attestationTypes, attestationType)
+	attestationType, keyword := inferAttestationType(evidenceReq)
+	gen.PredicateKeyword = keyword
+	explicitTypes := explicitPredicateTypes(evidenceReq)
+	if len(explicitTypes) > 0 {
+		gen.AttestationTypes = explicitTypes
+	} else if attestationType != "" {
+		gen.AttestationTypes = append(gen.AttestationTypes, attestationType)
 	}
 
 	// Try to determine appropriate template based on evidence requirements
-	templateName := selectTemplateFromEvidence(evidenceReq)
+	templateName, matched := matchTemplateFromEvidence(evidenceReq)
+	gen.TemplateSelection = TemplateFromEvidence
+	gen.MatchedKeywords = matched
 	if templateName == "" {
 		// Fall back to method type mapping
 		if defaultTemplate, ok := MethodTypeToCELTemplate[method.Type]; ok {
 			templateName = defaultTemplate
+			gen.TemplateSelection = TemplateFromMethodType
 		}
 	}
 
@@ -95,49 +222,82 @@ func GenerateCELFromMethod(
 	templateStr, ok := templates[templateName]
 	if !ok {
 		// Generate a basic CEL expression as fallback
-		return generateBasicCEL(attestationType, evidenceReq)
+		code, attestationTypes, err := generateBasicCEL(attestationType, evidenceReq)
+		gen.Code = code
+		if len(explicitTypes) == 0 {
+			gen.AttestationTypes = attestationTypes
+		}
+		gen.TemplateSelection = TemplateFallback
+		gen.Fallback = true
+		gen.MissingTemplate = templateName
+		return gen, err
 	}
+	gen.TemplateName = templateName
 
 	// Generate CEL from template
-	cel, err := GenerateCEL(templateStr, params)
+	cel, keys, err := generateCEL(templateStr, params)
 	if err != nil {
-		return "", attestationTypes, fmt.Errorf("failed to generate CEL: %w", err)
+		return gen, fmt.Errorf("failed to generate CEL: %w", err)
+	}
+	gen.Code = cel
+	for _, key := range keys {
+		if gen.Parameters == nil {
+			gen.Parameters = make(map[string]string)
+		}
+		gen.Parameters[key] = fmt.Sprint(params[key])
 	}
 
-	return cel, attestationTypes, nil
+	return gen, nil
 }
 
 // selectTemplateFromEvidence analyzes evidence requirements to select
 // an appropriate CEL template.
 func selectTemplateFromEvidence(evidenceReq string) string {
+	templateName, _ := matchTemplateFromEvidence(evidenceReq)
+	return templateName
+}
+
+// matchTemplateFromEvidence selects a CEL template from evidence requirements
+// and returns the keywords that selected it.
+func matchTemplateFromEvidence(evidenceReq string) (string, []string) {
 	lowerReq := strings.ToLower(evidenceReq)
 
 	// SLSA provenance patterns
-	if strings.Contains(lowerReq, "slsa") || strings.Contains(lowerReq, "provenance") {
-		if strings.Contains(lowerReq, "builder") {
-			return "slsa-provenance-builder"
+	if kw := firstKeyword(lowerReq, "slsa", "provenance"); kw != "" {
+		if sub := firstKeyword(lowerReq, "builder"); sub != "" {
+			return "slsa-provenance-builder", []string{kw, sub}
 		}
-		if strings.Contains(lowerReq, "material") {
-			return "slsa-provenance-materials"
+		if sub := firstKeyword(lowerReq, "material"); sub != "" {
+			return "slsa-provenance-materials", []string{kw, sub}
 		}
-		if strings.Contains(lowerReq, "buildtype") || strings.Contains(lowerReq, "build type") {
-			return "slsa-provenance-buildtype"
+		if sub := firstKeyword(lowerReq, "buildtype", "build type"); sub != "" {
+			return "slsa-provenance-buildtype", []string{kw, sub}
 		}
 	}
 
 	// Vulnerability scan patterns
-	if strings.Contains(lowerReq, "vulnerabilit") || strings.Contains(lowerReq, "cve") {
-		if strings.Contains(lowerReq, "critical") || strings.Contains(lowerReq, "no critical") {
-			return "vulnerability-scan-no-critical"
+	if kw := firstKeyword(lowerReq, "vulnerabilit", "cve"); kw != "" {
+		if sub := firstKeyword(lowerReq, "critical"); sub != "" {
+			return "vulnerability-scan-no-critical", []string{kw, sub}
 		}
-		if strings.Contains(lowerReq, "threshold") {
-			return "vulnerability-scan-threshold"
+		if sub := firstKeyword(lowerReq, "threshold"); sub != "" {
+			return "vulnerability-scan-threshold", []string{kw, sub}
 		}
-		if strings.Contains(lowerReq, "scanner") {
-			return "vulnerability-scanner"
+		if sub := firstKeyword(lowerReq, "scanner"); sub != "" {
+			return "vulnerability-scanner", []string{kw, sub}
 		}
 	}
 
+	return "", nil
+}
+
+// firstKeyword returns the first keyword contained in text, or "" if none is.
+func firstKeyword(text string, keywords ...string) string {
+	for _, keyword := range keywords {
+		if strings.Contains(text, keyword) {
+			return keyword
+		}
+	}
 	return ""
 }
 
@@ -157,6 +317,7 @@ func generateBasicCEL(attestationType, evidenceReq string) (string, []string, er
 }
 
 // ScopeFilterToCEL converts Gemara scope dimensions to CEL filtering expressions.
+// Dimension values are escaped as CEL string literals.
 func ScopeFilterToCEL(dimensions gemara.Dimensions) string {
 	var filters []string
 
@@ -166,7 +327,7 @@ func ScopeFilterToCEL(dimensions gemara.Dimensions) string {
 		for i, tech := range dimensions.Technologies {
 			// Normalize technology names to lowercase with hyphens
 			normalized := strings.ToLower(strings.ReplaceAll(tech, " ", "-"))
-			techList[i] = fmt.Sprintf(`"%s"`, normalized)
+			techList[i] = strconv.Quote(normalized)
 		}
 		filters = append(filters, fmt.Sprintf(`subject.type in [%s]`, strings.Join(techList, ", ")))
 	}
@@ -177,7 +338,7 @@ func ScopeFilterToCEL(dimensions gemara.Dimensions) string {
 		for i, region := range dimensions.Geopolitical {
 			// Normalize regions to lowercase codes
 			normalized := normalizeRegion(region)
-			regionList[i] = fmt.Sprintf(`"%s"`, normalized)
+			regionList[i] = strconv.Quote(normalized)
 		}
 		filters = append(filters, fmt.Sprintf(`subject.annotations.region in [%s]`, strings.Join(regionList, ", ")))
 	}
@@ -187,7 +348,7 @@ func ScopeFilterToCEL(dimensions gemara.Dimensions) string {
 		sensitivityList := make([]string, len(dimensions.Sensitivity))
 		for i, sensitivity := range dimensions.Sensitivity {
 			normalized := strings.ToLower(sensitivity)
-			sensitivityList[i] = fmt.Sprintf(`"%s"`, normalized)
+			sensitivityList[i] = strconv.Quote(normalized)
 		}
 		filters = append(filters, fmt.Sprintf(`subject.annotations.classification in [%s]`, strings.Join(sensitivityList, ", ")))
 	}
@@ -196,7 +357,7 @@ func ScopeFilterToCEL(dimensions gemara.Dimensions) string {
 	if len(dimensions.Groups) > 0 {
 		groupList := make([]string, len(dimensions.Groups))
 		for i, group := range dimensions.Groups {
-			groupList[i] = fmt.Sprintf(`"%s"`, group)
+			groupList[i] = strconv.Quote(group)
 		}
 		filters = append(filters, fmt.Sprintf(`subject.annotations.group in [%s]`, strings.Join(groupList, ", ")))
 	}
@@ -0,0 +1,210 @@
+package ampel
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Tenet fields that MergePolicyWithBase merges three ways by default. Any
+// tenet field merged with MergePreferManual or MergeThreeWay can conflict.
+const (
+	ConflictFieldCode    = "code"
+	ConflictFieldOutputs = "outputs"
+)
+
+// Conflict resolutions accepted by MergeConflict.Resolution.
+const (
+	ResolveOurs   = "ours"
+	ResolveTheirs = "theirs"
+)
+
+// MergeConflict is a tenet field edited both manually and by the generator
+// since the generation base. Values are the field as text: string fields
+// such as the CEL code as is, other fields such as outputs as indented JSON.
+type MergeConflict struct {
+	TenetID string `json:"tenet_id"`
+	Field   string `json:"field"`
+
+	// PolicyID is the member policy of the tenet in a PolicySet merge
+	PolicyID string `json:"policy_id,omitempty"`
+
+	// Base is the value last generated
+	Base string `json:"base"`
+
+	// Ours is the manually edited value in the workspace
+	Ours string `json:"ours"`
+
+	// Theirs is the newly generated value
+	Theirs string `json:"theirs"`
+}
+
+// String returns a one-line summary of the conflict.
+func (c MergeConflict) String() string {
+	if c.PolicyID != "" {
+		return fmt.Sprintf("policy %s tenet %s %s", c.PolicyID, c.TenetID, c.Field)
+	}
+	return fmt.Sprintf("tenet %s %s", c.TenetID, c.Field)
+}
+
+// Resolution returns the value chosen by resolution: ResolveOurs keeps the
+// manual edit and ResolveTheirs takes the generated value.
+func (c MergeConflict) Resolution(resolution string) (string, error) {
+	switch resolution {
+	case ResolveOurs:
+		return c.Ours, nil
+	case ResolveTheirs:
+		return c.Theirs, nil
+	default:
+		return "", fmt.Errorf("invalid resolution %q (use %s or %s)", resolution, ResolveOurs, ResolveTheirs)
+	}
+}
+
+// newMergeConflict records a conflict on a field of the given tenets.
+func newMergeConflict(tenetID, field string, base, existing, generated *Tenet) MergeConflict {
+	return MergeConflict{
+		TenetID: tenetID,
+		Field:   field,
+		Base:    fieldText(base, field),
+		Ours:    fieldText(existing, field),
+		Theirs:  fieldText(generated, field),
+	}
+}
+
+// ResolveConflict sets the conflicting field of the tenet in policy to value
+// and records the generated value in base, so the next MergePolicyWithBase
+// treats value as a manual edit of the current generation and no longer
+// reports the conflict. base may be nil when no base is recorded.
+func ResolveConflict(policy, base *Policy, conflict MergeConflict, value string) error {
+	tenet, ok := tenetsByID(policy)[conflict.TenetID]
+	if !ok {
+		return fmt.Errorf("policy %s has no tenet %s", policy.GetId(), conflict.TenetID)
+	}
+	if err := setFieldText(tenet, conflict.Field, value); err != nil {
+		return err
+	}
+
+	if baseTenet, ok := tenetsByID(base)[conflict.TenetID]; ok {
+		if err := setFieldText(baseTenet, conflict.Field, conflict.Theirs); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ResolvePolicySetConflict resolves a conflict of a PolicySet merge in the
+// member policy named by the conflict, as ResolveConflict does. base may be
+// nil when no base is recorded.
+func ResolvePolicySetConflict(policySet, base *PolicySet, conflict MergeConflict, value string) error {
+	policy, ok := policiesByID(policySet)[conflict.PolicyID]
+	if !ok {
+		return fmt.Errorf("policy set %s has no member policy %q", policySet.GetId(), conflict.PolicyID)
+	}
+	return ResolveConflict(policy, policiesByID(base)[conflict.PolicyID], conflict, value)
+}
+
+// Conflict markers delimiting the sections of a conflict, as in a diff3
+// style merge: ours, base and theirs.
+const (
+	conflictMarkerOurs   = "<<<<<<< ours"
+	conflictMarkerBase   = "||||||| base"
+	conflictMarkerSplit  = "======="
+	conflictMarkerTheirs = ">>>>>>> theirs"
+)
+
+// WriteConflictMarkers writes conflicts in the side-car conflict marker
+// format. Each conflict is a block of its manual, base and generated values:
+//
+//	<<<<<<< ours tenet-1 code
+//	manually edited CEL
+//	||||||| base
+//	previously generated CEL
+//	=======
+//	newly generated CEL
+//	>>>>>>> theirs
+//
+// Conflicts of a PolicySet member policy add the member policy ID to the
+// first marker line. Lines starting with # before a block are comments.
+func WriteConflictMarkers(w io.Writer, policyID string, conflicts []MergeConflict) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %d merge conflict(s) in policy %s\n", len(conflicts), policyID)
+	fmt.Fprintf(&b, "# Resolve with: ampel_export resolve %s --ours|--theirs|--value\n", policyID)
+	for _, c := range conflicts {
+		fmt.Fprintf(&b, "%s %s %s", conflictMarkerOurs, c.TenetID, c.Field)
+		if c.PolicyID != "" {
+			b.WriteString(" " + c.PolicyID)
+		}
+		b.WriteString("\n")
+		b.WriteString(c.Ours + "\n")
+		b.WriteString(conflictMarkerBase + "\n")
+		b.WriteString(c.Base + "\n")
+		b.WriteString(conflictMarkerSplit + "\n")
+		b.WriteString(c.Theirs + "\n")
+		b.WriteString(conflictMarkerTheirs + "\n")
+	}
+	if _, err := io.WriteString(w, b.String()); err != nil {
+		return fmt.Errorf("failed to write conflict markers: %w", err)
+	}
+	return nil
+}
+
+// ParseConflictMarkers reads conflicts written by WriteConflictMarkers.
+func ParseConflictMarkers(r io.Reader) ([]MergeConflict, error) {
+	var conflicts []MergeConflict
+	var current *MergeConflict
+	var section *string
+	var lines []string
+	lineNumber := 0
+
+	// finish stores the lines read so far in the current section
+	finish := func() {
+		if section != nil {
+			*section = strings.Join(lines, "\n")
+		}
+		lines = nil
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		lineNumber++
+
+		switch {
+		case current == nil && (line == "" || strings.HasPrefix(line, "#")):
+			continue
+		case current == nil && strings.HasPrefix(line, conflictMarkerOurs+" "):
+			fields := strings.Fields(strings.TrimPrefix(line, conflictMarkerOurs))
+			if len(fields) != 2 && len(fields) != 3 {
+				return nil, fmt.Errorf("line %d: expected %q followed by tenet ID, field and optional policy ID", lineNumber, conflictMarkerOurs)
+			}
+			current = &MergeConflict{TenetID: fields[0], Field: fields[1]}
+			if len(fields) == 3 {
+				current.PolicyID = fields[2]
+			}
+			section = &current.Ours
+		case current == nil:
+			return nil, fmt.Errorf("line %d: unexpected content outside a conflict", lineNumber)
+		case line == conflictMarkerBase && section == &current.Ours:
+			finish()
+			section = &current.Base
+		case line == conflictMarkerSplit && section == &current.Base:
+			finish()
+			section = &current.Theirs
+		case line == conflictMarkerTheirs && section == &current.Theirs:
+			finish()
+			conflicts = append(conflicts, *current)
+			current, section = nil, nil
+		default:
+			lines = append(lines, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read conflict markers: %w", err)
+	}
+	if current != nil {
+		return nil, fmt.Errorf("conflict %s is not terminated by %q", current, conflictMarkerTheirs)
+	}
+	return conflicts, nil
+}
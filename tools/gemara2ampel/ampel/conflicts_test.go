@@ -0,0 +1,111 @@
+package ampel
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestMergePolicyWithBase_OutputsConflict verifies conflicting outputs are reported as JSON.
+func TestMergePolicyWithBase_OutputsConflict(t *testing.T) {
+	base := newMergeTestPolicy(withTenets(&Tenet{Id: "tenet-1", Code: "code_v1"}))
+	existing := newMergeTestPolicy(withTenets(&Tenet{Id: "tenet-1", Code: "code_v1"}))
+	generated := newMergeTestPolicy(withTenets(&Tenet{Id: "tenet-1", Code: "code_v1"}))
+	base.Tenets[0].Outputs = map[string]*Output{"key": {Code: "context.key"}}
+	existing.Tenets[0].Outputs = map[string]*Output{"key": {Code: "context.manual"}}
+	generated.Tenets[0].Outputs = map[string]*Output{"key": {Code: "context.renamed"}}
+
+	merged, stats, err := MergePolicyWithBase(base, existing, generated)
+	require.NoError(t, err)
+	assert.Equal(t, "context.manual", merged.Tenets[0].Outputs["key"].Code)
+
+	require.Len(t, stats.Conflicts, 1)
+	conflict := stats.Conflicts[0]
+	assert.Equal(t, ConflictFieldOutputs, conflict.Field)
+	assert.Contains(t, conflict.Ours, "context.manual")
+	assert.Contains(t, conflict.Theirs, "context.renamed")
+	assert.Equal(t, "tenet tenet-1 outputs", conflict.String())
+}
+
+// TestConflictMarkers_RoundTrip verifies the side-car format reads back what it writes.
+func TestConflictMarkers_RoundTrip(t *testing.T) {
+	conflicts := []MergeConflict{
+		{TenetID: "tenet-1", Field: ConflictFieldCode, Base: "a == 1", Ours: "// manual\na == 2\n", Theirs: "a == 3"},
+		{TenetID: "tenet-2", Field: ConflictFieldOutputs, Base: "", Ours: "{\n  \"key\": {}\n}", Theirs: ""},
+		{TenetID: "tenet-3", Field: ConflictFieldCode, PolicyID: "member-policy", Base: "b", Ours: "c", Theirs: "d"},
+	}
+
+	var b strings.Builder
+	require.NoError(t, WriteConflictMarkers(&b, "policy-001", conflicts))
+	assert.Contains(t, b.String(), "<<<<<<< ours tenet-1 code\n// manual\na == 2\n\n||||||| base\na == 1\n=======\na == 3\n>>>>>>> theirs\n")
+	assert.Contains(t, b.String(), "<<<<<<< ours tenet-3 code member-policy\n")
+
+	parsed, err := ParseConflictMarkers(strings.NewReader(b.String()))
+	require.NoError(t, err)
+	assert.Equal(t, conflicts, parsed)
+}
+
+// TestParseConflictMarkers_Invalid verifies malformed side-car files are rejected.
+func TestParseConflictMarkers_Invalid(t *testing.T) {
+	for name, content := range map[string]string{
+		"content outside a conflict": "stray line\n",
+		"missing field":              "<<<<<<< ours tenet-1\n",
+		"extra field":                "<<<<<<< ours tenet-1 code policy extra\n",
+		"unterminated":               "<<<<<<< ours tenet-1 code\nx\n||||||| base\ny\n",
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := ParseConflictMarkers(strings.NewReader(content))
+			assert.Error(t, err)
+		})
+	}
+}
+
+// TestResolveConflict verifies each resolution ends the conflict on the next merge.
+func TestResolveConflict(t *testing.T) {
+	tests := []struct {
+		name       string
+		resolution string
+		value      string
+		wantCode   string
+	}{
+		{name: "ours", resolution: ResolveOurs, wantCode: "manual"},
+		{name: "theirs", resolution: ResolveTheirs, wantCode: "code_v2"},
+		{name: "edited", value: "manual && code_v2", wantCode: "manual && code_v2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			base := newMergeTestPolicy(withTenets(&Tenet{Id: "tenet-1", Code: "code_v1"}))
+			existing := newMergeTestPolicy(withTenets(&Tenet{Id: "tenet-1", Code: "manual"}))
+			generated := newMergeTestPolicy(withTenets(&Tenet{Id: "tenet-1", Code: "code_v2"}))
+			merged, stats, err := MergePolicyWithBase(base, existing, generated)
+			require.NoError(t, err)
+			require.Len(t, stats.Conflicts, 1)
+			nextBase := AdvanceBase(base, generated, stats)
+
+			conflict := stats.Conflicts[0]
+			value := tt.value
+			if tt.resolution != "" {
+				value, err = conflict.Resolution(tt.resolution)
+				require.NoError(t, err)
+			}
+			require.NoError(t, ResolveConflict(merged, nextBase, conflict, value))
+			assert.Equal(t, tt.wantCode, merged.Tenets[0].Code)
+			assert.Equal(t, "code_v2", nextBase.Tenets[0].Code)
+
+			// Regenerating the same policy keeps the resolution without a conflict
+			remerged, stats, err := MergePolicyWithBase(nextBase, merged, generated)
+			require.NoError(t, err)
+			assert.Empty(t, stats.Conflicts)
+			assert.Equal(t, tt.wantCode, remerged.Tenets[0].Code)
+		})
+	}
+
+	_, err := MergeConflict{}.Resolution("mine")
+	assert.Error(t, err)
+
+	policy := newMergeTestPolicy()
+	assert.Error(t, ResolveConflict(policy, nil, MergeConflict{TenetID: "missing", Field: ConflictFieldCode}, ""))
+}
@@ -0,0 +1,210 @@
+package ampel
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gemaraproj/go-gemara"
+)
+
+// Severity classifies a diagnostic reported during transformation.
+type Severity int
+
+const (
+	// SeverityInfo reports expected behavior worth knowing about
+	SeverityInfo Severity = iota
+	// SeverityWarning reports input that was handled but probably not as intended
+	SeverityWarning
+	// SeverityError reports output that is likely to be wrong
+	SeverityError
+)
+
+// String returns the lowercase name of the severity.
+func (s Severity) String() string {
+	switch s {
+	case SeverityInfo:
+		return "info"
+	case SeverityWarning:
+		return "warning"
+	case SeverityError:
+		return "error"
+	default:
+		return fmt.Sprintf("severity(%d)", int(s))
+	}
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (s Severity) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (s *Severity) UnmarshalText(text []byte) error {
+	parsed, err := ParseSeverity(string(text))
+	if err != nil {
+		return err
+	}
+	*s = parsed
+	return nil
+}
+
+// ParseSeverity parses a severity name (info, warning or error).
+func ParseSeverity(name string) (Severity, error) {
+	switch strings.ToLower(name) {
+	case "info":
+		return SeverityInfo, nil
+	case "warning", "warn":
+		return SeverityWarning, nil
+	case "error":
+		return SeverityError, nil
+	default:
+		return 0, fmt.Errorf("unknown severity %q (use info, warning or error)", name)
+	}
+}
+
+// Diagnostic codes reported by the transformation.
+const (
+	// DiagMethodSkipped: an evaluation method is not automated and produced no tenet
+	DiagMethodSkipped = "method-skipped"
+
+	// DiagDuplicateParameter: a parameter ID is defined identically by more than one plan
+	DiagDuplicateParameter = "duplicate-parameter"
+
+	// DiagParameterConflict: a parameter ID is defined with different accepted values by more than one plan
+	DiagParameterConflict = "parameter-conflict"
+
+	// DiagRequiredContextUnset: a required context entry has no value
+	DiagRequiredContextUnset = "required-context-unset"
+
+	// DiagSharedContextConflict: PolicySet member policies define a context key differently
+	DiagSharedContextConflict = "shared-context-conflict"
+
+	// DiagUnsupportedMetadata: a PolicySet metadata key has no PolicySetMeta field and was ignored
+	DiagUnsupportedMetadata = "unsupported-metadata"
+
+	// DiagRequirementNotInCatalog: a catalog was given but does not contain the plan's requirement
+	DiagRequirementNotInCatalog = "requirement-not-in-catalog"
+
+	// DiagAmbiguousRequirement: an unqualified requirement ID is defined by several catalogs
+	DiagAmbiguousRequirement = "ambiguous-requirement"
+
+	// DiagUnknownTemplate: the selected CEL template does not exist and a basic expression was generated
+	DiagUnknownTemplate = "unknown-template"
+
+	// DiagMissingTemplateParameter: a CEL template references a parameter the plan does not define
+	DiagMissingTemplateParameter = "missing-template-parameter"
+)
+
+// SourceLocation points at the Gemara element a diagnostic refers to.
+type SourceLocation struct {
+	PolicyID string `json:"policy_id,omitempty"`
+	PlanID   string `json:"plan_id,omitempty"`
+
+	// MethodIndex is the position of the method in the plan's
+	// evaluation-methods list, or nil when the diagnostic concerns the plan
+	MethodIndex *int `json:"method_index,omitempty"`
+
+	// TenetID is the tenet generated from the method, if any
+	TenetID string `json:"tenet_id,omitempty"`
+}
+
+// String formats the location as "policy/plan/method N".
+func (l SourceLocation) String() string {
+	var parts []string
+	if l.PolicyID != "" {
+		parts = append(parts, "policy "+l.PolicyID)
+	}
+	if l.PlanID != "" {
+		parts = append(parts, "plan "+l.PlanID)
+	}
+	if l.MethodIndex != nil {
+		parts = append(parts, fmt.Sprintf("method %d", *l.MethodIndex))
+	}
+	if l.TenetID != "" {
+		parts = append(parts, "tenet "+l.TenetID)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Diagnostic is a single finding reported during transformation.
+type Diagnostic struct {
+	Severity Severity       `json:"severity"`
+	Code     string         `json:"code"`
+	Message  string         `json:"message"`
+	Location SourceLocation `json:"location"`
+}
+
+// String formats the diagnostic as "severity[code] location: message".
+func (d Diagnostic) String() string {
+	if loc := d.Location.String(); loc != "" {
+		return fmt.Sprintf("%s[%s] %s: %s", d.Severity, d.Code, loc, d.Message)
+	}
+	return fmt.Sprintf("%s[%s] %s", d.Severity, d.Code, d.Message)
+}
+
+// Diagnostics is the collection of findings reported during transformation.
+type Diagnostics []Diagnostic
+
+// Add appends a diagnostic to the collection.
+func (d *Diagnostics) Add(severity Severity, code string, location SourceLocation, format string, args ...interface{}) {
+	*d = append(*d, Diagnostic{
+		Severity: severity,
+		Code:     code,
+		Message:  fmt.Sprintf(format, args...),
+		Location: location,
+	})
+}
+
+// HasErrors reports whether any diagnostic has error severity.
+func (d Diagnostics) HasErrors() bool {
+	return d.AtLeast(SeverityError) > 0
+}
+
+// AtLeast returns the number of diagnostics at or above the given severity.
+func (d Diagnostics) AtLeast(severity Severity) int {
+	count := 0
+	for _, diag := range d {
+		if diag.Severity >= severity {
+			count++
+		}
+	}
+	return count
+}
+
+// WithoutPreservedCode returns the diagnostics without the CEL generation
+// findings (unknown-template, missing-template-parameter) of the given
+// tenets. Use it when merging into a workspace, where the code of existing
+// tenets is preserved and the generated code is discarded.
+func (d Diagnostics) WithoutPreservedCode(preservedTenets map[string]bool) Diagnostics {
+	var kept Diagnostics
+	for _, diag := range d {
+		isCodeFinding := diag.Code == DiagUnknownTemplate || diag.Code == DiagMissingTemplateParameter
+		if isCodeFinding && preservedTenets[diag.Location.TenetID] {
+			continue
+		}
+		kept = append(kept, diag)
+	}
+	return kept
+}
+
+// FromPolicyWithDiagnostics converts a Gemara policy like FromPolicy and also
+// returns the diagnostics reported during the transformation. Diagnostics are
+// returned even when the transformation fails.
+func FromPolicyWithDiagnostics(policy *gemara.Policy, opts ...TransformOption) (*Policy, Diagnostics, error) {
+	var diags Diagnostics
+	opts = append(opts, WithDiagnostics(&diags))
+	ampelPolicy, err := FromPolicy(policy, opts...)
+	return ampelPolicy, diags, err
+}
+
+// planLocation returns the source location of an assessment plan.
+func planLocation(policy *gemara.Policy, plan gemara.AssessmentPlan) SourceLocation {
+	return SourceLocation{PolicyID: policy.Metadata.Id, PlanID: plan.Id}
+}
+
+// methodLocation returns the source location of a plan's evaluation method.
+func methodLocation(policy *gemara.Policy, plan gemara.AssessmentPlan, methodIndex int) SourceLocation {
+	loc := planLocation(policy, plan)
+	loc.MethodIndex = &methodIndex
+	return loc
+}
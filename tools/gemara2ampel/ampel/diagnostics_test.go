@@ -0,0 +1,137 @@
+package ampel
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/gemaraproj/go-gemara"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// findDiagnostics returns the diagnostics with the given code.
+func findDiagnostics(diags Diagnostics, code string) Diagnostics {
+	var found Diagnostics
+	for _, diag := range diags {
+		if diag.Code == code {
+			found = append(found, diag)
+		}
+	}
+	return found
+}
+
+// TestFromPolicyWithDiagnostics_SkippedMethod verifies non-automated methods are reported.
+func TestFromPolicyWithDiagnostics_SkippedMethod(t *testing.T) {
+	policy := createTestPolicy()
+	policy.Adherence.AssessmentPlans[0].EvaluationMethods = append(
+		policy.Adherence.AssessmentPlans[0].EvaluationMethods,
+		gemara.AcceptedMethod{Type: "manual"},
+	)
+
+	_, diags, err := FromPolicyWithDiagnostics(policy)
+	require.NoError(t, err)
+
+	skipped := findDiagnostics(diags, DiagMethodSkipped)
+	require.Len(t, skipped, 1)
+	assert.Equal(t, SeverityInfo, skipped[0].Severity)
+	assert.Equal(t, "policy-001", skipped[0].Location.PolicyID)
+	assert.Equal(t, "plan-01", skipped[0].Location.PlanID)
+	require.NotNil(t, skipped[0].Location.MethodIndex)
+	assert.Equal(t, 1, *skipped[0].Location.MethodIndex)
+}
+
+// TestFromPolicyWithDiagnostics_DuplicateParameter verifies identical duplicate parameter IDs are reported.
+func TestFromPolicyWithDiagnostics_DuplicateParameter(t *testing.T) {
+	policy := createTestPolicy()
+	plan := policy.Adherence.AssessmentPlans[0]
+	plan.Parameters = []gemara.Parameter{{Id: "builder-id", AcceptedValues: []string{"a"}}}
+	second := plan
+	second.Id = "plan-02"
+	second.Parameters = []gemara.Parameter{{Id: "builder-id", AcceptedValues: []string{"a"}}}
+	policy.Adherence.AssessmentPlans = []gemara.AssessmentPlan{plan, second}
+
+	_, diags, err := FromPolicyWithDiagnostics(policy)
+	require.NoError(t, err)
+
+	duplicates := findDiagnostics(diags, DiagDuplicateParameter)
+	require.Len(t, duplicates, 1)
+	assert.Equal(t, SeverityInfo, duplicates[0].Severity)
+	assert.Equal(t, "plan-02", duplicates[0].Location.PlanID)
+	assert.Nil(t, duplicates[0].Location.MethodIndex)
+	assert.Contains(t, duplicates[0].Message, "plan-01")
+}
+
+// TestFromPolicyWithDiagnostics_MissingRequirement verifies catalog misses are reported.
+func TestFromPolicyWithDiagnostics_MissingRequirement(t *testing.T) {
+	policy := createTestPolicy()
+	policy.Adherence.AssessmentPlans[0].RequirementId = "REQ-404"
+
+	_, diags, err := FromPolicyWithDiagnostics(policy, WithCatalog(createTestCatalog()))
+	require.NoError(t, err)
+
+	missing := findDiagnostics(diags, DiagRequirementNotInCatalog)
+	require.Len(t, missing, 1)
+	assert.Contains(t, missing[0].Message, "REQ-404")
+
+	// Without a catalog there is nothing to report
+	_, diags, err = FromPolicyWithDiagnostics(policy)
+	require.NoError(t, err)
+	assert.Empty(t, findDiagnostics(diags, DiagRequirementNotInCatalog))
+}
+
+// TestFromPolicyWithDiagnostics_Templates verifies unknown templates and missing parameters are reported.
+func TestFromPolicyWithDiagnostics_Templates(t *testing.T) {
+	policy := createTestPolicy()
+
+	// The builder template references builder-id, which the plan does not define
+	_, diags, err := FromPolicyWithDiagnostics(policy)
+	require.NoError(t, err)
+	missing := findDiagnostics(diags, DiagMissingTemplateParameter)
+	require.Len(t, missing, 1)
+	assert.Equal(t, SeverityError, missing[0].Severity)
+	assert.True(t, diags.HasErrors())
+	assert.Equal(t, "REQ-01-plan-01-0", missing[0].Location.TenetID)
+
+	// Findings about generated code do not apply to tenets whose code is preserved
+	remaining := diags.WithoutPreservedCode(map[string]bool{"REQ-01-plan-01-0": true})
+	assert.Empty(t, findDiagnostics(remaining, DiagMissingTemplateParameter))
+	assert.Len(t, remaining, len(diags)-1)
+
+	original := MethodTypeToCELTemplate["automated"]
+	MethodTypeToCELTemplate["automated"] = "missing-template"
+	t.Cleanup(func() { MethodTypeToCELTemplate["automated"] = original })
+
+	policy.Adherence.AssessmentPlans[0].EvidenceRequirements = "Signed release"
+	_, diags, err = FromPolicyWithDiagnostics(policy)
+	require.NoError(t, err)
+	unknown := findDiagnostics(diags, DiagUnknownTemplate)
+	require.Len(t, unknown, 1)
+	assert.Contains(t, unknown[0].Message, "missing-template")
+}
+
+// TestDiagnostics_Severity verifies severity parsing, counting and JSON encoding.
+func TestDiagnostics_Severity(t *testing.T) {
+	var diags Diagnostics
+	diags.Add(SeverityInfo, "a", SourceLocation{}, "info")
+	diags.Add(SeverityWarning, "b", SourceLocation{PlanID: "plan-01"}, "warning %d", 1)
+	diags.Add(SeverityError, "c", SourceLocation{}, "error")
+
+	assert.Equal(t, 3, diags.AtLeast(SeverityInfo))
+	assert.Equal(t, 2, diags.AtLeast(SeverityWarning))
+	assert.Equal(t, 1, diags.AtLeast(SeverityError))
+	assert.Equal(t, "warning[b] plan plan-01: warning 1", diags[1].String())
+
+	severity, err := ParseSeverity("WARNING")
+	require.NoError(t, err)
+	assert.Equal(t, SeverityWarning, severity)
+	_, err = ParseSeverity("fatal")
+	assert.Error(t, err)
+
+	data, err := json.Marshal(diags[1])
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"severity":"warning","code":"b","message":"warning 1","location":{"plan_id":"plan-01"}}`, string(data))
+
+	var decoded Diagnostic
+	require.NoError(t, json.Unmarshal(data, &decoded))
+	assert.Equal(t, diags[1], decoded)
+}
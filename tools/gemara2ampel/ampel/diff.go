@@ -0,0 +1,496 @@
+package ampel
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// FieldChange is a changed field of a policy, tenet, context entry or
+// PolicySet. Values are text as in conflicts: strings as is, other values
+// as JSON. Old is empty for added fields and New for removed ones.
+type FieldChange struct {
+	Field string `json:"field"`
+	Old   string `json:"old,omitempty"`
+	New   string `json:"new,omitempty"`
+}
+
+// ContextChange is a changed context entry. Old and New hold the whole
+// entry as JSON when it was removed or added, Fields the changed fields of
+// an entry in both versions.
+type ContextChange struct {
+	Key    string        `json:"key"`
+	Old    string        `json:"old,omitempty"`
+	New    string        `json:"new,omitempty"`
+	Fields []FieldChange `json:"fields,omitempty"`
+}
+
+// TenetDiff lists the changed fields of a tenet found in both versions.
+type TenetDiff struct {
+	TenetID string `json:"tenet"`
+
+	// RenamedFrom is the previous ID of a renamed tenet
+	RenamedFrom string `json:"renamed_from,omitempty"`
+
+	Fields []FieldChange `json:"fields,omitempty"`
+}
+
+// PolicyDiff is the semantic difference between two versions of a policy.
+type PolicyDiff struct {
+	PolicyID string `json:"policy"`
+
+	TenetsAdded   []string `json:"tenets_added,omitempty"`
+	TenetsRemoved []string `json:"tenets_removed,omitempty"`
+
+	// Tenets lists the changed and renamed tenets, in new policy order
+	Tenets []TenetDiff `json:"tenets,omitempty"`
+
+	// Context lists the changed context entries by key
+	Context []ContextChange `json:"context,omitempty"`
+
+	// Fields lists the changes to the metadata and other policy fields,
+	// such as "meta.version"
+	Fields []FieldChange `json:"fields,omitempty"`
+}
+
+// Empty reports whether both versions of the policy are the same.
+func (d *PolicyDiff) Empty() bool {
+	return len(d.TenetsAdded) == 0 && len(d.TenetsRemoved) == 0 && len(d.Tenets) == 0 &&
+		len(d.Context) == 0 && len(d.Fields) == 0
+}
+
+// PolicySetDiff is the semantic difference between two versions of a
+// PolicySet.
+type PolicySetDiff struct {
+	PolicySetID string `json:"policyset"`
+
+	PoliciesAdded   []string `json:"policies_added,omitempty"`
+	PoliciesRemoved []string `json:"policies_removed,omitempty"`
+
+	// Policies lists the differences of the changed member policies
+	Policies []*PolicyDiff `json:"policies,omitempty"`
+
+	// Fields lists the changes to the metadata, common and other PolicySet
+	// fields
+	Fields []FieldChange `json:"fields,omitempty"`
+}
+
+// Empty reports whether both versions of the PolicySet are the same.
+func (d *PolicySetDiff) Empty() bool {
+	return len(d.PoliciesAdded) == 0 && len(d.PoliciesRemoved) == 0 && len(d.Policies) == 0 && len(d.Fields) == 0
+}
+
+// DiffPolicies compares two versions of a policy, either of which may be
+// nil. Tenets are matched by ID, or through renames, as listed in
+// MergeStats.Renames, from their old to their new ID.
+func DiffPolicies(old, new *Policy, renames []TenetRename) *PolicyDiff {
+	diff := &PolicyDiff{PolicyID: new.GetId()}
+	if diff.PolicyID == "" {
+		diff.PolicyID = old.GetId()
+	}
+
+	renamedFrom := make(map[string]string, len(renames))
+	renamed := make(map[string]bool, len(renames))
+	for _, rename := range renames {
+		renamedFrom[rename.To] = rename.From
+		renamed[rename.From] = true
+	}
+
+	oldTenets := tenetsByID(old)
+	for _, tenet := range new.GetTenets() {
+		oldID := tenet.Id
+		if from, ok := renamedFrom[tenet.Id]; ok {
+			oldID = from
+		}
+		oldTenet, found := oldTenets[oldID]
+		if !found {
+			diff.TenetsAdded = append(diff.TenetsAdded, tenet.Id)
+			continue
+		}
+		tenetDiff := TenetDiff{TenetID: tenet.Id}
+		if oldID != tenet.Id {
+			tenetDiff.RenamedFrom = oldID
+		}
+		tenetDiff.Fields = diffFields("", oldTenet.ProtoReflect(), tenet.ProtoReflect(), "id")
+		if tenetDiff.RenamedFrom != "" || len(tenetDiff.Fields) > 0 {
+			diff.Tenets = append(diff.Tenets, tenetDiff)
+		}
+	}
+
+	newTenetIDs := tenetIDs(new.GetTenets())
+	for _, tenet := range old.GetTenets() {
+		if !newTenetIDs[tenet.Id] && !renamed[tenet.Id] {
+			diff.TenetsRemoved = append(diff.TenetsRemoved, tenet.Id)
+		}
+	}
+
+	diff.Context = diffContext(old.GetContext(), new.GetContext())
+	diff.Fields = diffFields("", old.ProtoReflect(), new.ProtoReflect(), "tenets", "context")
+	return diff
+}
+
+// DiffPolicySets compares two versions of a PolicySet, either of which may
+// be nil. Member policies are matched by ID and compared with DiffPolicies,
+// using the tenet renames of each member policy, keyed by policy ID.
+func DiffPolicySets(old, new *PolicySet, renames map[string][]TenetRename) *PolicySetDiff {
+	diff := &PolicySetDiff{PolicySetID: new.GetId()}
+	if diff.PolicySetID == "" {
+		diff.PolicySetID = old.GetId()
+	}
+
+	oldPolicies := policiesByID(old)
+	newPolicies := policiesByID(new)
+	for _, policy := range new.GetPolicies() {
+		oldPolicy, found := oldPolicies[policy.Id]
+		if !found {
+			diff.PoliciesAdded = append(diff.PoliciesAdded, policy.Id)
+			continue
+		}
+		if policyDiff := DiffPolicies(oldPolicy, policy, renames[policy.Id]); !policyDiff.Empty() {
+			diff.Policies = append(diff.Policies, policyDiff)
+		}
+	}
+	for _, policy := range old.GetPolicies() {
+		if _, found := newPolicies[policy.Id]; !found {
+			diff.PoliciesRemoved = append(diff.PoliciesRemoved, policy.Id)
+		}
+	}
+
+	diff.Fields = diffFields("", old.ProtoReflect(), new.ProtoReflect(), "policies")
+	return diff
+}
+
+// diffContext compares two context maps key by key.
+func diffContext(old, new map[string]*ContextVal) []ContextChange {
+	keys := sortedKeys(old)
+	for _, key := range sortedKeys(new) {
+		if _, ok := old[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	var changes []ContextChange
+	for _, key := range keys {
+		oldVal, inOld := old[key]
+		newVal, inNew := new[key]
+		switch {
+		case !inOld:
+			changes = append(changes, ContextChange{Key: key, New: messageText(newVal)})
+		case !inNew:
+			changes = append(changes, ContextChange{Key: key, Old: messageText(oldVal)})
+		default:
+			if fields := diffFields("", oldVal.ProtoReflect(), newVal.ProtoReflect()); len(fields) > 0 {
+				changes = append(changes, ContextChange{Key: key, Fields: fields})
+			}
+		}
+	}
+	return changes
+}
+
+// diffFields compares the fields of two messages of the same type, except
+// the skipped ones, descending into message fields set on both sides.
+// Well-known types, such as context values, are compared as a whole.
+func diffFields(prefix string, old, new protoreflect.Message, skip ...string) []FieldChange {
+	var changes []FieldChange
+	fields := new.Descriptor().Fields()
+	for i := 0; i < fields.Len(); i++ {
+		fd := fields.Get(i)
+		name := string(fd.Name())
+		if slices.Contains(skip, name) || fieldEqual(old, new, fd) {
+			continue
+		}
+		if fd.Message() != nil && !fd.IsList() && !fd.IsMap() && old.Has(fd) && new.Has(fd) &&
+			!strings.HasPrefix(string(fd.Message().FullName()), "google.protobuf.") {
+			changes = append(changes, diffFields(prefix+name+".", old.Get(fd).Message(), new.Get(fd).Message())...)
+			continue
+		}
+		changes = append(changes, FieldChange{
+			Field: prefix + name,
+			Old:   fieldText(old.Interface(), name),
+			New:   fieldText(new.Interface(), name),
+		})
+	}
+	return changes
+}
+
+// messageText returns a message as compact JSON for diffs.
+func messageText(m proto.Message) string {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return fmt.Sprintf("error serializing: %v", err)
+	}
+	return string(data)
+}
+
+// diffContextLines is the number of unchanged lines around each hunk.
+const diffContextLines = 3
+
+// maxDiffCells bounds the line comparison table of LineDiff. Larger changes
+// are shown as replacing every changed line.
+const maxDiffCells = 1 << 22
+
+// UnifiedDiff returns the differences between two files in the unified
+// diff format, with oldName and newName in the headers, or an empty string
+// when they are the same. Use /dev/null as oldName for new files.
+func UnifiedDiff(oldName, newName string, old, new []byte) string {
+	hunks := LineDiff(string(old), string(new))
+	if hunks == "" {
+		return ""
+	}
+	return fmt.Sprintf("--- %s\n+++ %s\n%s", oldName, newName, hunks)
+}
+
+// LineDiff returns the hunks of the unified diff between two texts, with
+// three lines of context, or an empty string when they are the same.
+func LineDiff(old, new string) string {
+	script := diffScript(splitLines(old), splitLines(new))
+
+	// Line numbers of both texts before each script line
+	oldLine := make([]int, len(script)+1)
+	newLine := make([]int, len(script)+1)
+	for i, line := range script {
+		oldLine[i+1], newLine[i+1] = oldLine[i], newLine[i]
+		if line.op != '+' {
+			oldLine[i+1]++
+		}
+		if line.op != '-' {
+			newLine[i+1]++
+		}
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(script); {
+		for i < len(script) && script[i].op == ' ' {
+			i++
+		}
+		if i == len(script) {
+			break
+		}
+
+		// Group changes separated by less than twice the context
+		end := i
+		for j := i; j < len(script); j++ {
+			if script[j].op != ' ' {
+				if j-end > 2*diffContextLines {
+					break
+				}
+				end = j + 1
+			}
+		}
+		start := max(0, i-diffContextLines)
+		stop := min(len(script), end+diffContextLines)
+
+		fmt.Fprintf(&b, "@@ -%s +%s @@\n",
+			hunkRange(oldLine[start], oldLine[stop]-oldLine[start]),
+			hunkRange(newLine[start], newLine[stop]-newLine[start]))
+		for _, line := range script[start:stop] {
+			b.WriteByte(line.op)
+			b.WriteString(line.text)
+			if !strings.HasSuffix(line.text, "\n") {
+				b.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+		i = stop
+	}
+	return b.String()
+}
+
+// diffLine is a line of an edit script: kept (' '), removed ('-') or added ('+').
+type diffLine struct {
+	op   byte
+	text string
+}
+
+// diffScript returns the edit script turning old into new, keeping a
+// longest common subsequence of lines.
+func diffScript(old, new []string) []diffLine {
+	prefix := 0
+	for prefix < len(old) && prefix < len(new) && old[prefix] == new[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(old)-prefix && suffix < len(new)-prefix && old[len(old)-1-suffix] == new[len(new)-1-suffix] {
+		suffix++
+	}
+
+	var script []diffLine
+	for _, line := range old[:prefix] {
+		script = append(script, diffLine{' ', line})
+	}
+	a, b := old[prefix:len(old)-suffix], new[prefix:len(new)-suffix]
+	if (len(a)+1)*(len(b)+1) > maxDiffCells {
+		for _, line := range a {
+			script = append(script, diffLine{'-', line})
+		}
+		for _, line := range b {
+			script = append(script, diffLine{'+', line})
+		}
+	} else {
+		// lcs[i][j] is the length of the longest common subsequence of a[i:] and b[j:]
+		width := len(b) + 1
+		lcs := make([]int32, (len(a)+1)*width)
+		for i := len(a) - 1; i >= 0; i-- {
+			for j := len(b) - 1; j >= 0; j-- {
+				if a[i] == b[j] {
+					lcs[i*width+j] = lcs[(i+1)*width+j+1] + 1
+				} else {
+					lcs[i*width+j] = max(lcs[(i+1)*width+j], lcs[i*width+j+1])
+				}
+			}
+		}
+		i, j := 0, 0
+		for i < len(a) || j < len(b) {
+			switch {
+			case i < len(a) && j < len(b) && a[i] == b[j]:
+				script = append(script, diffLine{' ', a[i]})
+				i++
+				j++
+			case j == len(b) || (i < len(a) && lcs[(i+1)*width+j] >= lcs[i*width+j+1]):
+				script = append(script, diffLine{'-', a[i]})
+				i++
+			default:
+				script = append(script, diffLine{'+', b[j]})
+				j++
+			}
+		}
+	}
+	for _, line := range old[len(old)-suffix:] {
+		script = append(script, diffLine{' ', line})
+	}
+	return script
+}
+
+// splitLines splits text into lines keeping their line feed.
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	lines := strings.SplitAfter(text, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// hunkRange formats the start and length of a hunk side. Empty sides start
+// at the line before them.
+func hunkRange(before, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", before)
+	}
+	if count == 1 {
+		return strconv.Itoa(before + 1)
+	}
+	return fmt.Sprintf("%d,%d", before+1, count)
+}
+
+// JSONPatchOperation is an operation of an RFC 6902 JSON Patch.
+type JSONPatchOperation struct {
+	Op    string      `json:"op"`
+	Path  string      `json:"path"`
+	Value interface{} `json:"value"`
+}
+
+// MarshalJSON leaves out the value of remove operations.
+func (o JSONPatchOperation) MarshalJSON() ([]byte, error) {
+	if o.Op == "remove" {
+		return json.Marshal(struct {
+			Op   string `json:"op"`
+			Path string `json:"path"`
+		}{o.Op, o.Path})
+	}
+	type operation JSONPatchOperation
+	return json.Marshal(operation(o))
+}
+
+// JSONPatch returns the RFC 6902 JSON Patch turning the old JSON document
+// into the new one: add, remove and replace operations on object members,
+// and on array items by index. An empty old document is patched by adding
+// the whole new document.
+func JSONPatch(old, new []byte) ([]JSONPatchOperation, error) {
+	newDoc, err := decodeJSON(new)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse new document: %w", err)
+	}
+	if len(bytes.TrimSpace(old)) == 0 {
+		return []JSONPatchOperation{{Op: "add", Path: "", Value: newDoc}}, nil
+	}
+	oldDoc, err := decodeJSON(old)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse old document: %w", err)
+	}
+
+	var ops []JSONPatchOperation
+	diffJSON("", oldDoc, newDoc, &ops)
+	return ops, nil
+}
+
+// decodeJSON parses a JSON document keeping numbers as written.
+func decodeJSON(data []byte) (interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var doc interface{}
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// diffJSON appends the operations turning old into new at path.
+func diffJSON(path string, old, new interface{}, ops *[]JSONPatchOperation) {
+	if reflect.DeepEqual(old, new) {
+		return
+	}
+
+	switch oldValue := old.(type) {
+	case map[string]interface{}:
+		newValue, ok := new.(map[string]interface{})
+		if !ok {
+			break
+		}
+		for _, key := range sortedKeys(oldValue) {
+			if _, found := newValue[key]; !found {
+				*ops = append(*ops, JSONPatchOperation{Op: "remove", Path: path + "/" + escapePointer(key)})
+			}
+		}
+		for _, key := range sortedKeys(newValue) {
+			if value, found := oldValue[key]; found {
+				diffJSON(path+"/"+escapePointer(key), value, newValue[key], ops)
+			} else {
+				*ops = append(*ops, JSONPatchOperation{Op: "add", Path: path + "/" + escapePointer(key), Value: newValue[key]})
+			}
+		}
+		return
+	case []interface{}:
+		newValue, ok := new.([]interface{})
+		if !ok {
+			break
+		}
+		common := min(len(oldValue), len(newValue))
+		for i := 0; i < common; i++ {
+			diffJSON(fmt.Sprintf("%s/%d", path, i), oldValue[i], newValue[i], ops)
+		}
+		for i := len(oldValue) - 1; i >= common; i-- {
+			*ops = append(*ops, JSONPatchOperation{Op: "remove", Path: fmt.Sprintf("%s/%d", path, i)})
+		}
+		for i := common; i < len(newValue); i++ {
+			*ops = append(*ops, JSONPatchOperation{Op: "add", Path: fmt.Sprintf("%s/%d", path, i), Value: newValue[i]})
+		}
+		return
+	}
+	*ops = append(*ops, JSONPatchOperation{Op: "replace", Path: path, Value: new})
+}
+
+// escapePointer escapes a key for a JSON Pointer (RFC 6901).
+func escapePointer(key string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(key, "~", "~0"), "/", "~1")
+}
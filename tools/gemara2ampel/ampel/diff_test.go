@@ -0,0 +1,155 @@
+package ampel
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// TestDiffPolicies verifies tenet, context and metadata changes are listed.
+func TestDiffPolicies(t *testing.T) {
+	old := newMergeTestPolicy(withContext(map[string]*ContextVal{
+		"builder-id": {Type: "string", Value: structpb.NewStringValue("https://github.com/actions/runner")},
+		"scanner":    {Type: "string"},
+	}), withTenets(
+		&Tenet{Id: "tenet-1", Title: "Unchanged", Code: "true"},
+		&Tenet{Id: "tenet-2", Title: "Edited", Code: "a\nb"},
+		&Tenet{Id: "REQ-01-plan-0", Title: "Renamed", Code: "true"},
+		&Tenet{Id: "tenet-gone", Code: "true"},
+	))
+
+	new := newMergeTestPolicy(withVersion(2), withContext(map[string]*ContextVal{
+		"builder-id":   {Type: "string", Value: structpb.NewStringValue("https://gitlab.com/runner")},
+		"max-critical": {Type: "int"},
+	}), withTenets(
+		&Tenet{Id: "tenet-1", Title: "Unchanged", Code: "true"},
+		&Tenet{Id: "tenet-2", Title: "Edited", Code: "a\nc", Predicates: &PredicateSpec{Types: []string{"https://slsa.dev/provenance/v1"}}},
+		&Tenet{Id: "REQ-1-plan-0", Title: "Renamed", Code: "true"},
+		&Tenet{Id: "tenet-new", Code: "true"},
+	))
+
+	diff := DiffPolicies(old, new, []TenetRename{{From: "REQ-01-plan-0", To: "REQ-1-plan-0"}})
+	assert.False(t, diff.Empty())
+	assert.Equal(t, "test-policy", diff.PolicyID)
+	assert.Equal(t, []string{"tenet-new"}, diff.TenetsAdded)
+	assert.Equal(t, []string{"tenet-gone"}, diff.TenetsRemoved)
+
+	require.Len(t, diff.Tenets, 2)
+	assert.Equal(t, "tenet-2", diff.Tenets[0].TenetID)
+	assert.Equal(t, []FieldChange{
+		{Field: "code", Old: "a\nb", New: "a\nc"},
+		{Field: "predicates", New: "{\n  \"types\": [\n    \"https://slsa.dev/provenance/v1\"\n  ]\n}"},
+	}, diff.Tenets[0].Fields)
+	assert.Equal(t, TenetDiff{TenetID: "REQ-1-plan-0", RenamedFrom: "REQ-01-plan-0"}, diff.Tenets[1])
+
+	assert.Equal(t, []ContextChange{
+		{Key: "builder-id", Fields: []FieldChange{
+			{Field: "value", Old: `"https://github.com/actions/runner"`, New: `"https://gitlab.com/runner"`},
+		}},
+		{Key: "max-critical", New: `{"type":"int"}`},
+		{Key: "scanner", Old: `{"type":"string"}`},
+	}, diff.Context)
+
+	assert.Equal(t, []FieldChange{{Field: "meta.version", Old: `"1"`, New: `"2"`}}, diff.Fields)
+
+	// Comparing a policy with itself finds nothing
+	assert.True(t, DiffPolicies(old, old, nil).Empty())
+
+	// A new policy only adds tenets
+	diff = DiffPolicies(nil, new, nil)
+	assert.Len(t, diff.TenetsAdded, 4)
+	assert.Empty(t, diff.TenetsRemoved)
+}
+
+// TestDiffPolicySets verifies member policies are compared by ID.
+func TestDiffPolicySets(t *testing.T) {
+	existing := newMergeTestPolicySet(
+		mainMemberPolicy("manual"),
+		importedMemberPolicy("imported", importedPolicyURI),
+		&Policy{Id: "hand-added"},
+	)
+	existing.Policies[1].Source.Location.Digest = map[string]string{"sha256": "abc"}
+	generated := newMergeTestPolicySet(mainMemberPolicy("code_v2"), importedMemberPolicy("imported", importedPolicyURI))
+	generated.Meta.Description = "Regenerated set"
+
+	diff := DiffPolicySets(existing, generated, nil)
+	assert.Equal(t, "main-policy-set", diff.PolicySetID)
+	assert.Empty(t, diff.PoliciesAdded)
+	assert.Equal(t, []string{"hand-added"}, diff.PoliciesRemoved)
+	require.Len(t, diff.Policies, 2)
+	assert.Equal(t, "main-policy", diff.Policies[0].PolicyID)
+	assert.Equal(t, "imported", diff.Policies[1].PolicyID)
+	assert.Equal(t, []FieldChange{{Field: "meta.description", Old: "Set", New: "Regenerated set"}}, diff.Fields)
+
+	assert.True(t, DiffPolicySets(existing, existing, nil).Empty())
+}
+
+// TestUnifiedDiff verifies the hunks of the unified diff format.
+func TestUnifiedDiff(t *testing.T) {
+	old := "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n"
+	new := "1\n2\nthree\n4\n5\n6\n7\n8\n9\n10\n11\n12\n13\n"
+
+	assert.Equal(t, `--- a/policy.json
++++ b/policy.json
+@@ -1,6 +1,6 @@
+ 1
+ 2
+-3
++three
+ 4
+ 5
+ 6
+@@ -10,3 +10,4 @@
+ 10
+ 11
+ 12
++13
+`, UnifiedDiff("a/policy.json", "b/policy.json", []byte(old), []byte(new)))
+
+	assert.Empty(t, UnifiedDiff("a", "b", []byte(old), []byte(old)))
+
+	// Files without a final line feed, as written by the workspace
+	assert.Equal(t, "@@ -1,2 +1,2 @@\n {\n-}\n\\ No newline at end of file\n+ }\n\\ No newline at end of file\n",
+		LineDiff("{\n}", "{\n }"))
+
+	// New files
+	assert.Equal(t, "@@ -0,0 +1,2 @@\n+a\n+b\n", LineDiff("", "a\nb\n"))
+}
+
+// TestJSONPatch verifies the RFC 6902 operations turning one document into another.
+func TestJSONPatch(t *testing.T) {
+	old := `{"id": "p", "meta": {"version": 1, "a/b": "x"}, "tenets": [{"id": "t1"}, {"id": "t2"}, {"id": "t3"}], "gone": true}`
+	new := `{"id": "p", "meta": {"version": 2, "a/b": "y"}, "tenets": [{"id": "t1"}, {"id": "t2b"}], "context": {"k": null}}`
+
+	ops, err := JSONPatch([]byte(old), []byte(new))
+	require.NoError(t, err)
+
+	data, err := json.Marshal(ops)
+	require.NoError(t, err)
+	assert.JSONEq(t, `[
+		{"op": "remove", "path": "/gone"},
+		{"op": "add", "path": "/context", "value": {"k": null}},
+		{"op": "replace", "path": "/meta/a~1b", "value": "y"},
+		{"op": "replace", "path": "/meta/version", "value": 2},
+		{"op": "replace", "path": "/tenets/1/id", "value": "t2b"},
+		{"op": "remove", "path": "/tenets/2"}
+	]`, string(data))
+
+	// Identical documents need no operation
+	ops, err = JSONPatch([]byte(old), []byte(old))
+	require.NoError(t, err)
+	assert.Empty(t, ops)
+
+	// New documents are added whole
+	ops, err = JSONPatch(nil, []byte(new))
+	require.NoError(t, err)
+	require.Len(t, ops, 1)
+	assert.Equal(t, "add", ops[0].Op)
+	assert.Equal(t, "", ops[0].Path)
+
+	_, err = JSONPatch([]byte("{"), []byte(new))
+	assert.Error(t, err)
+}
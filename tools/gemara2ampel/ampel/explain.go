@@ -0,0 +1,151 @@
+package ampel
+
+import (
+	"sort"
+
+	"github.com/gemaraproj/go-gemara"
+)
+
+// PolicyTrace records how FromPolicy generated each tenet of a policy.
+// Pass a PolicyTrace to WithTrace to have it populated during transformation.
+// Traces accumulate across policies, so a trace shared by FromPolicies or by
+// the imports of a policy holds the tenets of each policy in turn.
+type PolicyTrace struct {
+	// PolicyID is the ID of the first policy traced
+	PolicyID string        `json:"policy_id"`
+	Tenets   []*TenetTrace `json:"tenets"`
+}
+
+// TenetTrace explains the decisions behind a single generated tenet.
+type TenetTrace struct {
+	// PolicyID is the ID of the policy the tenet was generated for
+	PolicyID string `json:"policy_id"`
+
+	// TenetID is the ID of the generated tenet
+	TenetID string `json:"tenet_id"`
+
+	// PlanID and RequirementID identify the source assessment plan
+	PlanID        string `json:"plan_id"`
+	RequirementID string `json:"requirement_id,omitempty"`
+
+	// MethodIndex is the position of the source method in the plan's
+	// evaluation-methods list, and TenetIndex its position among the
+	// automated methods, used in the tenet ID
+	MethodIndex       int    `json:"method_index"`
+	TenetIndex        int    `json:"tenet_index"`
+	MethodType        string `json:"method_type"`
+	MethodDescription string `json:"method_description,omitempty"`
+
+	// EvidenceRequirements is the text the template and predicate type were
+	// inferred from
+	EvidenceRequirements string `json:"evidence_requirements,omitempty"`
+
+	// MatchedKeywords are the evidence keywords that selected the template
+	MatchedKeywords []string `json:"matched_keywords,omitempty"`
+
+	// Template is the name of the CEL template used, empty on fallback
+	Template string `json:"template,omitempty"`
+
+	// TemplateSelection is one of TemplateFromEvidence, TemplateFromMethodType
+	// or TemplateFallback
+	TemplateSelection string `json:"template_selection"`
+
+	// PredicateType is the inferred attestation predicate type and
+	// PredicateKeyword the evidence keyword it was inferred from
+	PredicateType    string `json:"predicate_type,omitempty"`
+	PredicateKeyword string `json:"predicate_keyword,omitempty"`
+
+	// Parameters maps each template parameter the template read to its
+	// substituted value
+	Parameters map[string]string `json:"parameters,omitempty"`
+
+	// ScopeFilter is the scope filter prepended to the code, if any
+	ScopeFilter string `json:"scope_filter,omitempty"`
+
+	// Catalog describes the catalog enrichment used for the tenet, if any
+	Catalog *EnrichmentTrace `json:"catalog,omitempty"`
+
+	// Fallback is set when no template was available and a basic
+	// predicate type check or placeholder was generated
+	Fallback bool `json:"fallback"`
+}
+
+// EnrichmentTrace describes the catalog entries used to enrich a tenet.
+type EnrichmentTrace struct {
+	CatalogID     string `json:"catalog_id,omitempty"`
+	ControlID     string `json:"control_id,omitempty"`
+	RequirementID string `json:"requirement_id,omitempty"`
+	FamilyID      string `json:"family_id,omitempty"`
+
+	// TitleSource is "requirement", "control" or "method" depending on where
+	// the tenet title came from
+	TitleSource string `json:"title_source"`
+}
+
+// newTenetTrace builds the trace of a tenet generated from a plan's method.
+func newTenetTrace(
+	policyID string,
+	tenet *Tenet,
+	plan gemara.AssessmentPlan,
+	methodIndex, tenetIndex int,
+	method gemara.AcceptedMethod,
+	gen *celGeneration,
+	scopeFilter string,
+	enrichment *CatalogEnrichment,
+) *TenetTrace {
+	trace := &TenetTrace{
+		PolicyID:             policyID,
+		TenetID:              tenet.Id,
+		PlanID:               plan.Id,
+		RequirementID:        plan.RequirementId,
+		MethodIndex:          methodIndex,
+		TenetIndex:           tenetIndex,
+		MethodType:           method.Type,
+		MethodDescription:    method.Description,
+		EvidenceRequirements: plan.EvidenceRequirements,
+		MatchedKeywords:      gen.MatchedKeywords,
+		Template:             gen.TemplateName,
+		TemplateSelection:    gen.TemplateSelection,
+		PredicateKeyword:     gen.PredicateKeyword,
+		Parameters:           gen.Parameters,
+		ScopeFilter:          scopeFilter,
+		Fallback:             gen.Fallback,
+	}
+	if len(gen.AttestationTypes) > 0 {
+		trace.PredicateType = gen.AttestationTypes[0]
+	}
+
+	if enrichment != nil {
+		trace.Catalog = &EnrichmentTrace{TitleSource: "method"}
+		if enrichment.Catalog != nil {
+			trace.Catalog.CatalogID = enrichment.Catalog.Metadata.Id
+		}
+		if enrichment.Control != nil {
+			trace.Catalog.ControlID = enrichment.Control.Id
+			if enrichment.Control.Title != "" {
+				trace.Catalog.TitleSource = "control"
+			}
+		}
+		if enrichment.Requirement != nil {
+			trace.Catalog.RequirementID = enrichment.Requirement.Id
+			if enrichment.Requirement.Text != "" {
+				trace.Catalog.TitleSource = "requirement"
+			}
+		}
+		if enrichment.Family != nil {
+			trace.Catalog.FamilyID = enrichment.Family.Id
+		}
+	}
+
+	return trace
+}
+
+// ParameterNames returns the substituted parameter names in sorted order.
+func (t *TenetTrace) ParameterNames() []string {
+	names := make([]string, 0, len(t.Parameters))
+	for name := range t.Parameters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
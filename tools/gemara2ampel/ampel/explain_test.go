@@ -0,0 +1,130 @@
+package ampel
+
+import (
+	"testing"
+
+	"github.com/gemaraproj/go-gemara"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestFromPolicy_WithTrace verifies the trace records template selection, parameters and catalog enrichment.
+func TestFromPolicy_WithTrace(t *testing.T) {
+	policy := createTestPolicy()
+	policy.Adherence.AssessmentPlans[0].Parameters = []gemara.Parameter{
+		{Id: "builder-id", AcceptedValues: []string{"https://github.com/actions/runner"}},
+		{Id: "unused", AcceptedValues: []string{"x"}},
+	}
+
+	trace := &PolicyTrace{}
+	ampelPolicy, err := FromPolicy(policy, WithCatalog(createTestCatalog()), WithTrace(trace))
+	require.NoError(t, err)
+
+	assert.Equal(t, "policy-001", trace.PolicyID)
+	require.Len(t, trace.Tenets, len(ampelPolicy.Tenets))
+
+	tenetTrace := trace.Tenets[0]
+	assert.Equal(t, ampelPolicy.Tenets[0].Id, tenetTrace.TenetID)
+	assert.Equal(t, "plan-01", tenetTrace.PlanID)
+	assert.Equal(t, "REQ-01", tenetTrace.RequirementID)
+	assert.Equal(t, 0, tenetTrace.MethodIndex)
+	assert.Equal(t, "automated", tenetTrace.MethodType)
+	assert.Equal(t, []string{"slsa", "builder"}, tenetTrace.MatchedKeywords)
+	assert.Equal(t, "slsa-provenance-builder", tenetTrace.Template)
+	assert.Equal(t, TemplateFromEvidence, tenetTrace.TemplateSelection)
+	assert.Equal(t, "https://slsa.dev/provenance/v1", tenetTrace.PredicateType)
+	assert.Equal(t, "slsa", tenetTrace.PredicateKeyword)
+	assert.Equal(t, map[string]string{"builder-id": `context["builder-id"]`}, tenetTrace.Parameters)
+	assert.False(t, tenetTrace.Fallback)
+
+	require.NotNil(t, tenetTrace.Catalog)
+	assert.Equal(t, "CTRL-01", tenetTrace.Catalog.ControlID)
+	assert.Equal(t, "REQ-01", tenetTrace.Catalog.RequirementID)
+	assert.Equal(t, "CF-01", tenetTrace.Catalog.FamilyID)
+	assert.Equal(t, "requirement", tenetTrace.Catalog.TitleSource)
+}
+
+// TestFromPolicy_WithTraceParameters verifies only the parameters a template reads are traced.
+func TestFromPolicy_WithTraceParameters(t *testing.T) {
+	policy := createTestPolicy()
+	policy.Adherence.AssessmentPlans[0].Parameters = []gemara.Parameter{
+		{Id: "builder-id", AcceptedValues: []string{"https://github.com/actions/runner"}},
+		{Id: "unused", AcceptedValues: []string{"x"}},
+	}
+
+	// The code contains the value of the unused parameter without the
+	// template reading it
+	templates := map[string]string{
+		"slsa-provenance-builder": `{{index . "builder-id"}} == context["unused"]`,
+	}
+	trace := &PolicyTrace{}
+	ampelPolicy, err := FromPolicy(policy, WithCELTemplates(templates), WithTrace(trace))
+	require.NoError(t, err)
+
+	require.Len(t, trace.Tenets, 1)
+	assert.Contains(t, ampelPolicy.Tenets[0].Code, `context["unused"]`)
+	assert.Equal(t, map[string]string{"builder-id": `context["builder-id"]`}, trace.Tenets[0].Parameters)
+}
+
+// TestFromPolicies_WithTrace verifies a shared trace accumulates the tenets of every policy.
+func TestFromPolicies_WithTrace(t *testing.T) {
+	first := createTestPolicy()
+	second := createTestPolicy()
+	second.Metadata.Id = "policy-002"
+
+	trace := &PolicyTrace{}
+	_, err := FromPolicies([]*gemara.Policy{first, second}, WithTransformOptions(WithTrace(trace)))
+	require.NoError(t, err)
+
+	assert.Equal(t, "policy-001", trace.PolicyID)
+	require.Len(t, trace.Tenets, 2)
+	assert.Equal(t, "policy-001", trace.Tenets[0].PolicyID)
+	assert.Equal(t, "policy-002", trace.Tenets[1].PolicyID)
+}
+
+// TestFromPolicy_WithTraceSelection verifies method-type and fallback template selection are traced.
+func TestFromPolicy_WithTraceSelection(t *testing.T) {
+	policy := createTestPolicy()
+	policy.Adherence.AssessmentPlans[0].EvidenceRequirements = "Signed release artifacts"
+	policy.Adherence.AssessmentPlans[0].EvaluationMethods = []gemara.AcceptedMethod{
+		{Type: "manual"},
+		{Type: "gate"},
+		{Type: "automated"},
+	}
+
+	trace := &PolicyTrace{}
+	_, err := FromPolicy(policy, WithTrace(trace))
+	require.NoError(t, err)
+
+	// The manual method is skipped, so traced method indexes point at the source list
+	require.Len(t, trace.Tenets, 2)
+
+	gate := trace.Tenets[0]
+	assert.Equal(t, 1, gate.MethodIndex)
+	assert.Equal(t, 0, gate.TenetIndex)
+	assert.Equal(t, "REQ-01-plan-01-0", gate.TenetID)
+	assert.Empty(t, gate.MatchedKeywords)
+	assert.Equal(t, "generic-predicate-type", gate.Template)
+	assert.Equal(t, TemplateFromMethodType, gate.TemplateSelection)
+	assert.False(t, gate.Fallback)
+	assert.Nil(t, gate.Catalog)
+
+	automated := trace.Tenets[1]
+	assert.Equal(t, 2, automated.MethodIndex)
+	assert.Equal(t, 1, automated.TenetIndex)
+	assert.Equal(t, "generic-field-equals", automated.Template)
+	assert.Equal(t, TemplateFromMethodType, automated.TemplateSelection)
+
+	// Without a template for the method type the basic CEL fallback is traced
+	original := MethodTypeToCELTemplate["gate"]
+	MethodTypeToCELTemplate["gate"] = "missing-template"
+	t.Cleanup(func() { MethodTypeToCELTemplate["gate"] = original })
+
+	trace = &PolicyTrace{}
+	_, err = FromPolicy(policy, WithTrace(trace))
+	require.NoError(t, err)
+	require.Len(t, trace.Tenets, 2)
+	assert.Empty(t, trace.Tenets[0].Template)
+	assert.Equal(t, TemplateFallback, trace.Tenets[0].TemplateSelection)
+	assert.True(t, trace.Tenets[0].Fallback)
+}
@@ -0,0 +1,198 @@
+package ampel
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/goccy/go-yaml"
+)
+
+// IndexFile is the workspace file mapping the file names of policies back
+// to their IDs, to detect IDs whose files would collide.
+const IndexFile = ".index.yaml"
+
+// IndexVersion is the version of the filename index, and of the filename
+// encoding it indexes.
+const IndexVersion = 1
+
+// ErrFilenameCollision is returned when two policy IDs map to the same
+// workspace file, such as IDs differing only in case on case-insensitive
+// file systems.
+var ErrFilenameCollision = errors.New("policy file name collision")
+
+// reservedNames are device names that cannot be file names on Windows,
+// whatever their extension.
+var reservedNames = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true, "COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true, "LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+// EncodePolicyFilename encodes a policy ID into the file name stem of its
+// workspace files. Letters, digits, '-', '_' and '.' are kept, every other
+// byte is written as %XX in uppercase hexadecimal, as are a leading or
+// trailing '.' and the first character of reserved device names. The empty
+// ID is encoded as "%". The encoding is injective and reversed by
+// DecodePolicyFilename, so that IDs such as "org/policy", "org:policy" and
+// "org-policy" map to distinct files.
+func EncodePolicyFilename(policyID string) string {
+	if policyID == "" {
+		return "%"
+	}
+
+	device, _, _ := strings.Cut(policyID, ".")
+	reserved := reservedNames[strings.ToUpper(device)]
+
+	var b strings.Builder
+	for i := 0; i < len(policyID); i++ {
+		c := policyID[i]
+		escape := !isFilenameByte(c) ||
+			(c == '.' && (i == 0 || i == len(policyID)-1)) ||
+			(i == 0 && reserved)
+		if escape {
+			fmt.Fprintf(&b, "%%%02X", c)
+		} else {
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// DecodePolicyFilename decodes a file name stem written by
+// EncodePolicyFilename back into the policy ID.
+func DecodePolicyFilename(name string) (string, error) {
+	if name == "%" {
+		return "", nil
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		switch {
+		case c == '%':
+			if i+2 >= len(name) || !isUpperHex(name[i+1]) || !isUpperHex(name[i+2]) {
+				return "", fmt.Errorf("invalid escape in policy file name %q", name)
+			}
+			b.WriteByte(unhex(name[i+1])<<4 | unhex(name[i+2]))
+			i += 2
+		case isFilenameByte(c):
+			b.WriteByte(c)
+		default:
+			return "", fmt.Errorf("invalid character %q in policy file name %q", c, name)
+		}
+	}
+
+	// Only canonical encodings decode, so that each ID has one file name
+	policyID := b.String()
+	if EncodePolicyFilename(policyID) != name {
+		return "", fmt.Errorf("policy file name %q is not canonically encoded", name)
+	}
+	return policyID, nil
+}
+
+// isFilenameByte reports whether c is kept as is in file names.
+func isFilenameByte(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c == '.'
+}
+
+// isUpperHex reports whether c is an uppercase hexadecimal digit.
+func isUpperHex(c byte) bool {
+	return c >= '0' && c <= '9' || c >= 'A' && c <= 'F'
+}
+
+// unhex returns the value of an uppercase hexadecimal digit.
+func unhex(c byte) byte {
+	if c <= '9' {
+		return c - '0'
+	}
+	return c - 'A' + 10
+}
+
+// FilenameIndex maps the file names of workspace policies back to their
+// IDs. Names are compared case-insensitively, as workspaces may live on
+// case-insensitive file systems.
+type FilenameIndex struct {
+	Version int `json:"version" yaml:"version"`
+
+	// Files maps each lowercased file name stem to the policy ID using it
+	Files map[string]string `json:"files" yaml:"files"`
+}
+
+// indexMu serializes filename index updates, as concurrent conversions into
+// a workspace claim their file names.
+var indexMu sync.Mutex
+
+// GetIndexPath returns the path of the workspace filename index.
+func (w *Workspace) GetIndexPath() string {
+	return filepath.Join(w.Path, IndexFile)
+}
+
+// LoadFilenameIndex reads the workspace filename index. Returns an empty
+// index when the workspace has none yet.
+func (w *Workspace) LoadFilenameIndex() (*FilenameIndex, error) {
+	index := &FilenameIndex{Version: IndexVersion, Files: make(map[string]string)}
+	indexPath := w.GetIndexPath()
+	data, err := w.ReadFile(indexPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return index, nil
+		}
+		return nil, fmt.Errorf("failed to read filename index: %w", err)
+	}
+	if err := yaml.Unmarshal(data, index); err != nil {
+		return nil, fmt.Errorf("failed to parse filename index %s: %w", indexPath, err)
+	}
+	if index.Version > IndexVersion {
+		return nil, fmt.Errorf("filename index %s has version %d, newer than the supported version %d", indexPath, index.Version, IndexVersion)
+	}
+	if index.Files == nil {
+		index.Files = make(map[string]string)
+	}
+	return index, nil
+}
+
+// SaveFilenameIndex writes the workspace filename index.
+func (w *Workspace) SaveFilenameIndex(index *FilenameIndex) error {
+	index.Version = IndexVersion
+	data, err := yaml.Marshal(index)
+	if err != nil {
+		return fmt.Errorf("failed to serialize filename index: %w", err)
+	}
+	if err := w.WriteFile(w.GetIndexPath(), data); err != nil {
+		return fmt.Errorf("failed to write filename index: %w", err)
+	}
+	return nil
+}
+
+// Claim records in the index that policyID uses the file name stem name,
+// failing with ErrFilenameCollision when another ID uses it.
+func (x *FilenameIndex) Claim(name, policyID string) error {
+	key := strings.ToLower(name)
+	if other, ok := x.Files[key]; ok && other != policyID {
+		return fmt.Errorf("%w: policies %q and %q both use the file name %s", ErrFilenameCollision, other, policyID, name)
+	}
+	x.Files[key] = policyID
+	return nil
+}
+
+// ClaimPolicyFilename records the file name of a policy ID in the workspace
+// filename index before its files are written, failing with
+// ErrFilenameCollision when the files of another ID would be overwritten.
+// It is safe for concurrent use within a process.
+func (w *Workspace) ClaimPolicyFilename(policyID string) error {
+	indexMu.Lock()
+	defer indexMu.Unlock()
+
+	index, err := w.LoadFilenameIndex()
+	if err != nil {
+		return err
+	}
+	if err := index.Claim(EncodePolicyFilename(policyID), policyID); err != nil {
+		return err
+	}
+	return w.SaveFilenameIndex(index)
+}
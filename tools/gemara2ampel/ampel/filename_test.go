@@ -0,0 +1,76 @@
+package ampel
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestEncodePolicyFilename verifies policy IDs are encoded into distinct safe file names.
+func TestEncodePolicyFilename(t *testing.T) {
+	tests := []struct {
+		name     string
+		policyID string
+		want     string
+	}{
+		{name: "no special chars", policyID: "policy-001", want: "policy-001"},
+		{name: "slashes", policyID: "org/team/policy", want: "org%2Fteam%2Fpolicy"},
+		{name: "backslashes", policyID: "org\\team\\policy", want: "org%5Cteam%5Cpolicy"},
+		{name: "colons", policyID: "namespace:policy:v1", want: "namespace%3Apolicy%3Av1"},
+		{name: "percent", policyID: "100%", want: "100%25"},
+		{name: "dot dot", policyID: "..", want: "%2E%2E"},
+		{name: "parent path", policyID: "../policy", want: "%2E.%2Fpolicy"},
+		{name: "inner dots", policyID: "policy.v1.2", want: "policy.v1.2"},
+		{name: "control characters", policyID: "a\nb\x00", want: "a%0Ab%00"},
+		{name: "spaces", policyID: "my policy ", want: "my%20policy%20"},
+		{name: "non-ASCII", policyID: "política", want: "pol%C3%ADtica"},
+		{name: "reserved name", policyID: "CON", want: "%43ON"},
+		{name: "reserved name with extension", policyID: "lpt1.policy", want: "%6Cpt1.policy"},
+		{name: "reserved name prefix", policyID: "console", want: "console"},
+		{name: "empty string", policyID: "", want: "%"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := EncodePolicyFilename(tt.policyID)
+			assert.Equal(t, tt.want, got)
+
+			decoded, err := DecodePolicyFilename(got)
+			require.NoError(t, err)
+			assert.Equal(t, tt.policyID, decoded)
+		})
+	}
+
+	// IDs that the legacy file names merged stay apart
+	names := map[string]bool{}
+	for _, id := range []string{"org/policy", "org:policy", "org-policy", "org\\policy"} {
+		names[EncodePolicyFilename(id)] = true
+	}
+	assert.Len(t, names, 4)
+}
+
+// TestDecodePolicyFilename verifies only canonical file names decode.
+func TestDecodePolicyFilename(t *testing.T) {
+	for _, name := range []string{"org%2fpolicy", "org%2", "org%ZZ", "org/policy", "%6Fk", ".hidden", "%43"} {
+		_, err := DecodePolicyFilename(name)
+		assert.Error(t, err, name)
+	}
+}
+
+// TestWorkspace_ClaimPolicyFilename verifies IDs sharing a file name are refused.
+func TestWorkspace_ClaimPolicyFilename(t *testing.T) {
+	ws, err := NewWorkspace(t.TempDir())
+	require.NoError(t, err)
+
+	require.NoError(t, ws.SavePolicy("org/Policy", newMergeTestPolicy(withPolicyID("org/Policy"))))
+	require.NoError(t, ws.SaveBase("org/Policy", newMergeTestPolicy(withPolicyID("org/Policy"))))
+
+	// IDs differing in case collide on case-insensitive file systems
+	err = ws.SavePolicy("org/policy", newMergeTestPolicy(withPolicyID("org/policy")))
+	assert.ErrorIs(t, err, ErrFilenameCollision)
+
+	index, err := ws.LoadFilenameIndex()
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"org%2fpolicy": "org/Policy"}, index.Files)
+}
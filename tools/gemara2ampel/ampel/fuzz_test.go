@@ -0,0 +1,116 @@
+package ampel
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gemaraproj/go-gemara"
+)
+
+// celStringLiteral matches a double-quoted CEL string literal.
+var celStringLiteral = regexp.MustCompile(`"(?:[^"\\]|\\.)*"`)
+
+// FuzzGenerateCEL checks that templates never panic and that text without
+// actions is rendered unchanged.
+func FuzzGenerateCEL(f *testing.F) {
+	for _, tmpl := range DefaultCELTemplates {
+		f.Add(tmpl, "builder-id", `context["builder-id"]`)
+	}
+	f.Add(`{{index . "missing"}}`, "x", "y")
+	f.Add(`{{.Unclosed`, "x", "y")
+	f.Add(`attestation.predicate.x == "a"`, "", "")
+
+	f.Fuzz(func(t *testing.T, tmpl, key, value string) {
+		code, err := GenerateCEL(tmpl, map[string]interface{}{key: value})
+		if err != nil {
+			return
+		}
+		if !strings.Contains(tmpl, "{{") && code != strings.TrimSpace(tmpl) {
+			t.Errorf("template without actions rendered as %q, want %q", code, strings.TrimSpace(tmpl))
+		}
+	})
+}
+
+// FuzzScopeFilterToCEL checks that dimension values cannot escape their CEL
+// string literals. Each argument is a comma-separated list of values.
+func FuzzScopeFilterToCEL(f *testing.F) {
+	f.Add("Cloud Computing", "United States,European Union", "Confidential", "platform")
+	f.Add("", "", "", "")
+	f.Add(`web"] || true || x in ["`, "", "", `a\`)
+
+	f.Fuzz(func(t *testing.T, technologies, regions, sensitivity, groups string) {
+		dimensions := gemara.Dimensions{
+			Technologies: splitFuzzList(technologies),
+			Geopolitical: splitFuzzList(regions),
+			Sensitivity:  splitFuzzList(sensitivity),
+			Groups:       splitFuzzList(groups),
+		}
+		filter := ScopeFilterToCEL(dimensions)
+
+		// Replacing every literal must leave only the filter structure
+		var clauses []string
+		for _, clause := range []struct {
+			field  string
+			values []string
+		}{
+			{"subject.type", dimensions.Technologies},
+			{"subject.annotations.region", dimensions.Geopolitical},
+			{"subject.annotations.classification", dimensions.Sensitivity},
+			{"subject.annotations.group", dimensions.Groups},
+		} {
+			if len(clause.values) == 0 {
+				continue
+			}
+			literals := strings.Repeat(`"", `, len(clause.values)-1) + `""`
+			clauses = append(clauses, clause.field+" in ["+literals+"]")
+		}
+		want := strings.Join(clauses, " && ")
+
+		for _, literal := range celStringLiteral.FindAllString(filter, -1) {
+			if _, err := strconv.Unquote(literal); err != nil {
+				t.Errorf("invalid string literal %s in %q: %v", literal, filter, err)
+			}
+		}
+		if got := celStringLiteral.ReplaceAllString(filter, `""`); got != want {
+			t.Errorf("filter structure is %q, want %q (filter %q)", got, want, filter)
+		}
+	})
+}
+
+// FuzzExtractPolicyIdFromReference checks the policy ID extracted from
+// arbitrary references.
+func FuzzExtractPolicyIdFromReference(f *testing.F) {
+	f.Add("https://example.com/policies.json#policies/policy-001.json")
+	f.Add("git+https://github.com/org/repo#policies/nested/policy-002.yaml")
+	f.Add("policy-003")
+	f.Add("a#b#c.d")
+	f.Add("#")
+
+	f.Fuzz(func(t *testing.T, reference string) {
+		id := extractPolicyIdFromReference(reference)
+		if !strings.Contains(reference, "#") {
+			if id != reference {
+				t.Errorf("reference without fragment gave %q, want it unchanged", id)
+			}
+			return
+		}
+
+		fragment := reference[strings.LastIndex(reference, "#")+1:]
+		if strings.Contains(id, "#") {
+			t.Errorf("ID %q of %q contains a fragment separator", id, reference)
+		}
+		if strings.Contains(id, "/") && strings.Trim(fragment, "/") != "" {
+			t.Errorf("ID %q of %q contains a path separator", id, reference)
+		}
+	})
+}
+
+// splitFuzzList splits a comma-separated fuzz argument, with "" as no values.
+func splitFuzzList(list string) []string {
+	if list == "" {
+		return nil
+	}
+	return strings.Split(list, ",")
+}
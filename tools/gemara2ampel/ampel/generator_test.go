@@ -0,0 +1,228 @@
+package ampel
+
+import (
+	"fmt"
+	"math/rand"
+	"slices"
+
+	"github.com/gemaraproj/go-gemara"
+)
+
+// generatedEvidence pairs evidence requirements with the parameters the CEL
+// template they select references, so generated plans never leave a
+// template parameter undefined.
+type generatedEvidence struct {
+	text string
+
+	// params are the parameter IDs the selected template references
+	params []string
+
+	// listParams are the parameter IDs referenced as "-list", which need
+	// more than one accepted value
+	listParams []string
+
+	// methodTemplate is set for evidence selecting no template, whose
+	// tenets use the method type templates. These reference fields no
+	// parameter defines and are reported as missing-template-parameter.
+	methodTemplate bool
+}
+
+// evidencePool lists evidence requirements covering every default template
+// selected from evidence, and evidence falling back to the method type
+// templates.
+var evidencePool = []generatedEvidence{
+	{text: "SLSA provenance with trusted builder", params: []string{"builder-id"}},
+	{text: "SLSA provenance with complete materials"},
+	{text: "SLSA provenance with the expected build type", params: []string{"build-type"}},
+	{text: "Vulnerability scan with no critical findings"},
+	{text: "Vulnerability scan within the agreed threshold from an approved scanner", params: []string{"max-critical"}, listParams: []string{"scanner"}},
+	{text: "Vulnerabilities reported by an approved scanner", listParams: []string{"scanner"}},
+	{text: "Signed release artifacts", methodTemplate: true},
+	{text: "Reviewed deployment manifests", params: []string{"builder-id"}, methodTemplate: true},
+}
+
+// generatedMethodTypes are the evaluation method types of generated plans.
+// Manual methods are skipped by the transformer and produce no tenet.
+var generatedMethodTypes = []string{"automated", "gate", "behavioral", "autoremediation", "manual"}
+
+// policyGenerator generates random but valid Gemara policies and catalogs for
+// property tests. The same seed always generates the same values.
+type policyGenerator struct {
+	rand *rand.Rand
+
+	// params holds the first definition of each parameter ID in the
+	// current policy
+	params map[string]gemara.Parameter
+
+	// conflicts holds the parameter IDs of the current policy that a later
+	// plan defined with different accepted values
+	conflicts map[string]bool
+
+	// methodTemplatePlans holds the IDs of the current policy's plans whose
+	// evidence selects no template
+	methodTemplatePlans map[string]bool
+}
+
+// newPolicyGenerator returns a generator seeded with seed.
+func newPolicyGenerator(seed int64) *policyGenerator {
+	return &policyGenerator{rand: rand.New(rand.NewSource(seed))}
+}
+
+// Policy generates a policy with one to five assessment plans, each with at
+// least one automated evaluation method.
+func (g *policyGenerator) Policy() *gemara.Policy {
+	g.params = make(map[string]gemara.Parameter)
+	g.conflicts = make(map[string]bool)
+	g.methodTemplatePlans = make(map[string]bool)
+
+	policy := &gemara.Policy{
+		Title: fmt.Sprintf("Generated Policy %d", g.rand.Intn(1000)),
+		Metadata: gemara.Metadata{
+			Id:          fmt.Sprintf("policy-%03d", g.rand.Intn(1000)),
+			Version:     fmt.Sprintf("%d.%d.0", 1+g.rand.Intn(3), g.rand.Intn(10)),
+			Description: "Generated policy",
+			Author:      gemara.Actor{Id: "generator", Name: "Policy Generator"},
+		},
+		Scope: gemara.Scope{In: g.dimensions()},
+	}
+
+	planCount := 1 + g.rand.Intn(5)
+	for i := 0; i < planCount; i++ {
+		policy.Adherence.AssessmentPlans = append(policy.Adherence.AssessmentPlans, g.plan(i))
+	}
+	return policy
+}
+
+// Catalog generates a catalog defining every requirement of policy, spread
+// over one or two families and with random guideline mappings.
+func (g *policyGenerator) Catalog(policy *gemara.Policy) *gemara.Catalog {
+	catalog := &gemara.Catalog{
+		Title: "Generated Catalog",
+		Metadata: gemara.Metadata{
+			Id:      fmt.Sprintf("catalog-%03d", g.rand.Intn(1000)),
+			Version: "1.0",
+			MappingReferences: []gemara.MappingReference{
+				{Id: "OSPS-B", Title: "Open Source Project Security Baseline"},
+				{Id: "800-53", Title: "NIST SP 800-53"},
+			},
+		},
+	}
+
+	familyCount := 1 + g.rand.Intn(2)
+	for i := 0; i < familyCount; i++ {
+		catalog.Families = append(catalog.Families, gemara.Family{
+			Id:    fmt.Sprintf("CF-%02d", i+1),
+			Title: fmt.Sprintf("Generated Family %d", i+1),
+		})
+	}
+
+	seen := make(map[string]bool)
+	for _, plan := range policy.Adherence.AssessmentPlans {
+		if seen[plan.RequirementId] {
+			continue
+		}
+		seen[plan.RequirementId] = true
+
+		control := gemara.Control{
+			Id:        fmt.Sprintf("CTRL-%02d", len(catalog.Controls)+1),
+			Title:     "Generated control for " + plan.RequirementId,
+			Objective: "Generated objective",
+			Family:    catalog.Families[g.rand.Intn(familyCount)].Id,
+			AssessmentRequirements: []gemara.AssessmentRequirement{
+				{Id: plan.RequirementId, Text: "Verify " + plan.RequirementId},
+			},
+		}
+		if g.rand.Intn(2) == 0 {
+			control.GuidelineMappings = []gemara.MultiMapping{{
+				ReferenceId: "OSPS-B",
+				Entries:     []gemara.MappingEntry{{ReferenceId: fmt.Sprintf("OSPS-QA-%02d", 1+g.rand.Intn(10))}},
+			}}
+		}
+		catalog.Controls = append(catalog.Controls, control)
+	}
+	return catalog
+}
+
+// plan generates the assessment plan at index i.
+func (g *policyGenerator) plan(i int) gemara.AssessmentPlan {
+	evidence := evidencePool[g.rand.Intn(len(evidencePool))]
+	plan := gemara.AssessmentPlan{
+		Id:                   fmt.Sprintf("plan-%02d", i+1),
+		RequirementId:        fmt.Sprintf("REQ-%02d", 1+g.rand.Intn(4)),
+		Frequency:            "continuous",
+		EvidenceRequirements: evidence.text,
+	}
+	if evidence.methodTemplate {
+		g.methodTemplatePlans[plan.Id] = true
+	}
+
+	// The first method is always automated so every plan generates a tenet
+	methodCount := 1 + g.rand.Intn(3)
+	for j := 0; j < methodCount; j++ {
+		methodType := "automated"
+		if j > 0 {
+			methodType = generatedMethodTypes[g.rand.Intn(len(generatedMethodTypes))]
+		}
+		plan.EvaluationMethods = append(plan.EvaluationMethods, gemara.AcceptedMethod{
+			Type:        methodType,
+			Description: fmt.Sprintf("Generated %s method %d", methodType, j+1),
+		})
+	}
+
+	for _, id := range evidence.params {
+		plan.Parameters = append(plan.Parameters, g.parameter(id, 0))
+	}
+	for _, id := range evidence.listParams {
+		plan.Parameters = append(plan.Parameters, g.parameter(id, 2))
+	}
+	return plan
+}
+
+// parameter returns the policy's definition of parameter id, generating one
+// with at least minValues accepted values on first use. Later uses get a
+// definition with an extra accepted value one time in four, which conflicts
+// with the first. Parameters without a minimum may be runtime-provided, with
+// no accepted values. Each parameter ID is used with a single minimum.
+func (g *policyGenerator) parameter(id string, minValues int) gemara.Parameter {
+	if param, ok := g.params[id]; ok {
+		if g.rand.Intn(4) != 0 {
+			return param
+		}
+		g.conflicts[id] = true
+		conflicting := param
+		conflicting.AcceptedValues = append(slices.Clone(param.AcceptedValues), id+"-conflicting-value")
+		return conflicting
+	}
+
+	param := gemara.Parameter{Id: id, Label: id, Description: "Generated parameter " + id}
+	valueCount := minValues + g.rand.Intn(3)
+	for k := 0; k < valueCount; k++ {
+		param.AcceptedValues = append(param.AcceptedValues, fmt.Sprintf("%s-value-%d", id, k+1))
+	}
+	g.params[id] = param
+	return param
+}
+
+// dimensions generates scope dimensions, each present with even odds.
+func (g *policyGenerator) dimensions() gemara.Dimensions {
+	return gemara.Dimensions{
+		Technologies: g.subset("Cloud Computing", "Web Applications", "Container Images"),
+		Geopolitical: g.subset("United States", "European Union", "Canada"),
+		Sensitivity:  g.subset("Confidential", "Public"),
+		Groups:       g.subset("platform", "release-engineering"),
+	}
+}
+
+// subset returns a random, possibly empty, subset of values.
+func (g *policyGenerator) subset(values ...string) []string {
+	if g.rand.Intn(2) == 0 {
+		return nil
+	}
+	var picked []string
+	for _, value := range values {
+		if g.rand.Intn(2) == 0 {
+			picked = append(picked, value)
+		}
+	}
+	return picked
+}
@@ -0,0 +1,31 @@
+//go:build windows
+
+package ampel
+
+import (
+	"errors"
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// lockOffset is the offset of the locked byte of the lock file, past its
+// content, so that the holder recorded in it stays readable.
+var lockOffset = windows.Overlapped{OffsetHigh: 0x40000000}
+
+// tryLockFile takes an exclusive lock on f without waiting, reporting false
+// when another open file holds it.
+func tryLockFile(f *os.File) (bool, error) {
+	overlapped := lockOffset
+	err := windows.LockFileEx(windows.Handle(f.Fd()), windows.LOCKFILE_EXCLUSIVE_LOCK|windows.LOCKFILE_FAIL_IMMEDIATELY, 0, 1, 0, &overlapped)
+	if errors.Is(err, windows.ERROR_LOCK_VIOLATION) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// unlockFile releases the lock taken on f by tryLockFile.
+func unlockFile(f *os.File) error {
+	overlapped := lockOffset
+	return windows.UnlockFileEx(windows.Handle(f.Fd()), 0, 1, 0, &overlapped)
+}
@@ -0,0 +1,167 @@
+package ampel
+
+import (
+	"fmt"
+	"strings"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// mergeLocked keeps the existing value of a locked field. It is only set
+// by locks and cannot be chosen as a field strategy.
+const mergeLocked MergeStrategy = "locked"
+
+// TenetLock pins a tenet, or some of its fields, to its content in the
+// workspace. Merges never overwrite or delete locked content and report
+// the generator changes that would have affected it.
+type TenetLock struct {
+	// PolicyID restricts the lock to a PolicySet member policy. Empty locks
+	// the tenet in any policy.
+	PolicyID string `json:"policy,omitempty" yaml:"policy,omitempty"`
+
+	TenetID string `json:"tenet" yaml:"tenet"`
+
+	// Fields lists the locked tenet fields, such as "code" or "outputs".
+	// Empty locks the whole tenet.
+	Fields []string `json:"fields,omitempty" yaml:"fields,omitempty"`
+
+	// Reason documents why the tenet is maintained by hand
+	Reason string `json:"reason,omitempty" yaml:"reason,omitempty"`
+}
+
+// Validate checks the lock names a tenet and only mergeable tenet fields.
+func (l TenetLock) Validate() error {
+	if l.TenetID == "" {
+		return fmt.Errorf("lock has no tenet ID")
+	}
+	for _, field := range l.Fields {
+		if _, ok := DefaultTenetMergeStrategies[field]; !ok {
+			return fmt.Errorf("lock of tenet %s: unknown field %q (use %s)",
+				l.TenetID, field, strings.Join(sortedKeys(DefaultTenetMergeStrategies), ", "))
+		}
+	}
+	return nil
+}
+
+// String returns a one-line summary of the lock.
+func (l TenetLock) String() string {
+	s := "tenet " + l.TenetID
+	if l.PolicyID != "" {
+		s = "policy " + l.PolicyID + " " + s
+	}
+	if len(l.Fields) > 0 {
+		s += " fields " + strings.Join(l.Fields, ", ")
+	}
+	return s
+}
+
+// WithLocks pins tenets, or some of their fields, to their existing content.
+// Locked fields keep the existing value, never conflict, and locked tenets
+// missing from the generated policy are kept as they are. The generator
+// changes to locked content are listed in MergeStats.LockedChanges.
+//
+// Example:
+//
+//	ampel.MergePolicy(existing, generated, ampel.WithLocks([]ampel.TenetLock{
+//	    {TenetID: "REQ-01-plan-01-0", Fields: []string{"code"}},
+//	}))
+func WithLocks(locks []TenetLock) MergeOption {
+	return func(opts *MergeOptions) {
+		opts.Locks = append(opts.Locks, locks...)
+	}
+}
+
+// LockedChange is a generator change to locked content that a merge did
+// not apply.
+type LockedChange struct {
+	// PolicyID is the member policy of the tenet in PolicySet merges
+	PolicyID string `json:"policy,omitempty"`
+
+	TenetID string `json:"tenet"`
+
+	// Field is the changed tenet field, empty when the tenet is no longer
+	// generated
+	Field string `json:"field,omitempty"`
+}
+
+// String returns a one-line description of the change.
+func (c LockedChange) String() string {
+	s := "tenet " + c.TenetID
+	if c.PolicyID != "" {
+		s = "policy " + c.PolicyID + " " + s
+	}
+	if c.Field == "" {
+		return s + " is no longer generated"
+	}
+	return s + " field " + c.Field + " changed upstream"
+}
+
+// tenetLocks holds the locked fields of tenets by tenet ID.
+type tenetLocks map[string]map[string]bool
+
+// resolveLocks returns the locked fields of the tenets of a policy. Locks of
+// whole tenets list every mergeable field.
+func resolveLocks(locks []TenetLock, policyID string) (tenetLocks, error) {
+	resolved := make(tenetLocks)
+	for _, lock := range locks {
+		if err := lock.Validate(); err != nil {
+			return nil, err
+		}
+		if lock.PolicyID != "" && lock.PolicyID != policyID {
+			continue
+		}
+		fields := lock.Fields
+		if len(fields) == 0 {
+			fields = sortedKeys(DefaultTenetMergeStrategies)
+		}
+		if resolved[lock.TenetID] == nil {
+			resolved[lock.TenetID] = make(map[string]bool)
+		}
+		for _, field := range fields {
+			resolved[lock.TenetID][field] = true
+		}
+	}
+	return resolved, nil
+}
+
+// locked reports whether any content of a tenet is locked.
+func (l tenetLocks) locked(tenet *Tenet) bool {
+	return len(l[tenet.Id]) > 0
+}
+
+// strategies returns the field strategies of a tenet with its locked fields
+// switched to mergeLocked.
+func (l tenetLocks) strategies(tenetID string, strategies []fieldStrategy) []fieldStrategy {
+	fields := l[tenetID]
+	if len(fields) == 0 {
+		return strategies
+	}
+	locked := make([]fieldStrategy, len(strategies))
+	for i, fs := range strategies {
+		locked[i] = fs
+		if fields[string(fs.field.Name())] {
+			locked[i].strategy = mergeLocked
+		}
+	}
+	return locked
+}
+
+// changes returns the locked fields of a tenet that the generator changed:
+// since base when recorded, otherwise compared to the existing tenet.
+func (l tenetLocks) changes(base, existing, generated *Tenet) []LockedChange {
+	reference := base
+	if reference == nil {
+		reference = existing
+	}
+	referenceMsg, generatedMsg := reference.ProtoReflect(), generated.ProtoReflect()
+	fields := generatedMsg.Descriptor().Fields()
+
+	var changes []LockedChange
+	for _, name := range sortedKeys(l[existing.Id]) {
+		fd := fields.ByName(protoreflect.Name(name))
+		if !fieldEqual(referenceMsg, generatedMsg, fd) {
+			changes = append(changes, LockedChange{TenetID: generated.Id, Field: name})
+		}
+	}
+	return changes
+}
@@ -0,0 +1,114 @@
+package ampel
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestMergePolicy_LockedTenet verifies a locked tenet keeps all its fields.
+func TestMergePolicy_LockedTenet(t *testing.T) {
+	base := newMergeTestPolicy(withTenets(&Tenet{Id: "tenet-1", Title: "Title v1", Code: "code_v1"}))
+	existing := newMergeTestPolicy(withTenets(&Tenet{Id: "tenet-1", Title: "Title v1", Code: "manual"}))
+	generated := newMergeTestPolicy(withTenets(&Tenet{Id: "tenet-1", Title: "Title v2", Code: "code_v2"}))
+
+	merged, stats, err := MergePolicyWithBase(base, existing, generated, WithLocks([]TenetLock{{TenetID: "tenet-1"}}))
+	require.NoError(t, err)
+
+	assert.Equal(t, "Title v1", merged.Tenets[0].Title)
+	assert.Equal(t, "manual", merged.Tenets[0].Code)
+	assert.Empty(t, stats.Conflicts)
+	assert.Equal(t, []LockedChange{
+		{TenetID: "tenet-1", Field: "code"},
+		{TenetID: "tenet-1", Field: "title"},
+	}, stats.LockedChanges)
+
+	// Without locks the edited code conflicts
+	_, stats, err = MergePolicyWithBase(base, existing, generated)
+	require.NoError(t, err)
+	assert.Len(t, stats.Conflicts, 1)
+	assert.Empty(t, stats.LockedChanges)
+}
+
+// TestMergePolicy_LockedFields verifies only the locked fields keep their value.
+func TestMergePolicy_LockedFields(t *testing.T) {
+	base := newMergeTestPolicy(withTenets(&Tenet{Id: "tenet-1", Title: "Title v1", Code: "code_v1"}))
+	existing := newMergeTestPolicy(withTenets(&Tenet{Id: "tenet-1", Title: "Title v1", Code: "manual"}))
+	generated := newMergeTestPolicy(withTenets(&Tenet{Id: "tenet-1", Title: "Title v2", Code: "code_v2"}))
+
+	merged, stats, err := MergePolicyWithBase(base, existing, generated,
+		WithLocks([]TenetLock{{TenetID: "tenet-1", Fields: []string{"code"}}}))
+	require.NoError(t, err)
+	assert.Equal(t, "Title v2", merged.Tenets[0].Title)
+	assert.Equal(t, "manual", merged.Tenets[0].Code)
+	assert.Empty(t, stats.Conflicts)
+	assert.Equal(t, []LockedChange{{TenetID: "tenet-1", Field: "code"}}, stats.LockedChanges)
+
+	// Unchanged upstream, nothing is reported
+	_, stats, err = MergePolicyWithBase(generated, existing, generated,
+		WithLocks([]TenetLock{{TenetID: "tenet-1", Fields: []string{"code"}}}))
+	require.NoError(t, err)
+	assert.Empty(t, stats.LockedChanges)
+
+	// Locks of other member policies do not apply
+	merged, _, err = MergePolicyWithBase(base, existing, generated,
+		WithLocks([]TenetLock{{PolicyID: "other-policy", TenetID: "tenet-1"}}))
+	require.NoError(t, err)
+	assert.Equal(t, "Title v2", merged.Tenets[0].Title)
+}
+
+// TestMergePolicy_LockedOrphan verifies locked tenets are never removed or renamed.
+func TestMergePolicy_LockedOrphan(t *testing.T) {
+	base := newMergeTestPolicy(withTenets(&Tenet{Id: "tenet-1", Title: "Title v1", Code: "code_v1"}))
+	existing := newMergeTestPolicy(withTenets(&Tenet{Id: "tenet-1", Title: "Title v1", Code: "manual"}))
+	generated := newMergeTestPolicy(withTenets(&Tenet{Id: "tenet-renamed", Title: "Title v1", Code: "code_v1"}))
+
+	locks := WithLocks([]TenetLock{{TenetID: "tenet-1", Fields: []string{"code"}}})
+	merged, stats, err := MergePolicyWithBase(base, existing, generated, locks)
+	require.NoError(t, err)
+
+	require.Len(t, merged.Tenets, 2)
+	assert.Equal(t, "tenet-1", merged.Tenets[1].Id)
+	assert.Equal(t, "manual", merged.Tenets[1].Code)
+	assert.False(t, IsManualOnly(merged.Tenets[1]))
+	assert.Empty(t, stats.Renames)
+	assert.Equal(t, 1, stats.TenetsKept)
+	assert.Zero(t, stats.TenetsRemoved)
+	assert.Equal(t, []LockedChange{{TenetID: "tenet-1"}}, stats.LockedChanges)
+	assert.Equal(t, "tenet tenet-1 is no longer generated", stats.LockedChanges[0].String())
+
+	// Hand-written locked tenets were never generated: nothing to report
+	_, stats, err = MergePolicyWithBase(nil, existing, generated, locks, WithRenameThreshold(2))
+	require.NoError(t, err)
+	assert.Empty(t, stats.LockedChanges)
+}
+
+// TestMergePolicySet_Locks verifies member locks report their member policy.
+func TestMergePolicySet_Locks(t *testing.T) {
+	base := newMergeTestPolicySet(mainMemberPolicy("code_v0"))
+	existing := newMergeTestPolicySet(mainMemberPolicy("manual"))
+	generated := newMergeTestPolicySet(mainMemberPolicy("code_v2"))
+
+	merged, stats, err := MergePolicySetWithBase(base, existing, generated,
+		WithLocks([]TenetLock{{PolicyID: "main-policy", TenetID: "tenet-1", Fields: []string{"code"}}}))
+	require.NoError(t, err)
+	assert.Equal(t, "manual", merged.Policies[0].Tenets[0].Code)
+	assert.Empty(t, stats.Conflicts())
+	require.Len(t, stats.LockedChanges(), 1)
+	assert.Equal(t, "policy main-policy tenet tenet-1 field code changed upstream", stats.LockedChanges()[0].String())
+}
+
+// TestTenetLock_Validate verifies locks name a tenet and mergeable fields.
+func TestTenetLock_Validate(t *testing.T) {
+	assert.NoError(t, TenetLock{TenetID: "tenet-1"}.Validate())
+	assert.NoError(t, TenetLock{TenetID: "tenet-1", Fields: []string{"code", "outputs"}}.Validate())
+	assert.Error(t, TenetLock{Fields: []string{"code"}}.Validate())
+	assert.Error(t, TenetLock{TenetID: "tenet-1", Fields: []string{"id"}}.Validate())
+
+	_, _, err := MergePolicy(&Policy{Id: "p"}, &Policy{Id: "p"}, WithLocks([]TenetLock{{TenetID: "t", Fields: []string{"bogus"}}}))
+	assert.ErrorContains(t, err, `unknown field "bogus"`)
+
+	assert.Equal(t, "policy member tenet tenet-1 fields code, outputs",
+		TenetLock{PolicyID: "member", TenetID: "tenet-1", Fields: []string{"code", "outputs"}}.String())
+}
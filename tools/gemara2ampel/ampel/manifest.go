@@ -0,0 +1,285 @@
+package ampel
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/goccy/go-yaml"
+)
+
+// ManifestFile is the workspace manifest, recording the sources, generator
+// and output digest of every policy generated into the workspace.
+const ManifestFile = "workspace.yaml"
+
+// ManifestVersion is the format version of the manifests written by this
+// package. Newer manifests are rejected.
+const ManifestVersion = 1
+
+// Kinds of generated workspace outputs.
+const (
+	ManifestKindPolicy    = "policy"
+	ManifestKindPolicySet = "policyset"
+)
+
+// Manifest records how each output of a workspace was generated.
+type Manifest struct {
+	Version int `json:"version" yaml:"version"`
+
+	// Outputs lists the generated policies and PolicySets, sorted by ID
+	Outputs []ManifestEntry `json:"outputs" yaml:"outputs"`
+}
+
+// ManifestEntry records the generation of a workspace policy or PolicySet.
+type ManifestEntry struct {
+	ID   string `json:"id" yaml:"id"`
+	Kind string `json:"kind" yaml:"kind"`
+
+	// Output is the policy file and its digest as last written
+	Output FileDigest `json:"output" yaml:"output"`
+
+	// Sources are the Gemara policy and values files read
+	Sources []FileDigest `json:"sources" yaml:"sources"`
+
+	// Catalogs are the catalogs used for enrichment
+	Catalogs []FileDigest `json:"catalogs,omitempty" yaml:"catalogs,omitempty"`
+
+	// TemplateDigest is the digest of the CEL template library, see
+	// TemplateDigest
+	TemplateDigest string `json:"template_digest" yaml:"template_digest"`
+
+	ToolVersion string    `json:"tool_version" yaml:"tool_version"`
+	GeneratedAt time.Time `json:"generated_at" yaml:"generated_at"`
+
+	// OrphanMode and MergeStrategies are the orphan mode and field merge
+	// strategies of the workspace merge, as given to ParseOrphanMode and
+	// ParseMergeStrategyOption, replayed to tell which edits a regeneration
+	// would drop. Unset, the defaults apply.
+	OrphanMode      string   `json:"orphan_mode,omitempty" yaml:"orphan_mode,omitempty"`
+	MergeStrategies []string `json:"merge_strategies,omitempty" yaml:"merge_strategies,omitempty"`
+}
+
+// FileDigest is a file and the digest of its content. Paths are relative
+// to the workspace directory, so manifests hold across checkouts.
+type FileDigest struct {
+	Path   string `json:"path" yaml:"path"`
+	Digest string `json:"digest" yaml:"digest"`
+}
+
+// Entry returns the entry of a policy or PolicySet ID, or nil when it is
+// not recorded.
+func (m *Manifest) Entry(id string) *ManifestEntry {
+	for i := range m.Outputs {
+		if m.Outputs[i].ID == id {
+			return &m.Outputs[i]
+		}
+	}
+	return nil
+}
+
+// SetEntry records an entry, replacing the entry of the same ID.
+func (m *Manifest) SetEntry(entry ManifestEntry) {
+	if existing := m.Entry(entry.ID); existing != nil {
+		*existing = entry
+		return
+	}
+	m.Outputs = append(m.Outputs, entry)
+	sort.Slice(m.Outputs, func(i, j int) bool { return m.Outputs[i].ID < m.Outputs[j].ID })
+}
+
+// DigestBytes returns the digest of data as "sha256:<hex>".
+func DigestBytes(data []byte) string {
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// TemplateDigest returns the digest of a CEL template library, such as
+// DefaultCELTemplates, over the template names and code.
+func TemplateDigest(templates map[string]string) string {
+	h := sha256.New()
+	for _, name := range sortedKeys(templates) {
+		fmt.Fprintf(h, "%d:%s%d:%s", len(name), name, len(templates[name]), templates[name])
+	}
+	return "sha256:" + hex.EncodeToString(h.Sum(nil))
+}
+
+// LoadManifest reads the workspace manifest. Returns an empty manifest
+// without error when none has been written yet.
+func (w *Workspace) LoadManifest() (*Manifest, error) {
+	manifestPath := w.GetManifestPath()
+
+	data, err := w.ReadFile(manifestPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &Manifest{Version: ManifestVersion}, nil
+		}
+		return nil, fmt.Errorf("failed to read manifest: %w", err)
+	}
+
+	var manifest Manifest
+	if err := yaml.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest %s: %w", manifestPath, err)
+	}
+	if manifest.Version > ManifestVersion {
+		return nil, fmt.Errorf("manifest %s has version %d, newer than the supported version %d", manifestPath, manifest.Version, ManifestVersion)
+	}
+	return &manifest, nil
+}
+
+// SaveManifest writes the workspace manifest.
+func (w *Workspace) SaveManifest(manifest *Manifest) error {
+	manifest.Version = ManifestVersion
+	data, err := yaml.Marshal(manifest)
+	if err != nil {
+		return fmt.Errorf("failed to serialize manifest: %w", err)
+	}
+
+	manifestPath := w.GetManifestPath()
+	if err := w.WriteFile(manifestPath, data); err != nil {
+		return fmt.Errorf("failed to write manifest %s: %w", manifestPath, err)
+	}
+	return nil
+}
+
+// manifestMu serializes manifest updates, as concurrent conversions into a
+// workspace record their outputs.
+var manifestMu sync.Mutex
+
+// RecordOutput records the manifest entry of a generated output, replacing
+// the previous entry of its ID. It is safe for concurrent use within a
+// process.
+func (w *Workspace) RecordOutput(entry ManifestEntry) error {
+	manifestMu.Lock()
+	defer manifestMu.Unlock()
+
+	manifest, err := w.LoadManifest()
+	if err != nil {
+		return err
+	}
+	manifest.SetEntry(entry)
+	return w.SaveManifest(manifest)
+}
+
+// StaleReasons returns why the output recorded by entry must be
+// regenerated, comparing it with inputs, the sources, catalogs, template
+// digest and tool version a conversion would use now. A nil entry is an
+// output never generated. Returns nil when the output is up to date.
+func (w *Workspace) StaleReasons(entry *ManifestEntry, inputs ManifestEntry) []string {
+	if entry == nil {
+		return []string{"not generated yet"}
+	}
+
+	var reasons []string
+	if _, err := os.Stat(w.ResolvePath(entry.Output.Path)); err != nil {
+		reasons = append(reasons, fmt.Sprintf("output %s is missing", entry.Output.Path))
+	}
+	return append(reasons, entry.inputChanges(inputs)...)
+}
+
+// inputChanges lists the differences between the recorded inputs of an
+// output and inputs.
+func (e *ManifestEntry) inputChanges(inputs ManifestEntry) []string {
+	var changes []string
+	changes = append(changes, digestChanges("source", e.Sources, inputs.Sources)...)
+	changes = append(changes, digestChanges("catalog", e.Catalogs, inputs.Catalogs)...)
+	if e.TemplateDigest != inputs.TemplateDigest {
+		changes = append(changes, "CEL template library changed")
+	}
+	if e.ToolVersion != inputs.ToolVersion {
+		changes = append(changes, fmt.Sprintf("tool version changed from %s to %s", e.ToolVersion, inputs.ToolVersion))
+	}
+	return changes
+}
+
+// mergeOptions returns the merge options of the recorded orphan mode and
+// merge strategies. Settings that no longer parse are reported as errors.
+func (e *ManifestEntry) mergeOptions() ([]MergeOption, error) {
+	var opts []MergeOption
+	if e.OrphanMode != "" {
+		mode, err := ParseOrphanMode(e.OrphanMode)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, WithOrphanMode(mode))
+	}
+	for _, setting := range e.MergeStrategies {
+		opt, err := ParseMergeStrategyOption(setting)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, opt)
+	}
+	return opts, nil
+}
+
+// digestChanges lists the files of kind added, removed or changed between
+// the recorded and current file digests.
+func digestChanges(kind string, recorded, current []FileDigest) []string {
+	digests := make(map[string]string, len(recorded))
+	for _, file := range recorded {
+		digests[file.Path] = file.Digest
+	}
+
+	var changes []string
+	for _, file := range current {
+		digest, ok := digests[file.Path]
+		switch {
+		case !ok:
+			changes = append(changes, fmt.Sprintf("%s %s added", kind, file.Path))
+		case digest != file.Digest:
+			changes = append(changes, fmt.Sprintf("%s %s changed", kind, file.Path))
+		}
+		delete(digests, file.Path)
+	}
+	for _, path := range sortedKeys(digests) {
+		changes = append(changes, fmt.Sprintf("%s %s removed", kind, path))
+	}
+	return changes
+}
+
+// DigestFile returns the digest of a file, with its path made relative to
+// the workspace when possible.
+func (w *Workspace) DigestFile(path string) (FileDigest, error) {
+	data, err := w.ReadFile(path)
+	if err != nil {
+		return FileDigest{}, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	return FileDigest{Path: w.relativePath(path), Digest: DigestBytes(data)}, nil
+}
+
+// ResolvePath returns the path of a manifest file entry: relative paths
+// are taken from the workspace directory.
+func (w *Workspace) ResolvePath(path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(w.Path, filepath.FromSlash(path))
+}
+
+// GetManifestPath returns the full path of the workspace manifest.
+func (w *Workspace) GetManifestPath() string {
+	return filepath.Join(w.Path, ManifestFile)
+}
+
+// relativePath returns path relative to the workspace, or absolute when no
+// relative path exists, as across Windows volumes.
+func (w *Workspace) relativePath(path string) string {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return path
+	}
+	absWorkspace, err := filepath.Abs(w.Path)
+	if err != nil {
+		return absPath
+	}
+	rel, err := filepath.Rel(absWorkspace, absPath)
+	if err != nil {
+		return absPath
+	}
+	return filepath.ToSlash(rel)
+}
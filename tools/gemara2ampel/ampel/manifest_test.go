@@ -0,0 +1,122 @@
+package ampel
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestWorkspace_Manifest verifies manifest entries are recorded and read back.
+func TestWorkspace_Manifest(t *testing.T) {
+	ws, err := NewWorkspace(t.TempDir())
+	require.NoError(t, err)
+
+	manifest, err := ws.LoadManifest()
+	require.NoError(t, err)
+	assert.Equal(t, ManifestVersion, manifest.Version)
+	assert.Empty(t, manifest.Outputs)
+
+	generatedAt := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	entry := ManifestEntry{
+		ID:             "policy-b",
+		Kind:           ManifestKindPolicy,
+		Output:         FileDigest{Path: "policy-b.json", Digest: DigestBytes([]byte("{}"))},
+		Sources:        []FileDigest{{Path: "../policy.yaml", Digest: DigestBytes([]byte("policy"))}},
+		Catalogs:       []FileDigest{{Path: "../catalog.yaml", Digest: DigestBytes([]byte("catalog"))}},
+		TemplateDigest: TemplateDigest(DefaultCELTemplates),
+		ToolVersion:    "1.0.0",
+		GeneratedAt:    generatedAt,
+	}
+	require.NoError(t, ws.RecordOutput(entry))
+	require.NoError(t, ws.RecordOutput(ManifestEntry{ID: "policy-a", Kind: ManifestKindPolicySet}))
+	assert.FileExists(t, filepath.Join(ws.Path, ManifestFile))
+
+	manifest, err = ws.LoadManifest()
+	require.NoError(t, err)
+	require.Len(t, manifest.Outputs, 2)
+	assert.Equal(t, "policy-a", manifest.Outputs[0].ID)
+	assert.Equal(t, entry, *manifest.Entry("policy-b"))
+	assert.Nil(t, manifest.Entry("missing"))
+
+	// Recording an output again replaces its entry
+	entry.ToolVersion = "1.1.0"
+	require.NoError(t, ws.RecordOutput(entry))
+	manifest, err = ws.LoadManifest()
+	require.NoError(t, err)
+	assert.Len(t, manifest.Outputs, 2)
+	assert.Equal(t, "1.1.0", manifest.Entry("policy-b").ToolVersion)
+
+	// Newer manifest versions are rejected
+	require.NoError(t, os.WriteFile(ws.GetManifestPath(), []byte("version: 99\n"), 0600))
+	_, err = ws.LoadManifest()
+	assert.Error(t, err)
+}
+
+// TestWorkspace_DigestFile verifies file digests use workspace-relative paths.
+func TestWorkspace_DigestFile(t *testing.T) {
+	dir := t.TempDir()
+	ws, err := NewWorkspace(filepath.Join(dir, "policies"))
+	require.NoError(t, err)
+
+	source := filepath.Join(dir, "gemara", "policy.yaml")
+	require.NoError(t, os.MkdirAll(filepath.Dir(source), 0755))
+	require.NoError(t, os.WriteFile(source, []byte("policy"), 0600))
+
+	digest, err := ws.DigestFile(source)
+	require.NoError(t, err)
+	assert.Equal(t, "../gemara/policy.yaml", digest.Path)
+	assert.Equal(t, DigestBytes([]byte("policy")), digest.Digest)
+	assert.Equal(t, filepath.Clean(source), filepath.Clean(ws.ResolvePath(digest.Path)))
+
+	_, err = ws.DigestFile(filepath.Join(dir, "missing.yaml"))
+	assert.Error(t, err)
+}
+
+// TestTemplateDigest verifies the digest covers template names and code.
+func TestTemplateDigest(t *testing.T) {
+	digest := TemplateDigest(map[string]string{"a": "true", "b": "false"})
+	assert.Equal(t, digest, TemplateDigest(map[string]string{"b": "false", "a": "true"}))
+	assert.NotEqual(t, digest, TemplateDigest(map[string]string{"a": "true", "b": "true"}))
+	assert.NotEqual(t, digest, TemplateDigest(map[string]string{"ab": "true", "": "false"}))
+}
+
+// TestWorkspace_StaleReasons verifies changed inputs and missing outputs are reported.
+func TestWorkspace_StaleReasons(t *testing.T) {
+	ws, err := NewWorkspace(t.TempDir())
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(ws.Path, "policy.json"), []byte("{}"), 0600))
+
+	entry := &ManifestEntry{
+		ID:     "policy",
+		Output: FileDigest{Path: "policy.json", Digest: DigestBytes([]byte("{}"))},
+		Sources: []FileDigest{
+			{Path: "../policy.yaml", Digest: "sha256:1"},
+			{Path: "../values.yaml", Digest: "sha256:2"},
+		},
+		Catalogs:       []FileDigest{{Path: "../catalog.yaml", Digest: "sha256:3"}},
+		TemplateDigest: "sha256:4",
+		ToolVersion:    "1.0.0",
+	}
+	inputs := *entry
+	assert.Nil(t, ws.StaleReasons(entry, inputs))
+	assert.Equal(t, []string{"not generated yet"}, ws.StaleReasons(nil, inputs))
+
+	inputs.Sources = []FileDigest{{Path: "../policy.yaml", Digest: "sha256:changed"}}
+	inputs.Catalogs = append(inputs.Catalogs, FileDigest{Path: "../other.yaml", Digest: "sha256:5"})
+	inputs.TemplateDigest = "sha256:changed"
+	inputs.ToolVersion = "1.1.0"
+	assert.Equal(t, []string{
+		"source ../policy.yaml changed",
+		"source ../values.yaml removed",
+		"catalog ../other.yaml added",
+		"CEL template library changed",
+		"tool version changed from 1.0.0 to 1.1.0",
+	}, ws.StaleReasons(entry, inputs))
+
+	require.NoError(t, os.Remove(filepath.Join(ws.Path, "policy.json")))
+	assert.Equal(t, []string{"output policy.json is missing"}, ws.StaleReasons(entry, *entry))
+}
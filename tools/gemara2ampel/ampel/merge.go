@@ -1,37 +1,129 @@
 package ampel
 
-import "fmt"
+import (
+	"fmt"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+)
 
 // MergeStats contains statistics about a policy merge operation.
 type MergeStats struct {
 	TenetsPreserved int // Existing tenets with preserved code/outputs
+	TenetsUpdated   int // Unedited tenets updated with the generated code/outputs
 	TenetsAdded     int // New tenets from Gemara
-	TenetsRemoved   int // Orphaned tenets deleted
+	TenetsRemoved   int // Orphaned tenets deleted or archived
+	TenetsKept      int // Orphaned tenets kept as manual-only or locked
+
+	// Orphans lists the orphaned tenets removed from the merged policy, as
+	// in the existing policy, to be archived in OrphanArchive mode
+	Orphans []*Tenet
+
+	// Conflicts lists the fields edited both manually and by the generator
+	// since the base. The existing values are kept until resolved.
+	Conflicts []MergeConflict
+
+	// Renames lists the existing tenets merged into a generated tenet with
+	// another ID, to be reviewed. Renamed tenets are counted as preserved,
+	// updated or conflicting rather than removed and added.
+	Renames []TenetRename
+
+	// LockedChanges lists the generator changes to locked tenets and fields
+	// that were not applied (see WithLocks)
+	LockedChanges []LockedChange
+
+	ContextKeysAdded       []string // Context keys new in the generated policy
+	ContextKeysRemoved     []string // Context keys of the existing policy no longer generated
+	ContextValuesPreserved int      // Context values set in the workspace that were kept
+
+	// Warnings describes context values set in the workspace that are no
+	// longer allowed and were reset to the generated value, and policy
+	// fields edited on both sides, which keep the workspace value
+	Warnings []string
 }
 
 // MergePolicy merges a generated policy with an existing policy, preserving manual edits
 // to CEL code and outputs while updating metadata and other fields from the generated policy.
 //
 // The merge algorithm:
-// 1. Updates all policy-level fields (id, meta) from generated
+// 1. Merges the policy-level fields following their merge strategy: id and
+// meta from generated, manually added identities, chain links, predicates
+// and transformers kept alongside the generated ones, and context keys from
+// generated with the values set in existing kept while still allowed
 // 2. For each tenet in the generated policy:
-//   - If a matching tenet exists in the existing policy (by Id), preserve its code and outputs
-//   - If no match exists, add the new tenet from generated
+//   - If a matching tenet exists in the existing policy (by Id), merge each
+//     field following its merge strategy, preserving code, outputs, error and
+//     assessment and adding manual predicate types to the generated ones.
+//     Locked fields keep their existing value
+//   - If no match exists, but an unmatched existing tenet is similar enough
+//     (see WithRenameThreshold), merge that tenet under the new ID
+//   - Otherwise add the new tenet from generated
 //
-// 3. Remove any tenets in existing that are not in generated (orphaned)
+// 3. Handle the tenets in existing that are not in generated (orphaned)
+// following the orphan mode: remove them, the default, keep them marked as
+// manual-only, or remove them and list them for archiving. Tenets already
+// marked as manual-only and locked tenets are always kept
 // 4. Validate the merged policy
 //
+// Field strategies default to DefaultTenetMergeStrategies and
+// DefaultPolicyMergeStrategies and are changed with WithTenetMergeStrategy
+// and WithPolicyMergeStrategy. The orphan mode is set with WithOrphanMode
+// and locks with WithLocks.
+//
 // Returns the merged policy, merge statistics, and any validation error.
-func MergePolicy(existing, generated *Policy) (*Policy, MergeStats, error) {
+func MergePolicy(existing, generated *Policy, opts ...MergeOption) (*Policy, MergeStats, error) {
+	return MergePolicyWithBase(nil, existing, generated, opts...)
+}
+
+// MergePolicyWithBase performs a three-way merge of a generated policy into
+// an existing policy, using base, the policy generated when existing was
+// last written, to tell manual edits from generator changes. For each tenet
+// field merged with the MergePreferManual strategy, such as code and outputs:
+//   - If it was not edited manually (existing equals base), the generated
+//     value is taken, so Gemara parameter and template changes reach the
+//     workspace
+//   - If only the existing value changed, the manual edit is kept
+//   - If both changed differently, the manual edit is kept and a
+//     MergeConflict is listed in MergeStats.Conflicts
+//
+// Union fields of a tenet not edited manually take the generated value, and
+// so do context values still equal to their base value.
+// Tenets missing from base, and every tenet when base is nil, are merged as
+// by MergePolicy, preserving the existing code and outputs. Use AdvanceBase
+// to compute the base to record for the next merge.
+func MergePolicyWithBase(base, existing, generated *Policy, opts ...MergeOption) (*Policy, MergeStats, error) {
 	stats := MergeStats{}
 
+	options := &MergeOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
+	strategies, err := resolveMergeStrategies(options)
+	if err != nil {
+		return nil, stats, err
+	}
+	if options.OrphanMode != "" {
+		if _, err := ParseOrphanMode(string(options.OrphanMode)); err != nil {
+			return nil, stats, err
+		}
+	}
+	locks, err := resolveLocks(options.Locks, generated.Id)
+	if err != nil {
+		return nil, stats, err
+	}
+
 	// Start with the generated policy as the base (updates all metadata)
-	merged := &Policy{
-		Id:      generated.Id,
-		Meta:    generated.Meta,
-		Context: generated.Context,
-		Tenets:  make([]*Tenet, 0, len(generated.Tenets)),
+	merged := proto.Clone(generated).(*Policy)
+	var baseMsg proto.Message
+	if base != nil {
+		baseMsg = base
+	}
+	for _, field := range mergeFields(baseMsg, existing, merged, strategies.policy) {
+		stats.Warnings = append(stats.Warnings, editedOnBothSides("policy", field))
 	}
+	merged.Context = mergeContext(base.GetContext(), existing.GetContext(), generated.GetContext(), merged.GetContext(),
+		strategyOf(strategies.policy, "context"), options.ContextAcceptedValues, &stats)
+	merged.Tenets = make([]*Tenet, 0, len(generated.Tenets))
 
 	// Build map of existing tenets by Id for fast lookup
 	existingTenets := make(map[string]*Tenet)
@@ -39,13 +131,46 @@ func MergePolicy(existing, generated *Policy) (*Policy, MergeStats, error) {
 		existingTenets[tenet.Id] = tenet
 	}
 
+	baseTenets := tenetsByID(base)
+	generatedTenetIDs := make(map[string]bool)
+	for _, tenet := range generated.Tenets {
+		generatedTenetIDs[tenet.Id] = true
+	}
+
+	// Match tenets that changed ID by similarity, locked tenets keep theirs.
+	// With a base, only tenets generated before can have been renamed.
+	renamedFrom := make(map[string]string)
+	renamed := make(map[string]bool)
+	keepsID := func(tenet *Tenet) bool {
+		return IsManualOnly(tenet) || locks.locked(tenet) || (base != nil && baseTenets[tenet.Id] == nil)
+	}
+	stats.Renames = detectRenames(unmatchedTenets(existing.Tenets, generatedTenetIDs, keepsID),
+		unmatchedTenets(generated.Tenets, tenetIDs(existing.Tenets), nil), baseTenets, renameThreshold(options))
+	for _, rename := range stats.Renames {
+		renamedFrom[rename.To] = rename.From
+		renamed[rename.From] = true
+	}
+
 	// Process each tenet in the generated policy
 	for _, generatedTenet := range generated.Tenets {
-		if existingTenet, found := existingTenets[generatedTenet.Id]; found {
-			// Tenet exists - merge it (preserve code and outputs)
-			mergedTenet := mergeTenet(existingTenet, generatedTenet)
+		existingID := generatedTenet.Id
+		if from, ok := renamedFrom[generatedTenet.Id]; ok {
+			existingID = from
+		}
+		if existingTenet, found := existingTenets[existingID]; found {
+			// Tenet exists - merge it against its base
+			mergedTenet, conflicts := mergeTenetWithBase(baseTenets[existingID], existingTenet, generatedTenet,
+				locks.strategies(existingID, strategies.tenet))
 			merged.Tenets = append(merged.Tenets, mergedTenet)
-			stats.TenetsPreserved++
+			stats.LockedChanges = append(stats.LockedChanges, locks.changes(baseTenets[existingID], existingTenet, generatedTenet)...)
+			switch {
+			case len(conflicts) > 0:
+				stats.Conflicts = append(stats.Conflicts, conflicts...)
+			case mergedTenet.Code != existingTenet.Code || !outputsEqual(mergedTenet.Outputs, existingTenet.Outputs):
+				stats.TenetsUpdated++
+			default:
+				stats.TenetsPreserved++
+			}
 		} else {
 			// New tenet - add it from generated
 			merged.Tenets = append(merged.Tenets, generatedTenet)
@@ -53,15 +178,26 @@ func MergePolicy(existing, generated *Policy) (*Policy, MergeStats, error) {
 		}
 	}
 
-	// Calculate removed tenets (in existing but not in generated)
-	generatedTenetIDs := make(map[string]bool)
-	for _, tenet := range generated.Tenets {
-		generatedTenetIDs[tenet.Id] = true
-	}
-	for id := range existingTenets {
-		if !generatedTenetIDs[id] {
-			stats.TenetsRemoved++
+	// Handle orphaned tenets (in existing but not in generated)
+	for _, tenet := range existing.Tenets {
+		if generatedTenetIDs[tenet.Id] || renamed[tenet.Id] {
+			continue
+		}
+		if locks.locked(tenet) {
+			merged.Tenets = append(merged.Tenets, tenet)
+			stats.TenetsKept++
+			if _, generatedBefore := baseTenets[tenet.Id]; generatedBefore {
+				stats.LockedChanges = append(stats.LockedChanges, LockedChange{TenetID: tenet.Id})
+			}
+			continue
+		}
+		if options.OrphanMode == OrphanKeep || IsManualOnly(tenet) {
+			merged.Tenets = append(merged.Tenets, markManualOnly(tenet))
+			stats.TenetsKept++
+			continue
 		}
+		stats.TenetsRemoved++
+		stats.Orphans = append(stats.Orphans, tenet)
 	}
 
 	// Validate the merged policy
@@ -72,14 +208,189 @@ func MergePolicy(existing, generated *Policy) (*Policy, MergeStats, error) {
 	return merged, stats, nil
 }
 
-// mergeTenet merges a single tenet, preserving code and outputs from existing
-// while updating other fields from generated.
-func mergeTenet(existing, generated *Tenet) *Tenet {
-	return &Tenet{
-		Id:      generated.Id,      // Use generated (should be same)
-		Title:   generated.Title,   // Update title from generated
-		Runtime: generated.Runtime, // Update runtime from generated
-		Code:    existing.Code,     // PRESERVE manual CEL edits
-		Outputs: existing.Outputs,  // PRESERVE manual outputs (parameters, etc.)
+// editedOnBothSides describes a policy or PolicySet field that was edited in
+// the workspace and changed by the generator.
+func editedOnBothSides(kind, field string) string {
+	return fmt.Sprintf("%s %s: edited in the workspace and changed by the generator, the workspace value was kept", kind, field)
+}
+
+// mergeContext merges an existing context into merged, the context after
+// the field merge, per key and returns it. Unless the context strategy is
+// MergePreferManual, keys generated again take the generated entry but keep
+// a value set in the workspace, one that differs from the base, while it
+// still matches the type and accepted values of the entry. Values no longer
+// allowed are reset with a warning. With the MergeUnion strategy and a base,
+// keys the generator no longer produces are removed unless edited in the
+// workspace, while keys added in the workspace are kept.
+func mergeContext(base, existing, generated, merged map[string]*ContextVal, strategy MergeStrategy, accepted map[string][]string, stats *MergeStats) map[string]*ContextVal {
+	if strategy != MergePreferManual {
+		for _, key := range sortedKeys(generated) {
+			existingVal, ok := existing[key]
+			if !ok {
+				continue
+			}
+			entry := proto.Clone(generated[key]).(*ContextVal)
+			if merged == nil {
+				merged = make(map[string]*ContextVal)
+			}
+			merged[key] = entry
+
+			value := existingVal.GetValue()
+			if value == nil {
+				continue
+			}
+			if baseVal, ok := base[key]; ok && proto.Equal(value, baseVal.GetValue()) {
+				// Not set in the workspace: keep the generated value
+				continue
+			}
+			if proto.Equal(value, entry.GetValue()) {
+				continue
+			}
+			if err := checkContextValue(entry.Type, accepted[key], value.AsInterface()); err != nil {
+				stats.Warnings = append(stats.Warnings, fmt.Sprintf(
+					"context %s: value %s set in the workspace is no longer allowed (%v), reset to the generated value", key, contextValueText(value), err))
+				continue
+			}
+			entry.Value = proto.Clone(value).(*structpb.Value)
+			stats.ContextValuesPreserved++
+		}
+	}
+
+	if strategy == MergeUnion && base != nil {
+		for _, key := range sortedKeys(merged) {
+			if _, ok := generated[key]; ok {
+				continue
+			}
+			if baseVal, ok := base[key]; ok && proto.Equal(existing[key], baseVal) {
+				delete(merged, key)
+			}
+		}
+	}
+
+	for _, key := range sortedKeys(merged) {
+		if _, ok := existing[key]; !ok {
+			stats.ContextKeysAdded = append(stats.ContextKeysAdded, key)
+		}
+	}
+	for _, key := range sortedKeys(existing) {
+		if _, ok := merged[key]; !ok {
+			stats.ContextKeysRemoved = append(stats.ContextKeysRemoved, key)
+		}
+	}
+	return merged
+}
+
+// contextValueText formats a context value as JSON for messages.
+func contextValueText(value *structpb.Value) string {
+	data, err := value.MarshalJSON()
+	if err != nil {
+		return value.String()
+	}
+	return string(data)
+}
+
+// mergeTenetWithBase merges a single tenet field by field following
+// strategies, three ways when a base tenet is recorded. Returns the fields
+// where a manual edit conflicts with a generator change.
+func mergeTenetWithBase(base, existing, generated *Tenet, strategies []fieldStrategy) (*Tenet, []MergeConflict) {
+	merged := proto.Clone(generated).(*Tenet)
+	existing = proto.Clone(existing).(*Tenet)
+	unmarkManualOnly(existing)
+
+	var baseMsg proto.Message
+	if base != nil {
+		baseMsg = base
+	}
+
+	var conflicts []MergeConflict
+	for _, field := range mergeFields(baseMsg, existing, merged, strategies) {
+		conflicts = append(conflicts, newMergeConflict(generated.Id, field, base, existing, generated))
+	}
+	return merged, conflicts
+}
+
+// outputsEqual reports whether two tenet output maps are equal.
+func outputsEqual(a, b map[string]*Output) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for key, output := range a {
+		other, ok := b[key]
+		if !ok || !proto.Equal(output, other) {
+			return false
+		}
+	}
+	return true
+}
+
+// unmatchedTenets returns the tenets whose ID is not in ids, leaving out
+// the ones skip, when set, reports.
+func unmatchedTenets(tenets []*Tenet, ids map[string]bool, skip func(*Tenet) bool) []*Tenet {
+	var unmatched []*Tenet
+	for _, tenet := range tenets {
+		if !ids[tenet.Id] && (skip == nil || !skip(tenet)) {
+			unmatched = append(unmatched, tenet)
+		}
+	}
+	return unmatched
+}
+
+// tenetIDs returns the set of IDs of tenets.
+func tenetIDs(tenets []*Tenet) map[string]bool {
+	ids := make(map[string]bool, len(tenets))
+	for _, tenet := range tenets {
+		ids[tenet.Id] = true
+	}
+	return ids
+}
+
+// renameThreshold returns the rename detection threshold of a merge.
+func renameThreshold(options *MergeOptions) float64 {
+	if options.RenameThreshold == 0 {
+		return DefaultRenameThreshold
+	}
+	return options.RenameThreshold
+}
+
+// tenetsByID indexes the tenets of a policy, which may be nil, by ID.
+func tenetsByID(policy *Policy) map[string]*Tenet {
+	tenets := make(map[string]*Tenet)
+	if policy == nil {
+		return tenets
+	}
+	for _, tenet := range policy.Tenets {
+		tenets[tenet.Id] = tenet
+	}
+	return tenets
+}
+
+// AdvanceBase returns the base to record after merging generated with
+// MergePolicyWithBase: the generated policy, except that conflicting tenets
+// keep their previous base so the conflict is reported again on the next
+// merge until it is resolved with ResolveConflict.
+//
+// Conflicting renamed tenets keep the previous base of their old ID.
+func AdvanceBase(base, generated *Policy, stats MergeStats) *Policy {
+	next := proto.Clone(generated).(*Policy)
+	baseTenets := tenetsByID(base)
+	renamedFrom := make(map[string]string, len(stats.Renames))
+	for _, rename := range stats.Renames {
+		renamedFrom[rename.To] = rename.From
+	}
+	for _, conflict := range stats.Conflicts {
+		baseTenet, ok := baseTenets[conflict.TenetID]
+		if from, renamed := renamedFrom[conflict.TenetID]; renamed {
+			baseTenet, ok = baseTenets[from]
+		}
+		if !ok {
+			continue
+		}
+		for i, tenet := range next.Tenets {
+			if tenet.Id == conflict.TenetID {
+				next.Tenets[i] = proto.Clone(baseTenet).(*Tenet)
+				next.Tenets[i].Id = conflict.TenetID
+			}
+		}
 	}
+	return next
 }
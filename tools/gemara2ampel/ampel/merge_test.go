@@ -5,6 +5,7 @@ import (
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/structpb"
 )
 
 func createMergeTestPolicy(id string, version int64, description string) *Policy {
@@ -19,6 +20,44 @@ func createMergeTestPolicy(id string, version int64, description string) *Policy
 	}
 }
 
+// mergeTestOption sets a field of a policy built by newMergeTestPolicy.
+type mergeTestOption func(*Policy)
+
+// newMergeTestPolicy returns version 1 of "test-policy" with the options
+// applied, so that each merge test sets only the fields it checks.
+func newMergeTestPolicy(opts ...mergeTestOption) *Policy {
+	policy := createMergeTestPolicy("test-policy", 1, "Description")
+	for _, opt := range opts {
+		opt(policy)
+	}
+	return policy
+}
+
+// withPolicyID sets the policy ID.
+func withPolicyID(id string) mergeTestOption {
+	return func(policy *Policy) { policy.Id = id }
+}
+
+// withVersion sets the policy version.
+func withVersion(version int64) mergeTestOption {
+	return func(policy *Policy) { policy.Meta.Version = version }
+}
+
+// withDescription sets the policy description.
+func withDescription(description string) mergeTestOption {
+	return func(policy *Policy) { policy.Meta.Description = description }
+}
+
+// withTenets sets the policy tenets.
+func withTenets(tenets ...*Tenet) mergeTestOption {
+	return func(policy *Policy) { policy.Tenets = tenets }
+}
+
+// withContext sets the policy context.
+func withContext(context map[string]*ContextVal) mergeTestOption {
+	return func(policy *Policy) { policy.Context = context }
+}
+
 // TestMergePolicy_PreservesCELCode verifies that CEL code from existing policy is preserved.
 func TestMergePolicy_PreservesCELCode(t *testing.T) {
 	existing := createMergeTestPolicy("test-policy", 1, "Original description")
@@ -364,3 +403,220 @@ func TestMergePolicy_ComplexScenario(t *testing.T) {
 	assert.Equal(t, 1, stats.TenetsAdded)     // tenet-4
 	assert.Equal(t, 1, stats.TenetsRemoved)   // tenet-2
 }
+
+// TestMergePolicyWithBase verifies the three-way merge outcome for each combination of edits.
+func TestMergePolicyWithBase(t *testing.T) {
+	tests := []struct {
+		name          string
+		base          string
+		existing      string
+		generated     string
+		wantCode      string
+		wantPreserved int
+		wantUpdated   int
+		wantConflict  bool
+	}{
+		{"unchanged", "code_v1", "code_v1", "code_v1", "code_v1", 1, 0, false},
+		{"generator change", "code_v1", "code_v1", "code_v2", "code_v2", 0, 1, false},
+		{"manual edit", "code_v1", "manual", "code_v1", "manual", 1, 0, false},
+		{"same edit on both sides", "code_v1", "code_v2", "code_v2", "code_v2", 1, 0, false},
+		{"conflicting edits", "code_v1", "manual", "code_v2", "manual", 0, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			base := newMergeTestPolicy(withTenets(&Tenet{Id: "tenet-1", Code: tt.base}))
+			existing := newMergeTestPolicy(withTenets(&Tenet{Id: "tenet-1", Code: tt.existing}))
+			generated := newMergeTestPolicy(withTenets(&Tenet{Id: "tenet-1", Code: tt.generated}))
+
+			merged, stats, err := MergePolicyWithBase(base, existing, generated)
+			require.NoError(t, err)
+			require.Len(t, merged.Tenets, 1)
+			assert.Equal(t, tt.wantCode, merged.Tenets[0].Code)
+			assert.Equal(t, tt.wantPreserved, stats.TenetsPreserved)
+			assert.Equal(t, tt.wantUpdated, stats.TenetsUpdated)
+			if tt.wantConflict {
+				assert.Equal(t, []MergeConflict{{
+					TenetID: "tenet-1",
+					Field:   ConflictFieldCode,
+					Base:    tt.base,
+					Ours:    tt.existing,
+					Theirs:  tt.generated,
+				}}, stats.Conflicts)
+			} else {
+				assert.Empty(t, stats.Conflicts)
+			}
+		})
+	}
+}
+
+// TestMergePolicyWithBase_Outputs verifies outputs are merged separately from code.
+func TestMergePolicyWithBase_Outputs(t *testing.T) {
+	base := newMergeTestPolicy(withTenets(&Tenet{Id: "tenet-1", Code: "code_v1"}))
+	existing := newMergeTestPolicy(withTenets(&Tenet{Id: "tenet-1", Code: "manual"}))
+	generated := newMergeTestPolicy(withTenets(&Tenet{Id: "tenet-1", Code: "code_v1"}))
+	base.Tenets[0].Outputs = map[string]*Output{"key": {Code: "context.key"}}
+	existing.Tenets[0].Outputs = map[string]*Output{"key": {Code: "context.key"}}
+	generated.Tenets[0].Outputs = map[string]*Output{"key": {Code: "context.renamed"}}
+
+	merged, stats, err := MergePolicyWithBase(base, existing, generated)
+	require.NoError(t, err)
+	assert.Equal(t, "manual", merged.Tenets[0].Code)
+	assert.Equal(t, "context.renamed", merged.Tenets[0].Outputs["key"].Code)
+	assert.Equal(t, 1, stats.TenetsUpdated)
+	assert.Empty(t, stats.Conflicts)
+}
+
+// TestMergePolicyWithBase_NoBase verifies tenets without a base keep their existing code.
+func TestMergePolicyWithBase_NoBase(t *testing.T) {
+	existing := newMergeTestPolicy(withTenets(&Tenet{Id: "tenet-1", Code: "manual"}))
+	generated := newMergeTestPolicy(withTenets(&Tenet{Id: "tenet-1", Code: "code_v2"}))
+
+	merged, stats, err := MergePolicyWithBase(nil, existing, generated)
+	require.NoError(t, err)
+	assert.Equal(t, "manual", merged.Tenets[0].Code)
+	assert.Equal(t, 1, stats.TenetsPreserved)
+
+	// A base without the tenet behaves the same
+	base := newMergeTestPolicy()
+	merged, _, err = MergePolicyWithBase(base, existing, generated)
+	require.NoError(t, err)
+	assert.Equal(t, "manual", merged.Tenets[0].Code)
+}
+
+// TestAdvanceBase verifies conflicting tenets keep their previous base.
+func TestAdvanceBase(t *testing.T) {
+	base := newMergeTestPolicy(withTenets(&Tenet{Id: "tenet-1", Code: "code_v1"}))
+	existing := newMergeTestPolicy(withTenets(&Tenet{Id: "tenet-1", Code: "manual"}))
+	generated := newMergeTestPolicy(withTenets(&Tenet{Id: "tenet-1", Code: "code_v2"}))
+	generated.Tenets = append(generated.Tenets, &Tenet{Id: "tenet-2", Code: "code_new"})
+
+	_, stats, err := MergePolicyWithBase(base, existing, generated)
+	require.NoError(t, err)
+	require.Len(t, stats.Conflicts, 1)
+
+	next := AdvanceBase(base, generated, stats)
+	require.Len(t, next.Tenets, 2)
+	assert.Equal(t, "code_v1", next.Tenets[0].Code)
+	assert.Equal(t, "code_new", next.Tenets[1].Code)
+
+	// The conflict is reported again until the tenet is reconciled
+	_, stats, err = MergePolicyWithBase(next, existing, generated)
+	require.NoError(t, err)
+	require.Len(t, stats.Conflicts, 1)
+	assert.Equal(t, "tenet-1", stats.Conflicts[0].TenetID)
+
+	// Without conflicts the base is the generated policy
+	next = AdvanceBase(base, generated, MergeStats{})
+	assert.Equal(t, "code_v2", next.Tenets[0].Code)
+}
+
+// TestMergePolicy_PreservesContextValues verifies context values set in the
+// workspace are kept while still allowed and reset otherwise.
+func TestMergePolicy_PreservesContextValues(t *testing.T) {
+	base := newMergeTestPolicy(withContext(map[string]*ContextVal{
+		"retired": {Type: "string", Value: structpb.NewStringValue("x")},
+	}))
+	existing := newMergeTestPolicy(withContext(map[string]*ContextVal{
+		"max-critical": {Type: "int", Value: structpb.NewNumberValue(5)},
+		"builder-id":   {Type: "string", Value: structpb.NewStringValue("https://gitlab.com/runner")},
+		"scanner":      {Type: "string", Value: structpb.NewStringValue("grype")},
+		"retired":      {Type: "string", Value: structpb.NewStringValue("x")},
+	}))
+	generated := newMergeTestPolicy(withVersion(2), withContext(map[string]*ContextVal{
+		"max-critical": {Type: "int", Value: structpb.NewNumberValue(0), Default: structpb.NewNumberValue(0)},
+		"builder-id":   {Type: "string", Value: structpb.NewStringValue("https://github.com/actions/runner")},
+		"scanner":      {Type: "string", Value: structpb.NewStringValue("trivy")},
+		"new-key":      {Type: "bool", Value: structpb.NewBoolValue(true)},
+	}))
+
+	merged, stats, err := MergePolicyWithBase(base, existing, generated, WithContextAcceptedValues(map[string][]string{
+		"builder-id": {"https://github.com/actions/runner", "https://gitlab.com/runner"},
+		"scanner":    {"trivy", "snyk"},
+	}))
+	require.NoError(t, err)
+
+	// Allowed values are kept, entries otherwise follow the generator
+	assert.Equal(t, float64(5), merged.Context["max-critical"].GetValue().GetNumberValue())
+	assert.Equal(t, float64(0), merged.Context["max-critical"].GetDefault().GetNumberValue())
+	assert.Equal(t, "https://gitlab.com/runner", merged.Context["builder-id"].GetValue().GetStringValue())
+	assert.Equal(t, 2, stats.ContextValuesPreserved)
+
+	// A value no longer accepted is reset with a warning
+	assert.Equal(t, "trivy", merged.Context["scanner"].GetValue().GetStringValue())
+	require.Len(t, stats.Warnings, 1)
+	assert.Contains(t, stats.Warnings[0], "context scanner")
+	assert.Contains(t, stats.Warnings[0], `"grype"`)
+
+	assert.Equal(t, []string{"builder-id", "max-critical", "new-key", "scanner"}, sortedKeys(merged.Context))
+	assert.Equal(t, []string{"new-key"}, stats.ContextKeysAdded)
+	assert.Equal(t, []string{"retired"}, stats.ContextKeysRemoved)
+
+	// The existing policy is not modified
+	assert.Equal(t, "grype", existing.Context["scanner"].GetValue().GetStringValue())
+}
+
+// TestMergePolicy_ContextValueType verifies values of another type are reset.
+func TestMergePolicy_ContextValueType(t *testing.T) {
+	existing := newMergeTestPolicy(withContext(map[string]*ContextVal{
+		"max-critical": {Type: "int", Value: structpb.NewStringValue("five")},
+		"scanner":      {Type: "string", Value: structpb.NewStringValue("grype")},
+	}))
+	generated := newMergeTestPolicy(withContext(map[string]*ContextVal{
+		"max-critical": {Type: "int", Value: structpb.NewNumberValue(0)},
+		"scanner":      {Type: "string", Value: structpb.NewStringValue("trivy")},
+	}))
+
+	merged, stats, err := MergePolicy(existing, generated)
+	require.NoError(t, err)
+	assert.Equal(t, float64(0), merged.Context["max-critical"].GetValue().GetNumberValue())
+	require.Len(t, stats.Warnings, 1)
+	assert.Contains(t, stats.Warnings[0], "context max-critical")
+
+	// Without accepted values any value of the right type is kept
+	assert.Equal(t, "grype", merged.Context["scanner"].GetValue().GetStringValue())
+}
+
+// TestMergePolicyWithBase_ContextValues verifies values not set in the
+// workspace follow the generator.
+func TestMergePolicyWithBase_ContextValues(t *testing.T) {
+	base := newMergeTestPolicy(withContext(map[string]*ContextVal{
+		"builder-id": {Type: "string", Value: structpb.NewStringValue("https://gitlab.com/runner")},
+		"scanner":    {Type: "string", Value: structpb.NewStringValue("trivy")},
+	}))
+	existing := newMergeTestPolicy(withContext(map[string]*ContextVal{
+		"builder-id": {Type: "string", Value: structpb.NewStringValue("https://gitlab.com/runner")},
+		"scanner":    {Type: "string", Value: structpb.NewStringValue("grype")},
+	}))
+	generated := newMergeTestPolicy(withContext(map[string]*ContextVal{
+		"builder-id": {Type: "string", Value: structpb.NewStringValue("https://github.com/actions/runner")},
+		"scanner":    {Type: "string", Value: structpb.NewStringValue("trivy")},
+	}))
+
+	merged, stats, err := MergePolicyWithBase(base, existing, generated)
+	require.NoError(t, err)
+
+	// builder-id still has its generated value, so the new one is taken
+	assert.Equal(t, "https://github.com/actions/runner", merged.Context["builder-id"].GetValue().GetStringValue())
+	assert.Equal(t, "grype", merged.Context["scanner"].GetValue().GetStringValue())
+	assert.Equal(t, 1, stats.ContextValuesPreserved)
+	assert.Empty(t, stats.Warnings)
+}
+
+// TestMergePolicy_ContextManualStrategy verifies the manual strategy keeps the existing context.
+func TestMergePolicy_ContextManualStrategy(t *testing.T) {
+	existing := newMergeTestPolicy(withContext(map[string]*ContextVal{
+		"scanner": {Type: "string", Value: structpb.NewStringValue("grype")},
+	}))
+	generated := newMergeTestPolicy(withContext(map[string]*ContextVal{
+		"scanner": {Type: "string", Value: structpb.NewStringValue("trivy")},
+		"new-key": {Type: "bool", Value: structpb.NewBoolValue(true)},
+	}))
+
+	merged, stats, err := MergePolicy(existing, generated, WithPolicyMergeStrategy("context", MergePreferManual))
+	require.NoError(t, err)
+	assert.Equal(t, "grype", merged.Context["scanner"].GetValue().GetStringValue())
+	assert.Equal(t, []string{"scanner"}, sortedKeys(merged.Context))
+	assert.Empty(t, stats.ContextKeysAdded)
+	assert.Empty(t, stats.ContextKeysRemoved)
+}
@@ -0,0 +1,238 @@
+package ampel
+
+import (
+	"fmt"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// PolicySetMergeStats contains statistics about a PolicySet merge operation.
+type PolicySetMergeStats struct {
+	// Policies holds the merge statistics of each merged member policy, by ID
+	Policies map[string]MergeStats
+
+	PoliciesAdded     []string // Member policies new in the generated set
+	PoliciesRemoved   []string // Generated member policies no longer generated
+	PoliciesKept      []string // Hand-added member policies kept
+	ReferencesUpdated []string // External policy references with a new location
+
+	ContextKeysAdded       []string // Common context keys new in the generated set
+	ContextKeysRemoved     []string // Common context keys no longer generated
+	ContextValuesPreserved int      // Common context values set in the workspace that were kept
+
+	// Warnings describes common context values set in the workspace that
+	// are no longer allowed and were reset to the generated value
+	Warnings []string
+}
+
+// Conflicts returns the merge conflicts of every member policy, with the
+// member policy ID set.
+func (s PolicySetMergeStats) Conflicts() []MergeConflict {
+	var conflicts []MergeConflict
+	for _, id := range sortedKeys(s.Policies) {
+		conflicts = append(conflicts, s.Policies[id].Conflicts...)
+	}
+	return conflicts
+}
+
+// LockedChanges returns the generator changes to locked content of every
+// member policy, with the member policy ID set.
+func (s PolicySetMergeStats) LockedChanges() []LockedChange {
+	var changes []LockedChange
+	for _, id := range sortedKeys(s.Policies) {
+		changes = append(changes, s.Policies[id].LockedChanges...)
+	}
+	return changes
+}
+
+// MergePolicySet merges a generated PolicySet with an existing one, member
+// policy by member policy, as MergePolicy does for single policies.
+//
+// The merge algorithm:
+// 1. Merges the PolicySet-level fields following their merge strategy:
+// meta from generated, manual common identities, references and context
+// entries, chain links and groups kept alongside the generated ones, and
+// common context values kept while still allowed
+// 2. For each member policy in the generated set:
+//   - If it references an external policy, the existing reference keeps its
+//     manually added digests, identity and version while the location is
+//     unchanged
+//   - If an inline policy with the same ID exists, the two are merged with
+//     MergePolicyWithBase, against the member of base
+//   - Otherwise the generated member policy is added
+//
+// 3. Keep existing member policies missing from the generated set, unless
+// base shows they were generated before: hand-added policies are kept, the
+// ones no longer generated are removed. Without a base every existing
+// member policy is kept
+// 4. Validate the merged PolicySet
+//
+// Field strategies default to DefaultPolicySetMergeStrategies and are
+// changed with WithPolicySetMergeStrategy. Locks naming a member policy
+// apply to its tenets only. Member context values are checked
+// against the accepted values set with WithMemberContextAcceptedValues.
+func MergePolicySet(existing, generated *PolicySet, opts ...MergeOption) (*PolicySet, PolicySetMergeStats, error) {
+	return MergePolicySetWithBase(nil, existing, generated, opts...)
+}
+
+// MergePolicySetWithBase performs a three-way merge of a generated PolicySet
+// into an existing one, using base, the PolicySet generated when existing
+// was last written, for the member policies as MergePolicyWithBase does.
+// Use AdvancePolicySetBase to compute the base to record for the next merge.
+func MergePolicySetWithBase(base, existing, generated *PolicySet, opts ...MergeOption) (*PolicySet, PolicySetMergeStats, error) {
+	stats := PolicySetMergeStats{Policies: make(map[string]MergeStats)}
+
+	options := &MergeOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
+	strategies, err := resolveMergeStrategies(options)
+	if err != nil {
+		return nil, stats, err
+	}
+
+	// Start with the generated PolicySet (updates all metadata)
+	merged := proto.Clone(generated).(*PolicySet)
+	var baseMsg proto.Message
+	if base != nil {
+		baseMsg = base
+	}
+	var fieldWarnings []string
+	for _, field := range mergeFields(baseMsg, existing, merged, strategies.policySet) {
+		fieldWarnings = append(fieldWarnings, editedOnBothSides("policyset", field))
+	}
+
+	commonStats := MergeStats{}
+	commonContext := mergeContext(base.GetCommon().GetContext(), existing.GetCommon().GetContext(), generated.GetCommon().GetContext(),
+		merged.GetCommon().GetContext(), strategyOf(strategies.policySet, "common"), commonAcceptedValues(options), &commonStats)
+	if len(commonContext) > 0 {
+		if merged.Common == nil {
+			merged.Common = &PolicySetCommon{}
+		}
+		merged.Common.Context = commonContext
+	}
+	stats.ContextKeysAdded = commonStats.ContextKeysAdded
+	stats.ContextKeysRemoved = commonStats.ContextKeysRemoved
+	stats.ContextValuesPreserved = commonStats.ContextValuesPreserved
+	stats.Warnings = append(fieldWarnings, commonStats.Warnings...)
+
+	existingPolicies := policiesByID(existing)
+	basePolicies := policiesByID(base)
+	generatedPolicies := policiesByID(generated)
+
+	merged.Policies = make([]*Policy, 0, len(generated.Policies))
+	for _, generatedPolicy := range generated.Policies {
+		existingPolicy, found := existingPolicies[generatedPolicy.Id]
+		switch {
+		case !found:
+			merged.Policies = append(merged.Policies, generatedPolicy)
+			stats.PoliciesAdded = append(stats.PoliciesAdded, generatedPolicy.Id)
+		case isPolicyReference(generatedPolicy) || isPolicyReference(existingPolicy):
+			mergedPolicy, updated := mergePolicyReference(existingPolicy, generatedPolicy)
+			merged.Policies = append(merged.Policies, mergedPolicy)
+			if updated {
+				stats.ReferencesUpdated = append(stats.ReferencesUpdated, generatedPolicy.Id)
+			}
+		default:
+			memberOpts := opts
+			if accepted, ok := options.MemberContextAcceptedValues[generatedPolicy.Id]; ok {
+				memberOpts = append(memberOpts[:len(memberOpts):len(memberOpts)], WithContextAcceptedValues(accepted))
+			}
+			mergedPolicy, policyStats, err := MergePolicyWithBase(basePolicies[generatedPolicy.Id], existingPolicy, generatedPolicy, memberOpts...)
+			if err != nil {
+				return nil, stats, fmt.Errorf("merging policy %s: %w", generatedPolicy.Id, err)
+			}
+			for i := range policyStats.Conflicts {
+				policyStats.Conflicts[i].PolicyID = generatedPolicy.Id
+			}
+			for i := range policyStats.LockedChanges {
+				policyStats.LockedChanges[i].PolicyID = generatedPolicy.Id
+			}
+			merged.Policies = append(merged.Policies, mergedPolicy)
+			stats.Policies[generatedPolicy.Id] = policyStats
+		}
+	}
+
+	// Keep hand-added member policies, drop the ones no longer generated
+	for _, existingPolicy := range existing.Policies {
+		if _, ok := generatedPolicies[existingPolicy.Id]; ok {
+			continue
+		}
+		if _, generatedBefore := basePolicies[existingPolicy.Id]; generatedBefore {
+			stats.PoliciesRemoved = append(stats.PoliciesRemoved, existingPolicy.Id)
+			continue
+		}
+		merged.Policies = append(merged.Policies, existingPolicy)
+		stats.PoliciesKept = append(stats.PoliciesKept, existingPolicy.Id)
+	}
+
+	// Validate the merged policy set
+	if err := merged.Validate(); err != nil {
+		return nil, stats, fmt.Errorf("merged policy set validation failed: %w", err)
+	}
+
+	return merged, stats, nil
+}
+
+// isPolicyReference reports whether a member policy only references an
+// external policy.
+func isPolicyReference(policy *Policy) bool {
+	return len(policy.GetTenets()) == 0 && policy.GetSource().GetLocation().GetUri() != ""
+}
+
+// mergePolicyReference merges a member policy referencing an external
+// policy. While the referenced location is unchanged, fields added to the
+// existing reference, such as a pinned digest, are kept. Returns whether the
+// location changed.
+func mergePolicyReference(existing, generated *Policy) (*Policy, bool) {
+	merged := proto.Clone(generated).(*Policy)
+	if existing.GetSource().GetLocation().GetUri() != generated.GetSource().GetLocation().GetUri() {
+		return merged, true
+	}
+
+	source := proto.Clone(existing.Source).(*PolicyRef)
+	proto.Merge(source, generated.Source)
+	merged.Source = source
+	if merged.Meta == nil && existing.Meta != nil {
+		merged.Meta = proto.Clone(existing.Meta).(*Meta)
+	}
+	return merged, false
+}
+
+// commonAcceptedValues combines the accepted values of the member policies
+// for the common context, whose entries are hoisted from member policies.
+func commonAcceptedValues(options *MergeOptions) map[string][]string {
+	accepted := make(map[string][]string)
+	for _, id := range sortedKeys(options.MemberContextAcceptedValues) {
+		for key, values := range options.MemberContextAcceptedValues[id] {
+			if _, ok := accepted[key]; !ok {
+				accepted[key] = values
+			}
+		}
+	}
+	return accepted
+}
+
+// policiesByID indexes the member policies of a PolicySet, which may be
+// nil, by ID.
+func policiesByID(policySet *PolicySet) map[string]*Policy {
+	policies := make(map[string]*Policy)
+	for _, policy := range policySet.GetPolicies() {
+		policies[policy.Id] = policy
+	}
+	return policies
+}
+
+// AdvancePolicySetBase returns the base to record after merging generated
+// with MergePolicySetWithBase, advancing each member policy as AdvanceBase
+// does.
+func AdvancePolicySetBase(base, generated *PolicySet, stats PolicySetMergeStats) *PolicySet {
+	next := proto.Clone(generated).(*PolicySet)
+	basePolicies := policiesByID(base)
+	for i, policy := range next.Policies {
+		if policyStats, ok := stats.Policies[policy.Id]; ok && len(policyStats.Conflicts) > 0 {
+			next.Policies[i] = AdvanceBase(basePolicies[policy.Id], policy, policyStats)
+		}
+	}
+	return next
+}
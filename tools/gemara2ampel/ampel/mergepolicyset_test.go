@@ -0,0 +1,178 @@
+package ampel
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// newMergeTestPolicySet returns "main-policy-set" with the member policies.
+func newMergeTestPolicySet(policies ...*Policy) *PolicySet {
+	return &PolicySet{
+		Id:       "main-policy-set",
+		Meta:     &PolicySetMeta{Description: "Set"},
+		Policies: policies,
+	}
+}
+
+// mainMemberPolicy returns the inline member policy with one tenet.
+func mainMemberPolicy(code string) *Policy {
+	return newMergeTestPolicy(withPolicyID("main-policy"), withTenets(&Tenet{Id: "tenet-1", Code: code}))
+}
+
+// importedMemberPolicy returns a member policy referencing an external policy.
+func importedMemberPolicy(id, uri string) *Policy {
+	return &Policy{Id: id, Source: &PolicyRef{Id: id, Location: &ResourceDescriptor{Uri: uri}}}
+}
+
+const importedPolicyURI = "https://example.com/policies.json#imported.json"
+
+// TestMergePolicySet verifies members are merged by ID and hand-added members kept.
+func TestMergePolicySet(t *testing.T) {
+	base := newMergeTestPolicySet(mainMemberPolicy("code_v2"), importedMemberPolicy("imported", importedPolicyURI))
+	existing := newMergeTestPolicySet(
+		mainMemberPolicy("manual"),
+		importedMemberPolicy("imported", importedPolicyURI),
+		&Policy{Id: "hand-added", Tenets: []*Tenet{{Id: "custom", Code: "true"}}},
+	)
+	existing.Policies[1].Source.Location.Digest = map[string]string{"sha256": "abc"}
+	generated := newMergeTestPolicySet(mainMemberPolicy("code_v2"), importedMemberPolicy("imported", importedPolicyURI))
+	generated.Meta.Description = "Regenerated set"
+
+	merged, stats, err := MergePolicySetWithBase(base, existing, generated)
+	require.NoError(t, err)
+
+	assert.Equal(t, "Regenerated set", merged.Meta.Description)
+	require.Len(t, merged.Policies, 3)
+
+	// The inline member keeps its manual code
+	assert.Equal(t, "main-policy", merged.Policies[0].Id)
+	assert.Equal(t, "manual", merged.Policies[0].Tenets[0].Code)
+	assert.Equal(t, 1, stats.Policies["main-policy"].TenetsPreserved)
+
+	// The external reference keeps its pinned digest
+	assert.Equal(t, "imported", merged.Policies[1].Id)
+	assert.Equal(t, "abc", merged.Policies[1].Source.Location.Digest["sha256"])
+	assert.Empty(t, stats.ReferencesUpdated)
+
+	// The hand-added member is kept
+	assert.Equal(t, "hand-added", merged.Policies[2].Id)
+	assert.Equal(t, []string{"hand-added"}, stats.PoliciesKept)
+	assert.Empty(t, stats.PoliciesAdded)
+	assert.Empty(t, stats.PoliciesRemoved)
+
+	// The existing set is not modified
+	assert.Equal(t, "Set", existing.Meta.Description)
+}
+
+// TestMergePolicySet_MembersAddedAndRemoved verifies members generated before are removed.
+func TestMergePolicySet_MembersAddedAndRemoved(t *testing.T) {
+	base := newMergeTestPolicySet(mainMemberPolicy("code_v1"), importedMemberPolicy("imported", importedPolicyURI))
+	existing := newMergeTestPolicySet(
+		mainMemberPolicy("code_v1"),
+		importedMemberPolicy("imported", importedPolicyURI),
+		&Policy{Id: "hand-added"},
+	)
+	generated := newMergeTestPolicySet(mainMemberPolicy("code_v1"), importedMemberPolicy("new-import", "https://example.com/new.json"))
+
+	merged, stats, err := MergePolicySetWithBase(base, existing, generated)
+	require.NoError(t, err)
+
+	var ids []string
+	for _, policy := range merged.Policies {
+		ids = append(ids, policy.Id)
+	}
+	assert.Equal(t, []string{"main-policy", "new-import", "hand-added"}, ids)
+	assert.Equal(t, []string{"new-import"}, stats.PoliciesAdded)
+	assert.Equal(t, []string{"imported"}, stats.PoliciesRemoved)
+
+	// Without a base the member cannot be told from a hand-added one
+	_, stats, err = MergePolicySet(existing, generated)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"imported", "hand-added"}, stats.PoliciesKept)
+}
+
+// TestMergePolicySet_ReferenceLocationChanged verifies a moved reference takes the generated source.
+func TestMergePolicySet_ReferenceLocationChanged(t *testing.T) {
+	existing := newMergeTestPolicySet(importedMemberPolicy("imported", importedPolicyURI))
+	existing.Policies[0].Source.Location.Digest = map[string]string{"sha256": "abc"}
+	generated := newMergeTestPolicySet(importedMemberPolicy("imported", "https://example.com/v2/policies.json#imported.json"))
+
+	merged, stats, err := MergePolicySet(existing, generated)
+	require.NoError(t, err)
+	assert.Equal(t, "https://example.com/v2/policies.json#imported.json", merged.Policies[0].Source.Location.Uri)
+	assert.Empty(t, merged.Policies[0].Source.Location.Digest)
+	assert.Equal(t, []string{"imported"}, stats.ReferencesUpdated)
+}
+
+// TestMergePolicySet_Conflicts verifies member conflicts carry the member policy ID.
+func TestMergePolicySet_Conflicts(t *testing.T) {
+	base := newMergeTestPolicySet(mainMemberPolicy("code_v0"))
+	existing := newMergeTestPolicySet(mainMemberPolicy("manual"))
+	generated := newMergeTestPolicySet(mainMemberPolicy("code_v2"))
+
+	merged, stats, err := MergePolicySetWithBase(base, existing, generated)
+	require.NoError(t, err)
+	conflicts := stats.Conflicts()
+	require.Len(t, conflicts, 1)
+	assert.Equal(t, "main-policy", conflicts[0].PolicyID)
+	assert.Equal(t, "policy main-policy tenet tenet-1 code", conflicts[0].String())
+
+	// The conflicting member keeps its old base until resolved
+	next := AdvancePolicySetBase(base, generated, stats)
+	assert.Equal(t, "code_v0", next.Policies[0].Tenets[0].Code)
+
+	require.NoError(t, ResolvePolicySetConflict(merged, next, conflicts[0], conflicts[0].Theirs))
+	assert.Equal(t, "code_v2", merged.Policies[0].Tenets[0].Code)
+	assert.Equal(t, "code_v2", next.Policies[0].Tenets[0].Code)
+
+	conflicts[0].PolicyID = "missing"
+	assert.Error(t, ResolvePolicySetConflict(merged, next, conflicts[0], "x"))
+}
+
+// TestMergePolicySet_CommonContext verifies common context values set in the workspace are kept.
+func TestMergePolicySet_CommonContext(t *testing.T) {
+	existing := newMergeTestPolicySet(mainMemberPolicy("true"))
+	existing.Common = &PolicySetCommon{Context: map[string]*ContextVal{
+		"builder-id": {Type: "string", Value: structpb.NewStringValue("https://gitlab.com/runner")},
+	}}
+	generated := newMergeTestPolicySet(mainMemberPolicy("true"))
+	generated.Common = &PolicySetCommon{Context: map[string]*ContextVal{
+		"builder-id": {Type: "string", Value: structpb.NewStringValue("https://github.com/actions/runner")},
+		"scanner":    {Type: "string", Value: structpb.NewStringValue("trivy")},
+	}}
+
+	merged, stats, err := MergePolicySet(existing, generated, WithMemberContextAcceptedValues("main-policy", map[string][]string{
+		"builder-id": {"https://github.com/actions/runner", "https://gitlab.com/runner"},
+	}))
+	require.NoError(t, err)
+	assert.Equal(t, "https://gitlab.com/runner", merged.Common.Context["builder-id"].GetValue().GetStringValue())
+	assert.Equal(t, 1, stats.ContextValuesPreserved)
+	assert.Equal(t, []string{"scanner"}, stats.ContextKeysAdded)
+
+	// A value no longer accepted is reset
+	_, stats, err = MergePolicySet(existing, generated, WithMemberContextAcceptedValues("main-policy", map[string][]string{
+		"builder-id": {"https://github.com/actions/runner"},
+	}))
+	require.NoError(t, err)
+	assert.Len(t, stats.Warnings, 1)
+}
+
+// TestMergePolicySet_SelfIsIdentity verifies merging a PolicySet with itself changes nothing.
+func TestMergePolicySet_SelfIsIdentity(t *testing.T) {
+	existing := newMergeTestPolicySet(
+		mainMemberPolicy("manual"),
+		importedMemberPolicy("imported", importedPolicyURI),
+		&Policy{Id: "hand-added"},
+	)
+
+	merged, stats, err := MergePolicySetWithBase(existing, existing, existing)
+	require.NoError(t, err)
+	assert.Len(t, merged.Policies, 3)
+	assert.Empty(t, stats.PoliciesAdded)
+	assert.Empty(t, stats.PoliciesRemoved)
+	assert.Empty(t, stats.PoliciesKept)
+	assert.Empty(t, stats.Conflicts())
+}
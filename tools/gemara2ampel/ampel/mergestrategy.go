@@ -0,0 +1,463 @@
+package ampel
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// MergeStrategy selects how MergePolicy combines a field of an existing
+// policy or tenet with the newly generated one.
+type MergeStrategy string
+
+const (
+	// MergePreferManual keeps manual edits. For tenets with a generation
+	// base, an unedited field takes the generated value and a field edited
+	// on both sides is a conflict; otherwise the existing value is kept
+	// whenever it is set.
+	MergePreferManual MergeStrategy = "manual"
+
+	// MergeThreeWay keeps manual edits found against the generation base:
+	// an unedited field takes the generated value and a field edited on
+	// both sides keeps the existing value as a conflict. Without a base,
+	// edits cannot be told apart from stale generated content and the
+	// generated value is taken.
+	MergeThreeWay MergeStrategy = "three-way"
+
+	// MergePreferGenerated always takes the generated value.
+	MergePreferGenerated MergeStrategy = "generated"
+
+	// MergeUnion combines both values: list items from both sides, map
+	// entries from both sides with existing entries winning, and message
+	// fields combined the same way. Only list, map and message fields
+	// support it.
+	MergeUnion MergeStrategy = "union"
+)
+
+// ParseMergeStrategy parses a merge strategy name.
+func ParseMergeStrategy(s string) (MergeStrategy, error) {
+	switch strategy := MergeStrategy(strings.ToLower(s)); strategy {
+	case MergePreferManual, MergeThreeWay, MergePreferGenerated, MergeUnion:
+		return strategy, nil
+	default:
+		return "", fmt.Errorf("unknown merge strategy %q (use manual, three-way, generated or union)", s)
+	}
+}
+
+// DefaultTenetMergeStrategies are the merge strategies of tenet fields,
+// keyed by field name. Fields derived only from the Gemara policy follow the
+// generator, fields holding manual content are never dropped and the title
+// follows the generator only while unedited since the base.
+var DefaultTenetMergeStrategies = map[string]MergeStrategy{
+	"runtime":    MergePreferGenerated,
+	"title":      MergeThreeWay,
+	"code":       MergePreferManual,
+	"outputs":    MergePreferManual,
+	"predicates": MergeUnion,
+	"error":      MergePreferManual,
+	"assessment": MergePreferManual,
+}
+
+// DefaultPolicyMergeStrategies are the merge strategies of policy fields,
+// keyed by field name. Tenets are merged by ID with the tenet strategies and
+// context keys added in the workspace are kept alongside the generated ones.
+var DefaultPolicyMergeStrategies = map[string]MergeStrategy{
+	"source":       MergePreferManual,
+	"meta":         MergeThreeWay,
+	"context":      MergeUnion,
+	"chain":        MergeUnion,
+	"identities":   MergeUnion,
+	"predicates":   MergeUnion,
+	"transformers": MergeUnion,
+}
+
+// DefaultPolicySetMergeStrategies are the merge strategies of PolicySet
+// fields, keyed by field name. Member policies are merged by ID with the
+// policy and tenet strategies.
+var DefaultPolicySetMergeStrategies = map[string]MergeStrategy{
+	"meta":   MergeThreeWay,
+	"common": MergeUnion,
+	"chain":  MergeUnion,
+	"groups": MergeUnion,
+}
+
+// MergeOptions configures MergePolicy, MergePolicySet and their three-way
+// variants.
+type MergeOptions struct {
+	// TenetStrategies overrides DefaultTenetMergeStrategies per field
+	TenetStrategies map[string]MergeStrategy
+
+	// PolicyStrategies overrides DefaultPolicyMergeStrategies per field
+	PolicyStrategies map[string]MergeStrategy
+
+	// PolicySetStrategies overrides DefaultPolicySetMergeStrategies per field
+	PolicySetStrategies map[string]MergeStrategy
+
+	// ContextAcceptedValues lists the accepted values of generated context
+	// keys, checked before keeping a context value set in the workspace
+	ContextAcceptedValues map[string][]string
+
+	// MemberContextAcceptedValues lists the accepted values of the context
+	// keys of PolicySet member policies, keyed by member policy ID
+	MemberContextAcceptedValues map[string]map[string][]string
+
+	// OrphanMode selects how tenets missing from the generated policy are
+	// handled, OrphanDelete when empty
+	OrphanMode OrphanMode
+
+	// RenameThreshold is the similarity from which unmatched tenets are
+	// taken as renamed, DefaultRenameThreshold when zero
+	RenameThreshold float64
+
+	// Locks pins tenets and tenet fields to their existing content
+	Locks []TenetLock
+}
+
+// MergeOption is a functional option for configuring a merge.
+type MergeOption func(*MergeOptions)
+
+// WithTenetMergeStrategy sets the merge strategy of a tenet field, such as
+// "title" or "predicates".
+//
+// Example:
+//
+//	ampel.MergePolicy(existing, generated,
+//	    ampel.WithTenetMergeStrategy("title", ampel.MergePreferManual),
+//	)
+func WithTenetMergeStrategy(field string, strategy MergeStrategy) MergeOption {
+	return func(opts *MergeOptions) {
+		if opts.TenetStrategies == nil {
+			opts.TenetStrategies = make(map[string]MergeStrategy)
+		}
+		opts.TenetStrategies[field] = strategy
+	}
+}
+
+// WithPolicyMergeStrategy sets the merge strategy of a policy field, such as
+// "meta" or "identities".
+func WithPolicyMergeStrategy(field string, strategy MergeStrategy) MergeOption {
+	return func(opts *MergeOptions) {
+		if opts.PolicyStrategies == nil {
+			opts.PolicyStrategies = make(map[string]MergeStrategy)
+		}
+		opts.PolicyStrategies[field] = strategy
+	}
+}
+
+// WithPolicySetMergeStrategy sets the merge strategy of a PolicySet field,
+// such as "meta" or "common".
+func WithPolicySetMergeStrategy(field string, strategy MergeStrategy) MergeOption {
+	return func(opts *MergeOptions) {
+		if opts.PolicySetStrategies == nil {
+			opts.PolicySetStrategies = make(map[string]MergeStrategy)
+		}
+		opts.PolicySetStrategies[field] = strategy
+	}
+}
+
+// WithContextAcceptedValues sets the accepted values of the generated context
+// keys, as returned by ContextAcceptedValues. A context value set in the
+// existing policy is only kept when it is one of them. Without accepted
+// values, existing values are only checked against the context type.
+func WithContextAcceptedValues(accepted map[string][]string) MergeOption {
+	return func(opts *MergeOptions) {
+		opts.ContextAcceptedValues = accepted
+	}
+}
+
+// WithMemberContextAcceptedValues sets the accepted values of the context
+// keys of a PolicySet member policy, as returned by ContextAcceptedValues,
+// for MergePolicySet.
+func WithMemberContextAcceptedValues(policyID string, accepted map[string][]string) MergeOption {
+	return func(opts *MergeOptions) {
+		if opts.MemberContextAcceptedValues == nil {
+			opts.MemberContextAcceptedValues = make(map[string]map[string][]string)
+		}
+		opts.MemberContextAcceptedValues[policyID] = accepted
+	}
+}
+
+// ParseMergeStrategyOption parses a "tenet.field=strategy",
+// "policy.field=strategy" or "policyset.field=strategy" setting into a
+// MergeOption.
+func ParseMergeStrategyOption(setting string) (MergeOption, error) {
+	key, value, ok := strings.Cut(setting, "=")
+	if !ok {
+		return nil, fmt.Errorf("invalid merge strategy %q: expected tenet.field=strategy, policy.field=strategy or policyset.field=strategy", setting)
+	}
+	strategy, err := ParseMergeStrategy(value)
+	if err != nil {
+		return nil, err
+	}
+	scope, field, _ := strings.Cut(key, ".")
+	switch scope {
+	case "tenet":
+		return WithTenetMergeStrategy(field, strategy), nil
+	case "policy":
+		return WithPolicyMergeStrategy(field, strategy), nil
+	case "policyset":
+		return WithPolicySetMergeStrategy(field, strategy), nil
+	default:
+		return nil, fmt.Errorf("invalid merge strategy field %q: expected tenet.field, policy.field or policyset.field", key)
+	}
+}
+
+// fieldStrategy is the strategy of one merged field.
+type fieldStrategy struct {
+	field    protoreflect.FieldDescriptor
+	strategy MergeStrategy
+}
+
+// mergeStrategies are the resolved strategies of a merge.
+type mergeStrategies struct {
+	tenet     []fieldStrategy
+	policy    []fieldStrategy
+	policySet []fieldStrategy
+}
+
+// resolveMergeStrategies applies options to the default strategies and
+// checks every field exists and supports its strategy.
+func resolveMergeStrategies(options *MergeOptions) (*mergeStrategies, error) {
+	tenet, err := resolveFieldStrategies((&Tenet{}).ProtoReflect().Descriptor(), DefaultTenetMergeStrategies, options.TenetStrategies)
+	if err != nil {
+		return nil, fmt.Errorf("tenet merge strategy: %w", err)
+	}
+	policy, err := resolveFieldStrategies((&Policy{}).ProtoReflect().Descriptor(), DefaultPolicyMergeStrategies, options.PolicyStrategies)
+	if err != nil {
+		return nil, fmt.Errorf("policy merge strategy: %w", err)
+	}
+	policySet, err := resolveFieldStrategies((&PolicySet{}).ProtoReflect().Descriptor(), DefaultPolicySetMergeStrategies, options.PolicySetStrategies)
+	if err != nil {
+		return nil, fmt.Errorf("policyset merge strategy: %w", err)
+	}
+	return &mergeStrategies{tenet: tenet, policy: policy, policySet: policySet}, nil
+}
+
+// resolveFieldStrategies returns the strategy of every field in defaults,
+// with overrides applied, in field declaration order.
+func resolveFieldStrategies(desc protoreflect.MessageDescriptor, defaults, overrides map[string]MergeStrategy) ([]fieldStrategy, error) {
+	strategies := make(map[string]MergeStrategy, len(defaults))
+	for field, strategy := range defaults {
+		strategies[field] = strategy
+	}
+	for _, field := range sortedKeys(overrides) {
+		if _, ok := defaults[field]; !ok {
+			return nil, fmt.Errorf("unknown field %q (use %s)", field, strings.Join(sortedKeys(defaults), ", "))
+		}
+		strategies[field] = overrides[field]
+	}
+
+	var resolved []fieldStrategy
+	for _, field := range sortedKeys(strategies) {
+		fd := desc.Fields().ByName(protoreflect.Name(field))
+		if fd == nil {
+			return nil, fmt.Errorf("unknown field %q", field)
+		}
+		strategy := strategies[field]
+		if _, err := ParseMergeStrategy(string(strategy)); err != nil {
+			return nil, fmt.Errorf("field %s: %w", field, err)
+		}
+		if strategy == MergeUnion && !fd.IsList() && !fd.IsMap() && fd.Message() == nil {
+			return nil, fmt.Errorf("field %s does not support the union strategy", field)
+		}
+		resolved = append(resolved, fieldStrategy{field: fd, strategy: strategy})
+	}
+	sort.Slice(resolved, func(i, j int) bool { return resolved[i].field.Index() < resolved[j].field.Index() })
+	return resolved, nil
+}
+
+// strategyOf returns the strategy of the named field.
+func strategyOf(strategies []fieldStrategy, name string) MergeStrategy {
+	for _, fs := range strategies {
+		if string(fs.field.Name()) == name {
+			return fs.strategy
+		}
+	}
+	return MergePreferGenerated
+}
+
+// mergeFields merges the fields of existing into merged, a clone of the
+// generated message, following strategies. With a base message, fields
+// preferring manual edits are merged three ways. Returns the names of the
+// fields edited on both sides, which keep the existing value.
+func mergeFields(base, existing, merged proto.Message, strategies []fieldStrategy) []string {
+	existingMsg := proto.Clone(existing).ProtoReflect()
+	mergedMsg := merged.ProtoReflect()
+	var conflicts []string
+
+	for _, fs := range strategies {
+		fd := fs.field
+		switch fs.strategy {
+		case MergePreferGenerated:
+			// merged already holds the generated value
+		case mergeLocked:
+			copyField(mergedMsg, existingMsg, fd)
+		case MergePreferManual, MergeThreeWay:
+			if base == nil {
+				if fs.strategy == MergeThreeWay {
+					continue
+				}
+				if existingMsg.Has(fd) {
+					mergedMsg.Set(fd, existingMsg.Get(fd))
+				}
+				continue
+			}
+			baseMsg := base.ProtoReflect()
+			switch {
+			case fieldEqual(existingMsg, baseMsg, fd):
+				// Not edited manually: keep the generated value
+			case fieldEqual(mergedMsg, baseMsg, fd), fieldEqual(existingMsg, mergedMsg, fd):
+				copyField(mergedMsg, existingMsg, fd)
+			default:
+				copyField(mergedMsg, existingMsg, fd)
+				conflicts = append(conflicts, string(fd.Name()))
+			}
+		case MergeUnion:
+			if base != nil && fieldEqual(existingMsg, base.ProtoReflect(), fd) {
+				// Not edited manually: nothing to add to the generated value
+				continue
+			}
+			unionField(mergedMsg, existingMsg, fd)
+		}
+	}
+	return conflicts
+}
+
+// fieldEqual reports whether a field has the same value in both messages.
+func fieldEqual(a, b protoreflect.Message, fd protoreflect.FieldDescriptor) bool {
+	return proto.Equal(fieldOnly(a, fd), fieldOnly(b, fd))
+}
+
+// fieldOnly returns a message of the same type holding only one field of m.
+func fieldOnly(m protoreflect.Message, fd protoreflect.FieldDescriptor) proto.Message {
+	out := m.New()
+	if m.Has(fd) {
+		out.Set(fd, m.Get(fd))
+	}
+	return out.Interface()
+}
+
+// copyField sets a field of dst to its value in src, clearing it when unset.
+func copyField(dst, src protoreflect.Message, fd protoreflect.FieldDescriptor) {
+	if src.Has(fd) {
+		dst.Set(fd, src.Get(fd))
+	} else {
+		dst.Clear(fd)
+	}
+}
+
+// unionField adds the content of a field of src to the same field of dst.
+func unionField(dst, src protoreflect.Message, fd protoreflect.FieldDescriptor) {
+	if !src.Has(fd) {
+		return
+	}
+	if !dst.Has(fd) {
+		dst.Set(fd, src.Get(fd))
+		return
+	}
+
+	switch {
+	case fd.IsList():
+		dstList := dst.Mutable(fd).List()
+		srcList := src.Get(fd).List()
+		for i := 0; i < srcList.Len(); i++ {
+			if !listContains(dstList, srcList.Get(i), fd) {
+				dstList.Append(srcList.Get(i))
+			}
+		}
+	case fd.IsMap():
+		dstMap := dst.Mutable(fd).Map()
+		src.Get(fd).Map().Range(func(key protoreflect.MapKey, value protoreflect.Value) bool {
+			dstMap.Set(key, value)
+			return true
+		})
+	case fd.Message() != nil:
+		dstMsg := dst.Mutable(fd).Message()
+		srcMsg := src.Get(fd).Message()
+		fields := fd.Message().Fields()
+		for i := 0; i < fields.Len(); i++ {
+			sub := fields.Get(i)
+			if sub.IsList() || sub.IsMap() || sub.Message() != nil {
+				unionField(dstMsg, srcMsg, sub)
+			} else if srcMsg.Has(sub) {
+				dstMsg.Set(sub, srcMsg.Get(sub))
+			}
+		}
+	}
+}
+
+// listContains reports whether list holds an item equal to value.
+func listContains(list protoreflect.List, value protoreflect.Value, fd protoreflect.FieldDescriptor) bool {
+	for i := 0; i < list.Len(); i++ {
+		item := list.Get(i)
+		if fd.Message() != nil {
+			if proto.Equal(item.Message().Interface(), value.Message().Interface()) {
+				return true
+			}
+		} else if item.Interface() == value.Interface() {
+			return true
+		}
+	}
+	return false
+}
+
+// fieldText returns a tenet field as conflict text: string fields as is,
+// other fields as indented JSON using the policy file field names.
+func fieldText(m proto.Message, name string) string {
+	msg := m.ProtoReflect()
+	fd := msg.Descriptor().Fields().ByName(protoreflect.Name(name))
+	if fd == nil || !msg.Has(fd) {
+		return ""
+	}
+	if fd.Kind() == protoreflect.StringKind && !fd.IsList() {
+		return msg.Get(fd).String()
+	}
+
+	data, err := protojson.MarshalOptions{UseProtoNames: true}.Marshal(fieldOnly(msg, fd))
+	if err != nil {
+		return fmt.Sprintf("error serializing %s: %v", name, err)
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return fmt.Sprintf("error serializing %s: %v", name, err)
+	}
+	var indented bytes.Buffer
+	if err := json.Indent(&indented, fields[name], "", "  "); err != nil {
+		return fmt.Sprintf("error serializing %s: %v", name, err)
+	}
+	return indented.String()
+}
+
+// setFieldText sets a field from conflict text written by fieldText.
+func setFieldText(m proto.Message, name, value string) error {
+	msg := m.ProtoReflect()
+	fd := msg.Descriptor().Fields().ByName(protoreflect.Name(name))
+	if fd == nil {
+		return fmt.Errorf("unknown field %q", name)
+	}
+	if fd.Kind() == protoreflect.StringKind && !fd.IsList() {
+		msg.Set(fd, protoreflect.ValueOfString(value))
+		return nil
+	}
+	if strings.TrimSpace(value) == "" {
+		msg.Clear(fd)
+		return nil
+	}
+
+	data, err := json.Marshal(map[string]json.RawMessage{name: json.RawMessage(value)})
+	if err != nil {
+		return fmt.Errorf("invalid %s JSON: %w", name, err)
+	}
+	parsed := msg.New()
+	if err := protojson.Unmarshal(data, parsed.Interface()); err != nil {
+		return fmt.Errorf("invalid %s JSON: %w", name, err)
+	}
+	copyField(msg, parsed, fd)
+	return nil
+}
@@ -0,0 +1,286 @@
+package ampel
+
+import (
+	"testing"
+
+	api "github.com/carabiner-dev/policy/api/v1"
+	signer "github.com/carabiner-dev/signer/api/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+)
+
+// manualTenet returns a tenet with manual content in every field.
+func manualTenet() *Tenet {
+	return &Tenet{
+		Id:         "tenet-1",
+		Title:      "Manual Title",
+		Runtime:    "cel@v13.0",
+		Code:       "manual_code",
+		Predicates: &PredicateSpec{Types: []string{"https://example.com/manual"}, Limit: 5},
+		Outputs:    map[string]*Output{"manual": {Code: "context.manual"}},
+		Error:      &Error{Message: "Manual error", Guidance: "Manual guidance"},
+		Assessment: &Assessment{Message: "Manual assessment"},
+	}
+}
+
+// generatedTenet returns the tenet of manualTenet as generated.
+func generatedTenet() *Tenet {
+	return &Tenet{
+		Id:         "tenet-1",
+		Title:      "Generated Title",
+		Runtime:    "cel@v14.0",
+		Code:       "generated_code",
+		Predicates: &PredicateSpec{Types: []string{"https://slsa.dev/provenance/v1"}},
+	}
+}
+
+// TestMergePolicy_DefaultTenetStrategies verifies the default strategy of every tenet field.
+func TestMergePolicy_DefaultTenetStrategies(t *testing.T) {
+	existing := newMergeTestPolicy(withTenets(manualTenet()))
+	generated := newMergeTestPolicy(withTenets(generatedTenet()))
+
+	merged, _, err := MergePolicy(existing, generated)
+	require.NoError(t, err)
+	tenet := merged.Tenets[0]
+
+	// Without a base, the title cannot be told apart from a stale one
+	assert.Equal(t, "Generated Title", tenet.Title)
+	assert.Equal(t, "cel@v14.0", tenet.Runtime)
+	assert.Equal(t, "manual_code", tenet.Code)
+	assert.Equal(t, []string{"https://slsa.dev/provenance/v1", "https://example.com/manual"}, tenet.Predicates.Types)
+	assert.Equal(t, int32(5), tenet.Predicates.Limit)
+	assert.Equal(t, "context.manual", tenet.Outputs["manual"].Code)
+	assert.Equal(t, "Manual error", tenet.Error.Message)
+	assert.Equal(t, "Manual guidance", tenet.Error.Guidance)
+	assert.Equal(t, "Manual assessment", tenet.Assessment.Message)
+
+	// The existing policy is not modified
+	assert.Equal(t, []string{"https://example.com/manual"}, existing.Tenets[0].Predicates.Types)
+}
+
+// TestMergePolicy_DefaultPolicyStrategies verifies the default strategy of every policy field.
+func TestMergePolicy_DefaultPolicyStrategies(t *testing.T) {
+	existing := newMergeTestPolicy(withDescription("Old description"), withContext(map[string]*ContextVal{"manual": {Type: "string"}}))
+	existing.Source = &PolicyRef{Id: "manual-source"}
+	existing.Identities = []*Identity{{Id: "manual-identity", Ref: &signer.IdentityRef{Id: "manual"}}}
+	existing.Predicates = &PredicateSpec{Types: []string{"https://example.com/manual"}}
+	existing.Transformers = []*api.Transformer{{Id: "manual-transformer"}}
+	generated := newMergeTestPolicy(withDescription("New description"), withContext(map[string]*ContextVal{"builder-id": {Type: "string"}}))
+	generated.Identities = []*Identity{{Id: "generated-identity", Ref: &signer.IdentityRef{Id: "generated"}}}
+	generated.Predicates = &PredicateSpec{Types: []string{"https://slsa.dev/provenance/v1"}}
+
+	merged, _, err := MergePolicy(existing, generated)
+	require.NoError(t, err)
+
+	assert.Equal(t, "manual-source", merged.Source.Id)
+	assert.Equal(t, "New description", merged.Meta.Description)
+	assert.Equal(t, []string{"builder-id", "manual"}, sortedKeys(merged.Context))
+	require.Len(t, merged.Identities, 2)
+	assert.Equal(t, "generated-identity", merged.Identities[0].Id)
+	assert.Equal(t, "manual-identity", merged.Identities[1].Id)
+	assert.Equal(t, []string{"https://slsa.dev/provenance/v1", "https://example.com/manual"}, merged.Predicates.Types)
+	require.Len(t, merged.Transformers, 1)
+	assert.Equal(t, "manual-transformer", merged.Transformers[0].Id)
+}
+
+// TestMergePolicy_TenetStrategyOverrides verifies each strategy can be chosen per tenet field.
+func TestMergePolicy_TenetStrategyOverrides(t *testing.T) {
+	existing := newMergeTestPolicy(withTenets(manualTenet()))
+	generated := newMergeTestPolicy(withTenets(generatedTenet()))
+
+	merged, _, err := MergePolicy(existing, generated,
+		WithTenetMergeStrategy("title", MergePreferManual),
+		WithTenetMergeStrategy("runtime", MergePreferManual),
+		WithTenetMergeStrategy("code", MergePreferGenerated),
+		WithTenetMergeStrategy("predicates", MergePreferGenerated),
+		WithTenetMergeStrategy("outputs", MergeUnion),
+		WithTenetMergeStrategy("error", MergePreferGenerated),
+		WithTenetMergeStrategy("assessment", MergeUnion),
+	)
+	require.NoError(t, err)
+	tenet := merged.Tenets[0]
+
+	assert.Equal(t, "Manual Title", tenet.Title)
+	assert.Equal(t, "cel@v13.0", tenet.Runtime)
+	assert.Equal(t, "generated_code", tenet.Code)
+	assert.Equal(t, []string{"https://slsa.dev/provenance/v1"}, tenet.Predicates.Types)
+	assert.Equal(t, []string{"manual"}, sortedKeys(tenet.Outputs))
+	assert.Nil(t, tenet.Error)
+	assert.Equal(t, "Manual assessment", tenet.Assessment.Message)
+}
+
+// TestMergePolicy_PolicyStrategyOverrides verifies each strategy can be chosen per policy field.
+func TestMergePolicy_PolicyStrategyOverrides(t *testing.T) {
+	existing := newMergeTestPolicy(withDescription("Old description"), withContext(map[string]*ContextVal{"manual": {Type: "string"}}))
+	existing.Source = &PolicyRef{Id: "manual-source"}
+	existing.Identities = []*Identity{{Id: "manual-identity", Ref: &signer.IdentityRef{Id: "manual"}}}
+	existing.Predicates = &PredicateSpec{Types: []string{"https://example.com/manual"}}
+	existing.Transformers = []*api.Transformer{{Id: "manual-transformer"}}
+	generated := newMergeTestPolicy(withDescription("New description"), withContext(map[string]*ContextVal{"builder-id": {Type: "string"}}))
+	generated.Identities = []*Identity{{Id: "generated-identity", Ref: &signer.IdentityRef{Id: "generated"}}}
+
+	merged, _, err := MergePolicy(existing, generated,
+		WithPolicyMergeStrategy("source", MergePreferGenerated),
+		WithPolicyMergeStrategy("meta", MergePreferManual),
+		WithPolicyMergeStrategy("context", MergePreferManual),
+		WithPolicyMergeStrategy("identities", MergePreferGenerated),
+		WithPolicyMergeStrategy("predicates", MergePreferManual),
+		WithPolicyMergeStrategy("transformers", MergePreferGenerated),
+	)
+	require.NoError(t, err)
+
+	assert.Nil(t, merged.Source)
+	assert.Equal(t, "Old description", merged.Meta.Description)
+	assert.Equal(t, []string{"manual"}, sortedKeys(merged.Context))
+	require.Len(t, merged.Identities, 1)
+	assert.Equal(t, "generated-identity", merged.Identities[0].Id)
+	assert.Equal(t, []string{"https://example.com/manual"}, merged.Predicates.Types)
+	assert.Empty(t, merged.Transformers)
+}
+
+// TestMergePolicyWithBase_StrategiesWithBase verifies unedited fields follow the generator.
+func TestMergePolicyWithBase_StrategiesWithBase(t *testing.T) {
+	base := newMergeTestPolicy(withTenets(&Tenet{
+		Id:         "tenet-1",
+		Title:      "Manual Title",
+		Code:       "manual_code",
+		Predicates: &PredicateSpec{Types: []string{"https://example.com/manual"}, Limit: 5},
+		Error:      &Error{Message: "Old generated error"},
+		Assessment: &Assessment{Message: "Manual assessment"},
+	}))
+	existing := newMergeTestPolicy(withTenets(manualTenet()))
+	generated := newMergeTestPolicy(withTenets(generatedTenet()))
+	generated.Tenets[0].Error = &Error{Message: "New generated error"}
+	generated.Tenets[0].Assessment = &Assessment{Message: "Generated assessment"}
+
+	merged, stats, err := MergePolicyWithBase(base, existing, generated)
+	require.NoError(t, err)
+	tenet := merged.Tenets[0]
+
+	// Title, code and predicates were not edited, so they follow the generator
+	assert.Equal(t, "Generated Title", tenet.Title)
+	assert.Equal(t, "generated_code", tenet.Code)
+	assert.Equal(t, []string{"https://slsa.dev/provenance/v1"}, tenet.Predicates.Types)
+	assert.Equal(t, "Generated assessment", tenet.Assessment.Message)
+
+	// The error was edited on both sides
+	assert.Equal(t, "Manual error", tenet.Error.Message)
+	require.Len(t, stats.Conflicts, 1)
+	assert.Equal(t, "error", stats.Conflicts[0].Field)
+	assert.JSONEq(t, `{"message": "Manual error", "guidance": "Manual guidance"}`, stats.Conflicts[0].Ours)
+	assert.JSONEq(t, `{"message": "New generated error"}`, stats.Conflicts[0].Theirs)
+
+	// Resolving parses the JSON text back into the field
+	require.NoError(t, ResolveConflict(merged, base, stats.Conflicts[0], stats.Conflicts[0].Theirs))
+	assert.Equal(t, "New generated error", merged.Tenets[0].Error.Message)
+	assert.Empty(t, merged.Tenets[0].Error.Guidance)
+	assert.Error(t, ResolveConflict(merged, base, stats.Conflicts[0], "{not json"))
+}
+
+// TestMergePolicyWithBase_ManualMetadata verifies titles, meta and context
+// keys edited in the workspace are kept.
+func TestMergePolicyWithBase_ManualMetadata(t *testing.T) {
+	base := newMergeTestPolicy(
+		withDescription("Base description"),
+		withContext(map[string]*ContextVal{"builder-id": {Type: "string"}, "retired": {Type: "string"}}),
+		withTenets(&Tenet{Id: "tenet-1", Title: "Base Title"}),
+	)
+	existing := newMergeTestPolicy(
+		withDescription("Old description"),
+		withContext(map[string]*ContextVal{"manual": {Type: "string"}, "retired": {Type: "string"}}),
+		withTenets(&Tenet{Id: "tenet-1", Title: "Manual Title"}),
+	)
+	generated := newMergeTestPolicy(
+		withDescription("New description"),
+		withContext(map[string]*ContextVal{"builder-id": {Type: "string"}}),
+		withTenets(&Tenet{Id: "tenet-1", Title: "Generated Title"}),
+	)
+
+	merged, stats, err := MergePolicyWithBase(base, existing, generated)
+	require.NoError(t, err)
+
+	// Fields edited on both sides keep the workspace value
+	assert.Equal(t, "Manual Title", merged.Tenets[0].Title)
+	require.Len(t, stats.Conflicts, 1)
+	assert.Equal(t, "title", stats.Conflicts[0].Field)
+	assert.Equal(t, "Old description", merged.Meta.Description)
+	require.Len(t, stats.Warnings, 1)
+	assert.Contains(t, stats.Warnings[0], "policy meta")
+
+	// Keys added in the workspace are kept, unedited keys no longer generated are removed
+	assert.Equal(t, []string{"builder-id", "manual"}, sortedKeys(merged.Context))
+	assert.Equal(t, []string{"retired"}, stats.ContextKeysRemoved)
+}
+
+// TestMergePolicy_ChainStrategy verifies chain links of both sides are kept
+// and links not edited since the base follow the generator.
+func TestMergePolicy_ChainStrategy(t *testing.T) {
+	link := func(predicateType string) *api.ChainLink {
+		return &api.ChainLink{Source: &api.ChainLink_Predicate{Predicate: &api.ChainedPredicate{Type: predicateType}}}
+	}
+	chainTypes := func(policy *Policy) []string {
+		var types []string
+		for _, l := range policy.Chain {
+			types = append(types, l.GetPredicate().GetType())
+		}
+		return types
+	}
+	existing := newMergeTestPolicy()
+	existing.Chain = []*api.ChainLink{link("https://example.com/manual")}
+	generated := newMergeTestPolicy()
+	generated.Chain = []*api.ChainLink{link("https://slsa.dev/provenance/v1")}
+
+	merged, _, err := MergePolicy(existing, generated)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"https://slsa.dev/provenance/v1", "https://example.com/manual"}, chainTypes(merged))
+
+	base := proto.Clone(existing).(*Policy)
+	merged, _, err = MergePolicyWithBase(base, existing, generated)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"https://slsa.dev/provenance/v1"}, chainTypes(merged))
+
+	merged, _, err = MergePolicy(existing, generated, WithPolicyMergeStrategy("chain", MergePreferGenerated))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"https://slsa.dev/provenance/v1"}, chainTypes(merged))
+}
+
+// TestMergePolicy_InvalidStrategies verifies unknown fields and unsupported strategies are rejected.
+func TestMergePolicy_InvalidStrategies(t *testing.T) {
+	existing, generated := newMergeTestPolicy(), newMergeTestPolicy()
+
+	for name, opt := range map[string]MergeOption{
+		"unknown tenet field":  WithTenetMergeStrategy("id", MergePreferManual),
+		"unknown policy field": WithPolicyMergeStrategy("tenets", MergeUnion),
+		"unknown strategy":     WithTenetMergeStrategy("code", "theirs"),
+		"union of a string":    WithTenetMergeStrategy("code", MergeUnion),
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, _, err := MergePolicy(existing, generated, opt)
+			assert.Error(t, err)
+		})
+	}
+}
+
+// TestParseMergeStrategyOption verifies command-line strategy settings.
+func TestParseMergeStrategyOption(t *testing.T) {
+	existing := newMergeTestPolicy(withTenets(&Tenet{Id: "tenet-1", Title: "Manual Title"}))
+	existing.Identities = []*Identity{{Id: "manual-identity", Ref: &signer.IdentityRef{Id: "manual"}}}
+	generated := newMergeTestPolicy(withTenets(&Tenet{Id: "tenet-1", Title: "Generated Title"}))
+	generated.Identities = []*Identity{{Id: "generated-identity", Ref: &signer.IdentityRef{Id: "generated"}}}
+
+	titleOpt, err := ParseMergeStrategyOption("tenet.title=MANUAL")
+	require.NoError(t, err)
+	identitiesOpt, err := ParseMergeStrategyOption("policy.identities=generated")
+	require.NoError(t, err)
+
+	merged, _, err := MergePolicy(existing, generated, titleOpt, identitiesOpt)
+	require.NoError(t, err)
+	assert.Equal(t, "Manual Title", merged.Tenets[0].Title)
+	assert.Len(t, merged.Identities, 1)
+
+	for _, setting := range []string{"tenet.title", "title=manual", "tenet.title=mine"} {
+		_, err := ParseMergeStrategyOption(setting)
+		assert.Error(t, err, setting)
+	}
+}
@@ -0,0 +1,206 @@
+package ampel
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// FilenameMigration is the renaming of the files of a policy from the
+// legacy file name, which replaced '/', '\' and ':' with '-', to the
+// EncodePolicyFilename one.
+type FilenameMigration struct {
+	ID   string `json:"id" yaml:"id"`
+	From string `json:"from" yaml:"from"`
+	To   string `json:"to" yaml:"to"`
+
+	// Files lists the files renamed, relative to the workspace
+	Files []string `json:"files" yaml:"files"`
+}
+
+// policyFileLayouts are the directory and suffix of each workspace file
+// named after a policy ID.
+var policyFileLayouts = []struct {
+	dir    string
+	suffix string
+}{
+	{"", ".json"},
+	{BaseDir, ".json"},
+	{ArchiveDir, ".json"},
+	{"", ".conflicts"},
+	{"", ".locks.yaml"},
+}
+
+// legacyPolicyFilename returns the file name stem that workspaces used for
+// a policy ID before EncodePolicyFilename.
+func legacyPolicyFilename(policyID string) string {
+	return strings.NewReplacer("/", "-", "\\", "-", ":", "-").Replace(policyID)
+}
+
+// PendingMigrations returns the policies of the workspace whose files still
+// use the legacy file name, read from the IDs of the policy files. Policy
+// files named otherwise, such as with a custom output name, are left
+// alone.
+func (w *Workspace) PendingMigrations() ([]FilenameMigration, error) {
+	ids, err := w.policyFileIDs()
+	if err != nil {
+		return nil, err
+	}
+
+	var migrations []FilenameMigration
+	for _, stem := range slices.Sorted(maps.Keys(ids)) {
+		id := ids[stem]
+		encoded := EncodePolicyFilename(id)
+		if encoded == stem || legacyPolicyFilename(id) != stem {
+			continue
+		}
+
+		migration := FilenameMigration{ID: id, From: stem, To: encoded}
+		for _, layout := range policyFileLayouts {
+			from := filepath.Join(w.Path, layout.dir, stem+layout.suffix)
+			if _, err := w.ReadFile(from); err != nil {
+				if os.IsNotExist(err) {
+					continue
+				}
+				return nil, fmt.Errorf("failed to read %s: %w", from, err)
+			}
+			to := filepath.Join(w.Path, layout.dir, encoded+layout.suffix)
+			if _, err := w.ReadFile(to); err == nil {
+				return nil, fmt.Errorf("cannot migrate %s: %s already exists", w.relativePath(from), w.relativePath(to))
+			}
+			migration.Files = append(migration.Files, w.relativePath(from))
+		}
+		migrations = append(migrations, migration)
+	}
+	return migrations, nil
+}
+
+// MigrateFilenames renames the files of the policies still using the legacy
+// file name, updates the output paths of the workspace manifest and builds
+// the filename index of every policy file, failing with
+// ErrFilenameCollision when two policy IDs share a file name. The changes
+// are written together, in the open transaction or as a generation of
+// their own. Returns the migrations done.
+func (w *Workspace) MigrateFilenames() ([]FilenameMigration, error) {
+	if w.tx != nil {
+		return w.migrateFilenames()
+	}
+
+	tx, err := w.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Abort()
+	migrations, err := w.migrateFilenames()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return migrations, nil
+}
+
+// migrateFilenames migrates the workspace files in the open transaction.
+func (w *Workspace) migrateFilenames() ([]FilenameMigration, error) {
+	migrations, err := w.PendingMigrations()
+	if err != nil {
+		return nil, err
+	}
+	manifest, err := w.LoadManifest()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, migration := range migrations {
+		for _, layout := range policyFileLayouts {
+			from := filepath.Join(w.Path, layout.dir, migration.From+layout.suffix)
+			data, err := w.ReadFile(from)
+			if os.IsNotExist(err) {
+				continue
+			}
+			if err != nil {
+				return nil, fmt.Errorf("failed to read %s: %w", from, err)
+			}
+			to := filepath.Join(w.Path, layout.dir, migration.To+layout.suffix)
+			if err := w.WriteFile(to, data); err != nil {
+				return nil, err
+			}
+			if err := w.RemoveFile(from); err != nil {
+				return nil, err
+			}
+
+			for i := range manifest.Outputs {
+				if manifest.Outputs[i].Output.Path == w.relativePath(from) {
+					manifest.Outputs[i].Output.Path = w.relativePath(to)
+				}
+			}
+		}
+	}
+	if len(migrations) > 0 {
+		if err := w.SaveManifest(manifest); err != nil {
+			return nil, err
+		}
+	}
+
+	// Index every policy file named after its ID
+	indexMu.Lock()
+	defer indexMu.Unlock()
+	index, err := w.LoadFilenameIndex()
+	if err != nil {
+		return nil, err
+	}
+	ids, err := w.policyFileIDs()
+	if err != nil {
+		return nil, err
+	}
+	for _, stem := range slices.Sorted(maps.Keys(ids)) {
+		if EncodePolicyFilename(ids[stem]) != stem {
+			continue
+		}
+		if err := index.Claim(stem, ids[stem]); err != nil {
+			return nil, err
+		}
+	}
+	if err := w.SaveFilenameIndex(index); err != nil {
+		return nil, err
+	}
+	return migrations, nil
+}
+
+// policyFileIDs returns the ID of each policy or PolicySet file at the root
+// of the workspace, by file name stem.
+func (w *Workspace) policyFileIDs() (map[string]string, error) {
+	paths, err := filepath.Glob(filepath.Join(w.Path, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	if w.tx != nil {
+		paths = append(paths, w.tx.stagedPaths(w.Path, ".json")...)
+	}
+
+	ids := make(map[string]string, len(paths))
+	for _, path := range paths {
+		data, err := w.ReadFile(path)
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			return nil, fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		var doc struct {
+			ID string `json:"id"`
+		}
+		if err := json.Unmarshal(data, &doc); err != nil || doc.ID == "" {
+			// Not a policy file
+			continue
+		}
+		ids[strings.TrimSuffix(filepath.Base(path), ".json")] = doc.ID
+	}
+	return ids, nil
+}
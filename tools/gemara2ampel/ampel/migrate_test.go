@@ -0,0 +1,76 @@
+package ampel
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestWorkspace_MigrateFilenames verifies legacy file names are migrated with their side-car files.
+func TestWorkspace_MigrateFilenames(t *testing.T) {
+	ws, err := NewWorkspace(t.TempDir())
+	require.NoError(t, err)
+	write := func(path, content string) {
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0600))
+	}
+
+	// A workspace written with the legacy file names
+	legacy := filepath.Join(ws.Path, "org-policy.json")
+	write(legacy, `{"id": "org/policy"}`)
+	write(filepath.Join(ws.Path, BaseDir, "org-policy.json"), `{"id": "org/policy"}`)
+	write(filepath.Join(ws.Path, "org-policy.locks.yaml"), "locks: []\n")
+	write(filepath.Join(ws.Path, "plain.json"), `{"id": "plain"}`)
+	write(filepath.Join(ws.Path, "custom-name.json"), `{"id": "org/custom"}`)
+	require.NoError(t, ws.RecordOutput(ManifestEntry{ID: "org/policy", Kind: ManifestKindPolicy, Output: FileDigest{Path: "org-policy.json"}}))
+
+	pending, err := ws.PendingMigrations()
+	require.NoError(t, err)
+	assert.Equal(t, []FilenameMigration{{
+		ID:    "org/policy",
+		From:  "org-policy",
+		To:    "org%2Fpolicy",
+		Files: []string{"org-policy.json", ".base/org-policy.json", "org-policy.locks.yaml"},
+	}}, pending)
+
+	migrations, err := ws.MigrateFilenames()
+	require.NoError(t, err)
+	assert.Equal(t, pending, migrations)
+
+	assert.NoFileExists(t, legacy)
+	assertFileContent(t, ws.GetPolicyPath("org/policy"), `{"id": "org/policy"}`)
+	assert.FileExists(t, ws.GetBasePath("org/policy"))
+	assert.FileExists(t, ws.GetLocksPath("org/policy"))
+	assert.FileExists(t, filepath.Join(ws.Path, "custom-name.json"), "custom output names are kept")
+
+	manifest, err := ws.LoadManifest()
+	require.NoError(t, err)
+	assert.Equal(t, "org%2Fpolicy.json", manifest.Entry("org/policy").Output.Path)
+
+	index, err := ws.LoadFilenameIndex()
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"org%2fpolicy": "org/policy", "plain": "plain"}, index.Files)
+
+	// Migrating again changes nothing, and the migration rolls back as one generation
+	migrations, err = ws.MigrateFilenames()
+	require.NoError(t, err)
+	assert.Empty(t, migrations)
+	_, err = ws.Rollback(false)
+	require.NoError(t, err)
+	assertFileContent(t, legacy, `{"id": "org/policy"}`)
+}
+
+// TestWorkspace_MigrateFilenamesConflict verifies migrations never overwrite files.
+func TestWorkspace_MigrateFilenamesConflict(t *testing.T) {
+	ws, err := NewWorkspace(t.TempDir())
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(ws.Path, "org-policy.json"), []byte(`{"id": "org:policy"}`), 0600))
+	require.NoError(t, os.WriteFile(ws.GetPolicyPath("org:policy"), []byte(`{"id": "other"}`), 0600))
+
+	_, err = ws.MigrateFilenames()
+	assert.Error(t, err)
+	assertFileContent(t, filepath.Join(ws.Path, "org-policy.json"), `{"id": "org:policy"}`)
+}
@@ -8,6 +8,18 @@ type TransformOptions struct {
 	// Catalog is an optional catalog used to enrich tenets with control details
 	Catalog *gemara.Catalog
 
+	// Catalogs are additional catalogs searched together with Catalog
+	Catalogs []*gemara.Catalog
+
+	// CatalogIndex is a prebuilt requirement index. When set, Catalog and
+	// Catalogs are ignored
+	CatalogIndex *CatalogIndex
+
+	// FrameworkNames renames the guideline mapping references of catalog
+	// controls when they are added to Meta.Controls
+	// Key: mapping reference ID, Value: framework name ("" to omit)
+	FrameworkNames map[string]string
+
 	// CELTemplates provides custom CEL code templates for generating verification logic
 	// Key: template name, Value: CEL template string with {{.Parameter}} placeholders
 	CELTemplates map[string]string
@@ -23,6 +35,21 @@ type TransformOptions struct {
 	// DefaultRule specifies the overall policy rule if not provided
 	// Default: "all(tenets)" meaning all tenets must pass
 	DefaultRule string
+
+	// Trace, when set, is populated with the provenance of every generated tenet
+	Trace *PolicyTrace
+
+	// Diagnostics, when set, collects the findings reported during transformation
+	Diagnostics *Diagnostics
+
+	// ParameterConflicts controls how parameters defined differently by
+	// several assessment plans are handled
+	// Default: ParameterConflictFirstWins
+	ParameterConflicts ParameterConflictMode
+
+	// ContextValues overrides the runtime value of context entries, keyed by
+	// parameter ID or context key
+	ContextValues map[string]interface{}
 }
 
 // TransformOption is a function that configures TransformOptions.
@@ -40,6 +67,59 @@ func WithCatalog(catalog *gemara.Catalog) TransformOption {
 	}
 }
 
+// WithCatalogs adds catalogs used for enriching tenets. Requirements are
+// looked up in all catalogs through an index built once per transformation.
+// A plan can name the catalog of its requirement with a catalog-qualified ID
+// ("catalog-id:requirement-id"). Unqualified IDs defined by several catalogs
+// are resolved against the catalogs imported by the policy and otherwise
+// reported as ambiguous-requirement diagnostics.
+//
+// Example:
+//
+//	ampel.FromPolicy(policy, ampel.WithCatalogs(ospsBaseline, slsa, internal))
+func WithCatalogs(catalogs ...*gemara.Catalog) TransformOption {
+	return func(opts *TransformOptions) {
+		opts.Catalogs = append(opts.Catalogs, catalogs...)
+	}
+}
+
+// WithCatalogIndex sets a prebuilt catalog index, avoiding re-indexing large
+// catalogs for every policy. It replaces WithCatalog and WithCatalogs.
+//
+// Example:
+//
+//	index, err := ampel.NewCatalogIndex(ospsBaseline, slsa)
+//	ampel.FromPolicies(policies, ampel.WithTransformOptions(ampel.WithCatalogIndex(index)))
+func WithCatalogIndex(index *CatalogIndex) TransformOption {
+	return func(opts *TransformOptions) {
+		opts.CatalogIndex = index
+	}
+}
+
+// WithFrameworkNames sets the framework names used for the guideline mappings
+// of catalog controls. Every control found in a catalog adds its guideline
+// mapping entries (references to NIST 800-53, OSPS Baseline, CIS, ...) to
+// Meta.Controls, using the mapping reference ID as the framework name unless
+// it is renamed here. Mapping a reference ID to "" leaves its entries out.
+// Repeated calls merge the names.
+//
+// Example:
+//
+//	ampel.FromPolicy(policy,
+//	    ampel.WithCatalog(catalog),
+//	    ampel.WithFrameworkNames(map[string]string{"OSPS-B": "OSPS", "CCM": ""}),
+//	)
+func WithFrameworkNames(names map[string]string) TransformOption {
+	return func(opts *TransformOptions) {
+		if opts.FrameworkNames == nil {
+			opts.FrameworkNames = make(map[string]string)
+		}
+		for k, v := range names {
+			opts.FrameworkNames[k] = v
+		}
+	}
+}
+
 // WithCELTemplates provides custom CEL code templates for generating
 // verification logic. Templates should use Go text/template syntax with
 // parameters accessible via {{.ParameterName}}.
@@ -92,11 +172,52 @@ func WithDefaultRule(rule string) TransformOption {
 	}
 }
 
+// WithTrace records how each tenet was generated into trace: the source plan
+// and method, the matched evidence keywords, the chosen template, the inferred
+// predicate type, the parameters the template read, the catalog enrichment
+// and whether a fallback was used. Tenets are appended to trace, so one trace
+// collects every policy of FromPolicies or of resolved imports.
+//
+// Example:
+//
+//	trace := &ampel.PolicyTrace{}
+//	policy, err := ampel.FromPolicy(gemaraPolicy, ampel.WithTrace(trace))
+//	for _, t := range trace.Tenets {
+//	    fmt.Println(t.TenetID, t.Template)
+//	}
+func WithTrace(trace *PolicyTrace) TransformOption {
+	return func(opts *TransformOptions) {
+		opts.Trace = trace
+	}
+}
+
+// WithDiagnostics collects the findings reported during transformation into
+// diags: skipped non-automated methods, duplicate parameter IDs, requirements
+// missing from the catalog, unknown templates, template parameters the plan
+// does not define and required context entries left without a value.
+// Diagnostics are appended, so one collection can be shared by several
+// transformations.
+func WithDiagnostics(diags *Diagnostics) TransformOption {
+	return func(opts *TransformOptions) {
+		opts.Diagnostics = diags
+	}
+}
+
+// report records a diagnostic if diagnostics collection is enabled.
+func (opts *TransformOptions) report(severity Severity, code string, location SourceLocation, format string, args ...interface{}) {
+	if opts.Diagnostics != nil {
+		opts.Diagnostics.Add(severity, code, location, format, args...)
+	}
+}
+
 // applyDefaults sets default values for any unset options.
 func (opts *TransformOptions) applyDefaults() {
 	if opts.DefaultRule == "" {
 		opts.DefaultRule = "all(tenets)"
 	}
+	if opts.ParameterConflicts == "" {
+		opts.ParameterConflicts = ParameterConflictFirstWins
+	}
 	if opts.CELTemplates == nil {
 		opts.CELTemplates = make(map[string]string)
 	}
@@ -120,7 +241,8 @@ type PolicySetOptions struct {
 	// Version specifies the policy set version
 	Version string
 
-	// Metadata contains additional policy set custom metadata
+	// Metadata sets PolicySetMeta fields by name: runtime, enforce,
+	// expiration, frameworks and origin
 	Metadata map[string]interface{}
 
 	// Meta maps policy IDs to their metadata (controls, enforcement, etc.)
@@ -128,6 +250,14 @@ type PolicySetOptions struct {
 
 	// TransformOptions are passed to FromPolicy for each policy transformation
 	TransformOptions []TransformOption
+
+	// Resolver loads imported policies so they can be converted inline.
+	// When nil, imports are added as external references.
+	Resolver PolicyResolver
+
+	// HoistContext moves context entries shared identically by member
+	// policies into the PolicySet common context
+	HoistContext bool
 }
 
 // PolicySetOption is a function that configures PolicySetOptions.
@@ -148,13 +278,21 @@ func WithPolicySetMetadata(name, description, version string) PolicySetOption {
 	}
 }
 
-// WithPolicySetCustomMetadata sets custom metadata fields for the PolicySet.
+// WithPolicySetCustomMetadata sets PolicySetMeta fields by name. Supported
+// keys are runtime, enforce, expiration (RFC 3339 string or time.Time),
+// frameworks (FrameworkRef values or maps with id, name and definition URI)
+// and origin (URI string or *ResourceDescriptor). The PolicySet format has no
+// free-form metadata, so other keys, such as author or organization, are
+// ignored and reported as unsupported-metadata diagnostics.
 //
 // Example:
 //
 //	metadata := map[string]interface{}{
-//	    "author": "Security Team",
-//	    "organization": "ACME Corp",
+//	    "enforce": "ON",
+//	    "expiration": "2027-01-01T00:00:00Z",
+//	    "frameworks": []interface{}{
+//	        map[string]interface{}{"id": "OSPS", "name": "OSPS Baseline"},
+//	    },
 //	}
 //	ampel.FromPolicies(policies, ampel.WithPolicySetCustomMetadata(metadata))
 func WithPolicySetCustomMetadata(metadata map[string]interface{}) PolicySetOption {
@@ -206,3 +344,25 @@ func WithTransformOptions(transformOpts ...TransformOption) PolicySetOption {
 		opts.TransformOptions = append(opts.TransformOptions, transformOpts...)
 	}
 }
+
+// WithPolicyResolver enables inline conversion of imported policies in
+// FromPolicyWithImports. Each entry in imports.policies is loaded through the
+// resolver and converted with FromPolicy, recursively following the imports of
+// imported policies. Import cycles are reported as errors, policies imported
+// through more than one path are converted once, and the import reference and
+// resolved content digest are recorded in each policy's Meta.Origin. Source is
+// left unset, since Ampel would fetch a policy from its Source location and
+// apply the inline tenets as overlays.
+//
+// Example:
+//
+//	resolver := ampel.MultiResolver{
+//	    &ampel.FileResolver{BaseDir: "policies"},
+//	    &ampel.MirrorResolver{Root: "mirror"},
+//	}
+//	ampel.FromPolicyWithImports(policy, ampel.WithPolicyResolver(resolver))
+func WithPolicyResolver(resolver PolicyResolver) PolicySetOption {
+	return func(opts *PolicySetOptions) {
+		opts.Resolver = resolver
+	}
+}
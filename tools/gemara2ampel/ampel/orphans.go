@@ -0,0 +1,121 @@
+package ampel
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// OrphanMode selects what MergePolicy does with existing tenets the
+// generated policy no longer contains, such as hand-written checks or
+// tenets of a removed assessment plan.
+type OrphanMode string
+
+const (
+	// OrphanDelete drops orphaned tenets from the merged policy
+	OrphanDelete OrphanMode = "delete"
+
+	// OrphanKeep keeps orphaned tenets in the merged policy, marked as
+	// manual-only with ManualOnlyMarker
+	OrphanKeep OrphanMode = "keep"
+
+	// OrphanArchive drops orphaned tenets from the merged policy and lists
+	// them in MergeStats.Orphans to be archived with Workspace.ArchiveTenets
+	OrphanArchive OrphanMode = "archive"
+)
+
+// ParseOrphanMode parses an orphan mode name (delete, keep or archive).
+func ParseOrphanMode(name string) (OrphanMode, error) {
+	switch mode := OrphanMode(name); mode {
+	case OrphanDelete, OrphanKeep, OrphanArchive:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("unknown orphan mode %q (use delete, keep or archive)", name)
+	}
+}
+
+// WithOrphanMode sets how tenets missing from the generated policy are
+// handled. The default is OrphanDelete. Tenets marked as manual-only are
+// kept in every mode.
+//
+// Example:
+//
+//	ampel.MergePolicy(existing, generated, ampel.WithOrphanMode(ampel.OrphanArchive))
+func WithOrphanMode(mode OrphanMode) MergeOption {
+	return func(opts *MergeOptions) {
+		opts.OrphanMode = mode
+	}
+}
+
+// ManualOnlyMarker is the CEL comment line starting the code of tenets kept
+// without a generated counterpart. Marked tenets are never removed by a
+// merge; the marker is dropped once the tenet is generated again.
+const ManualOnlyMarker = "// gemara2ampel:manual-only"
+
+// IsManualOnly reports whether a tenet is marked as manual-only.
+func IsManualOnly(tenet *Tenet) bool {
+	return strings.HasPrefix(tenet.GetCode(), ManualOnlyMarker)
+}
+
+// markManualOnly returns a copy of tenet marked as manual-only.
+func markManualOnly(tenet *Tenet) *Tenet {
+	marked := proto.Clone(tenet).(*Tenet)
+	if !IsManualOnly(marked) {
+		marked.Code = ManualOnlyMarker + "\n" + marked.Code
+	}
+	return marked
+}
+
+// unmarkManualOnly removes the manual-only marker from a tenet's code.
+func unmarkManualOnly(tenet *Tenet) {
+	if IsManualOnly(tenet) {
+		tenet.Code = strings.TrimPrefix(strings.TrimPrefix(tenet.Code, ManualOnlyMarker), "\n")
+	}
+}
+
+// ArchivedTenet is an orphaned tenet moved out of a workspace policy.
+type ArchivedTenet struct {
+	Tenet *Tenet `json:"tenet"`
+
+	// PolicyID is the member policy the tenet belonged to, for tenets
+	// archived from a PolicySet
+	PolicyID string `json:"policy_id,omitempty"`
+
+	// Reason explains why the tenet was removed from the policy
+	Reason string `json:"reason"`
+
+	// ArchivedAt is when the tenet was archived
+	ArchivedAt time.Time `json:"archived_at"`
+}
+
+// OrphanReason describes why the tenets of an existing policy are missing
+// from the generated policy, for archived tenets.
+func OrphanReason(generated *Policy) string {
+	return fmt.Sprintf("no longer generated from Gemara policy %s (version %d)", generated.GetId(), generated.GetMeta().GetVersion())
+}
+
+// RestoreArchivedTenet adds an archived tenet back to policy, marked as
+// manual-only so later merges keep it. Fails when the policy already has a
+// tenet with the same ID.
+func RestoreArchivedTenet(policy *Policy, archived ArchivedTenet) error {
+	if archived.Tenet == nil {
+		return fmt.Errorf("archive entry has no tenet")
+	}
+	if _, ok := tenetsByID(policy)[archived.Tenet.Id]; ok {
+		return fmt.Errorf("policy %s already has a tenet %s", policy.GetId(), archived.Tenet.Id)
+	}
+	policy.Tenets = append(policy.Tenets, markManualOnly(archived.Tenet))
+	return nil
+}
+
+// RestorePolicySetArchivedTenet adds an archived tenet back to its member
+// policy in policySet, as RestoreArchivedTenet does.
+func RestorePolicySetArchivedTenet(policySet *PolicySet, archived ArchivedTenet) error {
+	policy, ok := policiesByID(policySet)[archived.PolicyID]
+	if !ok {
+		return fmt.Errorf("policy set %s has no member policy %q", policySet.GetId(), archived.PolicyID)
+	}
+	return RestoreArchivedTenet(policy, archived)
+}
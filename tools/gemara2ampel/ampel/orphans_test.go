@@ -0,0 +1,118 @@
+package ampel
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestMergePolicy_OrphanModes verifies each orphan mode.
+func TestMergePolicy_OrphanModes(t *testing.T) {
+	tests := []struct {
+		name        string
+		mode        OrphanMode
+		wantTenets  []string
+		wantKept    int
+		wantRemoved int
+	}{
+		{"default", "", []string{"tenet-1"}, 0, 1},
+		{"delete", OrphanDelete, []string{"tenet-1"}, 0, 1},
+		{"keep", OrphanKeep, []string{"tenet-1", "custom-check"}, 1, 0},
+		{"archive", OrphanArchive, []string{"tenet-1"}, 0, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			existing := newMergeTestPolicy(withTenets(
+				&Tenet{Id: "tenet-1", Code: "generated_code"},
+				&Tenet{Id: "custom-check", Code: "manual_check"},
+			))
+			generated := newMergeTestPolicy(withVersion(2), withTenets(&Tenet{Id: "tenet-1", Code: "generated_code"}))
+
+			merged, stats, err := MergePolicy(existing, generated, WithOrphanMode(tt.mode))
+			require.NoError(t, err)
+
+			var ids []string
+			for _, tenet := range merged.Tenets {
+				ids = append(ids, tenet.Id)
+			}
+			assert.Equal(t, tt.wantTenets, ids)
+			assert.Equal(t, tt.wantKept, stats.TenetsKept)
+			assert.Equal(t, tt.wantRemoved, stats.TenetsRemoved)
+			require.Len(t, stats.Orphans, tt.wantRemoved)
+			if tt.wantRemoved > 0 {
+				assert.Equal(t, "manual_check", stats.Orphans[0].Code)
+			}
+		})
+	}
+
+	_, _, err := MergePolicy(newMergeTestPolicy(), newMergeTestPolicy(), WithOrphanMode("drop"))
+	assert.Error(t, err)
+}
+
+// TestMergePolicy_ManualOnlyTenets verifies marked tenets survive every mode
+// and lose the marker once generated again.
+func TestMergePolicy_ManualOnlyTenets(t *testing.T) {
+	existing := newMergeTestPolicy(withTenets(
+		&Tenet{Id: "tenet-1", Code: "generated_code"},
+		&Tenet{Id: "custom-check", Code: "manual_check"},
+	))
+	generated := newMergeTestPolicy(withVersion(2), withTenets(&Tenet{Id: "tenet-1", Code: "generated_code"}))
+
+	merged, _, err := MergePolicy(existing, generated, WithOrphanMode(OrphanKeep))
+	require.NoError(t, err)
+	kept := merged.Tenets[1]
+	assert.True(t, IsManualOnly(kept))
+	assert.Equal(t, ManualOnlyMarker+"\nmanual_check", kept.Code)
+	assert.False(t, IsManualOnly(existing.Tenets[1]))
+
+	// Marked tenets are kept in delete mode and marked once
+	merged, stats, err := MergePolicy(merged, generated)
+	require.NoError(t, err)
+	require.Len(t, merged.Tenets, 2)
+	assert.Equal(t, ManualOnlyMarker+"\nmanual_check", merged.Tenets[1].Code)
+	assert.Equal(t, 1, stats.TenetsKept)
+
+	// Generated again, the tenet keeps its code without the marker
+	generated.Tenets = append(generated.Tenets, &Tenet{Id: "custom-check", Code: "generated_check"})
+	merged, _, err = MergePolicy(merged, generated)
+	require.NoError(t, err)
+	assert.Equal(t, "manual_check", merged.Tenets[1].Code)
+}
+
+// TestRestoreArchivedTenet verifies restored tenets are marked as manual-only.
+func TestRestoreArchivedTenet(t *testing.T) {
+	existing := newMergeTestPolicy(withTenets(
+		&Tenet{Id: "tenet-1", Code: "generated_code"},
+		&Tenet{Id: "custom-check", Code: "manual_check"},
+	))
+	generated := newMergeTestPolicy(withVersion(2), withTenets(&Tenet{Id: "tenet-1", Code: "generated_code"}))
+	merged, stats, err := MergePolicy(existing, generated, WithOrphanMode(OrphanArchive))
+	require.NoError(t, err)
+
+	archived := ArchivedTenet{Tenet: stats.Orphans[0], Reason: OrphanReason(generated)}
+	assert.Equal(t, "no longer generated from Gemara policy test-policy (version 2)", archived.Reason)
+
+	require.NoError(t, RestoreArchivedTenet(merged, archived))
+	require.Len(t, merged.Tenets, 2)
+	assert.True(t, IsManualOnly(merged.Tenets[1]))
+	assert.Error(t, RestoreArchivedTenet(merged, archived))
+	assert.Error(t, RestoreArchivedTenet(merged, ArchivedTenet{}))
+
+	// The restored tenet survives the next merge
+	merged, _, err = MergePolicy(merged, generated, WithOrphanMode(OrphanArchive))
+	require.NoError(t, err)
+	assert.Len(t, merged.Tenets, 2)
+}
+
+// TestParseOrphanMode verifies orphan mode names.
+func TestParseOrphanMode(t *testing.T) {
+	for _, name := range []string{"delete", "keep", "archive"} {
+		mode, err := ParseOrphanMode(name)
+		require.NoError(t, err)
+		assert.Equal(t, OrphanMode(name), mode)
+	}
+	_, err := ParseOrphanMode("drop")
+	assert.Error(t, err)
+}
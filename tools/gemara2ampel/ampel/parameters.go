@@ -0,0 +1,170 @@
+package ampel
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/gemaraproj/go-gemara"
+)
+
+// ParameterConflictMode controls how FromPolicy handles a parameter ID that
+// several assessment plans define with different accepted values.
+type ParameterConflictMode string
+
+const (
+	// ParameterConflictFirstWins keeps the first definition in Policy.Context
+	// and reports each conflict as a warning diagnostic
+	ParameterConflictFirstWins ParameterConflictMode = "first"
+
+	// ParameterConflictNamespace gives each plan its own context key
+	// ("plan-id.param-id") for conflicting parameters and rewrites the CEL
+	// context references of that plan to match
+	ParameterConflictNamespace ParameterConflictMode = "namespace"
+
+	// ParameterConflictFail fails the transformation with a
+	// *ParameterConflictError listing every conflict
+	ParameterConflictFail ParameterConflictMode = "fail"
+)
+
+// ParseParameterConflictMode parses a conflict mode name (first, namespace or fail).
+func ParseParameterConflictMode(name string) (ParameterConflictMode, error) {
+	switch mode := ParameterConflictMode(name); mode {
+	case ParameterConflictFirstWins, ParameterConflictNamespace, ParameterConflictFail:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("unknown parameter conflict mode %q (use first, namespace or fail)", name)
+	}
+}
+
+// ParameterDefinition is one assessment plan's definition of a parameter.
+type ParameterDefinition struct {
+	PlanID         string   `json:"plan_id"`
+	AcceptedValues []string `json:"accepted_values"`
+}
+
+// ParameterConflict describes a parameter ID defined with different accepted
+// values by more than one assessment plan.
+type ParameterConflict struct {
+	ParameterID string                `json:"parameter_id"`
+	Definitions []ParameterDefinition `json:"definitions"`
+}
+
+// ParameterConflictError is returned by FromPolicy in ParameterConflictFail
+// mode when plans define the same parameter differently.
+type ParameterConflictError struct {
+	PolicyID  string
+	Conflicts []ParameterConflict
+}
+
+// Error formats the conflict report, one definition per line.
+func (e *ParameterConflictError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "policy %s has %d conflicting parameter definition(s):", e.PolicyID, len(e.Conflicts))
+	for _, conflict := range e.Conflicts {
+		fmt.Fprintf(&b, "\n  %s:", conflict.ParameterID)
+		for _, def := range conflict.Definitions {
+			fmt.Fprintf(&b, "\n    plan %s accepts [%s]", def.PlanID, strings.Join(def.AcceptedValues, ", "))
+		}
+	}
+	return b.String()
+}
+
+// WithParameterConflicts sets how parameters defined differently by several
+// assessment plans are handled. The default is ParameterConflictFirstWins.
+//
+// Example:
+//
+//	ampel.FromPolicy(policy, ampel.WithParameterConflicts(ampel.ParameterConflictNamespace))
+func WithParameterConflicts(mode ParameterConflictMode) TransformOption {
+	return func(opts *TransformOptions) {
+		opts.ParameterConflicts = mode
+	}
+}
+
+// findParameterConflicts returns the parameters defined with different
+// accepted values by more than one plan, sorted by parameter ID.
+func findParameterConflicts(policy *gemara.Policy) []ParameterConflict {
+	definitions := make(map[string][]ParameterDefinition)
+	for _, plan := range policy.Adherence.AssessmentPlans {
+		for _, param := range plan.Parameters {
+			definitions[param.Id] = append(definitions[param.Id], ParameterDefinition{
+				PlanID:         plan.Id,
+				AcceptedValues: param.AcceptedValues,
+			})
+		}
+	}
+
+	var conflicts []ParameterConflict
+	for paramID, defs := range definitions {
+		for _, def := range defs[1:] {
+			if !slices.Equal(def.AcceptedValues, defs[0].AcceptedValues) {
+				conflicts = append(conflicts, ParameterConflict{ParameterID: paramID, Definitions: defs})
+				break
+			}
+		}
+	}
+
+	sort.Slice(conflicts, func(i, j int) bool {
+		return conflicts[i].ParameterID < conflicts[j].ParameterID
+	})
+	return conflicts
+}
+
+// namespacedContextKey returns the context key of a plan's parameter in
+// ParameterConflictNamespace mode.
+func namespacedContextKey(planID, paramID string) string {
+	return planID + "." + paramID
+}
+
+// planContextKeys maps each parameter ID of a plan to its Policy.Context key.
+// Only conflicting parameters in namespace mode get a key other than their ID.
+// conflicts are the findParameterConflicts of the plan's policy.
+func planContextKeys(plan gemara.AssessmentPlan, conflicts []ParameterConflict, options *TransformOptions) map[string]string {
+	keys := make(map[string]string, len(plan.Parameters))
+	for _, param := range plan.Parameters {
+		keys[param.Id] = param.Id
+	}
+
+	if options.ParameterConflicts != ParameterConflictNamespace {
+		return keys
+	}
+	for _, conflict := range conflicts {
+		if _, ok := keys[conflict.ParameterID]; ok {
+			keys[conflict.ParameterID] = namespacedContextKey(plan.Id, conflict.ParameterID)
+		}
+	}
+	return keys
+}
+
+// ContextAcceptedValues returns the accepted values of each Policy.Context
+// key FromPolicy generates for policy with the same options. Keys of
+// parameters without accepted values are omitted. Pass the result to
+// WithContextAcceptedValues so a workspace merge can check the context values
+// set by operators.
+func ContextAcceptedValues(policy *gemara.Policy, opts ...TransformOption) map[string][]string {
+	options := &TransformOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
+	options.applyDefaults()
+
+	conflicts := findParameterConflicts(policy)
+	accepted := make(map[string][]string)
+	seen := make(map[string]bool)
+	for _, plan := range policy.Adherence.AssessmentPlans {
+		contextKeys := planContextKeys(plan, conflicts, options)
+		for _, param := range plan.Parameters {
+			key := contextKeys[param.Id]
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			if len(param.AcceptedValues) > 0 {
+				accepted[key] = param.AcceptedValues
+			}
+		}
+	}
+	return accepted
+}
@@ -0,0 +1,117 @@
+package ampel
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/gemaraproj/go-gemara"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// createConflictTestPolicy returns a policy where two plans define builder-id differently.
+func createConflictTestPolicy() *gemara.Policy {
+	policy := createTestPolicy()
+	first := policy.Adherence.AssessmentPlans[0]
+	first.Parameters = []gemara.Parameter{
+		{Id: "builder-id", AcceptedValues: []string{"https://github.com/actions/runner"}},
+		{Id: "shared", AcceptedValues: []string{"same"}},
+	}
+	second := first
+	second.Id = "plan-02"
+	second.RequirementId = "REQ-02"
+	second.Parameters = []gemara.Parameter{
+		{Id: "builder-id", AcceptedValues: []string{"https://gitlab.com/runner"}},
+		{Id: "shared", AcceptedValues: []string{"same"}},
+	}
+	policy.Adherence.AssessmentPlans = []gemara.AssessmentPlan{first, second}
+	return policy
+}
+
+// TestParameterConflicts_FirstWins verifies the default mode keeps the first definition and reports a warning.
+func TestParameterConflicts_FirstWins(t *testing.T) {
+	ampelPolicy, diags, err := FromPolicyWithDiagnostics(createConflictTestPolicy())
+	require.NoError(t, err)
+
+	assert.Len(t, ampelPolicy.Context, 2)
+	assert.Equal(t, "https://github.com/actions/runner", ampelPolicy.Context["builder-id"].Value.GetStringValue())
+	for _, tenet := range ampelPolicy.Tenets {
+		assert.Contains(t, tenet.Code, `context["builder-id"]`)
+	}
+
+	conflicts := findDiagnostics(diags, DiagParameterConflict)
+	require.Len(t, conflicts, 1)
+	assert.Equal(t, SeverityWarning, conflicts[0].Severity)
+	assert.False(t, diags.HasErrors())
+	assert.Equal(t, "plan-02", conflicts[0].Location.PlanID)
+
+	// Identical definitions are not conflicts
+	assert.Len(t, findDiagnostics(diags, DiagDuplicateParameter), 1)
+}
+
+// TestParameterConflicts_Namespace verifies conflicting parameters get per-plan context keys.
+func TestParameterConflicts_Namespace(t *testing.T) {
+	ampelPolicy, diags, err := FromPolicyWithDiagnostics(createConflictTestPolicy(),
+		WithParameterConflicts(ParameterConflictNamespace))
+	require.NoError(t, err)
+	assert.False(t, diags.HasErrors())
+
+	require.Len(t, ampelPolicy.Context, 3)
+	assert.NotContains(t, ampelPolicy.Context, "builder-id")
+	assert.Equal(t, "https://github.com/actions/runner", ampelPolicy.Context["plan-01.builder-id"].Value.GetStringValue())
+	assert.Equal(t, "https://gitlab.com/runner", ampelPolicy.Context["plan-02.builder-id"].Value.GetStringValue())
+	assert.Contains(t, ampelPolicy.Context, "shared")
+
+	require.Len(t, ampelPolicy.Tenets, 2)
+	assert.Contains(t, ampelPolicy.Tenets[0].Code, `context["plan-01.builder-id"]`)
+	assert.Contains(t, ampelPolicy.Tenets[1].Code, `context["plan-02.builder-id"]`)
+}
+
+// TestParameterConflicts_Fail verifies fail mode returns a conflict report.
+func TestParameterConflicts_Fail(t *testing.T) {
+	_, err := FromPolicy(createConflictTestPolicy(), WithParameterConflicts(ParameterConflictFail))
+	require.Error(t, err)
+
+	var conflictErr *ParameterConflictError
+	require.True(t, errors.As(err, &conflictErr))
+	require.Len(t, conflictErr.Conflicts, 1)
+	conflict := conflictErr.Conflicts[0]
+	assert.Equal(t, "builder-id", conflict.ParameterID)
+	require.Len(t, conflict.Definitions, 2)
+	assert.Equal(t, "plan-01", conflict.Definitions[0].PlanID)
+	assert.Equal(t, "plan-02", conflict.Definitions[1].PlanID)
+	assert.Contains(t, err.Error(), "plan plan-02 accepts [https://gitlab.com/runner]")
+
+	// Policies without conflicts convert normally
+	_, err = FromPolicy(createTestPolicy(), WithParameterConflicts(ParameterConflictFail))
+	assert.NoError(t, err)
+}
+
+// TestContextAcceptedValues verifies accepted values are keyed like the generated context.
+func TestContextAcceptedValues(t *testing.T) {
+	policy := createConflictTestPolicy()
+
+	accepted := ContextAcceptedValues(policy)
+	assert.Equal(t, map[string][]string{
+		"builder-id": {"https://github.com/actions/runner"},
+		"shared":     {"same"},
+	}, accepted)
+
+	accepted = ContextAcceptedValues(policy, WithParameterConflicts(ParameterConflictNamespace))
+	assert.Equal(t, map[string][]string{
+		"plan-01.builder-id": {"https://github.com/actions/runner"},
+		"plan-02.builder-id": {"https://gitlab.com/runner"},
+		"shared":             {"same"},
+	}, accepted)
+}
+
+// TestParseParameterConflictMode verifies conflict mode parsing.
+func TestParseParameterConflictMode(t *testing.T) {
+	for _, name := range []string{"first", "namespace", "fail"} {
+		mode, err := ParseParameterConflictMode(name)
+		require.NoError(t, err)
+		assert.Equal(t, ParameterConflictMode(name), mode)
+	}
+	_, err := ParseParameterConflictMode("merge")
+	assert.Error(t, err)
+}
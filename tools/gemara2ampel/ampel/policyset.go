@@ -0,0 +1,246 @@
+package ampel
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// WithHoistedContext moves context entries that several member policies
+// define identically into the PolicySet common context, so a shared value
+// such as an approved builder list is defined once and cannot drift between
+// policies. Entries with the same key but different definitions stay in their
+// policies and are reported as shared-context-conflict diagnostics to the
+// collector set with WithDiagnostics in the transform options.
+//
+// Example:
+//
+//	ampel.FromPolicies(policies,
+//	    ampel.WithHoistedContext(true),
+//	    ampel.WithTransformOptions(ampel.WithDiagnostics(&diags)),
+//	)
+func WithHoistedContext(hoist bool) PolicySetOption {
+	return func(opts *PolicySetOptions) {
+		opts.HoistContext = hoist
+	}
+}
+
+// contextDefinition is one member policy's definition of a context key.
+type contextDefinition struct {
+	policyID string
+	value    *ContextVal
+}
+
+// hoistSharedContext moves the context entries defined identically by every
+// member policy that defines them, and by at least two policies, into the
+// PolicySet common context.
+func hoistSharedContext(policySet *PolicySet, options *TransformOptions) {
+	definitions := make(map[string][]contextDefinition)
+	for _, policy := range policySet.Policies {
+		for key, value := range policy.Context {
+			definitions[key] = append(definitions[key], contextDefinition{policyID: policy.Id, value: value})
+		}
+	}
+
+	for _, key := range sortedKeys(definitions) {
+		defs := definitions[key]
+		if len(defs) < 2 {
+			continue
+		}
+
+		if differing := differingDefinitions(defs); len(differing) > 0 {
+			options.report(SeverityWarning, DiagSharedContextConflict, SourceLocation{PolicyID: differing[0]},
+				"context key %s is defined differently by policies %s; it stays in each policy",
+				key, strings.Join(definitionPolicyIDs(defs), ", "))
+			continue
+		}
+
+		if policySet.Common == nil {
+			policySet.Common = &PolicySetCommon{}
+		}
+		if policySet.Common.Context == nil {
+			policySet.Common.Context = make(map[string]*ContextVal)
+		}
+		policySet.Common.Context[key] = defs[0].value
+	}
+
+	if policySet.Common == nil {
+		return
+	}
+	for _, policy := range policySet.Policies {
+		for key := range policySet.Common.Context {
+			delete(policy.Context, key)
+		}
+		if len(policy.Context) == 0 {
+			policy.Context = nil
+		}
+	}
+}
+
+// differingDefinitions returns the IDs of the policies whose definition
+// differs from the first one.
+func differingDefinitions(defs []contextDefinition) []string {
+	var differing []string
+	for _, def := range defs[1:] {
+		if !proto.Equal(def.value, defs[0].value) {
+			differing = append(differing, def.policyID)
+		}
+	}
+	return differing
+}
+
+// definitionPolicyIDs returns the sorted IDs of the policies defining a key.
+func definitionPolicyIDs(defs []contextDefinition) []string {
+	ids := make([]string, 0, len(defs))
+	for _, def := range defs {
+		ids = append(ids, def.policyID)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// PolicySetMetaKeys are the metadata keys that set a PolicySetMeta field.
+var PolicySetMetaKeys = []string{"runtime", "enforce", "expiration", "frameworks", "origin"}
+
+// applyPolicySetMetadata sets the PolicySetMeta fields named by the keys of
+// PolicySetOptions.Metadata. Supported keys are runtime, enforce, expiration
+// (RFC 3339 string or time.Time), frameworks (FrameworkRef values or maps
+// with id, name and definition URI) and origin (URI string or
+// *ResourceDescriptor). Other keys, such as author, have no field to go to
+// and are reported as unsupported-metadata diagnostics.
+func applyPolicySetMetadata(meta *PolicySetMeta, metadata map[string]interface{}, options *TransformOptions) error {
+	for _, key := range sortedKeys(metadata) {
+		value := metadata[key]
+		var err error
+		switch key {
+		case "runtime":
+			meta.Runtime, err = metadataString(value)
+		case "enforce":
+			meta.Enforce, err = metadataString(value)
+		case "expiration":
+			meta.Expiration, err = metadataTimestamp(value)
+		case "frameworks":
+			meta.Frameworks, err = metadataFrameworks(value)
+		case "origin":
+			meta.Origin, err = metadataResource(value)
+		default:
+			options.report(SeverityWarning, DiagUnsupportedMetadata, SourceLocation{},
+				"policy set metadata %s has no PolicySetMeta field (use %s); ignored", key, strings.Join(PolicySetMetaKeys, ", "))
+		}
+		if err != nil {
+			return fmt.Errorf("metadata %s: %w", key, err)
+		}
+	}
+	return nil
+}
+
+// metadataString converts a metadata value to a string.
+func metadataString(value interface{}) (string, error) {
+	str, ok := value.(string)
+	if !ok {
+		return "", fmt.Errorf("expected a string, got %T", value)
+	}
+	return str, nil
+}
+
+// metadataTimestamp converts an RFC 3339 string or time.Time to a timestamp.
+func metadataTimestamp(value interface{}) (*timestamppb.Timestamp, error) {
+	switch v := value.(type) {
+	case time.Time:
+		return timestamppb.New(v), nil
+	case string:
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid RFC 3339 time: %w", err)
+		}
+		return timestamppb.New(t), nil
+	default:
+		return nil, fmt.Errorf("expected an RFC 3339 string or time.Time, got %T", value)
+	}
+}
+
+// metadataResource converts a URI string or resource descriptor.
+func metadataResource(value interface{}) (*ResourceDescriptor, error) {
+	switch v := value.(type) {
+	case *ResourceDescriptor:
+		return v, nil
+	case string:
+		return &ResourceDescriptor{Uri: v}, nil
+	default:
+		return nil, fmt.Errorf("expected a URI string or *ResourceDescriptor, got %T", value)
+	}
+}
+
+// metadataFrameworks converts a list of framework references.
+func metadataFrameworks(value interface{}) ([]*FrameworkRef, error) {
+	var items []interface{}
+	switch v := value.(type) {
+	case []*FrameworkRef:
+		return v, nil
+	case []map[string]interface{}:
+		for _, item := range v {
+			items = append(items, item)
+		}
+	case []interface{}:
+		items = v
+	default:
+		return nil, fmt.Errorf("expected a list of framework references, got %T", value)
+	}
+
+	frameworks := make([]*FrameworkRef, 0, len(items))
+	for i, item := range items {
+		switch v := item.(type) {
+		case *FrameworkRef:
+			frameworks = append(frameworks, v)
+		case map[string]interface{}:
+			framework := &FrameworkRef{}
+			for field, fieldValue := range v {
+				var err error
+				switch field {
+				case "id":
+					framework.Id, err = metadataString(fieldValue)
+				case "name":
+					framework.Name, err = metadataString(fieldValue)
+				case "definition":
+					framework.Definition, err = metadataResource(fieldValue)
+				default:
+					err = fmt.Errorf("unsupported field (use id, name or definition)")
+				}
+				if err != nil {
+					return nil, fmt.Errorf("framework %d %s: %w", i, field, err)
+				}
+			}
+			frameworks = append(frameworks, framework)
+		default:
+			return nil, fmt.Errorf("framework %d: expected a map or *FrameworkRef, got %T", i, item)
+		}
+	}
+	return frameworks, nil
+}
+
+// finishPolicySet applies the PolicySet-level options once all member
+// policies are converted.
+func finishPolicySet(policySet *PolicySet, psOptions *PolicySetOptions) error {
+	options := newTransformOptions(psOptions.TransformOptions)
+	if err := applyPolicySetMetadata(policySet.Meta, psOptions.Metadata, options); err != nil {
+		return fmt.Errorf("invalid policy set metadata: %w", err)
+	}
+	if psOptions.HoistContext {
+		hoistSharedContext(policySet, options)
+	}
+	return nil
+}
+
+// newTransformOptions applies transform options without defaults, to read
+// settings such as the diagnostics collector at the PolicySet level.
+func newTransformOptions(opts []TransformOption) *TransformOptions {
+	options := &TransformOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
+	return options
+}
@@ -0,0 +1,112 @@
+package ampel
+
+import (
+	"testing"
+
+	"github.com/gemaraproj/go-gemara"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// createHoistTestPolicies returns two policies sharing builder-id and disagreeing on scanner.
+func createHoistTestPolicies() []*gemara.Policy {
+	first := createTestPolicy()
+	first.Adherence.AssessmentPlans[0].Parameters = []gemara.Parameter{
+		{Id: "builder-id", AcceptedValues: []string{"https://github.com/actions/runner"}},
+		{Id: "scanner", AcceptedValues: []string{"trivy"}},
+		{Id: "only-first", AcceptedValues: []string{"x"}},
+	}
+
+	second := createTestPolicy()
+	second.Metadata.Id = "policy-002"
+	second.Adherence.AssessmentPlans[0].Parameters = []gemara.Parameter{
+		{Id: "builder-id", AcceptedValues: []string{"https://github.com/actions/runner"}},
+		{Id: "scanner", AcceptedValues: []string{"grype"}},
+	}
+	return []*gemara.Policy{first, second}
+}
+
+// TestFromPolicies_HoistedContext verifies identical entries move to the common context and conflicts are reported.
+func TestFromPolicies_HoistedContext(t *testing.T) {
+	var diags Diagnostics
+	policySet, err := FromPolicies(createHoistTestPolicies(),
+		WithHoistedContext(true),
+		WithTransformOptions(WithDiagnostics(&diags)),
+	)
+	require.NoError(t, err)
+
+	require.NotNil(t, policySet.Common)
+	require.Len(t, policySet.Common.Context, 1)
+	assert.Equal(t, "https://github.com/actions/runner", policySet.Common.Context["builder-id"].Value.GetStringValue())
+
+	first, second := policySet.Policies[0], policySet.Policies[1]
+	assert.NotContains(t, first.Context, "builder-id")
+	assert.NotContains(t, second.Context, "builder-id")
+	assert.Contains(t, first.Context, "only-first")
+	assert.Equal(t, "trivy", first.Context["scanner"].Value.GetStringValue())
+	assert.Equal(t, "grype", second.Context["scanner"].Value.GetStringValue())
+
+	// Tenet code still references the hoisted key
+	assert.Contains(t, first.Tenets[0].Code, `context["builder-id"]`)
+
+	conflicts := findDiagnostics(diags, DiagSharedContextConflict)
+	require.Len(t, conflicts, 1)
+	assert.Equal(t, "policy-002", conflicts[0].Location.PolicyID)
+	assert.Contains(t, conflicts[0].Message, "scanner")
+	assert.Contains(t, conflicts[0].Message, "policy-001, policy-002")
+}
+
+// TestFromPolicies_WithoutHoisting verifies context stays in each policy by default.
+func TestFromPolicies_WithoutHoisting(t *testing.T) {
+	policySet, err := FromPolicies(createHoistTestPolicies())
+	require.NoError(t, err)
+	assert.Nil(t, policySet.Common)
+	assert.Contains(t, policySet.Policies[0].Context, "builder-id")
+	assert.Contains(t, policySet.Policies[1].Context, "builder-id")
+}
+
+// TestFromPolicies_CustomMetadata verifies custom metadata is written to PolicySetMeta.
+func TestFromPolicies_CustomMetadata(t *testing.T) {
+	policySet, err := FromPolicies([]*gemara.Policy{createTestPolicy()},
+		WithPolicySetMetadata("set", "desc", "2.0.0"),
+		WithPolicySetCustomMetadata(map[string]interface{}{
+			"enforce":    "OFF",
+			"runtime":    "cel@v14.0",
+			"expiration": "2027-01-01T00:00:00Z",
+			"origin":     "https://github.com/example/policies",
+			"frameworks": []interface{}{
+				map[string]interface{}{"id": "OSPS", "name": "OSPS Baseline", "definition": "https://baseline.openssf.org"},
+			},
+		}),
+	)
+	require.NoError(t, err)
+
+	meta := policySet.Meta
+	assert.Equal(t, "desc", meta.Description)
+	assert.Equal(t, int64(2), meta.Version)
+	assert.Equal(t, "OFF", meta.Enforce)
+	assert.Equal(t, "cel@v14.0", meta.Runtime)
+	assert.Equal(t, int64(1798761600), meta.Expiration.GetSeconds())
+	assert.Equal(t, "https://github.com/example/policies", meta.Origin.GetUri())
+	require.Len(t, meta.Frameworks, 1)
+	assert.Equal(t, "OSPS", meta.Frameworks[0].Id)
+	assert.Equal(t, "OSPS Baseline", meta.Frameworks[0].Name)
+	assert.Equal(t, "https://baseline.openssf.org", meta.Frameworks[0].Definition.GetUri())
+
+	// Free-form keys have no field and are reported rather than failing
+	var diags Diagnostics
+	policySet, err = FromPolicies([]*gemara.Policy{createTestPolicy()},
+		WithPolicySetCustomMetadata(map[string]interface{}{"author": "Security Team", "enforce": "ON"}),
+		WithTransformOptions(WithDiagnostics(&diags)))
+	require.NoError(t, err)
+	assert.Equal(t, "ON", policySet.Meta.Enforce)
+	unsupported := findDiagnostics(diags, DiagUnsupportedMetadata)
+	require.Len(t, unsupported, 1)
+	assert.Equal(t, SeverityWarning, unsupported[0].Severity)
+	assert.Contains(t, unsupported[0].Message, "author")
+
+	_, err = FromPolicyWithImports(createTestPolicy(),
+		WithPolicySetCustomMetadata(map[string]interface{}{"expiration": "tomorrow"}))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid RFC 3339 time")
+}
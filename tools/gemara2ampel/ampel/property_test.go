@@ -0,0 +1,183 @@
+package ampel
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/gemaraproj/go-gemara"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+)
+
+// propertySeeds is the number of generated policies each property is checked against.
+const propertySeeds = 200
+
+// generatedCase is a generated policy with the options it is transformed with.
+type generatedCase struct {
+	seed   int64
+	policy *gemara.Policy
+	opts   []TransformOption
+
+	// namespaced is set when conflicts are transformed in namespace mode
+	namespaced bool
+
+	// conflicts and methodTemplatePlans are the parameter conflicts and the
+	// plans without an evidence template the generator produced
+	conflicts           map[string]bool
+	methodTemplatePlans map[string]bool
+}
+
+// generateCase generates the policy for seed, varying catalog enrichment,
+// scope filters and the parameter conflict mode between seeds.
+func generateCase(seed int64) generatedCase {
+	g := newPolicyGenerator(seed)
+	policy := g.Policy()
+	catalog := g.Catalog(policy)
+
+	opts := []TransformOption{WithScopeFilters(seed%2 == 0)}
+	if seed%3 != 0 {
+		opts = append(opts, WithCatalog(catalog))
+	}
+	namespaced := seed%5 == 0
+	if namespaced {
+		opts = append(opts, WithParameterConflicts(ParameterConflictNamespace))
+	}
+	return generatedCase{
+		seed:                seed,
+		policy:              policy,
+		opts:                opts,
+		namespaced:          namespaced,
+		conflicts:           g.conflicts,
+		methodTemplatePlans: g.methodTemplatePlans,
+	}
+}
+
+// transformGenerated transforms the policy generated for every seed and
+// calls check with the result.
+func transformGenerated(t *testing.T, check func(c generatedCase, ampelPolicy *Policy, diags Diagnostics)) {
+	t.Helper()
+	for seed := int64(0); seed < propertySeeds; seed++ {
+		c := generateCase(seed)
+		ampelPolicy, diags, err := FromPolicyWithDiagnostics(c.policy, c.opts...)
+		require.NoError(t, err, "seed %d", seed)
+		check(c, ampelPolicy, diags)
+	}
+}
+
+// TestProperty_GeneratedPoliciesValidate verifies every generated policy converts to a valid Ampel policy.
+func TestProperty_GeneratedPoliciesValidate(t *testing.T) {
+	transformGenerated(t, func(c generatedCase, ampelPolicy *Policy, diags Diagnostics) {
+		assert.NoError(t, ampelPolicy.Validate(), "seed %d", c.seed)
+		assert.Len(t, ampelPolicy.Tenets, countAutomatedMethods(c.policy), "seed %d", c.seed)
+	})
+}
+
+// TestProperty_Diagnostics verifies templates missing parameters and parameter conflicts are reported, and nothing else is an error.
+func TestProperty_Diagnostics(t *testing.T) {
+	var sawMissing, sawConflict bool
+	transformGenerated(t, func(c generatedCase, ampelPolicy *Policy, diags Diagnostics) {
+		// Every tenet of a plan using a method type template misses its fields
+		missing := make(map[string]bool)
+		for _, diag := range findDiagnostics(diags, DiagMissingTemplateParameter) {
+			missing[diag.Location.TenetID] = true
+		}
+		for _, plan := range c.policy.Adherence.AssessmentPlans {
+			automated := 0
+			for _, method := range plan.EvaluationMethods {
+				if !isAutomatedMethod(method.Type) {
+					continue
+				}
+				tenetID := generatedTenetID(plan, automated)
+				assert.Equal(t, c.methodTemplatePlans[plan.Id], missing[tenetID], "seed %d: tenet %s", c.seed, tenetID)
+				automated++
+			}
+		}
+		assert.Equal(t, len(findDiagnostics(diags, DiagMissingTemplateParameter)), diags.AtLeast(SeverityError),
+			"seed %d: %v", c.seed, diags)
+
+		// Every conflicting parameter is reported, as a warning or in namespace mode as info
+		conflicts := findDiagnostics(diags, DiagParameterConflict)
+		reported := make(map[string]bool)
+		for _, diag := range conflicts {
+			want := SeverityWarning
+			if c.namespaced {
+				want = SeverityInfo
+			}
+			assert.Equal(t, want, diag.Severity, "seed %d: %s", c.seed, diag.Message)
+			reported[strings.Fields(diag.Message)[1]] = true
+		}
+		assert.Equal(t, len(c.conflicts), len(reported), "seed %d: %v", c.seed, conflicts)
+		for id := range c.conflicts {
+			assert.True(t, reported[id], "seed %d: conflict on %s not reported", c.seed, id)
+		}
+
+		sawMissing = sawMissing || len(missing) > 0
+		sawConflict = sawConflict || len(conflicts) > 0
+	})
+	assert.True(t, sawMissing, "no generated policy uses a method type template")
+	assert.True(t, sawConflict, "no generated policy has a parameter conflict")
+}
+
+// TestProperty_UniqueTenetIDs verifies no two tenets of a policy share an ID.
+func TestProperty_UniqueTenetIDs(t *testing.T) {
+	transformGenerated(t, func(c generatedCase, ampelPolicy *Policy, _ Diagnostics) {
+		seen := make(map[string]bool)
+		for _, tenet := range ampelPolicy.Tenets {
+			assert.NotEmpty(t, tenet.Id, "seed %d", c.seed)
+			assert.False(t, seen[tenet.Id], "seed %d: duplicate tenet ID %s", c.seed, tenet.Id)
+			seen[tenet.Id] = true
+		}
+	})
+}
+
+// TestProperty_ContextReferencesDefined verifies every context["key"] in the CEL has a Policy.Context entry.
+func TestProperty_ContextReferencesDefined(t *testing.T) {
+	transformGenerated(t, func(c generatedCase, ampelPolicy *Policy, _ Diagnostics) {
+		for _, tenet := range ampelPolicy.Tenets {
+			for _, match := range contextReferencePattern.FindAllStringSubmatch(tenet.Code, -1) {
+				assert.Contains(t, ampelPolicy.Context, match[1], "seed %d: tenet %s", c.seed, tenet.Id)
+			}
+		}
+	})
+}
+
+// TestProperty_MergeWithSelfIsIdentity verifies merging a policy with itself changes nothing.
+func TestProperty_MergeWithSelfIsIdentity(t *testing.T) {
+	transformGenerated(t, func(c generatedCase, ampelPolicy *Policy, _ Diagnostics) {
+		merged, stats, err := MergePolicy(ampelPolicy, ampelPolicy)
+		require.NoError(t, err, "seed %d", c.seed)
+		assert.True(t, proto.Equal(ampelPolicy, merged), "seed %d: merged policy differs", c.seed)
+		assert.Equal(t, MergeStats{TenetsPreserved: len(ampelPolicy.Tenets)}, stats, "seed %d", c.seed)
+	})
+}
+
+// TestProperty_Deterministic verifies the same input always produces the same output.
+func TestProperty_Deterministic(t *testing.T) {
+	transformGenerated(t, func(c generatedCase, ampelPolicy *Policy, diags Diagnostics) {
+		again := generateCase(c.seed)
+		second, secondDiags, err := FromPolicyWithDiagnostics(again.policy, again.opts...)
+		require.NoError(t, err, "seed %d", c.seed)
+
+		first, err := json.Marshal(ampelPolicy)
+		require.NoError(t, err)
+		repeated, err := json.Marshal(second)
+		require.NoError(t, err)
+		assert.Equal(t, string(first), string(repeated), "seed %d", c.seed)
+		assert.Equal(t, diags, secondDiags, "seed %d", c.seed)
+	})
+}
+
+// countAutomatedMethods returns the number of tenets a policy should generate.
+func countAutomatedMethods(policy *gemara.Policy) int {
+	count := 0
+	for _, plan := range policy.Adherence.AssessmentPlans {
+		for _, method := range plan.EvaluationMethods {
+			if isAutomatedMethod(method.Type) {
+				count++
+			}
+		}
+	}
+	return count
+}
@@ -0,0 +1,168 @@
+package ampel
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// DefaultRenameThreshold is the similarity from which an existing tenet
+// missing from the generated policy is taken as renamed to a new tenet.
+const DefaultRenameThreshold = 0.75
+
+// WithRenameThreshold sets the similarity, between 0 and 1, from which
+// MergePolicy takes an existing tenet missing from the generated policy as
+// renamed to a new generated tenet, as when a plan or requirement ID
+// changes. The default is DefaultRenameThreshold; a threshold above 1
+// disables rename detection.
+//
+// Example:
+//
+//	ampel.MergePolicy(existing, generated, ampel.WithRenameThreshold(0.9))
+func WithRenameThreshold(threshold float64) MergeOption {
+	return func(opts *MergeOptions) {
+		opts.RenameThreshold = threshold
+	}
+}
+
+// TenetRename is an existing tenet matched to a generated tenet with
+// another ID. The existing tenet's edits are merged into the new ID.
+type TenetRename struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+
+	// Similarity is the score of the match, between the threshold and 1
+	Similarity float64 `json:"similarity"`
+}
+
+// String returns a one-line summary of the rename.
+func (r TenetRename) String() string {
+	return fmt.Sprintf("%s -> %s (similarity %.2f)", r.From, r.To, r.Similarity)
+}
+
+// detectRenames pairs the unmatched existing tenets with the unmatched
+// generated tenets by similarity, best matches first. Each tenet is paired
+// at most once and only pairs scoring at least threshold are kept. base
+// holds the generation base tenets by ID, whose generated code is compared
+// when recorded.
+func detectRenames(existing, generated []*Tenet, base map[string]*Tenet, threshold float64) []TenetRename {
+	if threshold > 1 {
+		return nil
+	}
+
+	var candidates []TenetRename
+	for _, old := range existing {
+		for _, tenet := range generated {
+			if score := tenetSimilarity(old, base[old.Id], tenet); score >= threshold {
+				candidates = append(candidates, TenetRename{From: old.Id, To: tenet.Id, Similarity: score})
+			}
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if candidates[i].Similarity != candidates[j].Similarity {
+			return candidates[i].Similarity > candidates[j].Similarity
+		}
+		if candidates[i].From != candidates[j].From {
+			return candidates[i].From < candidates[j].From
+		}
+		return candidates[i].To < candidates[j].To
+	})
+
+	var renames []TenetRename
+	pairedFrom := make(map[string]bool)
+	pairedTo := make(map[string]bool)
+	for _, candidate := range candidates {
+		if pairedFrom[candidate.From] || pairedTo[candidate.To] {
+			continue
+		}
+		pairedFrom[candidate.From] = true
+		pairedTo[candidate.To] = true
+		renames = append(renames, candidate)
+	}
+	return renames
+}
+
+// tenetSimilarity scores how likely generated is old under a new ID, as
+// the mean of the signals present on either side: the predicate types, the
+// plan source encoded in the ID, the title and the code. Signals missing on
+// both sides are left out rather than counted as a mismatch. The code of the
+// base tenet, as last generated, is compared when recorded, so manual edits
+// do not lower the score.
+func tenetSimilarity(old, base, generated *Tenet) float64 {
+	code := old.GetCode()
+	if base != nil {
+		code = base.GetCode()
+	}
+
+	var total float64
+	signals := 0
+	for _, pair := range [][2][]string{
+		{old.GetPredicates().GetTypes(), generated.GetPredicates().GetTypes()},
+		{words(old.GetTitle()), words(generated.GetTitle())},
+		{words(code), words(generated.GetCode())},
+	} {
+		if score, ok := jaccard(pair[0], pair[1]); ok {
+			total += score
+			signals++
+		}
+	}
+	if old.GetId() != "" || generated.GetId() != "" {
+		total += idSimilarity(old.GetId(), generated.GetId())
+		signals++
+	}
+	if signals == 0 {
+		return 0
+	}
+	return total / float64(signals)
+}
+
+// idSimilarity compares tenet IDs, generated as requirement-plan-index, by
+// their hyphen-separated parts: the share of parts in a common prefix or
+// suffix. A changed requirement or plan ID keeps the rest of the ID.
+func idSimilarity(a, b string) float64 {
+	partsA, partsB := strings.Split(a, "-"), strings.Split(b, "-")
+	shortest := min(len(partsA), len(partsB))
+
+	prefix := 0
+	for prefix < shortest && partsA[prefix] == partsB[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < shortest-prefix && partsA[len(partsA)-1-suffix] == partsB[len(partsB)-1-suffix] {
+		suffix++
+	}
+	return float64(prefix+suffix) / float64(max(len(partsA), len(partsB)))
+}
+
+// words splits text into lowercase words and symbols for comparison.
+func words(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return unicode.IsSpace(r) || r == '(' || r == ')' || r == '[' || r == ']' || r == ','
+	})
+}
+
+// jaccard returns the Jaccard index of two sets of strings. It reports
+// false when both are empty, as two missing values are no evidence either
+// way.
+func jaccard(a, b []string) (float64, bool) {
+	if len(a) == 0 && len(b) == 0 {
+		return 0, false
+	}
+	setA := make(map[string]bool, len(a))
+	for _, item := range a {
+		setA[item] = true
+	}
+	setB := make(map[string]bool, len(b))
+	for _, item := range b {
+		setB[item] = true
+	}
+
+	shared := 0
+	for item := range setA {
+		if setB[item] {
+			shared++
+		}
+	}
+	return float64(shared) / float64(len(setA)+len(setB)-shared), true
+}
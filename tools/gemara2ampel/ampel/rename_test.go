@@ -0,0 +1,217 @@
+package ampel
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestMergePolicy_DetectsRenames verifies edits move to the new tenet ID.
+func TestMergePolicy_DetectsRenames(t *testing.T) {
+	existing := newMergeTestPolicy(withTenets(&Tenet{
+		Id:         "REQ-01-plan-01-0",
+		Title:      "Verify the builder identity",
+		Code:       "// manual\nattestation.predicate.builder.id == context[\"builder-id\"]",
+		Predicates: &PredicateSpec{Types: []string{"https://slsa.dev/provenance/v1"}},
+	}))
+	generated := newMergeTestPolicy(withVersion(2), withTenets(&Tenet{
+		Id:         "REQ-1-plan-01-0",
+		Title:      "Verify the builder identity",
+		Code:       "attestation.predicate.builder.id == context[\"builder-id\"]",
+		Predicates: &PredicateSpec{Types: []string{"https://slsa.dev/provenance/v1"}},
+	}))
+
+	merged, stats, err := MergePolicy(existing, generated)
+	require.NoError(t, err)
+
+	require.Len(t, merged.Tenets, 1)
+	assert.Equal(t, "REQ-1-plan-01-0", merged.Tenets[0].Id)
+	assert.Equal(t, existing.Tenets[0].Code, merged.Tenets[0].Code)
+
+	require.Len(t, stats.Renames, 1)
+	assert.Equal(t, "REQ-01-plan-01-0", stats.Renames[0].From)
+	assert.Equal(t, "REQ-1-plan-01-0", stats.Renames[0].To)
+	assert.GreaterOrEqual(t, stats.Renames[0].Similarity, DefaultRenameThreshold)
+	assert.Equal(t, 1, stats.TenetsPreserved)
+	assert.Zero(t, stats.TenetsAdded)
+	assert.Zero(t, stats.TenetsRemoved)
+	assert.Empty(t, stats.Orphans)
+}
+
+// TestMergePolicy_RenameThreshold verifies dissimilar tenets are not paired.
+func TestMergePolicy_RenameThreshold(t *testing.T) {
+	existing := newMergeTestPolicy(withTenets(&Tenet{
+		Id:         "REQ-01-plan-01-0",
+		Title:      "Verify the builder identity",
+		Code:       "// manual\nattestation.predicate.builder.id == context[\"builder-id\"]",
+		Predicates: &PredicateSpec{Types: []string{"https://slsa.dev/provenance/v1"}},
+	}))
+	generated := newMergeTestPolicy(withVersion(2), withTenets(&Tenet{
+		Id:         "REQ-1-plan-01-0",
+		Title:      "Verify the builder identity",
+		Code:       "attestation.predicate.builder.id == context[\"builder-id\"]",
+		Predicates: &PredicateSpec{Types: []string{"https://slsa.dev/provenance/v1"}},
+	}))
+
+	// Disabled detection
+	_, stats, err := MergePolicy(existing, generated, WithRenameThreshold(1.1))
+	require.NoError(t, err)
+	assert.Empty(t, stats.Renames)
+	assert.Equal(t, 1, stats.TenetsAdded)
+	assert.Equal(t, 1, stats.TenetsRemoved)
+
+	// An unrelated tenet
+	generated.Tenets[0] = &Tenet{
+		Id:    "REQ-07-plan-09-0",
+		Title: "Check the vulnerability scan",
+		Code:  "attestation.predicate.scanner.result.summary.critical == 0",
+	}
+	merged, stats, err := MergePolicy(existing, generated)
+	require.NoError(t, err)
+	assert.Empty(t, stats.Renames)
+	assert.Equal(t, generated.Tenets[0].Code, merged.Tenets[0].Code)
+}
+
+// TestMergePolicy_RenamePairsBestMatch verifies each tenet is paired once, best match first.
+func TestMergePolicy_RenamePairsBestMatch(t *testing.T) {
+	existing := newMergeTestPolicy(withTenets(&Tenet{
+		Id:         "REQ-01-plan-01-0",
+		Title:      "Verify the builder identity",
+		Code:       "// manual\nattestation.predicate.builder.id == context[\"builder-id\"]",
+		Predicates: &PredicateSpec{Types: []string{"https://slsa.dev/provenance/v1"}},
+	}))
+	generated := newMergeTestPolicy(withVersion(2), withTenets(&Tenet{
+		Id:         "REQ-1-plan-01-0",
+		Title:      "Verify the builder identity",
+		Code:       "attestation.predicate.builder.id == context[\"builder-id\"]",
+		Predicates: &PredicateSpec{Types: []string{"https://slsa.dev/provenance/v1"}},
+	}))
+	other := &Tenet{
+		Id:         "REQ-2-plan-01-0",
+		Title:      "Verify the builder identity",
+		Code:       "attestation.predicate.builder.id != \"\"",
+		Predicates: generated.Tenets[0].Predicates,
+	}
+	generated.Tenets = append(generated.Tenets, other)
+
+	merged, stats, err := MergePolicy(existing, generated)
+	require.NoError(t, err)
+	require.Len(t, stats.Renames, 1)
+	assert.Equal(t, "REQ-1-plan-01-0", stats.Renames[0].To)
+	assert.Equal(t, other.Code, merged.Tenets[1].Code)
+	assert.Equal(t, 1, stats.TenetsAdded)
+}
+
+// TestMergePolicyWithBase_RenamedConflict verifies renamed tenets merge against their old base.
+func TestMergePolicyWithBase_RenamedConflict(t *testing.T) {
+	existing := newMergeTestPolicy(withTenets(&Tenet{
+		Id:         "REQ-01-plan-01-0",
+		Title:      "Verify the builder identity",
+		Code:       "// manual\nattestation.predicate.builder.id == context[\"builder-id\"]",
+		Predicates: &PredicateSpec{Types: []string{"https://slsa.dev/provenance/v1"}},
+	}))
+	generated := newMergeTestPolicy(withVersion(2), withTenets(&Tenet{
+		Id:         "REQ-1-plan-01-0",
+		Title:      "Verify the builder identity",
+		Code:       "attestation.predicate.builder.id == context[\"builder-id\"]",
+		Predicates: &PredicateSpec{Types: []string{"https://slsa.dev/provenance/v1"}},
+	}))
+	base := newMergeTestPolicy(withTenets(&Tenet{
+		Id:         "REQ-01-plan-01-0",
+		Title:      "Verify the builder identity",
+		Code:       "attestation.predicate.builder.id == context[\"builder\"]",
+		Predicates: existing.Tenets[0].Predicates,
+	}))
+
+	_, stats, err := MergePolicyWithBase(base, existing, generated)
+	require.NoError(t, err)
+	require.Len(t, stats.Renames, 1)
+	require.Len(t, stats.Conflicts, 1)
+	assert.Equal(t, "REQ-1-plan-01-0", stats.Conflicts[0].TenetID)
+	assert.Equal(t, base.Tenets[0].Code, stats.Conflicts[0].Base)
+
+	// The next base keeps the old generated code under the new ID
+	next := AdvanceBase(base, generated, stats)
+	assert.Equal(t, "REQ-1-plan-01-0", next.Tenets[0].Id)
+	assert.Equal(t, base.Tenets[0].Code, next.Tenets[0].Code)
+}
+
+// TestMergePolicyWithBase_RenameSources verifies tenets added in the
+// workspace are not taken as renamed generated tenets.
+func TestMergePolicyWithBase_RenameSources(t *testing.T) {
+	slsa := &PredicateSpec{Types: []string{"https://slsa.dev/provenance/v1"}}
+	base := newMergeTestPolicy(withTenets(&Tenet{Id: "REQ-01-plan-01-0", Code: "true"}))
+	existing := newMergeTestPolicy(withTenets(
+		&Tenet{Id: "REQ-01-plan-01-0", Code: "true"},
+		&Tenet{Id: "REQ-01-plan-02-0", Title: "Verify the builder identity", Code: "builder == \"ci\"", Predicates: slsa},
+	))
+	generated := newMergeTestPolicy(withTenets(
+		&Tenet{Id: "REQ-01-plan-01-0", Code: "true"},
+		&Tenet{Id: "REQ-01-plan-03-0", Title: "Verify the builder identity", Code: "builder == \"ci\"", Predicates: slsa},
+	))
+
+	merged, stats, err := MergePolicyWithBase(base, existing, generated, WithOrphanMode(OrphanKeep))
+	require.NoError(t, err)
+	assert.Empty(t, stats.Renames)
+	assert.Len(t, merged.Tenets, 3)
+
+	// Without a base any unmatched tenet can be the source
+	_, stats, err = MergePolicy(existing, generated)
+	require.NoError(t, err)
+	assert.Len(t, stats.Renames, 1)
+}
+
+// TestTenetSimilarity_EmptyFields verifies fields missing on both sides are
+// left out of the score instead of counting as a match or a mismatch.
+func TestTenetSimilarity_EmptyFields(t *testing.T) {
+	old := &Tenet{Id: "REQ-01-plan-01-0", Code: "attestation.predicate.builder.id != \"\""}
+	generated := &Tenet{Id: "REQ-02-plan-01-0", Code: "attestation.predicate.scanner.result.summary.critical == 0"}
+	assert.Less(t, tenetSimilarity(old, nil, generated), DefaultRenameThreshold)
+
+	generated = &Tenet{Id: "REQ-02-plan-01-0", Code: old.Code}
+	assert.InDelta(t, 0.9, tenetSimilarity(old, nil, generated), 1e-9)
+
+	assert.Zero(t, tenetSimilarity(&Tenet{}, nil, &Tenet{}))
+	_, ok := jaccard(nil, nil)
+	assert.False(t, ok)
+}
+
+// TestMergePolicy_RenamesUntitledTenet verifies a tenet without a title is
+// still matched to its renamed version.
+func TestMergePolicy_RenamesUntitledTenet(t *testing.T) {
+	existing := newMergeTestPolicy(withTenets(&Tenet{
+		Id:         "REQ-01-plan-01-0",
+		Code:       "// manual\nattestation.predicate.builder.id == context[\"builder-id\"]",
+		Predicates: &PredicateSpec{Types: []string{"https://slsa.dev/provenance/v1"}},
+	}))
+	base := newMergeTestPolicy(withTenets(&Tenet{
+		Id:         "REQ-01-plan-01-0",
+		Code:       "attestation.predicate.builder.id == context[\"builder-id\"]",
+		Predicates: &PredicateSpec{Types: []string{"https://slsa.dev/provenance/v1"}},
+	}))
+	generated := newMergeTestPolicy(withVersion(2), withTenets(&Tenet{
+		Id:         "REQ-1-plan-01-0",
+		Code:       "attestation.predicate.builder.id == context[\"builder-id\"]",
+		Predicates: &PredicateSpec{Types: []string{"https://slsa.dev/provenance/v1"}},
+	}))
+
+	merged, stats, err := MergePolicyWithBase(base, existing, generated)
+	require.NoError(t, err)
+
+	require.Len(t, stats.Renames, 1)
+	assert.Equal(t, "REQ-01-plan-01-0", stats.Renames[0].From)
+	assert.Equal(t, "REQ-1-plan-01-0", stats.Renames[0].To)
+	require.Len(t, merged.Tenets, 1)
+	assert.Equal(t, "REQ-1-plan-01-0", merged.Tenets[0].Id)
+	assert.Equal(t, existing.Tenets[0].Code, merged.Tenets[0].Code)
+}
+
+// TestIdSimilarity verifies tenet ID comparison by hyphen-separated parts.
+func TestIdSimilarity(t *testing.T) {
+	assert.Equal(t, 1.0, idSimilarity("REQ-01-plan-01-0", "REQ-01-plan-01-0"))
+	assert.Equal(t, 0.8, idSimilarity("REQ-01-plan-01-0", "REQ-02-plan-01-0"))
+	assert.Equal(t, 0.8, idSimilarity("REQ-01-plan-01-0", "REQ-01-plan-02-0"))
+	assert.Equal(t, 0.0, idSimilarity("a-b", "c-d"))
+	assert.Equal(t, 0.5, idSimilarity("REQ-01", "REQ-01-plan-01"))
+}
@@ -0,0 +1,394 @@
+package ampel
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/gemaraproj/go-gemara"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"google.golang.org/protobuf/proto"
+)
+
+// ErrPolicyNotResolved is returned by a PolicyResolver when it cannot handle
+// a reference. MultiResolver uses it to fall through to the next resolver.
+var ErrPolicyNotResolved = errors.New("policy reference not resolved")
+
+// ResolvedPolicy is a Gemara policy loaded through a PolicyResolver.
+type ResolvedPolicy struct {
+	// Policy is the parsed Gemara policy
+	Policy *gemara.Policy
+
+	// Source is the canonical location the policy was loaded from. It is used
+	// to detect import cycles and to deduplicate policies imported twice.
+	Source string
+
+	// Digest holds the digests of the policy content keyed by algorithm
+	// (sha256, and gitCommit/gitBlob for policies read from git)
+	Digest map[string]string
+}
+
+// PolicyResolver loads Gemara policies referenced in imports.policies.
+type PolicyResolver interface {
+	// Resolve loads the policy identified by reference. The parent is the
+	// policy that declared the import (nil for imports of the root policy)
+	// and allows resolvers to interpret relative references.
+	Resolve(reference string, parent *ResolvedPolicy) (*ResolvedPolicy, error)
+}
+
+// FileResolver resolves imports to Gemara policy files on the local filesystem.
+// Relative references are resolved against the directory of the importing
+// policy, or BaseDir for imports of the root policy.
+type FileResolver struct {
+	BaseDir string
+}
+
+// Resolve implements PolicyResolver.
+func (r *FileResolver) Resolve(reference string, parent *ResolvedPolicy) (*ResolvedPolicy, error) {
+	if hasRemoteScheme(reference) {
+		return nil, ErrPolicyNotResolved
+	}
+
+	policyPath := strings.TrimPrefix(reference, "file://")
+	if !filepath.IsAbs(policyPath) {
+		baseDir := r.BaseDir
+		if parent != nil && filepath.IsAbs(parent.Source) {
+			baseDir = filepath.Dir(parent.Source)
+		}
+		policyPath = filepath.Join(baseDir, policyPath)
+	}
+
+	return loadResolvedFile(policyPath)
+}
+
+// MirrorResolver resolves remote imports to files in a local mirror directory.
+// A reference such as "git+https://github.com/org/repo#path/policy.yaml" is
+// looked up at <Root>/github.com/org/repo/path/policy.yaml, and
+// "https://example.com/policies/policy.yaml" at <Root>/example.com/policies/policy.yaml.
+type MirrorResolver struct {
+	Root string
+}
+
+// Resolve implements PolicyResolver.
+func (r *MirrorResolver) Resolve(reference string, _ *ResolvedPolicy) (*ResolvedPolicy, error) {
+	if !hasRemoteScheme(reference) {
+		return nil, ErrPolicyNotResolved
+	}
+
+	u, err := url.Parse(strings.TrimPrefix(reference, "git+"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid policy reference %q: %w", reference, err)
+	}
+
+	// Drop any pinned revision ("repo@commit") and the .git suffix from the
+	// repository path so the mirror layout does not depend on them
+	repoPath := u.Path
+	if at := strings.LastIndex(repoPath, "@"); at != -1 {
+		repoPath = repoPath[:at]
+	}
+	repoPath = strings.TrimSuffix(repoPath, ".git")
+
+	parts := []string{r.Root, u.Host, filepath.FromSlash(repoPath)}
+	if u.Fragment != "" {
+		parts = append(parts, filepath.FromSlash(u.Fragment))
+	}
+	localPath := filepath.Join(parts...)
+
+	// Never follow references outside the mirror root
+	rel, err := filepath.Rel(r.Root, localPath)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return nil, fmt.Errorf("policy reference %q escapes the mirror directory", reference)
+	}
+
+	return loadResolvedFile(localPath)
+}
+
+// GitResolver resolves imports to files in a local git repository at a pinned
+// revision. References are paths inside the repository, either plain or in
+// the fragment of a VCS locator ("git+https://github.com/org/repo#path/policy.yaml").
+type GitResolver struct {
+	// RepoPath is the path to the local clone
+	RepoPath string
+
+	// Revision is the branch, tag or commit to read policies from
+	Revision string
+
+	repo   *git.Repository
+	commit plumbing.Hash
+}
+
+// Resolve implements PolicyResolver.
+func (r *GitResolver) Resolve(reference string, parent *ResolvedPolicy) (*ResolvedPolicy, error) {
+	filePath := reference
+	if hasRemoteScheme(reference) {
+		_, fragment, found := strings.Cut(reference, "#")
+		if !found {
+			return nil, ErrPolicyNotResolved
+		}
+		filePath = fragment
+	} else if parent != nil && strings.HasPrefix(parent.Source, r.sourcePrefix()) {
+		// Relative to the importing policy when it came from this repository
+		filePath = path.Join(path.Dir(strings.TrimPrefix(parent.Source, r.sourcePrefix())), filePath)
+	}
+	filePath = path.Clean(strings.TrimPrefix(filePath, "/"))
+
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+
+	commit, err := r.repo.CommitObject(r.commit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read commit %s: %w", r.commit, err)
+	}
+	file, err := commit.File(filePath)
+	if err != nil {
+		if errors.Is(err, object.ErrFileNotFound) {
+			return nil, ErrPolicyNotResolved
+		}
+		return nil, fmt.Errorf("failed to read %s at %s: %w", filePath, r.Revision, err)
+	}
+	contents, err := file.Contents()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s at %s: %w", filePath, r.Revision, err)
+	}
+
+	policy, err := parsePolicyData(filePath, []byte(contents))
+	if err != nil {
+		return nil, err
+	}
+
+	digest := contentDigest([]byte(contents))
+	digest["gitCommit"] = r.commit.String()
+	digest["gitBlob"] = file.Hash.String()
+
+	return &ResolvedPolicy{
+		Policy: policy,
+		Source: r.sourcePrefix() + filePath,
+		Digest: digest,
+	}, nil
+}
+
+// open opens the repository and pins the configured revision on first use.
+func (r *GitResolver) open() error {
+	if r.repo != nil {
+		return nil
+	}
+
+	repo, err := git.PlainOpen(r.RepoPath)
+	if err != nil {
+		return fmt.Errorf("failed to open git repository %s: %w", r.RepoPath, err)
+	}
+
+	revision := r.Revision
+	if revision == "" {
+		revision = "HEAD"
+	}
+	hash, err := repo.ResolveRevision(plumbing.Revision(revision))
+	if err != nil {
+		return fmt.Errorf("failed to resolve revision %s: %w", revision, err)
+	}
+
+	r.repo = repo
+	r.commit = *hash
+	return nil
+}
+
+// sourcePrefix returns the prefix used for the Source of resolved policies.
+func (r *GitResolver) sourcePrefix() string {
+	return fmt.Sprintf("git+file://%s@%s#", r.RepoPath, r.Revision)
+}
+
+// MultiResolver tries each resolver in order and returns the first result.
+// Resolvers that return ErrPolicyNotResolved are skipped.
+type MultiResolver []PolicyResolver
+
+// Resolve implements PolicyResolver.
+func (m MultiResolver) Resolve(reference string, parent *ResolvedPolicy) (*ResolvedPolicy, error) {
+	for _, resolver := range m {
+		resolved, err := resolver.Resolve(reference, parent)
+		if errors.Is(err, ErrPolicyNotResolved) {
+			continue
+		}
+		return resolved, err
+	}
+	return nil, fmt.Errorf("%w: %s", ErrPolicyNotResolved, reference)
+}
+
+// hasRemoteScheme reports whether a reference is a URL or VCS locator rather
+// than a local path.
+func hasRemoteScheme(reference string) bool {
+	return strings.Contains(reference, "://") && !strings.HasPrefix(reference, "file://")
+}
+
+// loadResolvedFile reads and parses a Gemara policy file.
+func loadResolvedFile(policyPath string) (*ResolvedPolicy, error) {
+	absPath, err := filepath.Abs(policyPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve path %s: %w", policyPath, err)
+	}
+
+	data, err := os.ReadFile(absPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrPolicyNotResolved
+		}
+		return nil, fmt.Errorf("failed to read policy file: %w", err)
+	}
+
+	policy, err := loadPolicyFile(absPath)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ResolvedPolicy{
+		Policy: policy,
+		Source: absPath,
+		Digest: contentDigest(data),
+	}, nil
+}
+
+// loadPolicyFile parses a Gemara policy file with the Gemara loader, as the
+// root policy is, so that imports are read by the same rules.
+func loadPolicyFile(policyPath string) (*gemara.Policy, error) {
+	policy := &gemara.Policy{}
+	if err := policy.LoadFile("file://" + policyPath); err != nil {
+		return nil, fmt.Errorf("failed to parse policy %s: %w", policyPath, err)
+	}
+	return policy, nil
+}
+
+// parsePolicyData parses Gemara policy content read from elsewhere than a
+// file, such as a git object, through a temporary file with the extension
+// of name, which selects the format as for files.
+func parsePolicyData(name string, data []byte) (*gemara.Policy, error) {
+	dir, err := os.MkdirTemp("", "gemara-policy-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse policy %s: %w", name, err)
+	}
+	defer os.RemoveAll(dir)
+
+	tempPath := filepath.Join(dir, "policy"+path.Ext(name))
+	if err := os.WriteFile(tempPath, data, 0600); err != nil {
+		return nil, fmt.Errorf("failed to parse policy %s: %w", name, err)
+	}
+	policy := &gemara.Policy{}
+	if err := policy.LoadFile("file://" + tempPath); err != nil {
+		return nil, fmt.Errorf("failed to parse policy %s: %w", name, err)
+	}
+	return policy, nil
+}
+
+// contentDigest returns the sha256 digest of data in ResourceDescriptor format.
+func contentDigest(data []byte) map[string]string {
+	sum := sha256.Sum256(data)
+	return map[string]string{"sha256": hex.EncodeToString(sum[:])}
+}
+
+// rootPolicySource stands in for the source of the root policy, which is
+// not loaded through the resolver.
+const rootPolicySource = "(root policy)"
+
+// importWalker converts imported policies depth-first, tracking the import
+// path to detect cycles and the visited sources to deduplicate diamonds.
+type importWalker struct {
+	options *PolicySetOptions
+
+	// visited holds the sources of policies already converted
+	visited map[string]bool
+
+	// stack holds the sources on the current import path
+	stack []string
+
+	// ids maps converted policy IDs to their source to catch two different
+	// sources claiming the same policy ID
+	ids map[string]string
+
+	policies []*Policy
+}
+
+// convertImportedPolicies resolves the imports of policy recursively and
+// converts each imported policy to an inline Ampel policy.
+func convertImportedPolicies(policy *gemara.Policy, options *PolicySetOptions) ([]*Policy, error) {
+	walker := &importWalker{
+		options: options,
+		visited: make(map[string]bool),
+		ids:     map[string]string{policy.Metadata.Id: rootPolicySource},
+	}
+	if err := walker.walk(policy, nil); err != nil {
+		return nil, err
+	}
+	return walker.policies, nil
+}
+
+// walk converts the imports of policy, then recurses into each of them.
+func (w *importWalker) walk(policy *gemara.Policy, parent *ResolvedPolicy) error {
+	for _, reference := range policy.Imports.Policies {
+		resolved, err := w.options.Resolver.Resolve(reference, parent)
+		if err != nil {
+			return fmt.Errorf("error resolving imported policy %s: %w", reference, err)
+		}
+
+		if slices.Contains(w.stack, resolved.Source) {
+			cycle := append(slices.Clone(w.stack), resolved.Source)
+			return fmt.Errorf("import cycle detected: %s", strings.Join(cycle, " -> "))
+		}
+		if w.visited[resolved.Source] {
+			continue
+		}
+		w.visited[resolved.Source] = true
+
+		policyID := resolved.Policy.Metadata.Id
+		if source, exists := w.ids[policyID]; exists {
+			// The root policy has no source, so a cycle back to it is only
+			// visible through its ID
+			if source == rootPolicySource {
+				return fmt.Errorf("import cycle detected: %s imports the root policy %s", resolved.Source, policyID)
+			}
+			return fmt.Errorf("policy ID %s is defined by both %s and %s", policyID, source, resolved.Source)
+		}
+		w.ids[policyID] = resolved.Source
+
+		ampelPolicy, err := FromPolicy(resolved.Policy, w.options.TransformOptions...)
+		if err != nil {
+			return fmt.Errorf("error converting imported policy %s: %w", reference, err)
+		}
+
+		// Add metadata for imported policy if provided
+		if w.options.Meta != nil {
+			if meta, ok := w.options.Meta[ampelPolicy.Id]; ok {
+				ampelPolicy.Meta = proto.Clone(meta).(*Meta)
+			}
+		}
+
+		// Record where the policy was imported from in Meta.Origin. Source
+		// must stay unset: Ampel fetches policies with a Source from their
+		// location, which is Gemara YAML, and would take the inline tenets
+		// as overlays
+		if ampelPolicy.Meta == nil {
+			ampelPolicy.Meta = &Meta{}
+		}
+		ampelPolicy.Meta.Origin = &ResourceDescriptor{
+			Uri:    reference,
+			Digest: resolved.Digest,
+		}
+
+		w.policies = append(w.policies, ampelPolicy)
+
+		w.stack = append(w.stack, resolved.Source)
+		if err := w.walk(resolved.Policy, resolved); err != nil {
+			return err
+		}
+		w.stack = w.stack[:len(w.stack)-1]
+	}
+
+	return nil
+}
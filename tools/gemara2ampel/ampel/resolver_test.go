@@ -0,0 +1,176 @@
+package ampel
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gemaraproj/go-gemara"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// importTestPolicyYAML returns a minimal Gemara policy with the given imports.
+func importTestPolicyYAML(id string, imports ...string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "title: %s\nmetadata:\n  id: %s\n  version: 1.0.0\n  description: Imported policy %s\n", id, id, id)
+	if len(imports) > 0 {
+		b.WriteString("imports:\n  policies:\n")
+		for _, imp := range imports {
+			fmt.Fprintf(&b, "    - %s\n", imp)
+		}
+	}
+	fmt.Fprintf(&b, `adherence:
+  assessment-plans:
+    - id: %s-plan
+      requirement-id: %s-REQ
+      frequency: daily
+      evidence-requirements: SLSA provenance with trusted builder
+      evaluation-methods:
+        - type: automated
+`, id, id)
+	return b.String()
+}
+
+func writeImportTestFile(t *testing.T, dir, name, content string) {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+	require.NoError(t, os.WriteFile(path, []byte(content), 0600))
+}
+
+// TestFromPolicyWithImports_Resolver verifies inline conversion with diamond deduplication.
+func TestFromPolicyWithImports_Resolver(t *testing.T) {
+	dir := t.TempDir()
+	writeImportTestFile(t, dir, "a.yaml", importTestPolicyYAML("policy-a", "shared/c.yaml"))
+	writeImportTestFile(t, dir, "b.yaml", importTestPolicyYAML("policy-b", "shared/c.yaml"))
+	writeImportTestFile(t, dir, "shared/c.yaml", importTestPolicyYAML("policy-c"))
+
+	policy := createTestPolicy()
+	policy.Imports.Policies = []string{"a.yaml", "b.yaml"}
+
+	policySet, err := FromPolicyWithImports(policy, WithPolicyResolver(&FileResolver{BaseDir: dir}))
+	require.NoError(t, err)
+
+	ids := make([]string, 0, len(policySet.Policies))
+	for _, p := range policySet.Policies {
+		ids = append(ids, p.Id)
+	}
+	assert.Equal(t, []string{"policy-001", "policy-a", "policy-c", "policy-b"}, ids)
+
+	// Imported policies are inline, without a Source that Ampel would fetch,
+	// and record the import and its digest as their origin
+	for _, p := range policySet.Policies[1:] {
+		assert.NotEmpty(t, p.Tenets, "imported policy %s should be converted inline", p.Id)
+		assert.Nil(t, p.Source)
+		require.NotNil(t, p.Meta.GetOrigin())
+		assert.Len(t, p.Meta.Origin.Digest["sha256"], 64)
+	}
+	assert.Equal(t, "a.yaml", policySet.Policies[1].Meta.Origin.Uri)
+	assert.Equal(t, "shared/c.yaml", policySet.Policies[2].Meta.Origin.Uri)
+}
+
+// TestFromPolicyWithImports_ResolverCycle verifies that import cycles are reported.
+func TestFromPolicyWithImports_ResolverCycle(t *testing.T) {
+	dir := t.TempDir()
+	writeImportTestFile(t, dir, "a.yaml", importTestPolicyYAML("policy-a", "b.yaml"))
+	writeImportTestFile(t, dir, "b.yaml", importTestPolicyYAML("policy-b", "a.yaml"))
+
+	policy := createTestPolicy()
+	policy.Imports.Policies = []string{"a.yaml"}
+
+	_, err := FromPolicyWithImports(policy, WithPolicyResolver(&FileResolver{BaseDir: dir}))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "import cycle detected")
+}
+
+// TestFromPolicyWithImports_ResolverCycleToRoot verifies that a cycle back to the root policy is reported.
+func TestFromPolicyWithImports_ResolverCycleToRoot(t *testing.T) {
+	dir := t.TempDir()
+	writeImportTestFile(t, dir, "root.yaml", importTestPolicyYAML("policy-root", "a.yaml"))
+	writeImportTestFile(t, dir, "a.yaml", importTestPolicyYAML("policy-a", "root.yaml"))
+
+	policy := &gemara.Policy{}
+	require.NoError(t, policy.LoadFile("file://"+filepath.Join(dir, "root.yaml")))
+
+	_, err := FromPolicyWithImports(policy, WithPolicyResolver(&FileResolver{BaseDir: dir}))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "import cycle detected")
+}
+
+// TestFromPolicyWithImports_ResolverMissing verifies that unresolvable imports fail the conversion.
+func TestFromPolicyWithImports_ResolverMissing(t *testing.T) {
+	policy := createTestPolicy()
+	policy.Imports.Policies = []string{"missing.yaml"}
+
+	_, err := FromPolicyWithImports(policy, WithPolicyResolver(&FileResolver{BaseDir: t.TempDir()}))
+	require.Error(t, err)
+	assert.ErrorIs(t, err, ErrPolicyNotResolved)
+}
+
+// TestMirrorResolver verifies remote references are mapped into the mirror directory.
+func TestMirrorResolver(t *testing.T) {
+	mirror := t.TempDir()
+	writeImportTestFile(t, mirror, "github.com/org/policies/slsa/builder.yaml", importTestPolicyYAML("slsa-builder"))
+
+	resolver := &MirrorResolver{Root: mirror}
+
+	resolved, err := resolver.Resolve("git+https://github.com/org/policies@abc123#slsa/builder.yaml", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "slsa-builder", resolved.Policy.Metadata.Id)
+	assert.Equal(t, filepath.Join(mirror, "github.com/org/policies/slsa/builder.yaml"), resolved.Source)
+
+	_, err = resolver.Resolve("local.yaml", nil)
+	assert.ErrorIs(t, err, ErrPolicyNotResolved)
+
+	_, err = resolver.Resolve("https://example.com/../../etc/passwd", nil)
+	assert.Error(t, err)
+}
+
+// TestGitResolver verifies imports are read from a repository at a pinned revision.
+func TestGitResolver(t *testing.T) {
+	repoDir := t.TempDir()
+	repo, err := git.PlainInit(repoDir, false)
+	require.NoError(t, err)
+	worktree, err := repo.Worktree()
+	require.NoError(t, err)
+
+	commitFile := func(name, content string) string {
+		writeImportTestFile(t, repoDir, name, content)
+		_, err := worktree.Add(name)
+		require.NoError(t, err)
+		hash, err := worktree.Commit("update "+name, &git.CommitOptions{
+			Author: &object.Signature{Name: "test", Email: "test@example.com", When: time.Now()},
+		})
+		require.NoError(t, err)
+		return hash.String()
+	}
+
+	pinned := commitFile("policies/a.yaml", importTestPolicyYAML("policy-a", "b.yaml"))
+	commitFile("policies/b.yaml", importTestPolicyYAML("policy-b"))
+
+	// At the pinned revision b.yaml does not exist yet
+	resolver := &GitResolver{RepoPath: repoDir, Revision: pinned}
+	parent, err := resolver.Resolve("git+https://github.com/org/repo#policies/a.yaml", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "policy-a", parent.Policy.Metadata.Id)
+	assert.Equal(t, pinned, parent.Digest["gitCommit"])
+	assert.NotEmpty(t, parent.Digest["gitBlob"])
+	assert.NotEmpty(t, parent.Digest["sha256"])
+
+	_, err = resolver.Resolve("b.yaml", parent)
+	assert.ErrorIs(t, err, ErrPolicyNotResolved)
+
+	// At HEAD the relative import resolves next to the parent
+	head := &GitResolver{RepoPath: repoDir}
+	parent, err = head.Resolve("policies/a.yaml", nil)
+	require.NoError(t, err)
+	child, err := head.Resolve("b.yaml", parent)
+	require.NoError(t, err)
+	assert.Equal(t, "policy-b", child.Policy.Metadata.Id)
+}
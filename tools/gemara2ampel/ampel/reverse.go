@@ -0,0 +1,235 @@
+package ampel
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/gemaraproj/go-gemara"
+	"github.com/goccy/go-yaml"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// contextReferencePattern matches context["param-id"] references in CEL code.
+var contextReferencePattern = regexp.MustCompile(`context\[\s*"([^"]+)"\s*\]`)
+
+// importAuthor is recorded as the author of policies created by ToGemaraPolicy.
+var importAuthor = gemara.Actor{
+	Id:   "ampel_export",
+	Name: "ampel_export import",
+	Type: gemara.Software,
+}
+
+// ToGemaraPolicy converts an Ampel policy into a Gemara Layer-3 policy
+// skeleton, so hand-written Ampel policies can be brought under the same
+// governance model as generated ones.
+//
+// The reverse mapping:
+//   - Policy ID and meta description become the Gemara policy metadata
+//   - Each tenet becomes one assessment plan with an automated evaluation
+//     method, the tenet ID as plan ID and the tenet title or assessment
+//     message as method description
+//   - Parameters are extracted from the context["param-id"] references in
+//     each tenet's CEL, with accepted values from Policy.Context
+//   - Evidence requirements are derived from the tenet predicate types
+//   - Meta.Controls frameworks become mapping references and catalog
+//     imports, and the first control ID is used as requirement ID
+//
+// The skeleton does not reproduce the CEL code. Seed a workspace with the
+// policy returned by AlignTenetIDs to keep the hand-written CEL when the
+// skeleton is converted back with FromPolicy and merged.
+func ToGemaraPolicy(policy *Policy) (*gemara.Policy, error) {
+	if policy == nil {
+		return nil, fmt.Errorf("policy is nil")
+	}
+	if policy.Id == "" {
+		return nil, fmt.Errorf("policy has no ID")
+	}
+	if len(policy.Tenets) == 0 {
+		return nil, fmt.Errorf("policy %s has no inline tenets", policy.Id)
+	}
+
+	gemaraPolicy := &gemara.Policy{
+		Title: policy.Id,
+		Metadata: gemara.Metadata{
+			Id:          policy.Id,
+			Description: policy.GetMeta().GetDescription(),
+			Author:      importAuthor,
+		},
+	}
+	if version := policy.GetMeta().GetVersion(); version > 0 {
+		gemaraPolicy.Metadata.Version = fmt.Sprintf("%d.0.0", version)
+	}
+
+	// Frameworks of the control references become catalog imports
+	requirementID := policy.Id
+	seenFrameworks := make(map[string]bool)
+	for _, control := range policy.GetMeta().GetControls() {
+		if requirementID == policy.Id && control.GetId() != "" {
+			requirementID = control.GetId()
+		}
+		framework := control.GetFramework()
+		if framework == "" || seenFrameworks[framework] {
+			continue
+		}
+		seenFrameworks[framework] = true
+		gemaraPolicy.Metadata.MappingReferences = append(gemaraPolicy.Metadata.MappingReferences, gemara.MappingReference{
+			Id:    framework,
+			Title: framework,
+		})
+		gemaraPolicy.Imports.Catalogs = append(gemaraPolicy.Imports.Catalogs, gemara.CatalogImport{ReferenceId: framework})
+	}
+
+	for i, tenet := range policy.Tenets {
+		planID := tenet.GetId()
+		if planID == "" {
+			planID = fmt.Sprintf("plan-%02d", i+1)
+		}
+
+		plan := gemara.AssessmentPlan{
+			Id:            planID,
+			RequirementId: requirementID,
+			EvaluationMethods: []gemara.AcceptedMethod{{
+				Type:        "automated",
+				Description: tenetDescription(tenet),
+			}},
+			EvidenceRequirements: evidenceFromPredicates(tenet.GetPredicates().GetTypes()),
+		}
+
+		params, err := extractParameters(tenet.GetCode(), policy.Context)
+		if err != nil {
+			return nil, fmt.Errorf("error extracting parameters of tenet %s: %w", tenet.GetId(), err)
+		}
+		plan.Parameters = params
+
+		gemaraPolicy.Adherence.AssessmentPlans = append(gemaraPolicy.Adherence.AssessmentPlans, plan)
+	}
+
+	return gemaraPolicy, nil
+}
+
+// AlignTenetIDs returns a copy of policy whose tenet IDs are the IDs FromPolicy
+// generates for the skeleton returned by ToGemaraPolicy. Saving the copy in a
+// workspace makes MergePolicy preserve every hand-written tenet when the
+// skeleton is regenerated.
+func AlignTenetIDs(policy *Policy, gemaraPolicy *gemara.Policy) (*Policy, error) {
+	plans := gemaraPolicy.Adherence.AssessmentPlans
+	if len(plans) != len(policy.Tenets) {
+		return nil, fmt.Errorf("policy %s has %d tenets but the Gemara policy has %d assessment plans",
+			policy.Id, len(policy.Tenets), len(plans))
+	}
+
+	aligned := proto.Clone(policy).(*Policy)
+	for i, plan := range plans {
+		aligned.Tenets[i].Id = generatedTenetID(plan, 0)
+	}
+	return aligned, nil
+}
+
+// MarshalGemaraPolicy serializes a Gemara policy as YAML, omitting empty
+// fields. Actor types are written by name, since the go-gemara marshalers
+// are not used for non-pointer fields.
+func MarshalGemaraPolicy(policy *gemara.Policy) ([]byte, error) {
+	data, err := yaml.MarshalWithOptions(policy,
+		yaml.OmitEmpty(),
+		yaml.CustomMarshaler[gemara.ActorType](func(actorType gemara.ActorType) ([]byte, error) {
+			return []byte(actorType.String()), nil
+		}),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to serialize Gemara policy: %w", err)
+	}
+	return data, nil
+}
+
+// tenetDescription describes what a tenet verifies, preferring its title.
+func tenetDescription(tenet *Tenet) string {
+	if tenet.GetTitle() != "" {
+		return tenet.GetTitle()
+	}
+	if tenet.GetAssessment().GetMessage() != "" {
+		return tenet.GetAssessment().GetMessage()
+	}
+	return fmt.Sprintf("Verify tenet %s", tenet.GetId())
+}
+
+// evidenceFromPredicates describes the attestations a tenet evaluates.
+func evidenceFromPredicates(predicateTypes []string) string {
+	switch len(predicateTypes) {
+	case 0:
+		return ""
+	case 1:
+		return "Attestation of predicate type " + predicateTypes[0]
+	default:
+		return "Attestations of predicate types " + strings.Join(predicateTypes, ", ")
+	}
+}
+
+// extractParameters returns a parameter for every distinct context key
+// referenced by the CEL code, in order of first reference.
+func extractParameters(code string, context map[string]*ContextVal) ([]gemara.Parameter, error) {
+	var params []gemara.Parameter
+	seen := make(map[string]bool)
+	for _, match := range contextReferencePattern.FindAllStringSubmatch(code, -1) {
+		key := match[1]
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		param := gemara.Parameter{Id: key, Label: key}
+		if contextVal, ok := context[key]; ok {
+			param.Description = contextVal.GetDescription()
+			accepted, err := acceptedValuesFromContext(contextVal)
+			if err != nil {
+				return nil, fmt.Errorf("context %s: %w", key, err)
+			}
+			param.AcceptedValues = accepted
+		}
+		params = append(params, param)
+	}
+	return params, nil
+}
+
+// acceptedValuesFromContext returns the value of a context entry, or its
+// default, as accepted values. Lists give one accepted value per item.
+func acceptedValuesFromContext(contextVal *ContextVal) ([]string, error) {
+	value := contextVal.GetValue()
+	if value == nil {
+		value = contextVal.GetDefault()
+	}
+	if value == nil {
+		return nil, nil
+	}
+
+	if list := value.GetListValue(); list != nil {
+		accepted := make([]string, 0, len(list.GetValues()))
+		for _, item := range list.GetValues() {
+			str, err := scalarString(item)
+			if err != nil {
+				return nil, err
+			}
+			accepted = append(accepted, str)
+		}
+		return accepted, nil
+	}
+
+	str, err := scalarString(value)
+	if err != nil {
+		return nil, err
+	}
+	return []string{str}, nil
+}
+
+// scalarString formats a scalar context value as a Gemara accepted value.
+func scalarString(value *structpb.Value) (string, error) {
+	switch kind := value.GetKind().(type) {
+	case *structpb.Value_StringValue:
+		return kind.StringValue, nil
+	case *structpb.Value_BoolValue, *structpb.Value_NumberValue:
+		return fmt.Sprint(value.AsInterface()), nil
+	default:
+		return "", fmt.Errorf("unsupported value %v", value.AsInterface())
+	}
+}
@@ -0,0 +1,111 @@
+package ampel
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// bpPoliciesDir holds the hand-written branch protection Ampel policies.
+const bpPoliciesDir = "../../../base_ansible_env/files/ampel-policies"
+
+// loadAmpelPolicy reads an Ampel policy JSON file.
+func loadAmpelPolicy(t *testing.T, path string) *Policy {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	policy := &Policy{}
+	require.NoError(t, json.Unmarshal(data, policy))
+	return policy
+}
+
+// TestToGemaraPolicy verifies plans, parameters, evidence and control references of the skeleton.
+func TestToGemaraPolicy(t *testing.T) {
+	policy := loadAmpelPolicy(t, filepath.Join(bpPoliciesDir, "BP-02.01-minimum-approvals.json"))
+	builders, err := structpb.NewValue([]interface{}{"github", "gitlab"})
+	require.NoError(t, err)
+	description := "Allowed platforms"
+	policy.Context = map[string]*ContextVal{"platform": {Type: "string", Default: builders, Description: &description}}
+	policy.Tenets[0].Code = `context["platform"] == "github" && context["platform"] != "" && ` + policy.Tenets[0].Code
+
+	gemaraPolicy, err := ToGemaraPolicy(policy)
+	require.NoError(t, err)
+
+	assert.Equal(t, "BP-2.01", gemaraPolicy.Metadata.Id)
+	assert.Equal(t, policy.Meta.Description, gemaraPolicy.Metadata.Description)
+	require.Len(t, gemaraPolicy.Metadata.MappingReferences, 2)
+	assert.Equal(t, "repo-branch-protection", gemaraPolicy.Metadata.MappingReferences[0].Id)
+	assert.Equal(t, "OSPS", gemaraPolicy.Imports.Catalogs[1].ReferenceId)
+
+	plans := gemaraPolicy.Adherence.AssessmentPlans
+	require.Len(t, plans, 3)
+	assert.Equal(t, "01", plans[0].Id)
+	assert.Equal(t, "BP-2", plans[0].RequirementId)
+	assert.Equal(t, "automated", plans[0].EvaluationMethods[0].Type)
+	assert.Equal(t, "Minimum one non-author approval is required", plans[0].EvaluationMethods[0].Description)
+	assert.Equal(t, "Attestation of predicate type http://github.com/carabiner-dev/snappy/specs/branch-rules.yaml", plans[0].EvidenceRequirements)
+
+	require.Len(t, plans[0].Parameters, 1)
+	assert.Equal(t, "platform", plans[0].Parameters[0].Id)
+	assert.Equal(t, []string{"github", "gitlab"}, plans[0].Parameters[0].AcceptedValues)
+	assert.Equal(t, "Allowed platforms", plans[0].Parameters[0].Description)
+	assert.Empty(t, plans[1].Parameters)
+
+	_, err = ToGemaraPolicy(&Policy{Id: "empty"})
+	assert.Error(t, err)
+}
+
+// TestToGemaraPolicy_RoundTrip verifies the hand-written CEL survives import, regeneration and workspace merge byte for byte.
+func TestToGemaraPolicy_RoundTrip(t *testing.T) {
+	paths, err := filepath.Glob(filepath.Join(bpPoliciesDir, "BP-*.json"))
+	require.NoError(t, err)
+	require.NotEmpty(t, paths)
+
+	for _, path := range paths {
+		t.Run(filepath.Base(path), func(t *testing.T) {
+			original := loadAmpelPolicy(t, path)
+
+			gemaraPolicy, err := ToGemaraPolicy(original)
+			require.NoError(t, err)
+
+			// Go through the YAML skeleton as the import command writes it
+			data, err := MarshalGemaraPolicy(gemaraPolicy)
+			require.NoError(t, err)
+			skeleton, err := parsePolicyData("skeleton.yaml", data)
+			require.NoError(t, err)
+
+			seed, err := AlignTenetIDs(original, skeleton)
+			require.NoError(t, err)
+			ws, err := NewWorkspace(t.TempDir())
+			require.NoError(t, err)
+			require.NoError(t, ws.SavePolicy(seed.Id, seed))
+
+			generated, err := FromPolicy(skeleton)
+			require.NoError(t, err)
+
+			// Re-conversion selects the original predicate types
+			require.Len(t, generated.Tenets, len(original.Tenets))
+			for i, tenet := range generated.Tenets {
+				assert.Equal(t, original.Tenets[i].GetPredicates().GetTypes(), tenet.GetPredicates().GetTypes())
+			}
+			existing, err := ws.LoadPolicy(generated.Id)
+			require.NoError(t, err)
+
+			merged, stats, err := MergePolicy(existing, generated)
+			require.NoError(t, err)
+			assert.Equal(t, len(original.Tenets), stats.TenetsPreserved)
+			assert.Zero(t, stats.TenetsAdded)
+			assert.Zero(t, stats.TenetsRemoved)
+
+			require.Len(t, merged.Tenets, len(original.Tenets))
+			for i, tenet := range merged.Tenets {
+				assert.Equal(t, original.Tenets[i].Code, tenet.Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,79 @@
+package ampel
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/goccy/go-yaml"
+)
+
+// SourceTree lists the Gemara policies and catalogs of a directory tree.
+type SourceTree struct {
+	Policies []string
+	Catalogs []string
+}
+
+// catalogFields are the top-level fields of Gemara catalogs.
+var catalogFields = []string{"controls", "families", "threats", "capabilities", "imported-controls"}
+
+// ScanSources walks the directory tree at root for Gemara policies and
+// catalogs, told apart by their top-level fields: policies have adherence,
+// catalogs have controls, families, threats or capabilities. Other YAML
+// files, such as values files, are skipped, as are hidden directories and
+// the directories in skip, such as a workspace inside the tree. Paths are
+// returned in lexical order.
+func ScanSources(root string, skip ...string) (*SourceTree, error) {
+	skipped := make(map[string]bool, len(skip))
+	for _, dir := range skip {
+		if abs, err := filepath.Abs(dir); err == nil {
+			skipped[abs] = true
+		}
+	}
+
+	tree := &SourceTree{}
+	err := filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			if path != root && strings.HasPrefix(entry.Name(), ".") {
+				return filepath.SkipDir
+			}
+			if abs, err := filepath.Abs(path); err == nil && skipped[abs] {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if ext := filepath.Ext(path); ext != ".yaml" && ext != ".yml" {
+			return nil
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		var document interface{}
+		if err := yaml.Unmarshal(data, &document); err != nil {
+			return fmt.Errorf("failed to parse %s: %w", path, err)
+		}
+		fields, ok := document.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		switch {
+		case fields["adherence"] != nil:
+			tree.Policies = append(tree.Policies, path)
+		case slices.ContainsFunc(catalogFields, func(field string) bool { return fields[field] != nil }):
+			tree.Catalogs = append(tree.Catalogs, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan %s: %w", root, err)
+	}
+	return tree, nil
+}
@@ -0,0 +1,49 @@
+package ampel
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestScanSources verifies policies and catalogs are told apart by their fields.
+func TestScanSources(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]string{
+		"policies/b.yaml":            "metadata:\n  id: b\nadherence:\n  assessment-plans: []\n",
+		"policies/a.yml":             "metadata:\n  id: a\nadherence: {}\n",
+		"catalogs/catalog.yaml":      "metadata:\n  id: c\ncontrols:\n  - id: C-01\n",
+		"values.yaml":                "builder-id: https://github.com/actions/runner\n",
+		"list.yaml":                  "- a\n",
+		"README.md":                  "adherence: {}\n",
+		".git/policy.yaml":           "adherence: {}\n",
+		"workspace/ignored.yaml":     "adherence: {}\n",
+		"policies/nested/deep.yaml":  "adherence: {}\n",
+		"catalogs/threats-only.yaml": "threats:\n  - id: T-01\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0600))
+	}
+
+	tree, err := ScanSources(root, filepath.Join(root, "workspace"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		filepath.Join(root, "policies", "a.yml"),
+		filepath.Join(root, "policies", "b.yaml"),
+		filepath.Join(root, "policies", "nested", "deep.yaml"),
+	}, tree.Policies)
+	assert.Equal(t, []string{
+		filepath.Join(root, "catalogs", "catalog.yaml"),
+		filepath.Join(root, "catalogs", "threats-only.yaml"),
+	}, tree.Catalogs)
+
+	// Malformed YAML is reported rather than skipped
+	require.NoError(t, os.WriteFile(filepath.Join(root, "broken.yaml"), []byte("a: [\n"), 0600))
+	_, err = ScanSources(root)
+	assert.Error(t, err)
+}
@@ -0,0 +1,295 @@
+package ampel
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+)
+
+// OutputState classifies a workspace output against its manifest entry.
+type OutputState string
+
+const (
+	// OutputUpToDate outputs are unchanged, as are their sources
+	OutputUpToDate OutputState = "up-to-date"
+
+	// OutputStale outputs were generated from sources, catalogs, CEL
+	// templates or a tool version that have changed since
+	OutputStale OutputState = "stale"
+
+	// OutputHandModified outputs were edited after their generation in a
+	// way that regenerating them would drop, such as hand-added tenets or
+	// edits of fields that follow the generator. Edits the merge keeps,
+	// such as CEL code, are not reported.
+	OutputHandModified OutputState = "hand-modified"
+
+	// OutputOrphaned outputs were generated from a Gemara policy that no
+	// longer exists
+	OutputOrphaned OutputState = "orphaned"
+
+	// OutputMissing outputs are recorded in the manifest but their file is
+	// gone, or were never generated from a Gemara policy of the sources
+	OutputMissing OutputState = "missing"
+)
+
+// OutputStates lists the output states in reporting order.
+var OutputStates = []OutputState{OutputUpToDate, OutputStale, OutputHandModified, OutputOrphaned, OutputMissing}
+
+// ParseOutputState parses an output state name.
+func ParseOutputState(name string) (OutputState, error) {
+	state := OutputState(name)
+	if !slices.Contains(OutputStates, state) {
+		return "", fmt.Errorf("unknown output state %q (use up-to-date, stale, hand-modified, orphaned or missing)", name)
+	}
+	return state, nil
+}
+
+// OutputStatus is the state of a workspace output. An output may be in
+// several states, such as stale and hand-modified, but up-to-date only
+// alone.
+type OutputStatus struct {
+	ID   string `json:"id"`
+	Kind string `json:"kind,omitempty"`
+
+	// Output is the output path relative to the workspace, empty for
+	// sources never generated
+	Output string `json:"output,omitempty"`
+
+	// Source is the Gemara policy of the output
+	Source string `json:"source,omitempty"`
+
+	States  []OutputState `json:"states"`
+	Reasons []string      `json:"reasons,omitempty"`
+}
+
+// Has reports whether the output is in state.
+func (s *OutputStatus) Has(state OutputState) bool {
+	return slices.Contains(s.States, state)
+}
+
+// Status returns the state of every output of the workspace manifest,
+// comparing the recorded output digest with the current file and the
+// recorded sources and catalogs with their current content. templateDigest
+// and toolVersion are those a regeneration would use.
+func (w *Workspace) Status(templateDigest, toolVersion string) ([]OutputStatus, error) {
+	manifest, err := w.LoadManifest()
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]OutputStatus, 0, len(manifest.Outputs))
+	for _, entry := range manifest.Outputs {
+		status, err := w.OutputStatus(entry, templateDigest, toolVersion)
+		if err != nil {
+			return nil, err
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// OutputStatus returns the state of the output recorded by entry, as Status
+// does.
+func (w *Workspace) OutputStatus(entry ManifestEntry, templateDigest, toolVersion string) (OutputStatus, error) {
+	status := OutputStatus{ID: entry.ID, Kind: entry.Kind, Output: entry.Output.Path}
+	addState := func(state OutputState, reasons ...string) {
+		if !status.Has(state) {
+			status.States = append(status.States, state)
+		}
+		status.Reasons = append(status.Reasons, reasons...)
+	}
+
+	data, err := os.ReadFile(w.ResolvePath(entry.Output.Path))
+	switch {
+	case os.IsNotExist(err):
+		addState(OutputMissing, fmt.Sprintf("output %s is missing", entry.Output.Path))
+	case err != nil:
+		return OutputStatus{}, fmt.Errorf("failed to read output %s: %w", entry.Output.Path, err)
+	case DigestBytes(data) != entry.Output.Digest:
+		dropped, err := w.droppedEdits(entry, data)
+		if err != nil {
+			return OutputStatus{}, err
+		}
+		if len(dropped) > 0 {
+			addState(OutputHandModified, dropped...)
+		}
+	}
+
+	if len(entry.Sources) > 0 {
+		status.Source = entry.Sources[0].Path
+		if _, err := os.Stat(w.ResolvePath(status.Source)); os.IsNotExist(err) {
+			addState(OutputOrphaned, fmt.Sprintf("source %s no longer exists", status.Source))
+			return status, nil
+		}
+	}
+
+	inputs := ManifestEntry{TemplateDigest: templateDigest, ToolVersion: toolVersion}
+	if inputs.Sources, err = w.currentDigests(entry.Sources); err != nil {
+		return OutputStatus{}, err
+	}
+	if inputs.Catalogs, err = w.currentDigests(entry.Catalogs); err != nil {
+		return OutputStatus{}, err
+	}
+	if changes := entry.inputChanges(inputs); len(changes) > 0 {
+		addState(OutputStale, changes...)
+	}
+
+	if len(status.States) == 0 {
+		status.States = []OutputState{OutputUpToDate}
+	}
+	return status, nil
+}
+
+// droppedEdits returns the edits of an output changed since its generation
+// that regenerating it would drop. The output is merged with its generation
+// base as if regenerated unchanged, with the locks of the workspace and the
+// orphan mode and merge strategies recorded in entry, and compared with the
+// merge result; the manual-only marker added to kept orphans is no edit. As the generated policy is the base, the
+// merge cannot conflict: conflicts with upstream changes are reported by the
+// next sync. Without a recorded base, or when the output no longer parses,
+// any change is reported.
+func (w *Workspace) droppedEdits(entry ManifestEntry, data []byte) ([]string, error) {
+	changed := []string{fmt.Sprintf("output %s changed since it was generated", entry.Output.Path)}
+	locks, err := w.LoadLocks(entry.ID)
+	if err != nil {
+		return nil, err
+	}
+	mergeOpts, err := entry.mergeOptions()
+	if err != nil {
+		return nil, fmt.Errorf("invalid merge settings recorded for %s: %w", entry.ID, err)
+	}
+	mergeOpts = append(mergeOpts, WithLocks(locks))
+
+	if entry.Kind == ManifestKindPolicySet {
+		base, err := w.LoadPolicySetBase(entry.ID)
+		if err != nil || base == nil {
+			return changed, err
+		}
+		existing := &PolicySet{}
+		if json.Unmarshal(data, existing) != nil {
+			return changed, nil
+		}
+		merged, _, err := MergePolicySetWithBase(base, existing, base, mergeOpts...)
+		if err != nil {
+			return changed, nil
+		}
+		for _, policy := range merged.Policies {
+			for _, existingPolicy := range existing.Policies {
+				if existingPolicy.GetId() == policy.GetId() {
+					unmarkKeptOrphans(existingPolicy, policy)
+				}
+			}
+		}
+
+		diff := DiffPolicySets(existing, merged, nil)
+		var dropped []string
+		for _, id := range diff.PoliciesAdded {
+			dropped = append(dropped, fmt.Sprintf("policy %s would be restored on regeneration", id))
+		}
+		for _, id := range diff.PoliciesRemoved {
+			dropped = append(dropped, fmt.Sprintf("policy %s would be removed on regeneration", id))
+		}
+		for _, policyDiff := range diff.Policies {
+			dropped = append(dropped, droppedPolicyEdits("policy "+policyDiff.PolicyID+" ", policyDiff)...)
+		}
+		for _, field := range diff.Fields {
+			dropped = append(dropped, fmt.Sprintf("%s edit would be dropped on regeneration", field.Field))
+		}
+		return dropped, nil
+	}
+
+	base, err := w.LoadBase(entry.ID)
+	if err != nil || base == nil {
+		return changed, err
+	}
+	existing := &Policy{}
+	if json.Unmarshal(data, existing) != nil {
+		return changed, nil
+	}
+	merged, _, err := MergePolicyWithBase(base, existing, base, mergeOpts...)
+	if err != nil {
+		return changed, nil
+	}
+	unmarkKeptOrphans(existing, merged)
+	return droppedPolicyEdits("", DiffPolicies(existing, merged, nil)), nil
+}
+
+// unmarkKeptOrphans removes the manual-only marker from the tenets of merged
+// that the merge marked, as the edits of kept orphans are not dropped.
+func unmarkKeptOrphans(existing, merged *Policy) {
+	marked := make(map[string]bool, len(existing.GetTenets()))
+	for _, tenet := range existing.GetTenets() {
+		marked[tenet.GetId()] = IsManualOnly(tenet)
+	}
+	for _, tenet := range merged.GetTenets() {
+		if !marked[tenet.GetId()] {
+			unmarkManualOnly(tenet)
+		}
+	}
+}
+
+// droppedPolicyEdits describes the differences from an edited policy to its
+// merge result, each prefixed with prefix.
+func droppedPolicyEdits(prefix string, diff *PolicyDiff) []string {
+	var dropped []string
+	for _, id := range diff.TenetsAdded {
+		dropped = append(dropped, fmt.Sprintf("%stenet %s would be restored on regeneration", prefix, id))
+	}
+	for _, id := range diff.TenetsRemoved {
+		dropped = append(dropped, fmt.Sprintf("%stenet %s would be removed on regeneration", prefix, id))
+	}
+	for _, tenet := range diff.Tenets {
+		for _, field := range tenet.Fields {
+			dropped = append(dropped, fmt.Sprintf("%stenet %s %s edit would be dropped on regeneration", prefix, tenet.TenetID, field.Field))
+		}
+	}
+	for _, change := range diff.Context {
+		dropped = append(dropped, fmt.Sprintf("%scontext %s edit would be dropped on regeneration", prefix, change.Key))
+	}
+	for _, field := range diff.Fields {
+		dropped = append(dropped, fmt.Sprintf("%s%s edit would be dropped on regeneration", prefix, field.Field))
+	}
+	return dropped
+}
+
+// UntrackedSources returns the Gemara policies of paths from which no
+// output of the workspace manifest was generated.
+func (w *Workspace) UntrackedSources(paths []string) ([]string, error) {
+	manifest, err := w.LoadManifest()
+	if err != nil {
+		return nil, err
+	}
+
+	tracked := make(map[string]bool, len(manifest.Outputs))
+	for _, entry := range manifest.Outputs {
+		if len(entry.Sources) > 0 {
+			tracked[entry.Sources[0].Path] = true
+		}
+	}
+
+	var untracked []string
+	for _, path := range paths {
+		if !tracked[w.relativePath(path)] {
+			untracked = append(untracked, path)
+		}
+	}
+	return untracked, nil
+}
+
+// currentDigests returns the current digests of the recorded files that
+// still exist.
+func (w *Workspace) currentDigests(recorded []FileDigest) ([]FileDigest, error) {
+	current := make([]FileDigest, 0, len(recorded))
+	for _, file := range recorded {
+		data, err := os.ReadFile(w.ResolvePath(file.Path))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", file.Path, err)
+		}
+		current = append(current, FileDigest{Path: file.Path, Digest: DigestBytes(data)})
+	}
+	return current, nil
+}
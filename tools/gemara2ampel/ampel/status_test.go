@@ -0,0 +1,155 @@
+package ampel
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestWorkspace_Status verifies outputs are classified against the manifest.
+func TestWorkspace_Status(t *testing.T) {
+	dir := t.TempDir()
+	ws, err := NewWorkspace(filepath.Join(dir, "policies"))
+	require.NoError(t, err)
+
+	write := func(path, content string) {
+		require.NoError(t, os.WriteFile(path, []byte(content), 0600))
+	}
+	record := func(id string) (source, output string) {
+		source = filepath.Join(dir, id+".yaml")
+		output = filepath.Join(ws.Path, id+".json")
+		write(source, "source "+id)
+		write(output, "output "+id)
+
+		entry := ManifestEntry{ID: id, Kind: ManifestKindPolicy, TemplateDigest: "sha256:t", ToolVersion: "1.0.0"}
+		entry.Output, err = ws.DigestFile(output)
+		require.NoError(t, err)
+		sourceDigest, err := ws.DigestFile(source)
+		require.NoError(t, err)
+		entry.Sources = []FileDigest{sourceDigest}
+		require.NoError(t, ws.RecordOutput(entry))
+		return source, output
+	}
+
+	record("current")
+	staleSource, _ := record("stale")
+	_, modifiedOutput := record("modified")
+	orphanSource, _ := record("orphaned")
+	_, missingOutput := record("missing")
+	bothSource, bothOutput := record("both")
+
+	write(staleSource, "changed")
+	write(modifiedOutput, "edited")
+	require.NoError(t, os.Remove(orphanSource))
+	require.NoError(t, os.Remove(missingOutput))
+	write(bothSource, "changed")
+	write(bothOutput, "edited")
+
+	statuses, err := ws.Status("sha256:t", "1.0.0")
+	require.NoError(t, err)
+	states := make(map[string][]OutputState)
+	for _, status := range statuses {
+		states[status.ID] = status.States
+	}
+	assert.Equal(t, map[string][]OutputState{
+		"current":  {OutputUpToDate},
+		"stale":    {OutputStale},
+		"modified": {OutputHandModified},
+		"orphaned": {OutputOrphaned},
+		"missing":  {OutputMissing},
+		"both":     {OutputHandModified, OutputStale},
+	}, states)
+
+	assert.Equal(t, []string{"source ../stale.yaml changed"}, statuses[statusIndex(statuses, "stale")].Reasons)
+	assert.Equal(t, "../current.yaml", statuses[statusIndex(statuses, "current")].Source)
+
+	// A new template library or tool version makes every generated output stale
+	statuses, err = ws.Status("sha256:new", "1.0.0")
+	require.NoError(t, err)
+	assert.True(t, statuses[statusIndex(statuses, "current")].Has(OutputStale))
+
+	// Sources without output are untracked
+	untracked, err := ws.UntrackedSources([]string{filepath.Join(dir, "current.yaml"), filepath.Join(dir, "new.yaml")})
+	require.NoError(t, err)
+	assert.Equal(t, []string{filepath.Join(dir, "new.yaml")}, untracked)
+}
+
+// TestWorkspace_StatusDroppedEdits verifies only edits a regeneration would
+// drop make an output hand-modified.
+func TestWorkspace_StatusDroppedEdits(t *testing.T) {
+	dir := t.TempDir()
+	ws, err := NewWorkspace(filepath.Join(dir, "policies"))
+	require.NoError(t, err)
+
+	generated := newMergeTestPolicy(withTenets(&Tenet{Id: "tenet-1", Title: "Title v1", Code: "code_v1", Runtime: "cel@v0"}))
+	require.NoError(t, ws.SaveBase("test-policy", generated))
+	require.NoError(t, ws.SavePolicy("test-policy", generated))
+	entry := ManifestEntry{ID: "test-policy", Kind: ManifestKindPolicy}
+	entry.Output, err = ws.DigestFile(ws.GetPolicyPath("test-policy"))
+	require.NoError(t, err)
+
+	status := func(edited *Policy) OutputStatus {
+		t.Helper()
+		require.NoError(t, ws.SavePolicy("test-policy", edited))
+		status, err := ws.OutputStatus(entry, "", "")
+		require.NoError(t, err)
+		return status
+	}
+
+	// Edited code and titles are kept by the merge
+	edited := status(newMergeTestPolicy(withTenets(&Tenet{Id: "tenet-1", Title: "Reviewed", Code: "manual", Runtime: "cel@v0"})))
+	assert.Equal(t, []OutputState{OutputUpToDate}, edited.States)
+
+	// The runtime follows the generator, hand-added tenets are orphaned
+	edited = status(newMergeTestPolicy(withTenets(
+		&Tenet{Id: "tenet-1", Title: "Title v1", Code: "code_v1", Runtime: "cel@v1"},
+		&Tenet{Id: "hand-added", Code: "true"},
+	)))
+	assert.Equal(t, []OutputState{OutputHandModified}, edited.States)
+	assert.Equal(t, []string{
+		"tenet hand-added would be removed on regeneration",
+		"tenet tenet-1 runtime edit would be dropped on regeneration",
+	}, edited.Reasons)
+
+	// Hand-deleted tenets are restored
+	edited = status(newMergeTestPolicy())
+	assert.Equal(t, []string{"tenet tenet-1 would be restored on regeneration"}, edited.Reasons)
+
+	// The recorded orphan mode and merge strategies are replayed
+	entry.OrphanMode = string(OrphanKeep)
+	entry.MergeStrategies = []string{"tenet.runtime=manual"}
+	edited = status(newMergeTestPolicy(withTenets(
+		&Tenet{Id: "tenet-1", Title: "Title v1", Code: "code_v1", Runtime: "cel@v1"},
+		&Tenet{Id: "hand-added", Code: "true"},
+	)))
+	assert.Equal(t, []OutputState{OutputUpToDate}, edited.States)
+	entry.OrphanMode, entry.MergeStrategies = "", nil
+
+	// Without a base any change is reported
+	require.NoError(t, ws.RemoveBase("test-policy"))
+	edited = status(newMergeTestPolicy(withTenets(&Tenet{Id: "tenet-1", Title: "Reviewed", Code: "manual", Runtime: "cel@v0"})))
+	assert.Equal(t, []string{"output test-policy.json changed since it was generated"}, edited.Reasons)
+}
+
+// TestParseOutputState verifies state names are validated.
+func TestParseOutputState(t *testing.T) {
+	state, err := ParseOutputState("hand-modified")
+	require.NoError(t, err)
+	assert.Equal(t, OutputHandModified, state)
+
+	_, err = ParseOutputState("dirty")
+	assert.Error(t, err)
+}
+
+// statusIndex returns the index of the status of an output ID.
+func statusIndex(statuses []OutputStatus, id string) int {
+	for i, status := range statuses {
+		if status.ID == id {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,505 @@
+package ampel
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/goccy/go-yaml"
+)
+
+// BackupDir is the workspace subdirectory holding a backup generation per
+// committed workspace operation: the files it replaced, for Rollback.
+const BackupDir = ".backup"
+
+// BackupGenerations is the number of backup generations kept; older ones
+// are pruned on commit.
+const BackupGenerations = 20
+
+// generationFile describes a backup generation within its directory.
+const generationFile = "generation.yaml"
+
+// generationIDFormat is the layout of generation IDs, sortable by time.
+const generationIDFormat = "20060102T150405.000000000Z"
+
+// Generation is a committed workspace operation, with the files it changed.
+type Generation struct {
+	ID    string       `json:"id" yaml:"id"`
+	Time  time.Time    `json:"time" yaml:"time"`
+	Files []BackupFile `json:"files" yaml:"files"`
+}
+
+// BackupFile is a file changed by a generation.
+type BackupFile struct {
+	// Path is the file path, relative to the workspace when possible
+	Path string `json:"path" yaml:"path"`
+
+	// Existed tells whether the file existed before the generation; its
+	// previous content is then kept in Backup, in the generation directory
+	Existed bool   `json:"existed" yaml:"existed"`
+	Backup  string `json:"backup,omitempty" yaml:"backup,omitempty"`
+
+	// Digest is the digest of the content written, empty when the
+	// generation removed the file
+	Digest string `json:"digest,omitempty" yaml:"digest,omitempty"`
+}
+
+// Transaction stages the writes and removals of workspace files so that an
+// operation over several files, or several policies, commits all of them or
+// none. While a transaction is open on a workspace, the workspace methods
+// write into it and read the files it staged. A transaction is safe for
+// concurrent use.
+type Transaction struct {
+	ws     *Workspace
+	mu     sync.Mutex
+	staged map[string]*stagedFile
+	order  []string
+	done   bool
+}
+
+// stagedFile is the staged content of a file, nil when it is removed.
+type stagedFile struct {
+	data []byte
+}
+
+// fileChange is a file write, or a removal when data is nil.
+type fileChange struct {
+	path string
+	data []byte
+}
+
+// Begin opens a transaction on the workspace, taking the workspace lock
+// until it is committed or aborted so that the files read and written
+// through it are not changed by other processes meanwhile. Only one
+// transaction may be open on a workspace at a time.
+func (w *Workspace) Begin() (*Transaction, error) {
+	if w.tx != nil {
+		return nil, errors.New("a transaction is already open on the workspace")
+	}
+	if err := w.lock(); err != nil {
+		return nil, err
+	}
+	w.tx = &Transaction{ws: w, staged: make(map[string]*stagedFile)}
+	return w.tx, nil
+}
+
+// Commit writes the staged files, each through a temporary file renamed
+// into place, after backing up the files they replace into a new
+// generation. When any file fails, the files already replaced are restored
+// and none is changed. Returns the generation, or nil when the staged files
+// change nothing.
+func (t *Transaction) Commit() (*Generation, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.done {
+		return nil, errors.New("transaction already committed or aborted")
+	}
+	t.done = true
+	t.ws.tx = nil
+
+	changes := make([]fileChange, len(t.order))
+	for i, path := range t.order {
+		changes[i] = fileChange{path: path, data: t.staged[path].data}
+	}
+	generation, err := t.ws.commitChanges(changes, true)
+	if unlockErr := t.ws.unlock(); err == nil && unlockErr != nil {
+		return generation, unlockErr
+	}
+	return generation, err
+}
+
+// Abort discards the staged files. Aborting a committed transaction does
+// nothing, so Abort can be deferred.
+func (t *Transaction) Abort() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.done {
+		return
+	}
+	t.done = true
+	t.ws.tx = nil
+	_ = t.ws.unlock()
+}
+
+// stage records the content of a file, nil to remove it.
+func (t *Transaction) stage(path string, data []byte) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.done {
+		return errors.New("transaction already committed or aborted")
+	}
+	if _, ok := t.staged[path]; !ok {
+		t.order = append(t.order, path)
+	}
+	t.staged[path] = &stagedFile{data: data}
+	return nil
+}
+
+// lookup returns the staged content of a file, and whether it is staged.
+func (t *Transaction) lookup(path string) (*stagedFile, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	file, ok := t.staged[path]
+	return file, ok
+}
+
+// stagedPaths returns the paths of the files staged for writing directly
+// in dir with the suffix.
+func (t *Transaction) stagedPaths(dir, suffix string) []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	dir = filepath.Clean(dir)
+	var paths []string
+	for _, path := range t.order {
+		if t.staged[path].data != nil && filepath.Dir(path) == dir && strings.HasSuffix(path, suffix) {
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
+
+// ReadFile reads a file as the workspace sees it: staged by the open
+// transaction, if any, or from disk.
+func (w *Workspace) ReadFile(path string) ([]byte, error) {
+	if w.tx != nil {
+		if file, ok := w.tx.lookup(filepath.Clean(path)); ok {
+			if file.data == nil {
+				return nil, &fs.PathError{Op: "open", Path: path, Err: fs.ErrNotExist}
+			}
+			return bytes.Clone(file.data), nil
+		}
+	}
+	return os.ReadFile(path)
+}
+
+// WriteFile writes a file into the open transaction, or commits it alone
+// as a generation when no transaction is open.
+func (w *Workspace) WriteFile(path string, data []byte) error {
+	if data == nil {
+		data = []byte{}
+	}
+	return w.changeFile(path, data)
+}
+
+// RemoveFile removes a file as WriteFile writes it. Removing a missing file
+// is not an error.
+func (w *Workspace) RemoveFile(path string) error {
+	return w.changeFile(path, nil)
+}
+
+// changeFile writes or, with nil data, removes a file.
+func (w *Workspace) changeFile(path string, data []byte) error {
+	path = filepath.Clean(path)
+	if w.tx != nil {
+		return w.tx.stage(path, data)
+	}
+	_, err := w.commitChanges([]fileChange{{path: path, data: data}}, true)
+	return err
+}
+
+// commitChanges applies file changes all or none under the workspace lock,
+// recording them as a backup generation when backup is set.
+func (w *Workspace) commitChanges(changes []fileChange, backup bool) (_ *Generation, err error) {
+	if err := w.lock(); err != nil {
+		return nil, err
+	}
+	defer func() {
+		if unlockErr := w.unlock(); err == nil {
+			err = unlockErr
+		}
+	}()
+	// Another process may hold a lock file replaced since Begin
+	if err := w.checkLock(); err != nil {
+		return nil, err
+	}
+
+	// Read the current content of each file, dropping changes that change nothing
+	type pendingChange struct {
+		fileChange
+		old     []byte
+		existed bool
+		temp    string
+		applied bool
+	}
+	var pending []*pendingChange
+	for _, change := range changes {
+		old, err := os.ReadFile(change.path)
+		existed := err == nil
+		if err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("failed to read %s: %w", change.path, err)
+		}
+		if (change.data == nil && !existed) || (change.data != nil && existed && bytes.Equal(old, change.data)) {
+			continue
+		}
+		pending = append(pending, &pendingChange{fileChange: change, old: old, existed: existed})
+	}
+	if len(pending) == 0 {
+		return nil, nil
+	}
+
+	var generationDir string
+	cleanup := func() {
+		for _, change := range pending {
+			if change.temp != "" && !change.applied {
+				os.Remove(change.temp)
+			}
+		}
+		if generationDir != "" {
+			os.RemoveAll(generationDir)
+		}
+	}
+
+	// Write the new content next to each file first, so that a failure
+	// leaves every file unchanged
+	for _, change := range pending {
+		if change.data == nil {
+			continue
+		}
+		temp, err := writeTempFile(change.path, change.data)
+		if err != nil {
+			cleanup()
+			return nil, err
+		}
+		change.temp = temp
+	}
+
+	var generation *Generation
+	if backup {
+		var err error
+		generation, generationDir, err = w.createGeneration()
+		if err != nil {
+			cleanup()
+			return nil, err
+		}
+		for i, change := range pending {
+			file := BackupFile{Path: w.relativePath(change.path), Existed: change.existed}
+			if change.data != nil {
+				file.Digest = DigestBytes(change.data)
+			}
+			if change.existed {
+				file.Backup = strconv.Itoa(i)
+				if err := os.WriteFile(filepath.Join(generationDir, file.Backup), change.old, 0600); err != nil {
+					cleanup()
+					return nil, fmt.Errorf("failed to back up %s: %w", change.path, err)
+				}
+			}
+			generation.Files = append(generation.Files, file)
+		}
+		data, err := yaml.Marshal(generation)
+		if err != nil {
+			cleanup()
+			return nil, fmt.Errorf("failed to serialize generation: %w", err)
+		}
+		if err := os.WriteFile(filepath.Join(generationDir, generationFile), data, 0600); err != nil {
+			cleanup()
+			return nil, fmt.Errorf("failed to write generation: %w", err)
+		}
+	}
+
+	// Move the new content into place, restoring the replaced files on failure
+	for _, change := range pending {
+		var err error
+		if change.data == nil {
+			err = os.Remove(change.path)
+		} else {
+			err = os.Rename(change.temp, change.path)
+		}
+		if err != nil {
+			for _, applied := range pending {
+				if !applied.applied {
+					continue
+				}
+				if applied.existed {
+					_ = WriteFileAtomic(applied.path, applied.old, 0600)
+				} else {
+					os.Remove(applied.path)
+				}
+			}
+			cleanup()
+			return nil, fmt.Errorf("failed to write %s, no file was changed: %w", change.path, err)
+		}
+		change.applied = true
+	}
+
+	if backup {
+		if err := w.pruneGenerations(); err != nil {
+			return generation, err
+		}
+	}
+	return generation, nil
+}
+
+// createGeneration creates the directory of a new backup generation.
+func (w *Workspace) createGeneration() (*Generation, string, error) {
+	backupDir := filepath.Join(w.Path, BackupDir)
+	if err := os.MkdirAll(backupDir, 0755); err != nil {
+		return nil, "", fmt.Errorf("failed to create backup directory: %w", err)
+	}
+
+	now := time.Now().UTC()
+	id := now.Format(generationIDFormat)
+	for i := 2; ; i++ {
+		dir := filepath.Join(backupDir, id)
+		err := os.Mkdir(dir, 0755)
+		if err == nil {
+			return &Generation{ID: id, Time: now}, dir, nil
+		}
+		if !os.IsExist(err) {
+			return nil, "", fmt.Errorf("failed to create backup generation: %w", err)
+		}
+		id = now.Format(generationIDFormat) + "-" + strconv.Itoa(i)
+	}
+}
+
+// Generations returns the backup generations of the workspace, oldest first.
+func (w *Workspace) Generations() ([]Generation, error) {
+	entries, err := os.ReadDir(filepath.Join(w.Path, BackupDir))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read backup directory: %w", err)
+	}
+
+	var generations []Generation
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		generationPath := filepath.Join(w.Path, BackupDir, entry.Name(), generationFile)
+		data, err := os.ReadFile(generationPath)
+		if err != nil {
+			// Generations interrupted while being written have no description
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, fmt.Errorf("failed to read generation: %w", err)
+		}
+		var generation Generation
+		if err := yaml.Unmarshal(data, &generation); err != nil {
+			return nil, fmt.Errorf("failed to parse generation %s: %w", generationPath, err)
+		}
+		generations = append(generations, generation)
+	}
+	sort.SliceStable(generations, func(i, j int) bool { return generations[i].Time.Before(generations[j].Time) })
+	return generations, nil
+}
+
+// Rollback restores the files changed by the latest generation to their
+// previous content, removing the files it created, then deletes the
+// generation, so that repeated rollbacks step further back. Files changed
+// since the generation are not overwritten unless force is set. Returns the
+// generation rolled back, or nil when there is none.
+func (w *Workspace) Rollback(force bool) (*Generation, error) {
+	if w.tx != nil {
+		return nil, errors.New("cannot roll back while a transaction is open on the workspace")
+	}
+	if err := w.lock(); err != nil {
+		return nil, err
+	}
+	defer w.unlock()
+	generations, err := w.Generations()
+	if err != nil || len(generations) == 0 {
+		return nil, err
+	}
+	generation := generations[len(generations)-1]
+	generationDir := filepath.Join(w.Path, BackupDir, generation.ID)
+
+	changes := make([]fileChange, 0, len(generation.Files))
+	for _, file := range generation.Files {
+		path := w.ResolvePath(file.Path)
+		if !force {
+			current, err := os.ReadFile(path)
+			if err != nil && !os.IsNotExist(err) {
+				return nil, fmt.Errorf("failed to read %s: %w", file.Path, err)
+			}
+			exists := err == nil
+			if exists != (file.Digest != "") || (exists && DigestBytes(current) != file.Digest) {
+				return nil, fmt.Errorf("%s changed since generation %s; roll back anyway with force", file.Path, generation.ID)
+			}
+		}
+
+		change := fileChange{path: path}
+		if file.Existed {
+			if change.data, err = os.ReadFile(filepath.Join(generationDir, file.Backup)); err != nil {
+				return nil, fmt.Errorf("failed to read backup of %s: %w", file.Path, err)
+			}
+		}
+		changes = append(changes, change)
+	}
+
+	if _, err := w.commitChanges(changes, false); err != nil {
+		return nil, err
+	}
+	if err := os.RemoveAll(generationDir); err != nil {
+		return nil, fmt.Errorf("failed to remove generation %s: %w", generation.ID, err)
+	}
+	return &generation, nil
+}
+
+// pruneGenerations removes the oldest generations beyond BackupGenerations.
+func (w *Workspace) pruneGenerations() error {
+	generations, err := w.Generations()
+	if err != nil {
+		return err
+	}
+	for len(generations) > BackupGenerations {
+		if err := os.RemoveAll(filepath.Join(w.Path, BackupDir, generations[0].ID)); err != nil {
+			return fmt.Errorf("failed to prune generation %s: %w", generations[0].ID, err)
+		}
+		generations = generations[1:]
+	}
+	return nil
+}
+
+// WriteFileAtomic writes data to path through a temporary file of the same
+// directory renamed into place, so that readers and interrupted runs see
+// either the previous or the new content.
+func WriteFileAtomic(path string, data []byte, perm os.FileMode) error {
+	temp, err := writeTempFile(path, data)
+	if err != nil {
+		return err
+	}
+	if err := os.Chmod(temp, perm); err != nil {
+		os.Remove(temp)
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if err := os.Rename(temp, path); err != nil {
+		os.Remove(temp)
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return nil
+}
+
+// writeTempFile writes data to a new hidden temporary file next to path,
+// created with owner-only permissions and synced to disk.
+func writeTempFile(path string, data []byte) (string, error) {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create directory %s: %w", dir, err)
+	}
+	f, err := os.CreateTemp(dir, "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return "", fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return "", fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return f.Name(), nil
+}
@@ -0,0 +1,167 @@
+package ampel
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestTransaction_Commit verifies staged files are written together and backed up.
+func TestTransaction_Commit(t *testing.T) {
+	ws, err := NewWorkspace(t.TempDir())
+	require.NoError(t, err)
+	replaced := filepath.Join(ws.Path, "replaced.json")
+	removed := filepath.Join(ws.Path, "removed.json")
+	created := filepath.Join(ws.Path, BaseDir, "created.json")
+	require.NoError(t, os.WriteFile(replaced, []byte("old"), 0600))
+	require.NoError(t, os.WriteFile(removed, []byte("gone"), 0600))
+
+	tx, err := ws.Begin()
+	require.NoError(t, err)
+	_, err = ws.Begin()
+	assert.Error(t, err, "only one transaction may be open")
+
+	require.NoError(t, ws.WriteFile(replaced, []byte("new")))
+	require.NoError(t, ws.RemoveFile(removed))
+	require.NoError(t, ws.WriteFile(created, []byte("created")))
+
+	// Staged files are visible through the workspace only
+	data, err := ws.ReadFile(replaced)
+	require.NoError(t, err)
+	assert.Equal(t, "new", string(data))
+	_, err = ws.ReadFile(removed)
+	assert.True(t, os.IsNotExist(err))
+	assertFileContent(t, replaced, "old")
+	assert.NoFileExists(t, created)
+
+	generation, err := tx.Commit()
+	require.NoError(t, err)
+	require.NotNil(t, generation)
+	assertFileContent(t, replaced, "new")
+	assert.NoFileExists(t, removed)
+	assertFileContent(t, created, "created")
+	assert.Equal(t, []BackupFile{
+		{Path: "replaced.json", Existed: true, Backup: "0", Digest: DigestBytes([]byte("new"))},
+		{Path: "removed.json", Existed: true, Backup: "1"},
+		{Path: ".base/created.json", Digest: DigestBytes([]byte("created"))},
+	}, generation.Files)
+
+	generations, err := ws.Generations()
+	require.NoError(t, err)
+	require.Len(t, generations, 1)
+	assert.Equal(t, generation.ID, generations[0].ID)
+
+	// No temporary file is left behind
+	entries, err := os.ReadDir(ws.Path)
+	require.NoError(t, err)
+	for _, entry := range entries {
+		assert.NotContains(t, entry.Name(), ".tmp-")
+	}
+
+	// Rollback restores the previous generation and consumes it
+	rolledBack, err := ws.Rollback(false)
+	require.NoError(t, err)
+	assert.Equal(t, generation.ID, rolledBack.ID)
+	assertFileContent(t, replaced, "old")
+	assertFileContent(t, removed, "gone")
+	assert.NoFileExists(t, created)
+
+	rolledBack, err = ws.Rollback(false)
+	require.NoError(t, err)
+	assert.Nil(t, rolledBack)
+}
+
+// TestTransaction_Abort verifies aborted transactions change nothing.
+func TestTransaction_Abort(t *testing.T) {
+	ws, err := NewWorkspace(t.TempDir())
+	require.NoError(t, err)
+
+	tx, err := ws.Begin()
+	require.NoError(t, err)
+	defer tx.Abort()
+	require.NoError(t, ws.SavePolicy("policy", newMergeTestPolicy(withPolicyID("policy"))))
+	assert.True(t, ws.PolicyExists("policy"))
+	tx.Abort()
+
+	assert.False(t, ws.PolicyExists("policy"))
+	_, err = tx.Commit()
+	assert.Error(t, err)
+	assert.NoDirExists(t, filepath.Join(ws.Path, BackupDir))
+}
+
+// TestTransaction_CommitFailure verifies a failing file leaves every file unchanged.
+func TestTransaction_CommitFailure(t *testing.T) {
+	ws, err := NewWorkspace(t.TempDir())
+	require.NoError(t, err)
+	first := filepath.Join(ws.Path, "first.json")
+	require.NoError(t, os.WriteFile(first, []byte("old"), 0600))
+	blocker := filepath.Join(ws.Path, "blocker")
+	require.NoError(t, os.WriteFile(blocker, nil, 0600))
+
+	tx, err := ws.Begin()
+	require.NoError(t, err)
+	require.NoError(t, ws.WriteFile(first, []byte("new")))
+	require.NoError(t, ws.WriteFile(filepath.Join(blocker, "second.json"), []byte("new")))
+	_, err = tx.Commit()
+	require.Error(t, err)
+
+	assertFileContent(t, first, "old")
+	generations, err := ws.Generations()
+	require.NoError(t, err)
+	assert.Empty(t, generations)
+}
+
+// TestWorkspace_WriteFile verifies writes outside a transaction are single generations.
+func TestWorkspace_WriteFile(t *testing.T) {
+	ws, err := NewWorkspace(t.TempDir())
+	require.NoError(t, err)
+	path := filepath.Join(ws.Path, "policy.json")
+
+	require.NoError(t, ws.WriteFile(path, []byte("v1")))
+	require.NoError(t, ws.WriteFile(path, []byte("v1")))
+	generations, err := ws.Generations()
+	require.NoError(t, err)
+	assert.Len(t, generations, 1, "unchanged content records no generation")
+
+	// Files changed since their generation are kept unless forced
+	require.NoError(t, ws.WriteFile(path, []byte("v2")))
+	require.NoError(t, os.WriteFile(path, []byte("edited"), 0600))
+	_, err = ws.Rollback(false)
+	assert.Error(t, err)
+	assertFileContent(t, path, "edited")
+	_, err = ws.Rollback(true)
+	require.NoError(t, err)
+	assertFileContent(t, path, "v1")
+
+	// Old generations are pruned
+	for i := range BackupGenerations + 5 {
+		require.NoError(t, ws.WriteFile(path, []byte(strconv.Itoa(i))))
+	}
+	generations, err = ws.Generations()
+	require.NoError(t, err)
+	assert.Len(t, generations, BackupGenerations)
+}
+
+// TestWriteFileAtomic verifies files are replaced whole.
+func TestWriteFileAtomic(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out", "policy.json")
+	require.NoError(t, WriteFileAtomic(path, []byte("one"), 0644))
+	require.NoError(t, WriteFileAtomic(path, []byte("two"), 0644))
+	assertFileContent(t, path, "two")
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0644), info.Mode().Perm())
+}
+
+// assertFileContent asserts the content of a file.
+func assertFileContent(t *testing.T, path, content string) {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, content, string(data))
+}
@@ -0,0 +1,170 @@
+package ampel
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gemaraproj/go-gemara"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// WithContextValues sets the runtime values written to Policy.Context instead
+// of the first accepted value. Keys are either parameter IDs, which set every
+// context entry of that parameter, or context keys such as the namespaced
+// "plan-id.param-id" keys, which take precedence over the parameter ID.
+//
+// Each value must match the type of its context entry, numbers and booleans
+// being stored as their string form in string entries, and, when the
+// parameter lists accepted values, be one of them. Unknown keys and invalid values fail
+// the transformation. Required parameters still without a value are reported
+// as required-context-unset warnings. Repeated calls merge the values, later
+// calls winning.
+//
+// Example:
+//
+//	ampel.FromPolicy(policy, ampel.WithContextValues(map[string]interface{}{
+//	    "builder-id": "https://gitlab.com/runner",
+//	}))
+func WithContextValues(values map[string]interface{}) TransformOption {
+	return func(opts *TransformOptions) {
+		if opts.ContextValues == nil {
+			opts.ContextValues = make(map[string]interface{})
+		}
+		for k, v := range values {
+			opts.ContextValues[k] = v
+		}
+	}
+}
+
+// applyContextValues sets the values given with WithContextValues on the
+// generated context and reports required entries that remain unset.
+// parameters and definedBy are keyed by context key.
+func applyContextValues(policy *gemara.Policy, ampelPolicy *Policy, parameters map[string]gemara.Parameter, definedBy map[string]string, options *TransformOptions) error {
+	var errs []error
+	for _, key := range sortedKeys(options.ContextValues) {
+		targets := contextValueTargets(key, parameters, options.ContextValues)
+		if len(targets) == 0 {
+			errs = append(errs, fmt.Errorf("context value %s: no parameter or context key with this name", key))
+			continue
+		}
+		for _, target := range targets {
+			if err := setContextValue(ampelPolicy.Context[target], parameters[target], options.ContextValues[key]); err != nil {
+				errs = append(errs, fmt.Errorf("context value %s: %w", target, err))
+			}
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return err
+	}
+
+	for _, key := range sortedKeys(ampelPolicy.Context) {
+		contextVal := ampelPolicy.Context[key]
+		if contextVal.Required != nil && *contextVal.Required && contextVal.Value == nil {
+			options.report(SeverityWarning, DiagRequiredContextUnset,
+				SourceLocation{PolicyID: policy.Metadata.Id, PlanID: definedBy[key]},
+				"required parameter %s has no value; set it before evaluating the policy", key)
+		}
+	}
+	return nil
+}
+
+// contextValueTargets returns the context keys a value key applies to. An
+// exact context key wins; otherwise the key is matched against parameter IDs,
+// skipping context keys that have a value of their own.
+func contextValueTargets(key string, parameters map[string]gemara.Parameter, values map[string]interface{}) []string {
+	if _, ok := parameters[key]; ok {
+		return []string{key}
+	}
+
+	var targets []string
+	for contextKey, param := range parameters {
+		if _, explicit := values[contextKey]; param.Id == key && !explicit {
+			targets = append(targets, contextKey)
+		}
+	}
+	sort.Strings(targets)
+	return targets
+}
+
+// setContextValue validates value against the context entry's type and the
+// parameter's accepted values and stores it as the entry's value.
+func setContextValue(contextVal *ContextVal, param gemara.Parameter, value interface{}) error {
+	value = scalarToContextType(contextVal.Type, value)
+	if err := checkContextValue(contextVal.Type, param.AcceptedValues, value); err != nil {
+		return err
+	}
+
+	structValue, err := structpb.NewValue(value)
+	if err != nil {
+		return fmt.Errorf("error creating value: %w", err)
+	}
+	contextVal.Value = structValue
+	return nil
+}
+
+// checkContextValue checks that value matches a context entry's type and,
+// when accepted values are listed, is one of them.
+func checkContextValue(contextType string, accepted []string, value interface{}) error {
+	if err := checkContextValueType(contextType, value); err != nil {
+		return err
+	}
+	if len(accepted) > 0 && !slices.Contains(accepted, fmt.Sprint(value)) {
+		return fmt.Errorf("%v is not an accepted value (accepted: %s)", value, strings.Join(accepted, ", "))
+	}
+	return nil
+}
+
+// scalarToContextType returns the string form of a scalar value set on a
+// string context entry. YAML and JSON decoders return scalars such as 0 or
+// true as numbers and booleans, while parameters are always strings.
+func scalarToContextType(contextType string, value interface{}) interface{} {
+	if contextType != "string" {
+		return value
+	}
+	switch v := value.(type) {
+	case bool, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return fmt.Sprint(v)
+	case float32:
+		return strconv.FormatFloat(float64(v), 'f', -1, 32)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return value
+}
+
+// checkContextValueType checks that value can be stored in a context entry of
+// the given type. Unknown types are not checked.
+func checkContextValueType(contextType string, value interface{}) error {
+	var ok bool
+	switch contextType {
+	case "string":
+		_, ok = value.(string)
+	case "bool", "boolean":
+		_, ok = value.(bool)
+	case "int", "integer", "number", "float", "double":
+		switch value.(type) {
+		case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+			ok = true
+		}
+	default:
+		return nil
+	}
+	if !ok {
+		return fmt.Errorf("expected a %s value, got %T", contextType, value)
+	}
+	return nil
+}
+
+// sortedKeys returns the keys of a string-keyed map in sorted order.
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,121 @@
+package ampel
+
+import (
+	"testing"
+
+	"github.com/gemaraproj/go-gemara"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// createValuesTestPolicy returns a policy with a multi-value parameter and a runtime-only parameter.
+func createValuesTestPolicy() *gemara.Policy {
+	policy := createTestPolicy()
+	policy.Adherence.AssessmentPlans[0].Parameters = []gemara.Parameter{
+		{Id: "builder-id", AcceptedValues: []string{"https://github.com/actions/runner", "https://gitlab.com/runner"}},
+		{Id: "repository", Label: "Source repository"},
+	}
+	return policy
+}
+
+// TestWithContextValues verifies chosen values replace the first accepted value.
+func TestWithContextValues(t *testing.T) {
+	ampelPolicy, diags, err := FromPolicyWithDiagnostics(createValuesTestPolicy(), WithContextValues(map[string]interface{}{
+		"builder-id": "https://gitlab.com/runner",
+		"repository": "github.com/example/repo",
+	}))
+	require.NoError(t, err)
+
+	builder := ampelPolicy.Context["builder-id"]
+	assert.Equal(t, "https://gitlab.com/runner", builder.Value.GetStringValue())
+	assert.Equal(t, "https://github.com/actions/runner", builder.Default.GetStringValue())
+	assert.Equal(t, "github.com/example/repo", ampelPolicy.Context["repository"].Value.GetStringValue())
+	assert.Empty(t, findDiagnostics(diags, DiagRequiredContextUnset))
+}
+
+// TestWithContextValues_Invalid verifies values are checked against accepted values, type and known keys.
+func TestWithContextValues_Invalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		values  map[string]interface{}
+		message string
+	}{
+		{"not accepted", map[string]interface{}{"builder-id": "https://example.com"}, "not an accepted value"},
+		{"wrong type", map[string]interface{}{"repository": []interface{}{"x"}}, "expected a string value, got []interface {}"},
+		{"unknown key", map[string]interface{}{"missing": "x"}, "context value missing: no parameter"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := FromPolicy(createValuesTestPolicy(), WithContextValues(tt.values))
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.message)
+		})
+	}
+}
+
+// TestWithContextValues_Scalars verifies YAML scalars are stored as the string form of string parameters.
+func TestWithContextValues_Scalars(t *testing.T) {
+	policy := createTestPolicy()
+	policy.Adherence.AssessmentPlans[0].Parameters = []gemara.Parameter{
+		{Id: "max-critical", AcceptedValues: []string{"0", "1"}},
+		{Id: "enabled", AcceptedValues: []string{"true", "false"}},
+		{Id: "threshold"},
+	}
+
+	// goccy/go-yaml decodes these as uint64, bool and float64
+	ampelPolicy, err := FromPolicy(policy, WithContextValues(map[string]interface{}{
+		"max-critical": uint64(0),
+		"enabled":      true,
+		"threshold":    0.5,
+	}))
+	require.NoError(t, err)
+	assert.Equal(t, "0", ampelPolicy.Context["max-critical"].Value.GetStringValue())
+	assert.Equal(t, "true", ampelPolicy.Context["enabled"].Value.GetStringValue())
+	assert.Equal(t, "0.5", ampelPolicy.Context["threshold"].Value.GetStringValue())
+
+	_, err = FromPolicy(policy, WithContextValues(map[string]interface{}{"max-critical": uint64(2)}))
+	assert.ErrorContains(t, err, "2 is not an accepted value")
+}
+
+// TestWithContextValues_RequiredUnset verifies required parameters without a value are reported.
+func TestWithContextValues_RequiredUnset(t *testing.T) {
+	_, diags, err := FromPolicyWithDiagnostics(createValuesTestPolicy())
+	require.NoError(t, err)
+
+	unset := findDiagnostics(diags, DiagRequiredContextUnset)
+	require.Len(t, unset, 1)
+	assert.Equal(t, SeverityWarning, unset[0].Severity)
+	assert.Equal(t, "plan-01", unset[0].Location.PlanID)
+	assert.Contains(t, unset[0].Message, "repository")
+}
+
+// TestWithContextValues_Namespaced verifies context keys take precedence over parameter IDs.
+func TestWithContextValues_Namespaced(t *testing.T) {
+	policy := createConflictTestPolicy()
+	policy.Adherence.AssessmentPlans[1].Parameters[0].AcceptedValues = []string{"https://gitlab.com/runner", "https://gitlab.example.com/runner"}
+
+	ampelPolicy, err := FromPolicy(policy,
+		WithParameterConflicts(ParameterConflictNamespace),
+		WithContextValues(map[string]interface{}{
+			"builder-id":         "https://gitlab.com/runner",
+			"plan-01.builder-id": "https://github.com/actions/runner",
+		}),
+		WithContextValues(map[string]interface{}{
+			"builder-id": "https://gitlab.example.com/runner",
+		}),
+	)
+	require.NoError(t, err)
+	assert.Equal(t, "https://github.com/actions/runner", ampelPolicy.Context["plan-01.builder-id"].Value.GetStringValue())
+	assert.Equal(t, "https://gitlab.example.com/runner", ampelPolicy.Context["plan-02.builder-id"].Value.GetStringValue())
+}
+
+// TestCheckContextValueType verifies type checks for the supported context types.
+func TestCheckContextValueType(t *testing.T) {
+	assert.NoError(t, checkContextValueType("string", "x"))
+	assert.NoError(t, checkContextValueType("bool", true))
+	assert.NoError(t, checkContextValueType("int", int64(3)))
+	assert.NoError(t, checkContextValueType("custom", []interface{}{"x"}))
+	assert.Error(t, checkContextValueType("bool", "true"))
+	assert.Error(t, checkContextValueType("number", "3"))
+}
@@ -1,27 +1,54 @@
 package ampel
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
+	"time"
+
+	"github.com/goccy/go-yaml"
 )
 
+// BaseDir is the workspace subdirectory holding the generation bases: the
+// policies as last generated, which MergePolicyWithBase merges against.
+const BaseDir = ".base"
+
+// ArchiveDir is the workspace subdirectory holding the tenets removed from
+// policies in OrphanArchive mode.
+const ArchiveDir = ".archive"
+
 // Workspace manages Ampel policy files in a directory.
 type Workspace struct {
 	Path string
+
+	// tx is the open transaction, see Begin
+	tx *Transaction
+
+	// The workspace lock, see WithLockTimeout. lockDepth counts the nested
+	// locks held and lockFile is the locked file while held
+	lockTimeout time.Duration
+	lockMu      sync.Mutex
+	lockDepth   int
+	lockFile    *os.File
 }
 
 // NewWorkspace creates or opens a workspace at the specified path.
 // The directory is created automatically if it doesn't exist.
-func NewWorkspace(path string) (*Workspace, error) {
+func NewWorkspace(path string, opts ...WorkspaceOption) (*Workspace, error) {
 	// Create directory if it doesn't exist
 	if err := os.MkdirAll(path, 0755); err != nil {
 		return nil, fmt.Errorf("failed to create workspace directory: %w", err)
 	}
 
-	return &Workspace{Path: path}, nil
+	ws := &Workspace{Path: path}
+	for _, opt := range opts {
+		opt(ws)
+	}
+	return ws, nil
 }
 
 // LoadPolicy loads an existing Ampel policy from the workspace.
@@ -29,7 +56,7 @@ func NewWorkspace(path string) (*Workspace, error) {
 func (w *Workspace) LoadPolicy(policyID string) (*Policy, error) {
 	policyPath := w.GetPolicyPath(policyID)
 
-	data, err := os.ReadFile(policyPath)
+	data, err := w.ReadFile(policyPath)
 	if err != nil {
 		if os.IsNotExist(err) {
 			return nil, fmt.Errorf("policy file not found: %s", policyPath)
@@ -48,6 +75,9 @@ func (w *Workspace) LoadPolicy(policyID string) (*Policy, error) {
 // SavePolicy saves an Ampel policy to the workspace.
 // The policy is written with proper JSON formatting and secure file permissions.
 func (w *Workspace) SavePolicy(policyID string, policy *Policy) error {
+	if err := w.ClaimPolicyFilename(policyID); err != nil {
+		return err
+	}
 	policyPath := w.GetPolicyPath(policyID)
 
 	// Serialize to JSON using protobuf JSON marshaling
@@ -57,7 +87,7 @@ func (w *Workspace) SavePolicy(policyID string, policy *Policy) error {
 	}
 
 	// Write to file with secure permissions (read/write for owner only)
-	if err := os.WriteFile(policyPath, data, 0600); err != nil {
+	if err := w.WriteFile(policyPath, data); err != nil {
 		return fmt.Errorf("failed to write policy file %s: %w", policyPath, err)
 	}
 
@@ -66,24 +96,282 @@ func (w *Workspace) SavePolicy(policyID string, policy *Policy) error {
 
 // PolicyExists checks if a policy file exists in the workspace.
 func (w *Workspace) PolicyExists(policyID string) bool {
-	policyPath := w.GetPolicyPath(policyID)
-	_, err := os.Stat(policyPath)
+	_, err := w.ReadFile(w.GetPolicyPath(policyID))
 	return err == nil
 }
 
 // GetPolicyPath returns the full file path for a policy ID.
-// The policy ID is sanitized to create a safe filename.
+// The policy ID is encoded by EncodePolicyFilename.
 func (w *Workspace) GetPolicyPath(policyID string) string {
-	filename := sanitizePolicyID(policyID) + ".json"
+	filename := EncodePolicyFilename(policyID) + ".json"
 	return filepath.Join(w.Path, filename)
 }
 
-// sanitizePolicyID converts a policy ID to a safe filename by replacing
-// problematic characters with hyphens.
-func sanitizePolicyID(policyID string) string {
-	// Replace path separators and other problematic characters
-	sanitized := strings.ReplaceAll(policyID, "/", "-")
-	sanitized = strings.ReplaceAll(sanitized, "\\", "-")
-	sanitized = strings.ReplaceAll(sanitized, ":", "-")
-	return sanitized
+// LoadBase loads the generation base recorded for a policy. Returns nil
+// without error when no base has been recorded, as in workspaces written
+// before bases were recorded.
+func (w *Workspace) LoadBase(policyID string) (*Policy, error) {
+	basePath := w.GetBasePath(policyID)
+
+	data, err := w.ReadFile(basePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read base file: %w", err)
+	}
+
+	var base Policy
+	if err := json.Unmarshal(data, &base); err != nil {
+		return nil, fmt.Errorf("failed to parse base JSON %s: %w", basePath, err)
+	}
+
+	return &base, nil
+}
+
+// SaveBase records the generated policy as the generation base of a policy.
+func (w *Workspace) SaveBase(policyID string, base *Policy) error {
+	if err := w.ClaimPolicyFilename(policyID); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(base, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to serialize base: %w", err)
+	}
+
+	basePath := w.GetBasePath(policyID)
+	if err := w.WriteFile(basePath, data); err != nil {
+		return fmt.Errorf("failed to write base file %s: %w", basePath, err)
+	}
+
+	return nil
+}
+
+// LoadPolicySetBase loads the generation base recorded for a PolicySet.
+// Returns nil without error when no base has been recorded.
+func (w *Workspace) LoadPolicySetBase(policySetID string) (*PolicySet, error) {
+	basePath := w.GetBasePath(policySetID)
+
+	data, err := w.ReadFile(basePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read base file: %w", err)
+	}
+
+	var base PolicySet
+	if err := json.Unmarshal(data, &base); err != nil {
+		return nil, fmt.Errorf("failed to parse base JSON %s: %w", basePath, err)
+	}
+
+	return &base, nil
+}
+
+// SavePolicySetBase records the generated PolicySet as its generation base.
+func (w *Workspace) SavePolicySetBase(policySetID string, base *PolicySet) error {
+	if err := w.ClaimPolicyFilename(policySetID); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(base, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to serialize base: %w", err)
+	}
+
+	basePath := w.GetBasePath(policySetID)
+	if err := w.WriteFile(basePath, data); err != nil {
+		return fmt.Errorf("failed to write base file %s: %w", basePath, err)
+	}
+
+	return nil
+}
+
+// RemoveBase deletes the generation base of a policy, so the next merge
+// preserves every existing tenet. Removing a missing base is not an error.
+func (w *Workspace) RemoveBase(policyID string) error {
+	if err := w.RemoveFile(w.GetBasePath(policyID)); err != nil {
+		return fmt.Errorf("failed to remove base file: %w", err)
+	}
+	return nil
+}
+
+// GetBasePath returns the full file path of a policy's generation base.
+func (w *Workspace) GetBasePath(policyID string) string {
+	return filepath.Join(w.Path, BaseDir, EncodePolicyFilename(policyID)+".json")
+}
+
+// SaveConflicts writes the unresolved merge conflicts of a policy to its
+// side-car conflict marker file, or removes the file when there are none.
+func (w *Workspace) SaveConflicts(policyID string, conflicts []MergeConflict) error {
+	conflictsPath := w.GetConflictsPath(policyID)
+	if len(conflicts) == 0 {
+		if err := w.RemoveFile(conflictsPath); err != nil {
+			return fmt.Errorf("failed to remove conflicts file: %w", err)
+		}
+		return nil
+	}
+
+	var b strings.Builder
+	if err := WriteConflictMarkers(&b, policyID, conflicts); err != nil {
+		return err
+	}
+	if err := w.WriteFile(conflictsPath, []byte(b.String())); err != nil {
+		return fmt.Errorf("failed to write conflicts file %s: %w", conflictsPath, err)
+	}
+	return nil
+}
+
+// LoadConflicts reads the unresolved merge conflicts of a policy. Returns
+// nil without error when the policy has no conflicts file.
+func (w *Workspace) LoadConflicts(policyID string) ([]MergeConflict, error) {
+	conflictsPath := w.GetConflictsPath(policyID)
+	data, err := w.ReadFile(conflictsPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to open conflicts file: %w", err)
+	}
+
+	conflicts, err := ParseConflictMarkers(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse conflicts file %s: %w", conflictsPath, err)
+	}
+	return conflicts, nil
+}
+
+// GetConflictsPath returns the full path of a policy's side-car conflict
+// marker file, next to the policy file.
+func (w *Workspace) GetConflictsPath(policyID string) string {
+	return filepath.Join(w.Path, EncodePolicyFilename(policyID)+".conflicts")
+}
+
+// ArchiveTenets appends orphaned tenets of a policy to its archive file,
+// recording reason and the current time.
+func (w *Workspace) ArchiveTenets(policyID string, tenets []*Tenet, reason string) error {
+	return w.ArchiveMemberTenets(policyID, "", tenets, reason)
+}
+
+// ArchiveMemberTenets appends orphaned tenets of a PolicySet member policy
+// to the archive file of the PolicySet, recording the member policy ID,
+// reason and the current time.
+func (w *Workspace) ArchiveMemberTenets(policySetID, memberID string, tenets []*Tenet, reason string) error {
+	if len(tenets) == 0 {
+		return nil
+	}
+	archive, err := w.LoadArchive(policySetID)
+	if err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	for _, tenet := range tenets {
+		archive = append(archive, ArchivedTenet{Tenet: tenet, PolicyID: memberID, Reason: reason, ArchivedAt: now})
+	}
+	return w.SaveArchive(policySetID, archive)
+}
+
+// LoadArchive reads the archived tenets of a policy, oldest first. Returns
+// nil without error when nothing has been archived.
+func (w *Workspace) LoadArchive(policyID string) ([]ArchivedTenet, error) {
+	archivePath := w.GetArchivePath(policyID)
+
+	data, err := w.ReadFile(archivePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read archive file: %w", err)
+	}
+
+	var archive []ArchivedTenet
+	if err := json.Unmarshal(data, &archive); err != nil {
+		return nil, fmt.Errorf("failed to parse archive JSON %s: %w", archivePath, err)
+	}
+	return archive, nil
+}
+
+// SaveArchive writes the archived tenets of a policy, or removes the archive
+// file when there are none.
+func (w *Workspace) SaveArchive(policyID string, archive []ArchivedTenet) error {
+	archivePath := w.GetArchivePath(policyID)
+	if len(archive) == 0 {
+		if err := w.RemoveFile(archivePath); err != nil {
+			return fmt.Errorf("failed to remove archive file: %w", err)
+		}
+		return nil
+	}
+
+	data, err := json.MarshalIndent(archive, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to serialize archive: %w", err)
+	}
+	if err := w.WriteFile(archivePath, data); err != nil {
+		return fmt.Errorf("failed to write archive file %s: %w", archivePath, err)
+	}
+	return nil
+}
+
+// GetArchivePath returns the full file path of a policy's archived tenets.
+func (w *Workspace) GetArchivePath(policyID string) string {
+	return filepath.Join(w.Path, ArchiveDir, EncodePolicyFilename(policyID)+".json")
+}
+
+// locksHeader introduces the side-car lock file of a policy.
+const locksHeader = `# Tenets and tenet fields maintained by hand: regeneration never overwrites
+# or deletes them. Entries name a tenet and optionally its locked fields
+# (runtime, title, code, predicates, outputs, error, assessment) and, in
+# PolicySets, its member policy.
+`
+
+// LoadLocks reads the locked tenets and fields of a policy from its
+// side-car lock file. Returns nil without error when the policy has no
+// lock file.
+func (w *Workspace) LoadLocks(policyID string) ([]TenetLock, error) {
+	locksPath := w.GetLocksPath(policyID)
+
+	data, err := w.ReadFile(locksPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read lock file: %w", err)
+	}
+
+	var locks []TenetLock
+	if err := yaml.Unmarshal(data, &locks); err != nil {
+		return nil, fmt.Errorf("failed to parse lock file %s: %w", locksPath, err)
+	}
+	for _, lock := range locks {
+		if err := lock.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid lock file %s: %w", locksPath, err)
+		}
+	}
+	return locks, nil
+}
+
+// SaveLocks writes the locked tenets and fields of a policy to its side-car
+// lock file, or removes the file when there are none.
+func (w *Workspace) SaveLocks(policyID string, locks []TenetLock) error {
+	locksPath := w.GetLocksPath(policyID)
+	if len(locks) == 0 {
+		if err := w.RemoveFile(locksPath); err != nil {
+			return fmt.Errorf("failed to remove lock file: %w", err)
+		}
+		return nil
+	}
+
+	data, err := yaml.Marshal(locks)
+	if err != nil {
+		return fmt.Errorf("failed to serialize locks: %w", err)
+	}
+	if err := w.WriteFile(locksPath, append([]byte(locksHeader), data...)); err != nil {
+		return fmt.Errorf("failed to write lock file %s: %w", locksPath, err)
+	}
+	return nil
+}
+
+// GetLocksPath returns the full path of a policy's side-car lock file, next
+// to the policy file.
+func (w *Workspace) GetLocksPath(policyID string) string {
+	return filepath.Join(w.Path, EncodePolicyFilename(policyID)+".locks.yaml")
 }
@@ -180,17 +180,17 @@ func TestWorkspace_GetPolicyPath(t *testing.T) {
 		{
 			name:       "ID with slashes",
 			policyID:   "org/team/policy",
-			wantSuffix: "org-team-policy.json",
+			wantSuffix: "org%2Fteam%2Fpolicy.json",
 		},
 		{
 			name:       "ID with backslashes",
 			policyID:   "org\\team\\policy",
-			wantSuffix: "org-team-policy.json",
+			wantSuffix: "org%5Cteam%5Cpolicy.json",
 		},
 		{
 			name:       "ID with colons",
 			policyID:   "namespace:policy:v1",
-			wantSuffix: "namespace-policy-v1.json",
+			wantSuffix: "namespace%3Apolicy%3Av1.json",
 		},
 	}
 
@@ -202,53 +202,6 @@ func TestWorkspace_GetPolicyPath(t *testing.T) {
 	}
 }
 
-// TestSanitizePolicyID verifies filename sanitization.
-func TestSanitizePolicyID(t *testing.T) {
-	tests := []struct {
-		name     string
-		policyID string
-		want     string
-	}{
-		{
-			name:     "no special chars",
-			policyID: "policy-001",
-			want:     "policy-001",
-		},
-		{
-			name:     "forward slashes",
-			policyID: "org/team/policy",
-			want:     "org-team-policy",
-		},
-		{
-			name:     "backslashes",
-			policyID: "org\\team\\policy",
-			want:     "org-team-policy",
-		},
-		{
-			name:     "colons",
-			policyID: "namespace:policy:v1",
-			want:     "namespace-policy-v1",
-		},
-		{
-			name:     "mixed special chars",
-			policyID: "org/team\\policy:v1",
-			want:     "org-team-policy-v1",
-		},
-		{
-			name:     "empty string",
-			policyID: "",
-			want:     "",
-		},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			got := sanitizePolicyID(tt.policyID)
-			assert.Equal(t, tt.want, got)
-		})
-	}
-}
-
 // TestWorkspace_FilePermissions verifies that files are created with secure permissions.
 func TestWorkspace_FilePermissions(t *testing.T) {
 	ws, err := NewWorkspace(t.TempDir())
@@ -347,3 +300,112 @@ func TestWorkspace_MultiplePolicies(t *testing.T) {
 		assert.Equal(t, originalPolicy.Meta.AssertMode, loadedPolicy.Meta.AssertMode)
 	}
 }
+
+// TestWorkspace_SaveAndLoadBase verifies generation bases are stored next to the policies.
+func TestWorkspace_SaveAndLoadBase(t *testing.T) {
+	ws, err := NewWorkspace(t.TempDir())
+	require.NoError(t, err)
+
+	// A workspace without a recorded base is not an error
+	base, err := ws.LoadBase("org/policy-001")
+	require.NoError(t, err)
+	assert.Nil(t, base)
+
+	generated := &Policy{Id: "org/policy-001", Tenets: []*Tenet{{Id: "tenet-1", Code: "code_v1"}}}
+	require.NoError(t, ws.SaveBase(generated.Id, generated))
+	assert.Equal(t, filepath.Join(ws.Path, BaseDir, "org%2Fpolicy-001.json"), ws.GetBasePath(generated.Id))
+
+	base, err = ws.LoadBase(generated.Id)
+	require.NoError(t, err)
+	require.NotNil(t, base)
+	assert.Equal(t, "code_v1", base.Tenets[0].Code)
+
+	// The base is not listed as a policy of the workspace
+	assert.False(t, ws.PolicyExists(generated.Id))
+
+	require.NoError(t, ws.RemoveBase(generated.Id))
+	require.NoError(t, ws.RemoveBase(generated.Id))
+	base, err = ws.LoadBase(generated.Id)
+	require.NoError(t, err)
+	assert.Nil(t, base)
+}
+
+// TestWorkspace_SaveAndLoadConflicts verifies the side-car conflicts file lifecycle.
+func TestWorkspace_SaveAndLoadConflicts(t *testing.T) {
+	ws, err := NewWorkspace(t.TempDir())
+	require.NoError(t, err)
+
+	conflicts, err := ws.LoadConflicts("policy-001")
+	require.NoError(t, err)
+	assert.Nil(t, conflicts)
+
+	saved := []MergeConflict{{TenetID: "tenet-1", Field: ConflictFieldCode, Base: "a", Ours: "b", Theirs: "c"}}
+	require.NoError(t, ws.SaveConflicts("policy-001", saved))
+	assert.FileExists(t, filepath.Join(ws.Path, "policy-001.conflicts"))
+
+	conflicts, err = ws.LoadConflicts("policy-001")
+	require.NoError(t, err)
+	assert.Equal(t, saved, conflicts)
+
+	// Saving no conflicts removes the file
+	require.NoError(t, ws.SaveConflicts("policy-001", nil))
+	assert.NoFileExists(t, ws.GetConflictsPath("policy-001"))
+}
+
+// TestWorkspace_ArchiveTenets verifies orphaned tenets are appended to the archive.
+func TestWorkspace_ArchiveTenets(t *testing.T) {
+	ws, err := NewWorkspace(t.TempDir())
+	require.NoError(t, err)
+
+	archive, err := ws.LoadArchive("policy-001")
+	require.NoError(t, err)
+	assert.Nil(t, archive)
+
+	require.NoError(t, ws.ArchiveTenets("policy-001", []*Tenet{{Id: "tenet-1", Code: "a"}}, "first"))
+	require.NoError(t, ws.ArchiveTenets("policy-001", []*Tenet{{Id: "tenet-2", Code: "b"}}, "second"))
+	require.NoError(t, ws.ArchiveTenets("policy-001", nil, "nothing"))
+	assert.FileExists(t, filepath.Join(ws.Path, ArchiveDir, "policy-001.json"))
+
+	archive, err = ws.LoadArchive("policy-001")
+	require.NoError(t, err)
+	require.Len(t, archive, 2)
+	assert.Equal(t, "tenet-1", archive[0].Tenet.Id)
+	assert.Equal(t, "a", archive[0].Tenet.Code)
+	assert.Equal(t, "first", archive[0].Reason)
+	assert.False(t, archive[0].ArchivedAt.IsZero())
+	assert.Equal(t, "second", archive[1].Reason)
+
+	// Saving an empty archive removes the file
+	require.NoError(t, ws.SaveArchive("policy-001", nil))
+	assert.NoFileExists(t, ws.GetArchivePath("policy-001"))
+}
+
+// TestWorkspace_Locks verifies the side-car lock file round trip.
+func TestWorkspace_Locks(t *testing.T) {
+	ws, err := NewWorkspace(t.TempDir())
+	require.NoError(t, err)
+
+	locks, err := ws.LoadLocks("policy-001")
+	require.NoError(t, err)
+	assert.Nil(t, locks)
+
+	saved := []TenetLock{
+		{TenetID: "tenet-1", Reason: "maintained by the platform team"},
+		{PolicyID: "member", TenetID: "tenet-2", Fields: []string{"code", "outputs"}},
+	}
+	require.NoError(t, ws.SaveLocks("policy-001", saved))
+	assert.FileExists(t, filepath.Join(ws.Path, "policy-001.locks.yaml"))
+
+	locks, err = ws.LoadLocks("policy-001")
+	require.NoError(t, err)
+	assert.Equal(t, saved, locks)
+
+	// Invalid locks are rejected
+	require.NoError(t, os.WriteFile(ws.GetLocksPath("policy-001"), []byte("- tenet: tenet-1\n  fields: [id]\n"), 0600))
+	_, err = ws.LoadLocks("policy-001")
+	assert.Error(t, err)
+
+	// Saving no locks removes the file
+	require.NoError(t, ws.SaveLocks("policy-001", nil))
+	assert.NoFileExists(t, ws.GetLocksPath("policy-001"))
+}
@@ -0,0 +1,220 @@
+package ampel
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/goccy/go-yaml"
+)
+
+// WorkspaceLockFile is the lock file of a workspace. The process mutating
+// the workspace holds an exclusive file lock on it, which the operating
+// system releases when the process exits, and records itself in it for
+// diagnostics. The file is left in place when the lock is released.
+const WorkspaceLockFile = ".workspace.lock"
+
+// lockPollInterval is how often a held lock is checked while waiting.
+const lockPollInterval = 100 * time.Millisecond
+
+// ErrWorkspaceLocked is returned when the workspace lock is held by another
+// process beyond the lock timeout.
+var ErrWorkspaceLocked = errors.New("workspace is locked")
+
+// ErrWorkspaceLockLost is returned when the lock file was removed or
+// replaced while the lock was held, so that another process may hold the
+// lock on the new file.
+var ErrWorkspaceLockLost = errors.New("workspace lock lost")
+
+// WorkspaceOption configures a workspace.
+type WorkspaceOption func(*Workspace)
+
+// WithLockTimeout sets how long mutating operations wait for a workspace
+// locked by another process. By default they fail at once.
+func WithLockTimeout(timeout time.Duration) WorkspaceOption {
+	return func(w *Workspace) {
+		w.lockTimeout = timeout
+	}
+}
+
+// WorkspaceLock describes the holder of a workspace lock.
+type WorkspaceLock struct {
+	PID  int       `json:"pid" yaml:"pid"`
+	Host string    `json:"host" yaml:"host"`
+	Time time.Time `json:"time" yaml:"time"`
+}
+
+// String returns a description of the lock holder.
+func (l WorkspaceLock) String() string {
+	return fmt.Sprintf("process %d on %s since %s", l.PID, l.Host, l.Time.Local().Format(time.DateTime))
+}
+
+// GetLockPath returns the path of the workspace lock file.
+func (w *Workspace) GetLockPath() string {
+	return filepath.Join(w.Path, WorkspaceLockFile)
+}
+
+// LockHolder returns the holder recorded in the lock file while the
+// workspace is locked, or nil when it is not locked.
+func (w *Workspace) LockHolder() (*WorkspaceLock, error) {
+	f, err := os.OpenFile(w.GetLockPath(), os.O_RDWR, 0)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to open workspace lock: %w", err)
+	}
+	defer f.Close()
+
+	locked, err := tryLockFile(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock workspace: %w", err)
+	}
+	if locked {
+		return nil, unlockFile(f)
+	}
+	return w.readLock()
+}
+
+// lock takes the workspace lock, waiting up to the lock timeout for another
+// process to release it. Locks taken by the same Workspace nest: each lock
+// is released by an unlock and the file lock by the last one.
+func (w *Workspace) lock() error {
+	w.lockMu.Lock()
+	defer w.lockMu.Unlock()
+	if w.lockDepth > 0 {
+		w.lockDepth++
+		return nil
+	}
+
+	host, err := os.Hostname()
+	if err != nil {
+		return fmt.Errorf("failed to get host name: %w", err)
+	}
+
+	deadline := time.Now().Add(w.lockTimeout)
+	for {
+		f, err := os.OpenFile(w.GetLockPath(), os.O_RDWR|os.O_CREATE, 0644)
+		if err != nil {
+			return fmt.Errorf("failed to open workspace lock: %w", err)
+		}
+		locked, err := tryLockFile(f)
+		if err != nil {
+			f.Close()
+			return fmt.Errorf("failed to lock workspace: %w", err)
+		}
+		if locked {
+			if !w.ownsLockFile(f) {
+				// Replaced between its opening and locking
+				_ = unlockFile(f)
+				f.Close()
+				continue
+			}
+			if err := recordLockHolder(f, WorkspaceLock{PID: os.Getpid(), Host: host, Time: time.Now().UTC()}); err != nil {
+				_ = unlockFile(f)
+				f.Close()
+				return err
+			}
+			w.lockFile = f
+			w.lockDepth = 1
+			return nil
+		}
+		f.Close()
+
+		if !time.Now().Before(deadline) {
+			holder, err := w.readLock()
+			if err != nil {
+				return err
+			}
+			return fmt.Errorf("%w by %s (%s)", ErrWorkspaceLocked, holder, w.GetLockPath())
+		}
+		time.Sleep(min(lockPollInterval, time.Until(deadline)))
+	}
+}
+
+// checkLock returns ErrWorkspaceLockLost when the lock file held by the
+// workspace is no longer the one at the lock path.
+func (w *Workspace) checkLock() error {
+	w.lockMu.Lock()
+	defer w.lockMu.Unlock()
+	if w.lockFile != nil && !w.ownsLockFile(w.lockFile) {
+		return fmt.Errorf("%w: %s was removed or replaced", ErrWorkspaceLockLost, w.GetLockPath())
+	}
+	return nil
+}
+
+// unlock releases a lock taken by lock. Releasing the file lock fails with
+// ErrWorkspaceLockLost when the lock file was removed or replaced meanwhile.
+func (w *Workspace) unlock() error {
+	w.lockMu.Lock()
+	defer w.lockMu.Unlock()
+	if w.lockDepth == 0 {
+		return nil
+	}
+	w.lockDepth--
+	if w.lockDepth > 0 {
+		return nil
+	}
+
+	f := w.lockFile
+	w.lockFile = nil
+	defer f.Close()
+	if !w.ownsLockFile(f) {
+		_ = unlockFile(f)
+		return fmt.Errorf("%w: %s was removed or replaced", ErrWorkspaceLockLost, w.GetLockPath())
+	}
+	// Clear the holder before releasing the lock
+	if err := f.Truncate(0); err != nil {
+		_ = unlockFile(f)
+		return fmt.Errorf("failed to clear workspace lock: %w", err)
+	}
+	if err := unlockFile(f); err != nil {
+		return fmt.Errorf("failed to release workspace lock: %w", err)
+	}
+	return nil
+}
+
+// ownsLockFile reports whether f is the file at the lock path.
+func (w *Workspace) ownsLockFile(f *os.File) bool {
+	held, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	current, err := os.Stat(w.GetLockPath())
+	return err == nil && os.SameFile(held, current)
+}
+
+// readLock reads the holder recorded in the lock file. A holder not
+// recorded yet, or by a process of an earlier version, reads as an unknown
+// holder since the last change of the file.
+func (w *Workspace) readLock() (*WorkspaceLock, error) {
+	data, err := os.ReadFile(w.GetLockPath())
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read workspace lock: %w", err)
+	}
+	var holder WorkspaceLock
+	if err != nil || yaml.Unmarshal(data, &holder) != nil || holder.PID == 0 {
+		holder = WorkspaceLock{Host: "unknown host", Time: time.Now().UTC()}
+		if info, err := os.Stat(w.GetLockPath()); err == nil {
+			holder.Time = info.ModTime().UTC()
+		}
+	}
+	return &holder, nil
+}
+
+// recordLockHolder replaces the content of the locked file f with holder.
+func recordLockHolder(f *os.File, holder WorkspaceLock) error {
+	data, err := yaml.Marshal(holder)
+	if err != nil {
+		return fmt.Errorf("failed to serialize workspace lock: %w", err)
+	}
+	if err := f.Truncate(0); err != nil {
+		return fmt.Errorf("failed to write workspace lock: %w", err)
+	}
+	if _, err := f.WriteAt(data, 0); err != nil {
+		return fmt.Errorf("failed to write workspace lock: %w", err)
+	}
+	return nil
+}
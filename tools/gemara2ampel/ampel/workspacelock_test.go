@@ -0,0 +1,114 @@
+package ampel
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/goccy/go-yaml"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestWorkspace_Lock verifies transactions hold the workspace lock against other workspaces.
+func TestWorkspace_Lock(t *testing.T) {
+	dir := t.TempDir()
+	ws, err := NewWorkspace(dir)
+	require.NoError(t, err)
+	other, err := NewWorkspace(dir)
+	require.NoError(t, err)
+
+	tx, err := ws.Begin()
+	require.NoError(t, err)
+	holder, err := ws.LockHolder()
+	require.NoError(t, err)
+	require.NotNil(t, holder)
+	assert.Equal(t, os.Getpid(), holder.PID)
+
+	// Writes of the holder nest, writes of other workspaces are refused
+	require.NoError(t, ws.WriteFile(filepath.Join(dir, "policy.json"), []byte("{}")))
+	err = other.WriteFile(filepath.Join(dir, "other.json"), []byte("{}"))
+	assert.ErrorIs(t, err, ErrWorkspaceLocked)
+	_, err = other.Rollback(false)
+	assert.ErrorIs(t, err, ErrWorkspaceLocked)
+
+	_, err = tx.Commit()
+	require.NoError(t, err)
+	holder, err = ws.LockHolder()
+	require.NoError(t, err)
+	assert.Nil(t, holder)
+	require.NoError(t, other.WriteFile(filepath.Join(dir, "other.json"), []byte("{}")))
+
+	// Aborted transactions release the lock too
+	tx, err = ws.Begin()
+	require.NoError(t, err)
+	tx.Abort()
+	holder, err = ws.LockHolder()
+	require.NoError(t, err)
+	assert.Nil(t, holder)
+}
+
+// TestWorkspace_LockTimeout verifies operations wait for the lock to be released.
+func TestWorkspace_LockTimeout(t *testing.T) {
+	dir := t.TempDir()
+	ws, err := NewWorkspace(dir)
+	require.NoError(t, err)
+	waiting, err := NewWorkspace(dir, WithLockTimeout(10*time.Second))
+	require.NoError(t, err)
+
+	tx, err := ws.Begin()
+	require.NoError(t, err)
+	released := make(chan struct{})
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		tx.Abort()
+		close(released)
+	}()
+
+	require.NoError(t, waiting.WriteFile(filepath.Join(dir, "policy.json"), []byte("{}")))
+	select {
+	case <-released:
+	default:
+		t.Fatal("write did not wait for the lock")
+	}
+}
+
+// TestWorkspace_LockHolderExited verifies the lock file left by a process
+// holds no lock: the operating system released it.
+func TestWorkspace_LockHolderExited(t *testing.T) {
+	dir := t.TempDir()
+	ws, err := NewWorkspace(dir)
+	require.NoError(t, err)
+	data, err := yaml.Marshal(WorkspaceLock{PID: 1, Host: "ci-runner", Time: time.Now().UTC()})
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(ws.GetLockPath(), data, 0644))
+
+	holder, err := ws.LockHolder()
+	require.NoError(t, err)
+	assert.Nil(t, holder)
+	require.NoError(t, ws.WriteFile(filepath.Join(dir, "policy.json"), []byte("{}")))
+}
+
+// TestWorkspace_LockLost verifies transactions fail to commit once their
+// lock file was replaced and another workspace locked the new one.
+func TestWorkspace_LockLost(t *testing.T) {
+	dir := t.TempDir()
+	ws, err := NewWorkspace(dir)
+	require.NoError(t, err)
+	other, err := NewWorkspace(dir)
+	require.NoError(t, err)
+
+	tx, err := ws.Begin()
+	require.NoError(t, err)
+	require.NoError(t, ws.WriteFile(filepath.Join(dir, "policy.json"), []byte("{}")))
+	require.NoError(t, os.Remove(ws.GetLockPath()))
+	require.NoError(t, other.WriteFile(filepath.Join(dir, "other.json"), []byte("{}")))
+
+	_, err = tx.Commit()
+	assert.ErrorIs(t, err, ErrWorkspaceLockLost)
+	assert.NoFileExists(t, filepath.Join(dir, "policy.json"))
+
+	// The workspace locks the new lock file afterwards
+	require.NoError(t, ws.WriteFile(filepath.Join(dir, "policy.json"), []byte("{}")))
+}
@@ -0,0 +1,360 @@
+package cli
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gemara2ampel/go/ampel"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testPolicyPath is the Gemara policy with parameters of the test data.
+const testPolicyPath = "../../../test_data/gemara-policy-with-params.yaml"
+
+// testPolicyID is the ID of the policy of testPolicyPath.
+const testPolicyID = "slsa-build-policy"
+
+// conflictingPolicy defines the builder-id parameter differently in two
+// plans, which fails to convert with --param-conflicts fail.
+const conflictingPolicy = `title: Conflicting Policy
+metadata:
+  id: conflicting-policy
+  version: 1.0.0
+  description: Plans disagreeing on a parameter
+adherence:
+  assessment-plans:
+    - id: plan-01
+      requirement-id: REQ-01
+      evidence-requirements: SLSA provenance attestation
+      parameters:
+        - id: builder-id
+          accepted-values: [https://github.com/actions/runner]
+      evaluation-methods:
+        - type: automated
+    - id: plan-02
+      requirement-id: REQ-02
+      evidence-requirements: SLSA provenance attestation
+      parameters:
+        - id: builder-id
+          accepted-values: [https://gitlab.com/runner]
+      evaluation-methods:
+        - type: automated
+`
+
+// runCommand runs ampel_export with args and returns its standard output.
+// Flags and the workspace of earlier runs are reset first, as each run of
+// the command is a new process.
+func runCommand(t *testing.T, args ...string) (string, error) {
+	t.Helper()
+	resetFlags(rootCmd)
+	workspace, workspaceTx = nil, nil
+
+	stdout := os.Stdout
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+	os.Stdout = w
+	stdConsole = &console{out: w, err: io.Discard}
+	defer func() {
+		os.Stdout = stdout
+		stdConsole = &console{out: os.Stdout, err: os.Stderr}
+	}()
+
+	var out bytes.Buffer
+	done := make(chan struct{})
+	go func() {
+		_, _ = io.Copy(&out, r)
+		close(done)
+	}()
+
+	rootCmd.SetArgs(args)
+	rootCmd.SetOut(io.Discard)
+	rootCmd.SetErr(io.Discard)
+	err = rootCmd.Execute()
+	require.NoError(t, w.Close())
+	<-done
+	return out.String(), err
+}
+
+// resetSlice is a slice flag value whose first Set after a reset replaces
+// the default, as it does for a flag parsed once.
+type resetSlice struct {
+	pflag.Value
+	slice pflag.SliceValue
+	set   bool
+}
+
+func (v *resetSlice) Set(value string) error {
+	if !v.set {
+		v.set = true
+		return v.slice.Replace([]string{value})
+	}
+	return v.slice.Append(value)
+}
+
+// resetFlags sets the flags of cmd and its subcommands back to their defaults.
+func resetFlags(cmd *cobra.Command) {
+	reset := func(f *pflag.Flag) {
+		f.Changed = false
+		value, ok := f.Value.(*resetSlice)
+		if !ok {
+			slice, isSlice := f.Value.(pflag.SliceValue)
+			if !isSlice {
+				_ = f.Value.Set(f.DefValue)
+				return
+			}
+			value = &resetSlice{Value: f.Value, slice: slice}
+			f.Value = value
+		}
+
+		var defaults []string
+		if def := strings.Trim(f.DefValue, "[]"); def != "" {
+			defaults = strings.Split(def, ",")
+		}
+		value.set = false
+		_ = value.slice.Replace(defaults)
+	}
+	cmd.Flags().VisitAll(reset)
+	cmd.PersistentFlags().VisitAll(reset)
+	for _, sub := range cmd.Commands() {
+		resetFlags(sub)
+	}
+}
+
+// copyTestPolicy copies the test policy into dir and returns its path.
+func copyTestPolicy(t *testing.T, dir string) string {
+	t.Helper()
+	data, err := os.ReadFile(testPolicyPath)
+	require.NoError(t, err)
+	path := filepath.Join(dir, "policy.yaml")
+	require.NoError(t, os.WriteFile(path, data, 0o644))
+	return path
+}
+
+// editFile replaces old with new in the file at path.
+func editFile(t *testing.T, path, old, new string) {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Contains(t, string(data), old)
+	require.NoError(t, os.WriteFile(path, []byte(strings.Replace(string(data), old, new, 1)), 0o644))
+}
+
+// TestSync_FailingPolicy verifies a failing policy keeps every workspace
+// file from being written, unless --keep-going writes the other policies.
+func TestSync_FailingPolicy(t *testing.T) {
+	src := t.TempDir()
+	copyTestPolicy(t, src)
+	require.NoError(t, os.WriteFile(filepath.Join(src, "conflicting.yaml"), []byte(conflictingPolicy), 0o644))
+
+	tests := []struct {
+		name        string
+		args        []string
+		wantErr     string
+		wantLines   []string
+		wantWritten bool
+	}{
+		{
+			name:      "stop at the first failure",
+			wantErr:   "1 of 2 policies failed to sync, no workspace file was written",
+			wantLines: []string{"failed       conflicting-policy", "skipped      " + testPolicyID},
+		},
+		{
+			name:        "keep going",
+			args:        []string{"--keep-going"},
+			wantErr:     "1 of 2 policies failed to sync",
+			wantLines:   []string{"failed       conflicting-policy", "regenerated  " + testPolicyID},
+			wantWritten: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ws := t.TempDir()
+			args := append([]string{"sync", src, "-w", ws, "--param-conflicts", "fail", "-j", "1"}, tt.args...)
+			out, err := runCommand(t, args...)
+			require.ErrorContains(t, err, tt.wantErr)
+			for _, line := range tt.wantLines {
+				assert.Contains(t, out, line)
+			}
+
+			_, err = os.Stat(filepath.Join(ws, testPolicyID+".json"))
+			assert.Equal(t, tt.wantWritten, err == nil)
+			manifest, err := (&ampel.Workspace{Path: ws}).LoadManifest()
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantWritten, manifest.Entry(testPolicyID) != nil)
+			assert.Nil(t, manifest.Entry("conflicting-policy"))
+		})
+	}
+
+	// Without the failing policy the other one is written
+	ws := t.TempDir()
+	require.NoError(t, os.Remove(filepath.Join(src, "conflicting.yaml")))
+	out, err := runCommand(t, "sync", src, "-w", ws)
+	require.NoError(t, err)
+	assert.Contains(t, out, "regenerated  "+testPolicyID)
+	assert.FileExists(t, filepath.Join(ws, testPolicyID+".json"))
+}
+
+// createConflictWorkspace converts the test policy into a workspace, edits
+// the code of its scanner tenet and regenerates it with a changed scanner
+// list, leaving one code conflict. Returns the workspace directory.
+func createConflictWorkspace(t *testing.T) string {
+	t.Helper()
+	src := t.TempDir()
+	ws := t.TempDir()
+	policyPath := copyTestPolicy(t, src)
+	_, err := runCommand(t, policyPath, "-w", ws)
+	require.NoError(t, err)
+
+	editFile(t, filepath.Join(ws, testPolicyID+".json"), `attestation.predicate.scanner.vendor in`, `// reviewed\nattestation.predicate.scanner.vendor in`)
+	editFile(t, policyPath, "- grype\n", "- grype\n            - snyk\n")
+	_, err = runCommand(t, policyPath, "-w", ws)
+	require.ErrorContains(t, err, "merge conflict")
+	return ws
+}
+
+// scannerCode returns the code of the scanner tenet in the workspace policy.
+func scannerCode(t *testing.T, ws string) string {
+	t.Helper()
+	workspace, err := ampel.NewWorkspace(ws)
+	require.NoError(t, err)
+	policy, err := workspace.LoadPolicy(testPolicyID)
+	require.NoError(t, err)
+	for _, tenet := range policy.Tenets {
+		if strings.HasPrefix(tenet.Id, "VULN-REQ-001") {
+			return tenet.Code
+		}
+	}
+	t.Fatal("scanner tenet not found")
+	return ""
+}
+
+// TestResolve verifies each resolution of a conflict ends it.
+func TestResolve(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		wantCode func(string) bool
+	}{
+		{"ours", []string{"--ours"}, func(code string) bool {
+			return strings.Contains(code, "// reviewed\n") && !strings.Contains(code, "snyk")
+		}},
+		{"theirs", []string{"--theirs"}, func(code string) bool {
+			return !strings.Contains(code, "// reviewed") && strings.Contains(code, `"snyk"`)
+		}},
+		{"value", []string{"--value", "attestation.predicate.scanner.vendor == \"snyk\""}, func(code string) bool {
+			return code == `attestation.predicate.scanner.vendor == "snyk"`
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ws := createConflictWorkspace(t)
+
+			// Without a resolution the conflicts are listed
+			out, err := runCommand(t, "resolve", testPolicyID, "-w", ws)
+			require.ErrorContains(t, err, "1 unresolved merge conflict(s)")
+			assert.Contains(t, out, "Conflict: tenet VULN-REQ-001-vuln-scan-check-0 code")
+
+			out, err = runCommand(t, append([]string{"resolve", testPolicyID, "-w", ws}, tt.args...)...)
+			require.NoError(t, err)
+			assert.Contains(t, out, "All conflicts in policy "+testPolicyID+" are resolved")
+			code := scannerCode(t, ws)
+			assert.True(t, tt.wantCode(code), code)
+
+			_, err = runCommand(t, "resolve", testPolicyID, "-w", ws)
+			require.NoError(t, err)
+		})
+	}
+
+	ws := createConflictWorkspace(t)
+	_, err := runCommand(t, "resolve", testPolicyID, "-w", ws, "--ours", "--theirs")
+	assert.Error(t, err)
+	_, err = runCommand(t, "resolve", testPolicyID, "-w", ws, "--tenet", "missing", "--ours")
+	assert.ErrorContains(t, err, "no conflict matches")
+}
+
+// TestStatus_ExitCodes verifies status fails only on outputs in a --fail-on state.
+func TestStatus_ExitCodes(t *testing.T) {
+	src := t.TempDir()
+	ws := t.TempDir()
+	policyPath := copyTestPolicy(t, src)
+	_, err := runCommand(t, policyPath, "-w", ws)
+	require.NoError(t, err)
+
+	out, err := runCommand(t, "status", "-w", ws)
+	require.NoError(t, err)
+	assert.Contains(t, out, "up-to-date")
+
+	// Code edits are kept by the merge, removed tenets would be restored
+	outputPath := filepath.Join(ws, testPolicyID+".json")
+	editFile(t, outputPath, `attestation.predicate.scanner.vendor in`, `// reviewed\nattestation.predicate.scanner.vendor in`)
+	out, err = runCommand(t, "status", "-w", ws, "--fail-on", "hand-modified")
+	require.NoError(t, err)
+	assert.Contains(t, out, "up-to-date")
+	edited, err := os.ReadFile(outputPath)
+	require.NoError(t, err)
+	editFile(t, outputPath, `"id": "VULN-REQ-001-vuln-scan-check-0"`, `"id": "hand-renamed"`)
+	out, err = runCommand(t, "status", "-w", ws)
+	require.NoError(t, err)
+	assert.Contains(t, out, "hand-modified")
+	_, err = runCommand(t, "status", "-w", ws, "--fail-on", "hand-modified")
+	require.ErrorContains(t, err, "1 of 1 outputs are")
+	require.NoError(t, os.WriteFile(outputPath, edited, 0o644))
+
+	// A changed source is stale
+	editFile(t, policyPath, "- grype\n", "- grype\n            - snyk\n")
+	out, err = runCommand(t, "status", "-w", ws)
+	require.ErrorContains(t, err, "1 of 1 outputs are")
+	assert.Contains(t, out, "stale")
+	_, err = runCommand(t, "status", "-w", ws, "--fail-on", "none")
+	require.NoError(t, err)
+	_, err = runCommand(t, "status", "-w", ws, "--fail-on", "missing")
+	require.NoError(t, err)
+
+	// A source never converted is missing
+	require.NoError(t, os.WriteFile(filepath.Join(src, "conflicting.yaml"), []byte(conflictingPolicy), 0o644))
+	out, err = runCommand(t, "status", src, "-w", ws, "--fail-on", "missing")
+	require.ErrorContains(t, err, "1 of 2 outputs are missing")
+	assert.Contains(t, out, "conflicting-policy")
+
+	_, err = runCommand(t, "status", "-w", ws, "--fail-on", "bogus")
+	assert.ErrorContains(t, err, "invalid --fail-on value")
+}
+
+// TestStatus_RecordedMergeSettings verifies status judges hand edits with
+// the orphan mode and merge strategies of the last conversion.
+func TestStatus_RecordedMergeSettings(t *testing.T) {
+	src := t.TempDir()
+	policyPath := copyTestPolicy(t, src)
+
+	tests := []struct {
+		name  string
+		args  []string
+		state string
+	}{
+		{name: "default orphan mode", state: "1 hand-modified"},
+		{name: "kept orphans", args: []string{"--orphans", "keep"}, state: "1 up-to-date"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ws := t.TempDir()
+			_, err := runCommand(t, append([]string{policyPath, "-w", ws}, tt.args...)...)
+			require.NoError(t, err)
+
+			editFile(t, filepath.Join(ws, testPolicyID+".json"), `"tenets": [`, `"tenets": [{"id": "hand-added", "code": "true"},`)
+			out, err := runCommand(t, "status", "-w", ws)
+			require.NoError(t, err)
+			assert.Contains(t, out, tt.state)
+		})
+	}
+}
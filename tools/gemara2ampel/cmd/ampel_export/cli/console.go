@@ -0,0 +1,17 @@
+package cli
+
+import (
+	"io"
+	"os"
+)
+
+// console is where a conversion reports: results to out, diagnostics,
+// warnings and conflicts to err. sync gives each policy its own console so
+// that concurrent conversions do not interleave their reports.
+type console struct {
+	out io.Writer
+	err io.Writer
+}
+
+// stdConsole reports to the standard output and error streams.
+var stdConsole = &console{out: os.Stdout, err: os.Stderr}
@@ -3,37 +3,122 @@ package cli
 import (
 	"encoding/json"
 	"fmt"
+	"maps"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
+	"time"
 
 	"gemara2ampel/go/ampel"
 
 	"github.com/gemaraproj/go-gemara"
+	"github.com/goccy/go-yaml"
 )
 
 // convertPolicy handles the main policy conversion logic
-func convertPolicy(path string) error {
+func convertPolicy(c *console, path string) error {
+	if err := checkDryRunFlags(); err != nil {
+		return err
+	}
+
 	// Calculate default output filename based on input YAML file
 	defaultOutputFile := getDefaultOutputFilename(path)
 
 	// Load the policy
+	policy, err := loadGemaraPolicy(path)
+	if err != nil {
+		return err
+	}
+
+	// Prepare transformation options
+	transformOpts, err := buildTransformOptions()
+	if err != nil {
+		return err
+	}
+
+	return convertGemaraPolicy(c, path, policy, transformOpts, defaultOutputFile)
+}
+
+// convertGemaraPolicy converts the Gemara policy loaded from path with the
+// transformation options of the command flags. transformOpts is not
+// modified, so sync shares it between concurrent conversions.
+func convertGemaraPolicy(c *console, path string, policy *gemara.Policy, transformOpts []ampel.TransformOption, defaultOutputFile string) error {
+	// Collect diagnostics so they can be reported before any file is written
+	diags := &ampel.Diagnostics{}
+	transformOpts = append(slices.Clip(transformOpts), ampel.WithDiagnostics(diags))
+
+	// Generate PolicySet or single Policy based on flag
+	if policySet {
+		return convertToPolicySet(c, path, policy, transformOpts, diags, defaultOutputFile)
+	}
+
+	return convertToPolicy(c, path, policy, transformOpts, diags, defaultOutputFile)
+}
+
+// checkDiagnostics prints the transformation diagnostics to stderr and fails
+// if any of them reaches the --fail-on severity threshold
+func checkDiagnostics(c *console, diags *ampel.Diagnostics) error {
+	for _, diag := range *diags {
+		fmt.Fprintln(c.err, diag.String())
+	}
+
+	if failOn == "none" {
+		return nil
+	}
+	threshold, err := ampel.ParseSeverity(failOn)
+	if err != nil {
+		return fmt.Errorf("invalid --fail-on value: %w", err)
+	}
+	if count := diags.AtLeast(threshold); count > 0 {
+		return fmt.Errorf("transformation reported %d diagnostic(s) at or above severity %s", count, threshold)
+	}
+	return nil
+}
+
+// loadGemaraPolicy loads a Gemara policy from a local file
+func loadGemaraPolicy(path string) (*gemara.Policy, error) {
 	policy := &gemara.Policy{}
 	pathWithScheme := fmt.Sprintf("file://%s", path)
 	if err := policy.LoadFile(pathWithScheme); err != nil {
-		return fmt.Errorf("failed to load policy: %w", err)
+		return nil, fmt.Errorf("failed to load policy: %w", err)
 	}
+	return policy, nil
+}
 
-	// Prepare transformation options
+// buildTransformOptions builds the transformation options from the command flags
+func buildTransformOptions() ([]ampel.TransformOption, error) {
 	var transformOpts []ampel.TransformOption
 
-	// Load catalog if provided
-	if catalogPath != "" {
-		catalog := &gemara.Catalog{}
-		catalogPathWithScheme := fmt.Sprintf("file://%s", catalogPath)
-		if err := catalog.LoadFile(catalogPathWithScheme); err != nil {
-			return fmt.Errorf("failed to load catalog: %w", err)
+	// Load catalogs if provided and index them once for all policies
+	if len(catalogPaths) > 0 {
+		var catalogs []*gemara.Catalog
+		for _, catalogPath := range catalogPaths {
+			catalog := &gemara.Catalog{}
+			catalogPathWithScheme := fmt.Sprintf("file://%s", catalogPath)
+			if err := catalog.LoadFile(catalogPathWithScheme); err != nil {
+				return nil, fmt.Errorf("failed to load catalog %s: %w", catalogPath, err)
+			}
+			catalogs = append(catalogs, catalog)
+		}
+		index, err := ampel.NewCatalogIndex(catalogs...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to index catalogs: %w", err)
+		}
+		transformOpts = append(transformOpts, ampel.WithCatalogIndex(index))
+	}
+
+	// Framework names for catalog guideline mappings
+	if len(frameworkNames) > 0 {
+		names := make(map[string]string, len(frameworkNames))
+		for _, assignment := range frameworkNames {
+			referenceID, name, ok := strings.Cut(assignment, "=")
+			if !ok || referenceID == "" {
+				return nil, fmt.Errorf("invalid --framework-name value %q (use reference-id=name)", assignment)
+			}
+			names[referenceID] = name
 		}
-		transformOpts = append(transformOpts, ampel.WithCatalog(catalog))
+		transformOpts = append(transformOpts, ampel.WithFrameworkNames(names))
 	}
 
 	// Add scope filters option
@@ -41,16 +126,52 @@ func convertPolicy(path string) error {
 		transformOpts = append(transformOpts, ampel.WithScopeFilters(true))
 	}
 
-	// Generate PolicySet or single Policy based on flag
-	if policySet {
-		return convertToPolicySet(policy, transformOpts, defaultOutputFile)
+	// Parameter conflict handling
+	conflictMode, err := ampel.ParseParameterConflictMode(paramConflicts)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --param-conflicts value: %w", err)
+	}
+	transformOpts = append(transformOpts, ampel.WithParameterConflicts(conflictMode))
+
+	// Runtime context values: --values first, then --set overrides
+	contextValues, err := loadContextValues()
+	if err != nil {
+		return nil, err
+	}
+	if len(contextValues) > 0 {
+		transformOpts = append(transformOpts, ampel.WithContextValues(contextValues))
 	}
 
-	return convertToPolicy(policy, transformOpts, defaultOutputFile)
+	return transformOpts, nil
+}
+
+// loadContextValues reads the --values file and applies the --set overrides
+func loadContextValues() (map[string]interface{}, error) {
+	values := make(map[string]interface{})
+
+	if valuesFile != "" {
+		data, err := os.ReadFile(valuesFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read values file: %w", err)
+		}
+		if err := yaml.Unmarshal(data, &values); err != nil {
+			return nil, fmt.Errorf("failed to parse values file %s: %w", valuesFile, err)
+		}
+	}
+
+	for _, assignment := range setValues {
+		key, value, ok := strings.Cut(assignment, "=")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid --set value %q (use param=value)", assignment)
+		}
+		values[key] = value
+	}
+
+	return values, nil
 }
 
 // convertToPolicySet generates a PolicySet
-func convertToPolicySet(policy *gemara.Policy, transformOpts []ampel.TransformOption, defaultOutputFile string) error {
+func convertToPolicySet(c *console, path string, policy *gemara.Policy, transformOpts []ampel.TransformOption, diags *ampel.Diagnostics, defaultOutputFile string) error {
 	// Set default output filename if not specified
 	finalOutputFile := outputFile
 	if finalOutputFile == "" {
@@ -65,17 +186,55 @@ func convertToPolicySet(policy *gemara.Policy, transformOpts []ampel.TransformOp
 		psOpts = append(psOpts, ampel.WithPolicySetMetadata(policySetName, policySetDesc, policySetVersion))
 	}
 
+	// Add custom PolicySet metadata fields
+	if len(policySetMeta) > 0 {
+		metadata := make(map[string]interface{}, len(policySetMeta))
+		for _, assignment := range policySetMeta {
+			key, value, ok := strings.Cut(assignment, "=")
+			if !ok || key == "" {
+				return fmt.Errorf("invalid --policyset-meta value %q (use key=value)", assignment)
+			}
+			if !slices.Contains(ampel.PolicySetMetaKeys, key) {
+				return fmt.Errorf("unsupported --policyset-meta key %q (use %s)", key, strings.Join(ampel.PolicySetMetaKeys, ", "))
+			}
+			metadata[key] = value
+		}
+		psOpts = append(psOpts, ampel.WithPolicySetCustomMetadata(metadata))
+	}
+
+	// Move context shared by member policies into the common context
+	if hoistContext {
+		psOpts = append(psOpts, ampel.WithHoistedContext(true))
+	}
+
 	// Add transform options
 	if len(transformOpts) > 0 {
 		psOpts = append(psOpts, ampel.WithTransformOptions(transformOpts...))
 	}
 
+	// Convert imported policies inline if requested
+	if resolveImports {
+		psOpts = append(psOpts, ampel.WithPolicyResolver(buildPolicyResolver(path)))
+	}
+
 	// Transform the policy to PolicySet
 	ampelPolicySet, err := ampel.FromPolicyWithImports(policy, psOpts...)
 	if err != nil {
 		return fmt.Errorf("failed to transform policy to PolicySet: %w", err)
 	}
 
+	// Check if workspace mode is enabled
+	if workspacePath != "" {
+		accepted := map[string]map[string][]string{
+			policy.Metadata.Id: ampel.ContextAcceptedValues(policy, transformOpts...),
+		}
+		return handlePolicySetWorkspaceMode(c, path, ampelPolicySet, accepted, diags)
+	}
+
+	if err := checkDiagnostics(c, diags); err != nil {
+		return err
+	}
+
 	// Serialize to JSON
 	ampelJSON, err := json.MarshalIndent(ampelPolicySet, "", "  ")
 	if err != nil {
@@ -83,19 +242,34 @@ func convertToPolicySet(policy *gemara.Policy, transformOpts []ampel.TransformOp
 	}
 
 	// Write to file
-	if err := os.WriteFile(finalOutputFile, ampelJSON, 0600); err != nil {
+	if err := ampel.WriteFileAtomic(finalOutputFile, ampelJSON, 0600); err != nil {
 		return fmt.Errorf("failed to write output file: %w", err)
 	}
 
-	fmt.Printf("Successfully wrote Ampel PolicySet to %s\n", finalOutputFile)
-	fmt.Printf("PolicySet: %s\n", ampelPolicySet.Id)
-	fmt.Printf("Policies: %d\n", len(ampelPolicySet.Policies))
+	fmt.Fprintf(c.out, "Successfully wrote Ampel PolicySet to %s\n", finalOutputFile)
+	fmt.Fprintf(c.out, "PolicySet: %s\n", ampelPolicySet.Id)
+	fmt.Fprintf(c.out, "Policies: %d\n", len(ampelPolicySet.Policies))
 
 	return nil
 }
 
+// buildPolicyResolver creates the resolver for imported policies. The git
+// repository is tried first when configured so imports are read at the pinned
+// revision, then local paths relative to the policy file, then the mirror.
+func buildPolicyResolver(path string) ampel.PolicyResolver {
+	var resolver ampel.MultiResolver
+	if importRepo != "" {
+		resolver = append(resolver, &ampel.GitResolver{RepoPath: importRepo, Revision: importRevision})
+	}
+	resolver = append(resolver, &ampel.FileResolver{BaseDir: filepath.Dir(path)})
+	if importMirror != "" {
+		resolver = append(resolver, &ampel.MirrorResolver{Root: importMirror})
+	}
+	return resolver
+}
+
 // convertToPolicy generates a single Ampel policy
-func convertToPolicy(policy *gemara.Policy, transformOpts []ampel.TransformOption, defaultOutputFile string) error {
+func convertToPolicy(c *console, path string, policy *gemara.Policy, transformOpts []ampel.TransformOption, diags *ampel.Diagnostics, defaultOutputFile string) error {
 	// Transform the policy to single Ampel policy
 	ampelPolicy, err := ampel.FromPolicy(policy, transformOpts...)
 	if err != nil {
@@ -104,40 +278,38 @@ func convertToPolicy(policy *gemara.Policy, transformOpts []ampel.TransformOptio
 
 	// Check if workspace mode is enabled
 	if workspacePath != "" {
-		return handleWorkspaceMode(ampelPolicy, defaultOutputFile)
+		accepted := ampel.ContextAcceptedValues(policy, transformOpts...)
+		return handleWorkspaceMode(c, path, ampelPolicy, accepted, diags, defaultOutputFile)
 	}
 
-	return handleStandardMode(ampelPolicy, defaultOutputFile)
+	if err := checkDiagnostics(c, diags); err != nil {
+		return err
+	}
+	return handleStandardMode(c, ampelPolicy, defaultOutputFile)
 }
 
-// handleWorkspaceMode handles policy conversion in workspace mode
-func handleWorkspaceMode(ampelPolicy *ampel.Policy, defaultOutputFile string) error {
+// handleWorkspaceMode handles policy conversion in workspace mode. accepted
+// lists the accepted values of the generated context keys, which decide the
+// context values set in the workspace that are kept. path is the Gemara
+// policy file, recorded in the workspace manifest.
+func handleWorkspaceMode(c *console, path string, ampelPolicy *ampel.Policy, accepted map[string][]string, diags *ampel.Diagnostics, defaultOutputFile string) error {
 	// Workspace mode
-	ws, err := ampel.NewWorkspace(workspacePath)
+	ws, err := openWorkspace()
 	if err != nil {
-		return fmt.Errorf("failed to create workspace: %w", err)
+		return err
 	}
 
 	// Determine policy ID and output path
 	policyID := ampelPolicy.Id
 
 	// Determine output path and check existence
-	var outputPath string
-	var policyExists bool
-
-	if outputFile != "" {
-		// Custom output filename provided
-		outputPath = outputFile
-		if !filepath.IsAbs(outputPath) {
-			outputPath = filepath.Join(workspacePath, outputFile)
-		}
-		// Check if custom output file exists
-		_, err := os.Stat(outputPath)
-		policyExists = err == nil
-	} else {
-		// Use default policy ID-based filename
-		outputPath = ws.GetPolicyPath(policyID)
-		policyExists = ws.PolicyExists(policyID)
+	outputPath := workspacePolicyPath(ws, policyID, outputFile)
+	_, statErr := os.Stat(outputPath)
+	policyExists := statErr == nil
+	if policyExists && forceOverwrite {
+		if err := checkNoLocks(ws, policyID); err != nil {
+			return err
+		}
 	}
 
 	if policyExists && !forceOverwrite {
@@ -152,32 +324,127 @@ func handleWorkspaceMode(ampelPolicy *ampel.Policy, defaultOutputFile string) er
 			return fmt.Errorf("failed to parse existing policy JSON (try --force-overwrite to regenerate): %w", err)
 		}
 
-		// Merge policies
-		mergedPolicy, stats, err := ampel.MergePolicy(existingPolicy, ampelPolicy)
+		base, err := ws.LoadBase(policyID)
+		if err != nil {
+			return err
+		}
+
+		mergeOpts, err := buildMergeOptions()
+		if err != nil {
+			return err
+		}
+		mergeOpts = append(mergeOpts, ampel.WithContextAcceptedValues(accepted))
+		locks, err := ws.LoadLocks(policyID)
+		if err != nil {
+			return err
+		}
+		mergeOpts = append(mergeOpts, ampel.WithLocks(locks))
+
+		// Merge policies against the recorded generation base
+		mergedPolicy, stats, err := ampel.MergePolicyWithBase(base, existingPolicy, ampelPolicy, mergeOpts...)
 		if err != nil {
 			return fmt.Errorf("failed to merge policies: %w", err)
 		}
 
-		// Save merged policy
+		// Findings about generated code do not apply to tenets that kept their existing code
+		generatedCode := make(map[string]string, len(ampelPolicy.Tenets))
+		for _, tenet := range ampelPolicy.Tenets {
+			generatedCode[tenet.Id] = tenet.Code
+		}
+		preserved := make(map[string]bool, len(mergedPolicy.Tenets))
+		for _, tenet := range mergedPolicy.Tenets {
+			preserved[tenet.Id] = tenet.Code != generatedCode[tenet.Id]
+		}
+		remaining := diags.WithoutPreservedCode(preserved)
+		if err := checkDiagnostics(c, &remaining); err != nil {
+			return err
+		}
+		if dryRun {
+			printMergeNotes(c, stats.Conflicts, stats.LockedChanges, stats.Warnings)
+			return printPolicyDryRun(c, outputPath, data, existingPolicy, mergedPolicy, stats.Renames)
+		}
+
+		// Save merged policy, reading every input first so that a failure
+		// stages none of the files of the policy
+		inputs, err := manifestInputs(ws, path)
+		if err != nil {
+			return err
+		}
 		mergedJSON, err := json.MarshalIndent(mergedPolicy, "", "  ")
 		if err != nil {
 			return fmt.Errorf("failed to serialize merged policy: %w", err)
 		}
-		if err := os.WriteFile(outputPath, mergedJSON, 0600); err != nil {
+		if orphanMode == string(ampel.OrphanArchive) {
+			if err := ws.ArchiveTenets(policyID, stats.Orphans, ampel.OrphanReason(ampelPolicy)); err != nil {
+				return err
+			}
+		}
+		if err := ws.WriteFile(outputPath, mergedJSON); err != nil {
 			return fmt.Errorf("failed to write merged policy: %w", err)
 		}
+		if err := ws.SaveBase(policyID, ampel.AdvanceBase(base, ampelPolicy, stats)); err != nil {
+			return err
+		}
+		if err := ws.SaveConflicts(policyID, stats.Conflicts); err != nil {
+			return err
+		}
+		if err := recordManifest(ws, inputs, policyID, ampel.ManifestKindPolicy, outputPath); err != nil {
+			return err
+		}
 
 		// Print update message with stats
-		fmt.Printf("Updated existing Ampel policy: %s\n", outputPath)
-		fmt.Printf("Policy: %s\n", mergedPolicy.Id)
+		fmt.Fprintf(c.out, "Updated existing Ampel policy: %s\n", outputPath)
+		fmt.Fprintf(c.out, "Policy: %s\n", mergedPolicy.Id)
 		totalTenets := len(mergedPolicy.Tenets)
-		fmt.Printf("Tenets: %d (%d preserved, %d added, %d removed)\n",
-			totalTenets, stats.TenetsPreserved, stats.TenetsAdded, stats.TenetsRemoved)
+		fmt.Fprintf(c.out, "Tenets: %d (%d preserved, %d updated, %d added, %d removed, %d kept, %d conflicts)\n",
+			totalTenets, stats.TenetsPreserved, stats.TenetsUpdated, stats.TenetsAdded, stats.TenetsRemoved, stats.TenetsKept, len(stats.Conflicts))
+		if orphanMode == string(ampel.OrphanArchive) && len(stats.Orphans) > 0 {
+			fmt.Fprintf(c.out, "Archived %d tenet(s) to %s; restore them with: ampel_export restore %s -w %s\n",
+				len(stats.Orphans), ws.GetArchivePath(policyID), policyID, workspacePath)
+		}
+		for _, rename := range stats.Renames {
+			fmt.Fprintf(c.out, "  Renamed tenet: %s\n", rename)
+		}
 		if stats.TenetsPreserved > 0 {
-			fmt.Println("Preserved manual changes to CEL code and parameters")
+			fmt.Fprintln(c.out, "Preserved manual changes to CEL code and parameters")
+		}
+		fmt.Fprintf(c.out, "Context: %d keys (%d values preserved, %d added, %d removed)\n",
+			len(mergedPolicy.Context), stats.ContextValuesPreserved, len(stats.ContextKeysAdded), len(stats.ContextKeysRemoved))
+		for _, key := range stats.ContextKeysAdded {
+			fmt.Fprintf(c.out, "  Added context key: %s\n", key)
+		}
+		for _, key := range stats.ContextKeysRemoved {
+			fmt.Fprintf(c.out, "  Removed context key: %s\n", key)
+		}
+		for _, warning := range stats.Warnings {
+			fmt.Fprintf(c.err, "Warning: %s\n", warning)
+		}
+		reportLockedChanges(c, stats.LockedChanges)
+		if err := reportMergeConflicts(c, ws, policyID, stats.Conflicts); err != nil {
+			return err
 		}
 	} else {
+		if err := checkDiagnostics(c, diags); err != nil {
+			return err
+		}
+		if dryRun {
+			var existingData []byte
+			var existingPolicy *ampel.Policy
+			if policyExists {
+				if existingData, err = os.ReadFile(outputPath); err != nil {
+					return fmt.Errorf("failed to read existing policy: %w", err)
+				}
+				// --force-overwrite also replaces files that no longer parse
+				_ = json.Unmarshal(existingData, &existingPolicy)
+			}
+			return printPolicyDryRun(c, outputPath, existingData, existingPolicy, ampelPolicy, nil)
+		}
+
 		// Create new or force overwrite
+		inputs, err := manifestInputs(ws, path)
+		if err != nil {
+			return err
+		}
 		// Serialize to JSON
 		ampelJSON, err := json.MarshalIndent(ampelPolicy, "", "  ")
 		if err != nil {
@@ -185,25 +452,349 @@ func handleWorkspaceMode(ampelPolicy *ampel.Policy, defaultOutputFile string) er
 		}
 
 		// Write to file
-		if err := os.WriteFile(outputPath, ampelJSON, 0600); err != nil {
+		if err := ws.WriteFile(outputPath, ampelJSON); err != nil {
+			return fmt.Errorf("failed to write output file: %w", err)
+		}
+		if err := ws.SaveBase(policyID, ampelPolicy); err != nil {
+			return err
+		}
+		if err := ws.SaveConflicts(policyID, nil); err != nil {
+			return err
+		}
+		if err := recordManifest(ws, inputs, policyID, ampel.ManifestKindPolicy, outputPath); err != nil {
+			return err
+		}
+
+		if forceOverwrite {
+			fmt.Fprintf(c.out, "Regenerated Ampel policy: %s\n", outputPath)
+			fmt.Fprintln(c.out, "Warning: Manual changes were discarded (--force-overwrite used)")
+		} else {
+			fmt.Fprintf(c.out, "Created new Ampel policy: %s\n", outputPath)
+		}
+		fmt.Fprintf(c.out, "Policy: %s\n", ampelPolicy.Id)
+		fmt.Fprintf(c.out, "Tenets: %d\n", len(ampelPolicy.Tenets))
+	}
+
+	return nil
+}
+
+// handlePolicySetWorkspaceMode handles PolicySet conversion in workspace
+// mode, merging the generated PolicySet member by member. accepted lists the
+// accepted context values of member policies by policy ID. path is the
+// Gemara policy file, recorded in the workspace manifest.
+func handlePolicySetWorkspaceMode(c *console, path string, policySet *ampel.PolicySet, accepted map[string]map[string][]string, diags *ampel.Diagnostics) error {
+	ws, err := openWorkspace()
+	if err != nil {
+		return err
+	}
+
+	policySetID := policySet.Id
+	outputPath := workspacePolicyPath(ws, policySetID, outputFile)
+	_, statErr := os.Stat(outputPath)
+	policySetExists := statErr == nil
+	if policySetExists && forceOverwrite {
+		if err := checkNoLocks(ws, policySetID); err != nil {
+			return err
+		}
+	}
+
+	if !policySetExists || forceOverwrite {
+		if err := checkDiagnostics(c, diags); err != nil {
+			return err
+		}
+		if dryRun {
+			var existingData []byte
+			var existing *ampel.PolicySet
+			if policySetExists {
+				if existingData, err = os.ReadFile(outputPath); err != nil {
+					return fmt.Errorf("failed to read existing PolicySet: %w", err)
+				}
+				// --force-overwrite also replaces files that no longer parse
+				_ = json.Unmarshal(existingData, &existing)
+			}
+			return printPolicySetDryRun(c, outputPath, existingData, existing, policySet, nil)
+		}
+		inputs, err := manifestInputs(ws, path)
+		if err != nil {
+			return err
+		}
+		policySetJSON, err := json.MarshalIndent(policySet, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to serialize PolicySet to JSON: %w", err)
+		}
+		if err := ws.WriteFile(outputPath, policySetJSON); err != nil {
 			return fmt.Errorf("failed to write output file: %w", err)
 		}
+		if err := ws.SavePolicySetBase(policySetID, policySet); err != nil {
+			return err
+		}
+		if err := ws.SaveConflicts(policySetID, nil); err != nil {
+			return err
+		}
+		if err := recordManifest(ws, inputs, policySetID, ampel.ManifestKindPolicySet, outputPath); err != nil {
+			return err
+		}
 
 		if forceOverwrite {
-			fmt.Printf("Regenerated Ampel policy: %s\n", outputPath)
-			fmt.Println("Warning: Manual changes were discarded (--force-overwrite used)")
+			fmt.Fprintf(c.out, "Regenerated Ampel PolicySet: %s\n", outputPath)
+			fmt.Fprintln(c.out, "Warning: Manual changes were discarded (--force-overwrite used)")
 		} else {
-			fmt.Printf("Created new Ampel policy: %s\n", outputPath)
+			fmt.Fprintf(c.out, "Created new Ampel PolicySet: %s\n", outputPath)
+		}
+		fmt.Fprintf(c.out, "PolicySet: %s\n", policySetID)
+		fmt.Fprintf(c.out, "Policies: %d\n", len(policySet.Policies))
+		return nil
+	}
+
+	data, err := os.ReadFile(outputPath)
+	if err != nil {
+		return fmt.Errorf("failed to read existing PolicySet: %w", err)
+	}
+	var existing *ampel.PolicySet
+	if err := json.Unmarshal(data, &existing); err != nil {
+		return fmt.Errorf("failed to parse existing PolicySet JSON (try --force-overwrite to regenerate): %w", err)
+	}
+	base, err := ws.LoadPolicySetBase(policySetID)
+	if err != nil {
+		return err
+	}
+
+	mergeOpts, err := buildMergeOptions()
+	if err != nil {
+		return err
+	}
+	for policyID, values := range accepted {
+		mergeOpts = append(mergeOpts, ampel.WithMemberContextAcceptedValues(policyID, values))
+	}
+	locks, err := ws.LoadLocks(policySetID)
+	if err != nil {
+		return err
+	}
+	mergeOpts = append(mergeOpts, ampel.WithLocks(locks))
+
+	merged, stats, err := ampel.MergePolicySetWithBase(base, existing, policySet, mergeOpts...)
+	if err != nil {
+		return fmt.Errorf("failed to merge PolicySets: %w", err)
+	}
+
+	// Findings about generated code do not apply to tenets that kept their existing code
+	generatedCode := make(map[string]string)
+	for _, policy := range policySet.Policies {
+		for _, tenet := range policy.Tenets {
+			generatedCode[tenet.Id] = tenet.Code
+		}
+	}
+	preserved := make(map[string]bool)
+	for _, policy := range merged.Policies {
+		for _, tenet := range policy.Tenets {
+			preserved[tenet.Id] = preserved[tenet.Id] || tenet.Code != generatedCode[tenet.Id]
 		}
-		fmt.Printf("Policy: %s\n", ampelPolicy.Id)
-		fmt.Printf("Tenets: %d\n", len(ampelPolicy.Tenets))
+	}
+	remaining := diags.WithoutPreservedCode(preserved)
+	if err := checkDiagnostics(c, &remaining); err != nil {
+		return err
+	}
+	if dryRun {
+		var warnings []string
+		renames := make(map[string][]ampel.TenetRename)
+		for _, id := range slices.Sorted(maps.Keys(stats.Policies)) {
+			for _, warning := range stats.Policies[id].Warnings {
+				warnings = append(warnings, "policy "+id+": "+warning)
+			}
+			renames[id] = stats.Policies[id].Renames
+		}
+		for _, warning := range stats.Warnings {
+			warnings = append(warnings, "common "+warning)
+		}
+		printMergeNotes(c, stats.Conflicts(), stats.LockedChanges(), warnings)
+		return printPolicySetDryRun(c, outputPath, data, existing, merged, renames)
 	}
 
+	// Read every input before writing so that a failure stages none of the
+	// files of the PolicySet
+	inputs, err := manifestInputs(ws, path)
+	if err != nil {
+		return err
+	}
+	mergedJSON, err := json.MarshalIndent(merged, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to serialize merged PolicySet: %w", err)
+	}
+	archived := 0
+	if orphanMode == string(ampel.OrphanArchive) {
+		for _, policy := range policySet.Policies {
+			orphans := stats.Policies[policy.Id].Orphans
+			if err := ws.ArchiveMemberTenets(policySetID, policy.Id, orphans, ampel.OrphanReason(policy)); err != nil {
+				return err
+			}
+			archived += len(orphans)
+		}
+	}
+	if err := ws.WriteFile(outputPath, mergedJSON); err != nil {
+		return fmt.Errorf("failed to write merged PolicySet: %w", err)
+	}
+	if err := ws.SavePolicySetBase(policySetID, ampel.AdvancePolicySetBase(base, policySet, stats)); err != nil {
+		return err
+	}
+	conflicts := stats.Conflicts()
+	if err := ws.SaveConflicts(policySetID, conflicts); err != nil {
+		return err
+	}
+	if err := recordManifest(ws, inputs, policySetID, ampel.ManifestKindPolicySet, outputPath); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(c.out, "Updated existing Ampel PolicySet: %s\n", outputPath)
+	fmt.Fprintf(c.out, "PolicySet: %s\n", merged.Id)
+	fmt.Fprintf(c.out, "Policies: %d (%d added, %d removed, %d kept, %d references updated)\n",
+		len(merged.Policies), len(stats.PoliciesAdded), len(stats.PoliciesRemoved), len(stats.PoliciesKept), len(stats.ReferencesUpdated))
+	for _, policy := range merged.Policies {
+		policyStats, ok := stats.Policies[policy.Id]
+		if !ok {
+			continue
+		}
+		fmt.Fprintf(c.out, "  %s: %d tenets (%d preserved, %d updated, %d added, %d removed, %d kept, %d conflicts)\n",
+			policy.Id, len(policy.Tenets), policyStats.TenetsPreserved, policyStats.TenetsUpdated, policyStats.TenetsAdded,
+			policyStats.TenetsRemoved, policyStats.TenetsKept, len(policyStats.Conflicts))
+		for _, rename := range policyStats.Renames {
+			fmt.Fprintf(c.out, "    Renamed tenet: %s\n", rename)
+		}
+		for _, warning := range policyStats.Warnings {
+			fmt.Fprintf(c.err, "Warning: policy %s: %s\n", policy.Id, warning)
+		}
+	}
+	for _, warning := range stats.Warnings {
+		fmt.Fprintf(c.err, "Warning: common %s\n", warning)
+	}
+	reportLockedChanges(c, stats.LockedChanges())
+	if archived > 0 {
+		fmt.Fprintf(c.out, "Archived %d tenet(s) to %s; restore them with: ampel_export restore %s -w %s\n",
+			archived, ws.GetArchivePath(policySetID), policySetID, workspacePath)
+	}
+
+	return reportMergeConflicts(c, ws, policySetID, conflicts)
+}
+
+// reportMergeConflicts prints the conflicts of a merge and returns an error
+// pointing to the side-car file while any remain.
+func reportMergeConflicts(c *console, ws *ampel.Workspace, id string, conflicts []ampel.MergeConflict) error {
+	if len(conflicts) == 0 {
+		return nil
+	}
+	printConflicts(c, conflicts)
+	return &pendingConflictsError{message: fmt.Sprintf("%d unresolved merge conflict(s), see %s; resolve them with: ampel_export resolve %s -w %s",
+		len(conflicts), ws.GetConflictsPath(id), id, workspacePath)}
+}
+
+// printConflicts prints merge conflicts to stderr.
+func printConflicts(c *console, conflicts []ampel.MergeConflict) {
+	for _, conflict := range conflicts {
+		fmt.Fprintf(c.err, "Conflict: %s was edited manually and changed upstream; kept the manual version\n", conflict)
+	}
+}
+
+// reportLockedChanges prints the upstream changes that locks kept out of
+// the workspace, for review.
+func reportLockedChanges(c *console, changes []ampel.LockedChange) {
+	for _, change := range changes {
+		fmt.Fprintf(c.err, "Locked: %s; kept the workspace version\n", change)
+	}
+}
+
+// checkNoLocks refuses to overwrite a workspace file holding locked tenets.
+func checkNoLocks(ws *ampel.Workspace, id string) error {
+	locks, err := ws.LoadLocks(id)
+	if err != nil {
+		return err
+	}
+	if len(locks) > 0 {
+		return fmt.Errorf("%s has %d locked tenet(s), see %s; --force-overwrite would discard them, unlock them first with: ampel_export lock %s -w %s --remove",
+			id, len(locks), ws.GetLocksPath(id), id, workspacePath)
+	}
 	return nil
 }
 
+// buildMergeOptions converts the --merge-strategy, --orphans and
+// --rename-threshold flags into merge options
+func buildMergeOptions() ([]ampel.MergeOption, error) {
+	mode, err := ampel.ParseOrphanMode(orphanMode)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --orphans: %w", err)
+	}
+	opts := []ampel.MergeOption{ampel.WithOrphanMode(mode), ampel.WithRenameThreshold(renameThreshold)}
+	for _, setting := range mergeStrategies {
+		opt, err := ampel.ParseMergeStrategyOption(setting)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --merge-strategy: %w", err)
+		}
+		opts = append(opts, opt)
+	}
+	return opts, nil
+}
+
+// recordManifest records the generation of the workspace output at
+// outputPath in the workspace manifest, from the inputs returned by
+// manifestInputs and with the --orphans and --merge-strategy settings.
+func recordManifest(ws *ampel.Workspace, entry ampel.ManifestEntry, id, kind, outputPath string) error {
+	output, err := ws.DigestFile(outputPath)
+	if err != nil {
+		return err
+	}
+	entry.Output = output
+	entry.ID = id
+	entry.Kind = kind
+	entry.GeneratedAt = time.Now().UTC().Truncate(time.Second)
+	entry.OrphanMode = orphanMode
+	entry.MergeStrategies = slices.Clone(mergeStrategies)
+
+	return ws.RecordOutput(entry)
+}
+
+// manifestInputs returns the manifest entry inputs of converting the Gemara
+// policy at sourcePath with the command flags: the policy and values files,
+// catalogs, CEL templates and tool version.
+func manifestInputs(ws *ampel.Workspace, sourcePath string) (ampel.ManifestEntry, error) {
+	entry := ampel.ManifestEntry{
+		TemplateDigest: ampel.TemplateDigest(ampel.DefaultCELTemplates),
+		ToolVersion:    version,
+	}
+
+	sources := []string{sourcePath}
+	if valuesFile != "" {
+		sources = append(sources, valuesFile)
+	}
+	for _, source := range sources {
+		digest, err := ws.DigestFile(source)
+		if err != nil {
+			return ampel.ManifestEntry{}, err
+		}
+		entry.Sources = append(entry.Sources, digest)
+	}
+	for _, catalogPath := range catalogPaths {
+		digest, err := ws.DigestFile(catalogPath)
+		if err != nil {
+			return ampel.ManifestEntry{}, err
+		}
+		entry.Catalogs = append(entry.Catalogs, digest)
+	}
+	return entry, nil
+}
+
+// workspacePolicyPath returns the path of a workspace policy: the custom
+// output file, relative to the workspace unless absolute, or the default
+// policy ID-based filename.
+func workspacePolicyPath(ws *ampel.Workspace, policyID, output string) string {
+	if output == "" {
+		return ws.GetPolicyPath(policyID)
+	}
+	if filepath.IsAbs(output) {
+		return output
+	}
+	return filepath.Join(ws.Path, output)
+}
+
 // handleStandardMode handles policy conversion in standard (non-workspace) mode
-func handleStandardMode(ampelPolicy *ampel.Policy, defaultOutputFile string) error {
+func handleStandardMode(c *console, ampelPolicy *ampel.Policy, defaultOutputFile string) error {
 	// Original behavior (no workspace)
 	// Set default output filename if not specified
 	finalOutputFile := outputFile
@@ -218,13 +809,13 @@ func handleStandardMode(ampelPolicy *ampel.Policy, defaultOutputFile string) err
 	}
 
 	// Write to file
-	if err := os.WriteFile(finalOutputFile, ampelJSON, 0600); err != nil {
+	if err := ampel.WriteFileAtomic(finalOutputFile, ampelJSON, 0600); err != nil {
 		return fmt.Errorf("failed to write output file: %w", err)
 	}
 
-	fmt.Printf("Successfully wrote Ampel policy to %s\n", finalOutputFile)
-	fmt.Printf("Policy: %s\n", ampelPolicy.Id)
-	fmt.Printf("Tenets: %d\n", len(ampelPolicy.Tenets))
+	fmt.Fprintf(c.out, "Successfully wrote Ampel policy to %s\n", finalOutputFile)
+	fmt.Fprintf(c.out, "Policy: %s\n", ampelPolicy.Id)
+	fmt.Fprintf(c.out, "Tenets: %d\n", len(ampelPolicy.Tenets))
 
 	return nil
 }
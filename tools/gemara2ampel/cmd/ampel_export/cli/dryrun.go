@@ -0,0 +1,165 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"gemara2ampel/go/ampel"
+)
+
+// checkDryRunFlags validates --dry-run and --diff-format.
+func checkDryRunFlags() error {
+	if !dryRun {
+		return nil
+	}
+	if workspacePath == "" {
+		return fmt.Errorf("--dry-run requires --workspace")
+	}
+	switch diffFormat {
+	case "text", "unified", "json-patch":
+		return nil
+	default:
+		return fmt.Errorf("unsupported --diff-format %q (use text, unified or json-patch)", diffFormat)
+	}
+}
+
+// printMergeNotes prints the warnings, locked upstream changes and
+// conflicts of a dry-run merge to stderr, keeping stdout for the changes.
+func printMergeNotes(c *console, conflicts []ampel.MergeConflict, locked []ampel.LockedChange, warnings []string) {
+	for _, warning := range warnings {
+		fmt.Fprintf(c.err, "Warning: %s\n", warning)
+	}
+	reportLockedChanges(c, locked)
+	printConflicts(c, conflicts)
+}
+
+// printPolicyDryRun prints the changes writing merged over the workspace
+// policy file at path, holding existingData, would make. existing is the
+// parsed file, nil when missing or unreadable.
+func printPolicyDryRun(c *console, path string, existingData []byte, existing, merged *ampel.Policy, renames []ampel.TenetRename) error {
+	return printDryRun(c, path, existingData, merged, func(w io.Writer) {
+		writePolicyDiffText(w, ampel.DiffPolicies(existing, merged, renames), "")
+	})
+}
+
+// printPolicySetDryRun prints the changes writing merged over the workspace
+// PolicySet file at path would make, as printPolicyDryRun does. renames
+// lists the tenet renames of each member policy.
+func printPolicySetDryRun(c *console, path string, existingData []byte, existing, merged *ampel.PolicySet, renames map[string][]ampel.TenetRename) error {
+	return printDryRun(c, path, existingData, merged, func(w io.Writer) {
+		diff := ampel.DiffPolicySets(existing, merged, renames)
+		if diff.Empty() {
+			fmt.Fprintf(w, "PolicySet %s: no changes\n", diff.PolicySetID)
+			return
+		}
+		fmt.Fprintf(w, "PolicySet %s\n", diff.PolicySetID)
+		for _, id := range diff.PoliciesAdded {
+			fmt.Fprintf(w, "  Policy added: %s\n", id)
+		}
+		for _, id := range diff.PoliciesRemoved {
+			fmt.Fprintf(w, "  Policy removed: %s\n", id)
+		}
+		for _, change := range diff.Fields {
+			writeFieldChange(w, "  ", "Changed "+change.Field, change)
+		}
+		for _, policyDiff := range diff.Policies {
+			writePolicyDiffText(w, policyDiff, "  ")
+		}
+	})
+}
+
+// printDryRun prints the changes of a workspace file in the --diff-format
+// format: the semantic diff written by writeText, a unified diff of the
+// JSON file or an RFC 6902 JSON Patch.
+func printDryRun(c *console, path string, existingData []byte, document interface{}, writeText func(io.Writer)) error {
+	data, err := json.MarshalIndent(document, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to serialize policy: %w", err)
+	}
+
+	switch diffFormat {
+	case "unified":
+		oldName := path
+		if existingData == nil {
+			oldName = "/dev/null"
+		}
+		fmt.Fprint(c.out, ampel.UnifiedDiff(oldName, path, existingData, data))
+	case "json-patch":
+		ops, err := ampel.JSONPatch(existingData, data)
+		if err != nil {
+			return err
+		}
+		if ops == nil {
+			ops = []ampel.JSONPatchOperation{}
+		}
+		patch, err := json.MarshalIndent(ops, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to serialize JSON Patch: %w", err)
+		}
+		fmt.Fprintln(c.out, string(patch))
+	default:
+		writeText(c.out)
+	}
+	return nil
+}
+
+// writePolicyDiffText prints the semantic diff of a policy in
+// human-readable form.
+func writePolicyDiffText(w io.Writer, diff *ampel.PolicyDiff, indent string) {
+	if diff.Empty() {
+		fmt.Fprintf(w, "%sPolicy %s: no changes\n", indent, diff.PolicyID)
+		return
+	}
+	fmt.Fprintf(w, "%sPolicy %s\n", indent, diff.PolicyID)
+	indent += "  "
+
+	for _, id := range diff.TenetsAdded {
+		fmt.Fprintf(w, "%sTenet added: %s\n", indent, id)
+	}
+	for _, id := range diff.TenetsRemoved {
+		fmt.Fprintf(w, "%sTenet removed: %s\n", indent, id)
+	}
+	for _, tenet := range diff.Tenets {
+		if tenet.RenamedFrom != "" {
+			fmt.Fprintf(w, "%sTenet renamed: %s -> %s\n", indent, tenet.RenamedFrom, tenet.TenetID)
+		}
+		if len(tenet.Fields) == 0 {
+			continue
+		}
+		fmt.Fprintf(w, "%sTenet changed: %s\n", indent, tenet.TenetID)
+		for _, change := range tenet.Fields {
+			writeFieldChange(w, indent+"  ", change.Field, change)
+		}
+	}
+	for _, change := range diff.Context {
+		switch {
+		case change.New != "":
+			fmt.Fprintf(w, "%sContext added: %s = %s\n", indent, change.Key, change.New)
+		case change.Old != "":
+			fmt.Fprintf(w, "%sContext removed: %s\n", indent, change.Key)
+		}
+		for _, field := range change.Fields {
+			writeFieldChange(w, indent, "Context changed "+change.Key+" "+field.Field, field)
+		}
+	}
+	for _, change := range diff.Fields {
+		writeFieldChange(w, indent, "Changed "+change.Field, change)
+	}
+}
+
+// writeFieldChange prints a field change on one line, or as a line diff
+// when either value spans several lines, as CEL code does.
+func writeFieldChange(w io.Writer, indent, label string, change ampel.FieldChange) {
+	if !strings.Contains(change.Old, "\n") && !strings.Contains(change.New, "\n") {
+		fmt.Fprintf(w, "%s%s: %s -> %s\n", indent, label, valueOrNone(change.Old), valueOrNone(change.New))
+		return
+	}
+	fmt.Fprintf(w, "%s%s:\n", indent, label)
+	hunks := ampel.LineDiff(change.Old+"\n", change.New+"\n")
+	for _, line := range strings.SplitAfter(strings.TrimSuffix(hunks, "\n"), "\n") {
+		fmt.Fprintf(w, "%s  %s", indent, line)
+	}
+	fmt.Fprintln(w)
+}
@@ -0,0 +1,153 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"gemara2ampel/go/ampel"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	// Flags for the explain command
+	explainFormat string
+)
+
+// explainCmd prints the provenance of every tenet generated from a policy
+var explainCmd = &cobra.Command{
+	Use:   "explain <policy.yaml>",
+	Short: "Explain how each tenet of the generated policy was produced",
+	Long: `explain converts a Gemara policy without writing any output and reports,
+for every generated tenet, the source assessment plan and method, the matched
+evidence keywords, the chosen CEL template, the inferred predicate type, the
+substituted parameters, the catalog enrichment used and whether a fallback
+was hit.`,
+	Example: `  # Explain the generated tenets as text
+  ampel_export explain policy.yaml --catalog catalog.yaml
+
+  # Explain the generated tenets as JSON
+  ampel_export explain policy.yaml --format json`,
+	Args: cobra.ExactArgs(1),
+	RunE: runExplain,
+}
+
+func init() {
+	explainCmd.Flags().StringArrayVarP(&catalogPaths, "catalog", "c", nil, "catalog file path for enriching policy details (repeatable)")
+	explainCmd.Flags().BoolVar(&scopeFilters, "scope-filters", false, "include scope-based CEL filters in tenets")
+	explainCmd.Flags().StringVar(&paramConflicts, "param-conflicts", "first", "handling of parameters defined differently by several plans: first, namespace or fail")
+	explainCmd.Flags().StringVar(&explainFormat, "format", "text", "output format: text or json")
+
+	rootCmd.AddCommand(explainCmd)
+}
+
+func runExplain(cmd *cobra.Command, args []string) error {
+	if explainFormat != "text" && explainFormat != "json" {
+		return fmt.Errorf("unsupported format %q (use text or json)", explainFormat)
+	}
+
+	policy, err := loadGemaraPolicy(args[0])
+	if err != nil {
+		return err
+	}
+
+	transformOpts, err := buildTransformOptions()
+	if err != nil {
+		return err
+	}
+
+	trace := &ampel.PolicyTrace{}
+	transformOpts = append(transformOpts, ampel.WithTrace(trace))
+	if _, err := ampel.FromPolicy(policy, transformOpts...); err != nil {
+		return fmt.Errorf("failed to transform policy: %w", err)
+	}
+
+	if explainFormat == "json" {
+		traceJSON, err := json.MarshalIndent(trace, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to serialize trace: %w", err)
+		}
+		fmt.Println(string(traceJSON))
+		return nil
+	}
+
+	writeTraceText(os.Stdout, trace)
+	return nil
+}
+
+// writeTraceText prints a policy trace in human-readable form
+func writeTraceText(w io.Writer, trace *ampel.PolicyTrace) {
+	fmt.Fprintf(w, "Policy: %s\n", trace.PolicyID)
+	fmt.Fprintf(w, "Tenets: %d\n", len(trace.Tenets))
+
+	for _, t := range trace.Tenets {
+		fmt.Fprintf(w, "\nTenet %s\n", t.TenetID)
+		if t.PolicyID != trace.PolicyID {
+			fmt.Fprintf(w, "  Policy:         %s\n", t.PolicyID)
+		}
+		fmt.Fprintf(w, "  Source:         plan %s", t.PlanID)
+		if t.RequirementID != "" {
+			fmt.Fprintf(w, " (requirement %s)", t.RequirementID)
+		}
+		fmt.Fprintf(w, ", method %d (%s), automated method %d\n", t.MethodIndex, t.MethodType, t.TenetIndex)
+
+		keywords := "none"
+		if len(t.MatchedKeywords) > 0 {
+			keywords = strings.Join(t.MatchedKeywords, ", ")
+		}
+		fmt.Fprintf(w, "  Keywords:       %s\n", keywords)
+
+		switch t.TemplateSelection {
+		case ampel.TemplateFromEvidence:
+			fmt.Fprintf(w, "  Template:       %s (selected from evidence requirements)\n", t.Template)
+		case ampel.TemplateFromMethodType:
+			fmt.Fprintf(w, "  Template:       %s (default for method type %s)\n", t.Template, t.MethodType)
+		default:
+			fmt.Fprintln(w, "  Template:       none")
+		}
+
+		if t.PredicateType != "" {
+			fmt.Fprintf(w, "  Predicate type: %s (keyword %q)\n", t.PredicateType, t.PredicateKeyword)
+		} else {
+			fmt.Fprintln(w, "  Predicate type: none inferred")
+		}
+
+		if len(t.Parameters) == 0 {
+			fmt.Fprintln(w, "  Parameters:     none")
+		} else {
+			fmt.Fprintln(w, "  Parameters:")
+			for _, name := range t.ParameterNames() {
+				fmt.Fprintf(w, "    %s = %s\n", name, t.Parameters[name])
+			}
+		}
+
+		if t.ScopeFilter != "" {
+			fmt.Fprintf(w, "  Scope filter:   %s\n", t.ScopeFilter)
+		}
+
+		if t.Catalog != nil {
+			fmt.Fprintf(w, "  Catalog:        control %s, requirement %s, family %s (title from %s)\n",
+				valueOrNone(t.Catalog.ControlID), valueOrNone(t.Catalog.RequirementID),
+				valueOrNone(t.Catalog.FamilyID), t.Catalog.TitleSource)
+		} else {
+			fmt.Fprintln(w, "  Catalog:        not enriched")
+		}
+
+		if t.Fallback {
+			fmt.Fprintln(w, "  Fallback:       yes (no template available, basic CEL generated)")
+		} else {
+			fmt.Fprintln(w, "  Fallback:       no")
+		}
+	}
+}
+
+// valueOrNone returns "none" for empty strings
+func valueOrNone(value string) string {
+	if value == "" {
+		return "none"
+	}
+	return value
+}
@@ -0,0 +1,127 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"gemara2ampel/go/ampel"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	// Flags for the import command
+	importOutput    string
+	importWorkspace string
+	importForce     bool
+)
+
+// importCmd converts a hand-written Ampel policy into a Gemara policy skeleton
+var importCmd = &cobra.Command{
+	Use:   "import <ampel-policy.json>",
+	Short: "Create a Gemara policy skeleton from an existing Ampel policy",
+	Long: `import converts a hand-written Ampel policy into a Gemara Layer-3 policy
+with one assessment plan per tenet, parameters extracted from the context
+references in the CEL, evidence requirements from the predicate types and
+catalog references from the policy controls.
+
+With --workspace, the Ampel policy is also stored in the workspace under the
+tenet IDs the Gemara skeleton generates, so converting the skeleton in
+workspace mode keeps the hand-written CEL unchanged.`,
+	Example: `  # Create BP-01.01-require-pull-request.yaml
+  ampel_export import BP-01.01-require-pull-request.json
+
+  # Create the skeleton and seed a workspace, then regenerate
+  ampel_export import BP-01.01-require-pull-request.json -o bp-01.yaml -w ./policies
+  ampel_export bp-01.yaml -w ./policies`,
+	Args: cobra.ExactArgs(1),
+	RunE: runImport,
+}
+
+func init() {
+	importCmd.Flags().StringVarP(&importOutput, "output", "o", "", "output file path (default: input filename with .yaml extension)")
+	importCmd.Flags().StringVarP(&importWorkspace, "workspace", "w", "", "workspace directory to seed with the Ampel policy")
+	importCmd.Flags().BoolVar(&importForce, "force-overwrite", false, "overwrite the output file and an existing workspace policy")
+
+	rootCmd.AddCommand(importCmd)
+}
+
+func runImport(cmd *cobra.Command, args []string) error {
+	data, err := os.ReadFile(args[0])
+	if err != nil {
+		return fmt.Errorf("failed to read Ampel policy: %w", err)
+	}
+	var ampelPolicy ampel.Policy
+	if err := json.Unmarshal(data, &ampelPolicy); err != nil {
+		return fmt.Errorf("failed to parse Ampel policy JSON: %w", err)
+	}
+
+	gemaraPolicy, err := ampel.ToGemaraPolicy(&ampelPolicy)
+	if err != nil {
+		return fmt.Errorf("failed to convert policy: %w", err)
+	}
+
+	finalOutputFile := importOutput
+	if finalOutputFile == "" {
+		base := filepath.Base(args[0])
+		finalOutputFile = base[:len(base)-len(filepath.Ext(base))] + ".yaml"
+	}
+	if _, err := os.Stat(finalOutputFile); err == nil && !importForce {
+		return fmt.Errorf("output file %s already exists (use --force-overwrite to replace it)", finalOutputFile)
+	}
+
+	// Seed the workspace before writing the skeleton so a refused seed leaves
+	// nothing behind; the seed and skeleton are then committed together
+	var ws *ampel.Workspace
+	var tx *ampel.Transaction
+	if importWorkspace != "" {
+		if ws, err = ampel.NewWorkspace(importWorkspace, workspaceOptions()...); err != nil {
+			return fmt.Errorf("failed to create workspace: %w", err)
+		}
+		if tx, err = ws.Begin(); err != nil {
+			return err
+		}
+		defer tx.Abort()
+		if err := checkMigrated(ws); err != nil {
+			return err
+		}
+		if ws.PolicyExists(ampelPolicy.Id) && !importForce {
+			return fmt.Errorf("workspace already has policy %s (use --force-overwrite to replace it)", ampelPolicy.Id)
+		}
+		seed, err := ampel.AlignTenetIDs(&ampelPolicy, gemaraPolicy)
+		if err != nil {
+			return fmt.Errorf("failed to align tenet IDs: %w", err)
+		}
+		if err := ws.SavePolicy(seed.Id, seed); err != nil {
+			return err
+		}
+		// The seed is hand-written, so a base from an earlier generation does not apply
+		if err := ws.RemoveBase(seed.Id); err != nil {
+			return err
+		}
+		fmt.Printf("Seeded workspace policy: %s\n", ws.GetPolicyPath(seed.Id))
+	}
+
+	yamlData, err := ampel.MarshalGemaraPolicy(gemaraPolicy)
+	if err != nil {
+		return err
+	}
+	if ws != nil {
+		if err := ws.WriteFile(finalOutputFile, yamlData); err != nil {
+			return fmt.Errorf("failed to write output file: %w", err)
+		}
+		if _, err := tx.Commit(); err != nil {
+			return fmt.Errorf("failed to write workspace files: %w", err)
+		}
+	} else if err := ampel.WriteFileAtomic(finalOutputFile, yamlData, 0600); err != nil {
+		return fmt.Errorf("failed to write output file: %w", err)
+	}
+
+	fmt.Printf("Successfully wrote Gemara policy to %s\n", finalOutputFile)
+	fmt.Printf("Policy: %s\n", gemaraPolicy.Metadata.Id)
+	fmt.Printf("Assessment plans: %d\n", len(gemaraPolicy.Adherence.AssessmentPlans))
+
+	return nil
+}
@@ -0,0 +1,144 @@
+package cli
+
+import (
+	"fmt"
+	"slices"
+
+	"gemara2ampel/go/ampel"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	// Flags for the lock command
+	lockWorkspace string
+	lockOutput    string
+	lockTenets    []string
+	lockFields    []string
+	lockPolicy    string
+	lockReason    string
+	lockRemove    bool
+)
+
+// lockCmd pins tenets or tenet fields of a workspace policy
+var lockCmd = &cobra.Command{
+	Use:   "lock <policy-or-policyset-id>",
+	Short: "Lock tenets or tenet fields of a workspace policy against regeneration",
+	Long: `lock pins tenets maintained by hand, or some of their fields, to their
+content in the workspace. Locks are kept in the side-car <policy>.locks.yaml
+file next to the policy, which can also be edited directly.
+
+Workspace mode never overwrites or deletes locked content: locked fields keep
+their value without conflicts, and locked tenets no longer generated are kept.
+Upstream Gemara changes that would have affected locked content are reported
+on each run. --force-overwrite refuses to regenerate a policy with locks.
+
+Without --tenet, lock lists the locks of the policy. With --remove, it removes
+the locks of the given tenets, or every lock without --tenet.`,
+	Example: `  # Lock a whole tenet
+  ampel_export lock slsa-build-policy -w ./policies --tenet REQ-01-plan-01-0 --reason "maintained by the platform team"
+
+  # Lock the code and outputs of a tenet only
+  ampel_export lock slsa-build-policy -w ./policies --tenet REQ-01-plan-01-0 --field code --field outputs
+
+  # Remove the lock
+  ampel_export lock slsa-build-policy -w ./policies --tenet REQ-01-plan-01-0 --remove`,
+	Args: cobra.ExactArgs(1),
+	RunE: runLock,
+}
+
+func init() {
+	lockCmd.Flags().StringVarP(&lockWorkspace, "workspace", "w", "", "workspace directory of the policy (required)")
+	lockCmd.Flags().StringVarP(&lockOutput, "output", "o", "", "policy filename in the workspace, when converted with --output")
+	lockCmd.Flags().StringArrayVar(&lockTenets, "tenet", nil, "lock the tenet with this ID (repeatable)")
+	lockCmd.Flags().StringArrayVar(&lockFields, "field", nil, "lock only this tenet field: runtime, title, code, predicates, outputs, error or assessment (repeatable)")
+	lockCmd.Flags().StringVar(&lockPolicy, "policy", "", "member policy of the tenets, for PolicySets")
+	lockCmd.Flags().StringVar(&lockReason, "reason", "", "why the tenets are maintained by hand")
+	lockCmd.Flags().BoolVar(&lockRemove, "remove", false, "remove the locks instead of adding them")
+	_ = lockCmd.MarkFlagRequired("workspace")
+	lockCmd.MarkFlagsMutuallyExclusive("remove", "field")
+	lockCmd.MarkFlagsMutuallyExclusive("remove", "reason")
+
+	rootCmd.AddCommand(lockCmd)
+}
+
+func runLock(cmd *cobra.Command, args []string) error {
+	id := args[0]
+	ws, err := ampel.NewWorkspace(lockWorkspace, workspaceOptions()...)
+	if err != nil {
+		return fmt.Errorf("failed to open workspace: %w", err)
+	}
+	tx, err := ws.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Abort()
+	if err := checkMigrated(ws); err != nil {
+		return err
+	}
+
+	locks, err := ws.LoadLocks(id)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case lockRemove:
+		var remaining []ampel.TenetLock
+		for _, lock := range locks {
+			selected := len(lockTenets) == 0 || slices.Contains(lockTenets, lock.TenetID)
+			if selected && (lockPolicy == "" || lock.PolicyID == lockPolicy) {
+				fmt.Printf("Unlocked %s\n", lock)
+				continue
+			}
+			remaining = append(remaining, lock)
+		}
+		return saveLocks(ws, tx, id, remaining)
+
+	case len(lockTenets) == 0:
+		if len(locks) == 0 {
+			fmt.Printf("No locked tenets in %s\n", id)
+		}
+		for _, lock := range locks {
+			if lock.Reason != "" {
+				fmt.Printf("%s: %s\n", lock, lock.Reason)
+			} else {
+				fmt.Println(lock)
+			}
+		}
+		return nil
+	}
+
+	file, err := loadWorkspaceFile(ws, id, lockOutput)
+	if err != nil {
+		return err
+	}
+	for _, tenetID := range lockTenets {
+		if !file.hasTenet(lockPolicy, tenetID) {
+			return fmt.Errorf("tenet %s not found in %s", tenetID, file.path)
+		}
+		lock := ampel.TenetLock{PolicyID: lockPolicy, TenetID: tenetID, Fields: lockFields, Reason: lockReason}
+		if err := lock.Validate(); err != nil {
+			return err
+		}
+
+		// A new lock of a tenet replaces the previous one
+		locks = slices.DeleteFunc(locks, func(l ampel.TenetLock) bool {
+			return l.PolicyID == lock.PolicyID && l.TenetID == lock.TenetID
+		})
+		locks = append(locks, lock)
+		fmt.Printf("Locked %s\n", lock)
+	}
+	return saveLocks(ws, tx, id, locks)
+}
+
+// saveLocks saves the locks of a policy and commits them.
+func saveLocks(ws *ampel.Workspace, tx *ampel.Transaction, id string, locks []ampel.TenetLock) error {
+	if err := ws.SaveLocks(id, locks); err != nil {
+		return err
+	}
+	if _, err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to write workspace files: %w", err)
+	}
+	return nil
+}
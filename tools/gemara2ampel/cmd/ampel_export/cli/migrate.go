@@ -0,0 +1,99 @@
+package cli
+
+import (
+	"fmt"
+
+	"gemara2ampel/go/ampel"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	// Flags for the migrate command
+	migrateWorkspace string
+	migrateDryRun    bool
+)
+
+// migrateCmd renames workspace files to the current file name encoding
+var migrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "Rename the files of a workspace to the current policy file name encoding",
+	Long: `migrate renames the workspace files named after policy IDs, with their
+generation bases, archives, conflict and lock files, from the legacy file
+names to the current encoding, and indexes the file name of every policy.
+
+Legacy file names replaced '/', '\' and ':' in policy IDs with '-', so that
+IDs such as org/policy, org:policy and org-policy shared a file. Current file
+names escape those and other unsafe characters as %XX and are reversible.
+Workspace commands refuse workspaces with legacy file names until migrated.
+
+Files are told apart by the ID they contain; policy files written under a
+custom --output name are left alone. The migration is written as one
+generation, undone by ampel_export rollback.`,
+	Example: `  # List the files a migration would rename
+  ampel_export migrate -w ./policies --dry-run
+
+  # Migrate the workspace
+  ampel_export migrate -w ./policies`,
+	Args: cobra.NoArgs,
+	RunE: runMigrate,
+}
+
+func init() {
+	migrateCmd.Flags().StringVarP(&migrateWorkspace, "workspace", "w", "", "workspace directory (required)")
+	migrateCmd.Flags().BoolVar(&migrateDryRun, "dry-run", false, "list the files to rename without renaming them")
+	_ = migrateCmd.MarkFlagRequired("workspace")
+
+	rootCmd.AddCommand(migrateCmd)
+}
+
+func runMigrate(cmd *cobra.Command, args []string) error {
+	var migrations []ampel.FilenameMigration
+	if migrateDryRun {
+		ws := &ampel.Workspace{Path: migrateWorkspace}
+		var err error
+		if migrations, err = ws.PendingMigrations(); err != nil {
+			return err
+		}
+	} else {
+		ws, err := ampel.NewWorkspace(migrateWorkspace, workspaceOptions()...)
+		if err != nil {
+			return fmt.Errorf("failed to open workspace: %w", err)
+		}
+		if migrations, err = ws.MigrateFilenames(); err != nil {
+			return err
+		}
+	}
+
+	if len(migrations) == 0 {
+		fmt.Printf("Workspace %s uses the current file names\n", migrateWorkspace)
+		return nil
+	}
+	for _, migration := range migrations {
+		fmt.Printf("%s: %s -> %s\n", migration.ID, migration.From, migration.To)
+		for _, file := range migration.Files {
+			fmt.Printf("  %s\n", file)
+		}
+	}
+	if migrateDryRun {
+		fmt.Printf("%d policies to migrate\n", len(migrations))
+	} else {
+		fmt.Printf("Migrated %d policies\n", len(migrations))
+	}
+	return nil
+}
+
+// checkMigrated refuses workspaces with files still named by the legacy
+// file name encoding, whose policies would otherwise be generated afresh
+// next to their legacy files.
+func checkMigrated(ws *ampel.Workspace) error {
+	pending, err := ws.PendingMigrations()
+	if err != nil {
+		return err
+	}
+	if len(pending) > 0 {
+		return fmt.Errorf("workspace %s uses legacy file names for %d policies, such as %s for %s; run ampel_export migrate -w %s",
+			ws.Path, len(pending), pending[0].From+".json", pending[0].ID, ws.Path)
+	}
+	return nil
+}
@@ -0,0 +1,183 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"gemara2ampel/go/ampel"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	// Flags for the resolve command
+	resolveWorkspace string
+	resolveOutput    string
+	resolveTenet     string
+	resolvePolicy    string
+	resolveField     string
+	resolveOurs      bool
+	resolveTheirs    bool
+	resolveValue     string
+	resolveValueFile string
+)
+
+// resolveCmd resolves the merge conflicts recorded for a workspace policy
+var resolveCmd = &cobra.Command{
+	Use:   "resolve <policy-or-policyset-id>",
+	Short: "Resolve merge conflicts of a workspace policy",
+	Long: `resolve settles the conflicts recorded when workspace mode merged a
+tenet field that was edited both manually and by the generator. Conflicts are
+kept in the side-car file <policy>.conflicts next to the policy, with the
+manual (ours), previously generated (base) and newly generated (theirs)
+values between conflict markers. Conflicts of a PolicySet name the member
+policy of the tenet.
+
+Without a resolution flag, resolve lists the unresolved conflicts. --ours
+keeps the value of the ours section, which may be edited in the side-car
+file first, --theirs takes the generated value and --value or --value-file
+sets an edited value for a single conflict. Select conflicts with --tenet and
+--field.
+
+resolve exits with a non-zero status while any conflict is unresolved.`,
+	Example: `  # List the unresolved conflicts
+  ampel_export resolve slsa-build-policy -w ./policies
+
+  # Take the generated code of one tenet, keep the manual version of the rest
+  ampel_export resolve slsa-build-policy -w ./policies --tenet REQ-01-plan-01-0 --theirs
+  ampel_export resolve slsa-build-policy -w ./policies --ours
+
+  # Set an edited value
+  ampel_export resolve slsa-build-policy -w ./policies --tenet REQ-01-plan-01-0 --field code --value-file merged.cel`,
+	Args: cobra.ExactArgs(1),
+	RunE: runResolve,
+}
+
+func init() {
+	resolveCmd.Flags().StringVarP(&resolveWorkspace, "workspace", "w", "", "workspace directory of the policy (required)")
+	resolveCmd.Flags().StringVarP(&resolveOutput, "output", "o", "", "policy filename in the workspace, when converted with --output")
+	resolveCmd.Flags().StringVar(&resolveTenet, "tenet", "", "only resolve conflicts of this tenet ID")
+	resolveCmd.Flags().StringVar(&resolvePolicy, "policy", "", "only resolve conflicts of this PolicySet member policy ID")
+	resolveCmd.Flags().StringVar(&resolveField, "field", "", "only resolve conflicts of this tenet field")
+	resolveCmd.Flags().BoolVar(&resolveOurs, "ours", false, "keep the manual value (the ours section of the conflicts file)")
+	resolveCmd.Flags().BoolVar(&resolveTheirs, "theirs", false, "take the generated value")
+	resolveCmd.Flags().StringVar(&resolveValue, "value", "", "set this value for a single conflict")
+	resolveCmd.Flags().StringVar(&resolveValueFile, "value-file", "", "set the content of this file as value for a single conflict")
+	_ = resolveCmd.MarkFlagRequired("workspace")
+	resolveCmd.MarkFlagsMutuallyExclusive("ours", "theirs", "value", "value-file")
+
+	rootCmd.AddCommand(resolveCmd)
+}
+
+func runResolve(cmd *cobra.Command, args []string) error {
+	policyID := args[0]
+	ws, err := ampel.NewWorkspace(resolveWorkspace, workspaceOptions()...)
+	if err != nil {
+		return fmt.Errorf("failed to open workspace: %w", err)
+	}
+	tx, err := ws.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Abort()
+	if err := checkMigrated(ws); err != nil {
+		return err
+	}
+
+	conflicts, err := ws.LoadConflicts(policyID)
+	if err != nil {
+		return err
+	}
+	if len(conflicts) == 0 {
+		fmt.Printf("No unresolved conflicts in policy %s\n", policyID)
+		return nil
+	}
+
+	var selected, remaining []ampel.MergeConflict
+	for _, conflict := range conflicts {
+		if (resolveTenet == "" || conflict.TenetID == resolveTenet) && (resolveField == "" || conflict.Field == resolveField) &&
+			(resolvePolicy == "" || conflict.PolicyID == resolvePolicy) {
+			selected = append(selected, conflict)
+		} else {
+			remaining = append(remaining, conflict)
+		}
+	}
+
+	resolving := resolveOurs || resolveTheirs || cmd.Flags().Changed("value") || resolveValueFile != ""
+	if !resolving {
+		for _, conflict := range selected {
+			fmt.Printf("Conflict: %s\n", conflict)
+		}
+		return unresolvedConflictsError(ws, policyID, len(conflicts))
+	}
+	if len(selected) == 0 {
+		return fmt.Errorf("no conflict matches the selected tenet and field")
+	}
+
+	value, hasValue, err := resolveEditedValue(cmd, selected)
+	if err != nil {
+		return err
+	}
+
+	file, err := loadWorkspaceFile(ws, policyID, resolveOutput)
+	if err != nil {
+		return err
+	}
+
+	for _, conflict := range selected {
+		if !hasValue {
+			resolution := ampel.ResolveOurs
+			if resolveTheirs {
+				resolution = ampel.ResolveTheirs
+			}
+			if value, err = conflict.Resolution(resolution); err != nil {
+				return err
+			}
+		}
+		if err := file.resolveConflict(conflict, value); err != nil {
+			return fmt.Errorf("failed to resolve conflict %s: %w", conflict, err)
+		}
+		fmt.Printf("Resolved conflict: %s\n", conflict)
+	}
+
+	if err := file.save(ws); err != nil {
+		return err
+	}
+	if err := ws.SaveConflicts(policyID, remaining); err != nil {
+		return err
+	}
+	if _, err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to write workspace files: %w", err)
+	}
+
+	if len(remaining) > 0 {
+		return unresolvedConflictsError(ws, policyID, len(remaining))
+	}
+	fmt.Printf("All conflicts in policy %s are resolved\n", policyID)
+	return nil
+}
+
+// resolveEditedValue returns the value given with --value or --value-file,
+// which applies to a single conflict.
+func resolveEditedValue(cmd *cobra.Command, selected []ampel.MergeConflict) (string, bool, error) {
+	if !cmd.Flags().Changed("value") && resolveValueFile == "" {
+		return "", false, nil
+	}
+	if len(selected) != 1 {
+		return "", false, fmt.Errorf("an edited value applies to a single conflict, but %d match (select one with --tenet and --field)", len(selected))
+	}
+	if resolveValueFile == "" {
+		return resolveValue, true, nil
+	}
+	data, err := os.ReadFile(resolveValueFile)
+	if err != nil {
+		return "", false, fmt.Errorf("failed to read value file: %w", err)
+	}
+	return strings.TrimSuffix(string(data), "\n"), true, nil
+}
+
+// unresolvedConflictsError reports the conflicts left in a policy's side-car file.
+func unresolvedConflictsError(ws *ampel.Workspace, policyID string, count int) error {
+	return fmt.Errorf("%d unresolved merge conflict(s) in %s", count, ws.GetConflictsPath(policyID))
+}
@@ -0,0 +1,136 @@
+package cli
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	"gemara2ampel/go/ampel"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	// Flags for the restore command
+	restoreWorkspace string
+	restoreOutput    string
+	restoreTenets    []string
+	restoreAll       bool
+)
+
+// restoreCmd restores archived tenets into a workspace policy
+var restoreCmd = &cobra.Command{
+	Use:   "restore <policy-or-policyset-id>",
+	Short: "Restore archived tenets into a workspace policy",
+	Long: `restore adds tenets archived by workspace mode with --orphans archive back
+to their policy. Archived tenets are kept in .archive/<policy>.json in the
+workspace with the reason and time of their removal. Tenets archived from a
+PolicySet return to their member policy.
+
+Without --tenet or --all, restore lists the archived tenets. Restored tenets
+are marked as manual-only, so later merges keep them even though the Gemara
+policy no longer generates them. When a tenet was archived several times, the
+latest version is restored and all its archive entries are removed.`,
+	Example: `  # List the archived tenets
+  ampel_export restore slsa-build-policy -w ./policies
+
+  # Restore one tenet
+  ampel_export restore slsa-build-policy -w ./policies --tenet REQ-02-plan-02-0`,
+	Args: cobra.ExactArgs(1),
+	RunE: runRestore,
+}
+
+func init() {
+	restoreCmd.Flags().StringVarP(&restoreWorkspace, "workspace", "w", "", "workspace directory of the policy (required)")
+	restoreCmd.Flags().StringVarP(&restoreOutput, "output", "o", "", "policy filename in the workspace, when converted with --output")
+	restoreCmd.Flags().StringArrayVar(&restoreTenets, "tenet", nil, "restore the archived tenet with this ID (repeatable)")
+	restoreCmd.Flags().BoolVar(&restoreAll, "all", false, "restore every archived tenet")
+	_ = restoreCmd.MarkFlagRequired("workspace")
+	restoreCmd.MarkFlagsMutuallyExclusive("tenet", "all")
+
+	rootCmd.AddCommand(restoreCmd)
+}
+
+func runRestore(cmd *cobra.Command, args []string) error {
+	policyID := args[0]
+	ws, err := ampel.NewWorkspace(restoreWorkspace, workspaceOptions()...)
+	if err != nil {
+		return fmt.Errorf("failed to open workspace: %w", err)
+	}
+	tx, err := ws.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Abort()
+	if err := checkMigrated(ws); err != nil {
+		return err
+	}
+
+	archive, err := ws.LoadArchive(policyID)
+	if err != nil {
+		return err
+	}
+	if len(archive) == 0 {
+		fmt.Printf("No archived tenets in policy %s\n", policyID)
+		return nil
+	}
+
+	if !restoreAll && len(restoreTenets) == 0 {
+		for _, archived := range archive {
+			member := ""
+			if archived.PolicyID != "" {
+				member = " in policy " + archived.PolicyID
+			}
+			fmt.Printf("%s%s (archived %s): %s\n", archived.Tenet.GetId(), member, archived.ArchivedAt.Format(time.RFC3339), archived.Reason)
+		}
+		return nil
+	}
+
+	// Pick the latest archive entry of each selected tenet, per member policy
+	latest := make(map[[2]string]int)
+	archivedIDs := make(map[string]bool)
+	for i, archived := range archive {
+		if restoreAll || slices.Contains(restoreTenets, archived.Tenet.GetId()) {
+			latest[[2]string{archived.PolicyID, archived.Tenet.GetId()}] = i
+			archivedIDs[archived.Tenet.GetId()] = true
+		}
+	}
+	for _, id := range restoreTenets {
+		if !archivedIDs[id] {
+			return fmt.Errorf("tenet %s is not archived for policy %s", id, policyID)
+		}
+	}
+
+	file, err := loadWorkspaceFile(ws, policyID, restoreOutput)
+	if err != nil {
+		return err
+	}
+
+	// Older entries of a restored tenet are dropped with the restored one
+	var remaining []ampel.ArchivedTenet
+	for i, archived := range archive {
+		index, ok := latest[[2]string{archived.PolicyID, archived.Tenet.GetId()}]
+		if !ok {
+			remaining = append(remaining, archived)
+			continue
+		}
+		if index != i {
+			continue
+		}
+		if err := file.restoreTenet(archived); err != nil {
+			return fmt.Errorf("failed to restore tenet %s: %w", archived.Tenet.GetId(), err)
+		}
+		fmt.Printf("Restored tenet: %s\n", archived.Tenet.GetId())
+	}
+
+	if err := file.save(ws); err != nil {
+		return err
+	}
+	if err := ws.SaveArchive(policyID, remaining); err != nil {
+		return err
+	}
+	if _, err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to write workspace files: %w", err)
+	}
+	return nil
+}
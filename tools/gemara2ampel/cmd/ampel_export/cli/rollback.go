@@ -0,0 +1,103 @@
+package cli
+
+import (
+	"fmt"
+	"time"
+
+	"gemara2ampel/go/ampel"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	// Flags for the rollback command
+	rollbackWorkspace string
+	rollbackList      bool
+	rollbackForce     bool
+)
+
+// rollbackCmd restores the workspace files changed by the latest operation
+var rollbackCmd = &cobra.Command{
+	Use:   "rollback",
+	Short: "Restore the workspace files changed by the latest workspace operation",
+	Long: `rollback undoes the latest operation that wrote to the workspace: a
+conversion, a sync, an import or a resolve, restore or lock command. Every
+operation is committed as a generation, keeping the files it replaced in
+.backup/<generation> in the workspace. rollback restores those files, removes
+the files the operation created, and deletes the generation, so that each
+rollback steps one operation further back.
+
+The latest generations are kept, older ones are pruned. Files edited since
+the generation was committed are not overwritten unless --force is set.`,
+	Example: `  # List the generations that can be rolled back
+  ampel_export rollback -w ./policies --list
+
+  # Undo the latest sync
+  ampel_export rollback -w ./policies`,
+	Args: cobra.NoArgs,
+	RunE: runRollback,
+}
+
+func init() {
+	rollbackCmd.Flags().StringVarP(&rollbackWorkspace, "workspace", "w", "", "workspace directory (required)")
+	rollbackCmd.Flags().BoolVar(&rollbackList, "list", false, "list the generations, latest last, without rolling back")
+	rollbackCmd.Flags().BoolVar(&rollbackForce, "force", false, "restore files edited since the generation was committed")
+	_ = rollbackCmd.MarkFlagRequired("workspace")
+	rollbackCmd.MarkFlagsMutuallyExclusive("list", "force")
+
+	rootCmd.AddCommand(rollbackCmd)
+}
+
+func runRollback(cmd *cobra.Command, args []string) error {
+	ws, err := ampel.NewWorkspace(rollbackWorkspace, workspaceOptions()...)
+	if err != nil {
+		return fmt.Errorf("failed to open workspace: %w", err)
+	}
+
+	if rollbackList {
+		generations, err := ws.Generations()
+		if err != nil {
+			return err
+		}
+		if len(generations) == 0 {
+			fmt.Printf("No generation in %s\n", ws.Path)
+		}
+		for _, generation := range generations {
+			fmt.Printf("%s  %s  %d files\n", generation.ID, generation.Time.Local().Format(time.DateTime), len(generation.Files))
+			for _, file := range generation.Files {
+				fmt.Printf("  %-9s %s\n", fileAction(file), file.Path)
+			}
+		}
+		return nil
+	}
+
+	generation, err := ws.Rollback(rollbackForce)
+	if err != nil {
+		return err
+	}
+	if generation == nil {
+		fmt.Printf("Nothing to roll back in %s\n", ws.Path)
+		return nil
+	}
+	for _, file := range generation.Files {
+		if file.Existed {
+			fmt.Printf("Restored %s\n", file.Path)
+		} else {
+			fmt.Printf("Removed %s\n", file.Path)
+		}
+	}
+	fmt.Printf("Rolled back generation %s (%s)\n", generation.ID, generation.Time.Local().Format(time.DateTime))
+	return nil
+}
+
+// fileAction describes how a generation changed a file.
+func fileAction(file ampel.BackupFile) string {
+	switch {
+	case !file.Existed:
+		return "created"
+	case file.Digest == "":
+		return "removed"
+	default:
+		return "modified"
+	}
+}
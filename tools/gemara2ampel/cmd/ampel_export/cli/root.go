@@ -1,13 +1,17 @@
 package cli
 
 import (
+	"time"
+
+	"gemara2ampel/go/ampel"
+
 	"github.com/spf13/cobra"
 )
 
 var (
 	// Flags for policy conversion
 	outputFile       string
-	catalogPath      string
+	catalogPaths     []string
 	scopeFilters     bool
 	policySet        bool
 	policySetName    string
@@ -15,13 +19,33 @@ var (
 	policySetVersion string
 	workspacePath    string
 	forceOverwrite   bool
+	resolveImports   bool
+	importMirror     string
+	importRepo       string
+	importRevision   string
+	failOn           string
+	paramConflicts   string
+	setValues        []string
+	valuesFile       string
+	frameworkNames   []string
+	policySetMeta    []string
+	hoistContext     bool
+	mergeStrategies  []string
+	orphanMode       string
+	renameThreshold  float64
+	dryRun           bool
+	diffFormat       string
+	lockTimeout      time.Duration
 )
 
+// version is the ampel_export version, recorded in workspace manifests
+const version = "1.0.0"
+
 // rootCmd represents the base command when called without any subcommands
 var rootCmd = &cobra.Command{
 	Use:     "ampel_export <policy.yaml>",
 	Short:   "Convert Gemara policies to Ampel verification policies",
-	Version: "1.0.0",
+	Version: version,
 	Long: `ampel_export converts Gemara Layer-3 policies to Ampel verification policy format.
 
 Ampel policies use CEL (Common Expression Language) to verify attestations
@@ -32,14 +56,29 @@ in the in-toto format, ensuring supply chain security requirements are met.`,
   # Generate with custom output file
   ampel_export policy.yaml -o custom-name.json --catalog catalog.yaml
 
+  # Enrich from several catalogs (plans may use catalog-id:requirement-id)
+  ampel_export policy.yaml -c osps-baseline.yaml -c slsa.yaml
+
   # Generate a PolicySet
   ampel_export policy.yaml --policyset
 
+  # Generate a PolicySet with imported policies converted inline
+  ampel_export policy.yaml --policyset --resolve-imports --import-mirror ./mirror
+
+  # Choose a non-default accepted value for a parameter
+  ampel_export policy.yaml --set builder-id=https://gitlab.com/runner --values values.yaml
+
   # Workspace mode: preserve manual CEL edits on regeneration
   ampel_export policy.yaml -w ./policies
 
+  # Review what regeneration would change in the workspace
+  ampel_export policy.yaml -w ./policies --dry-run --diff-format unified
+
   # Force regeneration, discarding manual changes
-  ampel_export policy.yaml -w ./policies --force-overwrite`,
+  ampel_export policy.yaml -w ./policies --force-overwrite
+
+  # Explain how each tenet was generated
+  ampel_export explain policy.yaml`,
 	Args: cobra.ExactArgs(1),
 	RunE: runConvert,
 }
@@ -50,20 +89,54 @@ func Execute() error {
 }
 
 func init() {
-	// Output and workspace flags
 	rootCmd.Flags().StringVarP(&outputFile, "output", "o", "", "output file path (default: input filename with .json extension)")
-	rootCmd.Flags().StringVarP(&workspacePath, "workspace", "w", "", "workspace directory for policy management with merge support")
-	rootCmd.Flags().BoolVar(&forceOverwrite, "force-overwrite", false, "force regeneration, discard manual changes (use with -w)")
-
-	// Catalog and options
-	rootCmd.Flags().StringVarP(&catalogPath, "catalog", "c", "", "catalog file path for enriching policy details")
-	rootCmd.Flags().BoolVar(&scopeFilters, "scope-filters", false, "include scope-based CEL filters in tenets")
+	addWorkspaceFlags(rootCmd)
+	addTransformFlags(rootCmd)
 
-	// PolicySet flags
-	rootCmd.Flags().BoolVar(&policySet, "policyset", false, "generate a PolicySet with imports as external references")
+	// PolicySet metadata flags
 	rootCmd.Flags().StringVar(&policySetName, "policyset-name", "", "name for the PolicySet (only used with --policyset)")
 	rootCmd.Flags().StringVar(&policySetDesc, "policyset-description", "", "description for the PolicySet (only used with --policyset)")
 	rootCmd.Flags().StringVar(&policySetVersion, "policyset-version", "", "version for the PolicySet (only used with --policyset)")
+	addPolicySetFlags(rootCmd)
+
+	// Workspace lock flags, shared by every command writing to a workspace
+	rootCmd.PersistentFlags().DurationVar(&lockTimeout, "lock-timeout", 30*time.Second, "how long to wait for a workspace locked by another process, 0 to fail at once")
+}
+
+// addWorkspaceFlags adds the workspace and merge flags to cmd.
+func addWorkspaceFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVarP(&workspacePath, "workspace", "w", "", "workspace directory for policy management with merge support")
+	cmd.Flags().BoolVar(&forceOverwrite, "force-overwrite", false, "force regeneration, discard manual changes (use with -w)")
+	cmd.Flags().StringArrayVar(&mergeStrategies, "merge-strategy", nil, "merge strategy of a field as tenet.field=strategy or policy.field=strategy, with strategy manual, three-way, generated or union (repeatable, use with -w)")
+	cmd.Flags().StringVar(&orphanMode, "orphans", "delete", "handling of tenets no longer generated: delete, keep (marked manual-only) or archive to .archive/ (use with -w)")
+	cmd.Flags().Float64Var(&renameThreshold, "rename-threshold", ampel.DefaultRenameThreshold, "similarity from 0 to 1 from which a tenet no longer generated is taken as renamed to a new tenet, above 1 to disable (use with -w)")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "print what workspace mode would change without writing any file (use with -w)")
+	cmd.Flags().StringVar(&diffFormat, "diff-format", "text", "format of the --dry-run changes: text, unified (diff of the policy file) or json-patch (RFC 6902)")
+}
+
+// addTransformFlags adds the catalog and transformation flags to cmd.
+func addTransformFlags(cmd *cobra.Command) {
+	cmd.Flags().StringArrayVarP(&catalogPaths, "catalog", "c", nil, "catalog file path for enriching policy details (repeatable)")
+	cmd.Flags().StringArrayVar(&frameworkNames, "framework-name", nil, "framework name for a catalog guideline mapping reference as reference-id=name, empty to omit it (repeatable)")
+	cmd.Flags().BoolVar(&scopeFilters, "scope-filters", false, "include scope-based CEL filters in tenets")
+	cmd.Flags().StringVar(&paramConflicts, "param-conflicts", "first", "handling of parameters defined differently by several plans: first, namespace or fail")
+	cmd.Flags().StringArrayVar(&setValues, "set", nil, "set a context value as param=value, overriding the first accepted value (repeatable)")
+	cmd.Flags().StringVar(&valuesFile, "values", "", "YAML file mapping parameter IDs or context keys to context values")
+	cmd.Flags().StringVar(&failOn, "fail-on", "error", "fail without writing output on diagnostics at or above this severity: info, warning, error or none")
+}
+
+// addPolicySetFlags adds the PolicySet generation and import resolution
+// flags to cmd.
+func addPolicySetFlags(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&policySet, "policyset", false, "generate a PolicySet with imports as external references")
+	cmd.Flags().StringArrayVar(&policySetMeta, "policyset-meta", nil, "PolicySet meta field as key=value: runtime, enforce, expiration or origin (repeatable, only used with --policyset)")
+	cmd.Flags().BoolVar(&hoistContext, "hoist-context", false, "move context entries shared identically by member policies into the PolicySet common context (only used with --policyset)")
+
+	// Import resolution flags
+	cmd.Flags().BoolVar(&resolveImports, "resolve-imports", false, "load imported policies and convert them inline (only used with --policyset)")
+	cmd.Flags().StringVar(&importMirror, "import-mirror", "", "local mirror directory for remote policy imports (use with --resolve-imports)")
+	cmd.Flags().StringVar(&importRepo, "import-repo", "", "local git repository to read policy imports from (use with --resolve-imports)")
+	cmd.Flags().StringVar(&importRevision, "import-revision", "HEAD", "git revision to read policy imports at (use with --import-repo)")
 }
 
 func runConvert(cmd *cobra.Command, args []string) error {
@@ -71,5 +144,5 @@ func runConvert(cmd *cobra.Command, args []string) error {
 
 	// Import the export package functionality
 	// We'll call the actual conversion logic here
-	return convertPolicy(policyPath)
+	return finishWorkspace(convertPolicy(stdConsole, policyPath))
 }
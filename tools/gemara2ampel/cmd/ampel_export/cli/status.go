@@ -0,0 +1,171 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	"gemara2ampel/go/ampel"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	// Flags for the status command
+	statusWorkspace string
+	statusFormat    string
+	statusFailOn    []string
+)
+
+// statusCmd reports the drift of workspace policies from their sources
+var statusCmd = &cobra.Command{
+	Use:   "status [source-dir]",
+	Short: "Report workspace policies out of date with their sources or edited by hand",
+	Long: `status compares the outputs recorded in the workspace manifest with the
+current workspace files and Gemara sources, and classifies each output as:
+
+  up-to-date     unchanged, as are its sources
+  stale          its Gemara policy, values file, catalogs, the CEL template
+                 library or the tool version changed since its generation
+  hand-modified  its file was edited since its generation in a way the
+                 next sync would drop, such as hand-added tenets or
+                 edits of fields following the generator
+  orphaned       its Gemara policy no longer exists
+  missing        its file is gone, or, with a source directory, a Gemara
+                 policy of the directory was never converted
+
+Sources are compared as recorded: catalogs added to a source tree since the
+last conversion are picked up by sync, not reported here.
+
+Edits kept by the merge, such as CEL code, are not reported. The merge uses
+the --orphans mode and --merge-strategy settings recorded by the last
+conversion. Outputs without a recorded generation base are hand-modified on
+any edit.
+
+status exits non-zero when an output is in a --fail-on state, by default
+stale, orphaned or missing, to gate CI on workspaces kept in sync.`,
+	Example: `  # Report the state of every workspace policy
+  ampel_export status -w ./policies
+
+  # Also report the Gemara policies of ./gemara never converted
+  ampel_export status ./gemara -w ./policies
+
+  # Fail only on outputs out of date with their sources
+  ampel_export status -w ./policies --fail-on stale --fail-on missing`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: runStatus,
+}
+
+func init() {
+	statusCmd.Flags().StringVarP(&statusWorkspace, "workspace", "w", "", "workspace directory (required)")
+	statusCmd.Flags().StringVar(&statusFormat, "format", "text", "output format: text or json")
+	statusCmd.Flags().StringArrayVar(&statusFailOn, "fail-on", []string{"stale", "orphaned", "missing"},
+		"exit non-zero when an output is in this state: up-to-date, stale, hand-modified, orphaned, missing or none (repeatable)")
+	_ = statusCmd.MarkFlagRequired("workspace")
+
+	rootCmd.AddCommand(statusCmd)
+}
+
+func runStatus(cmd *cobra.Command, args []string) error {
+	if statusFormat != "text" && statusFormat != "json" {
+		return fmt.Errorf("unsupported format %q (use text or json)", statusFormat)
+	}
+	var failStates []ampel.OutputState
+	for _, name := range statusFailOn {
+		if name == "none" {
+			continue
+		}
+		state, err := ampel.ParseOutputState(name)
+		if err != nil {
+			return fmt.Errorf("invalid --fail-on value: %w", err)
+		}
+		failStates = append(failStates, state)
+	}
+	// A gate failure is a result, not a usage error
+	cmd.SilenceUsage = true
+
+	ws := &ampel.Workspace{Path: statusWorkspace}
+	statuses, err := ws.Status(ampel.TemplateDigest(ampel.DefaultCELTemplates), version)
+	if err != nil {
+		return err
+	}
+
+	if len(args) == 1 {
+		tree, err := ampel.ScanSources(args[0], ws.Path)
+		if err != nil {
+			return err
+		}
+		untracked, err := ws.UntrackedSources(tree.Policies)
+		if err != nil {
+			return err
+		}
+		for _, path := range untracked {
+			id := path
+			if policy, err := loadGemaraPolicy(path); err == nil && policy.Metadata.Id != "" {
+				id = policy.Metadata.Id
+			}
+			statuses = append(statuses, ampel.OutputStatus{
+				ID:      id,
+				Source:  path,
+				States:  []ampel.OutputState{ampel.OutputMissing},
+				Reasons: []string{"never generated from " + path},
+			})
+		}
+	}
+
+	if statusFormat == "json" {
+		if statuses == nil {
+			statuses = []ampel.OutputStatus{}
+		}
+		statusJSON, err := json.MarshalIndent(statuses, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to serialize status: %w", err)
+		}
+		fmt.Println(string(statusJSON))
+	} else {
+		printStatusText(statuses)
+	}
+
+	failing := 0
+	for _, status := range statuses {
+		if slices.ContainsFunc(failStates, status.Has) {
+			failing++
+		}
+	}
+	if failing > 0 {
+		names := make([]string, len(failStates))
+		for i, state := range failStates {
+			names[i] = string(state)
+		}
+		list := strings.Join(names, " or ")
+		if len(names) > 2 {
+			list = strings.Join(names[:len(names)-1], ", ") + " or " + names[len(names)-1]
+		}
+		return fmt.Errorf("%d of %d outputs are %s", failing, len(statuses), list)
+	}
+	return nil
+}
+
+// printStatusText prints the state of each output with the reasons, then
+// the number of outputs in each state.
+func printStatusText(statuses []ampel.OutputStatus) {
+	counts := make(map[ampel.OutputState]int)
+	for _, status := range statuses {
+		states := make([]string, len(status.States))
+		for i, state := range status.States {
+			states[i] = string(state)
+			counts[state]++
+		}
+		fmt.Printf("%-26s %s\n", strings.Join(states, ","), status.ID)
+		for _, reason := range status.Reasons {
+			fmt.Printf("  %s\n", reason)
+		}
+	}
+
+	summary := make([]string, len(ampel.OutputStates))
+	for i, state := range ampel.OutputStates {
+		summary[i] = fmt.Sprintf("%d %s", counts[state], state)
+	}
+	fmt.Printf("%d outputs: %s\n", len(statuses), strings.Join(summary, ", "))
+}
@@ -0,0 +1,297 @@
+package cli
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"gemara2ampel/go/ampel"
+
+	"github.com/gemaraproj/go-gemara"
+	"github.com/spf13/cobra"
+)
+
+var (
+	// Flags for the sync command
+	syncJobs      int
+	syncKeepGoing bool
+	syncAll       bool
+)
+
+// Sync outcomes of a policy
+const (
+	syncUpToDate    = "up to date"
+	syncRegenerated = "regenerated"
+	syncConflicts   = "conflicts"
+	syncStale       = "stale"
+	syncFailed      = "failed"
+	syncSkipped     = "skipped"
+	syncDiscarded   = "discarded"
+)
+
+// syncCmd regenerates the stale policies of a workspace from a source tree
+var syncCmd = &cobra.Command{
+	Use:   "sync <source-dir>",
+	Short: "Regenerate the stale policies of a workspace from a directory of Gemara policies",
+	Long: `sync scans a directory tree for Gemara policies and catalogs and regenerates
+into the workspace every policy that is stale: never generated, with its
+output missing, or with a policy, values file, catalog, CEL template library
+or tool version different from the ones recorded in the workspace manifest.
+Stale policies are converted and merged as by ampel_export -w, several at a
+time, with every catalog of the tree and of --catalog.
+
+Policies and catalogs are told apart by their top-level fields; other YAML
+files, hidden directories and the workspace itself are skipped. Policies are
+written under their default workspace file names.
+
+The workspace files of a sync are written together once the conversions
+are done. By default a sync is all or nothing: it stops starting conversions
+after the first failure and writes no file when any policy fails. With
+--keep-going it converts every stale policy, writes the policies that
+succeeded and fails at the end, listing the failed ones. A failed policy
+writes none of its files. Merge conflicts are written for resolution and
+reported at the end. ampel_export rollback undoes a sync.`,
+	Example: `  # Regenerate the stale policies of ./policies from ./gemara
+  ampel_export sync ./gemara -w ./policies
+
+  # Regenerate PolicySets, reporting every failure
+  ampel_export sync ./gemara -w ./policies --policyset --keep-going
+
+  # Review what a sync would change
+  ampel_export sync ./gemara -w ./policies --dry-run`,
+	Args: cobra.ExactArgs(1),
+	RunE: runSync,
+}
+
+func init() {
+	addWorkspaceFlags(syncCmd)
+	addTransformFlags(syncCmd)
+	addPolicySetFlags(syncCmd)
+	syncCmd.Flags().IntVarP(&syncJobs, "jobs", "j", runtime.GOMAXPROCS(0), "number of policies converted concurrently")
+	syncCmd.Flags().BoolVar(&syncKeepGoing, "keep-going", false, "keep converting the other policies after a failure and write the ones that succeed")
+	syncCmd.Flags().BoolVar(&syncAll, "all", false, "regenerate up-to-date policies too")
+	_ = syncCmd.MarkFlagRequired("workspace")
+
+	rootCmd.AddCommand(syncCmd)
+}
+
+// syncResult is the outcome of syncing one Gemara policy.
+type syncResult struct {
+	path    string
+	id      string
+	policy  *gemara.Policy
+	reasons []string
+	status  string
+	err     error
+}
+
+func runSync(cmd *cobra.Command, args []string) error {
+	sourceDir := args[0]
+	if syncJobs < 1 {
+		return fmt.Errorf("--jobs must be at least 1")
+	}
+	if err := checkDryRunFlags(); err != nil {
+		return err
+	}
+	if _, err := buildMergeOptions(); err != nil {
+		return err
+	}
+	// Failures from here on are reported per policy, not as usage errors
+	cmd.SilenceUsage = true
+
+	ws, err := openWorkspace()
+	if err != nil {
+		return err
+	}
+	defer abortWorkspace()
+	tree, err := ampel.ScanSources(sourceDir, ws.Path)
+	if err != nil {
+		return err
+	}
+	if len(tree.Policies) == 0 {
+		return fmt.Errorf("no Gemara policy found in %s", sourceDir)
+	}
+	catalogPaths = appendNewPaths(catalogPaths, tree.Catalogs)
+
+	transformOpts, err := buildTransformOptions()
+	if err != nil {
+		return err
+	}
+	manifest, err := ws.LoadManifest()
+	if err != nil {
+		return err
+	}
+
+	// Find the stale policies, refusing sources that generate the same output
+	results := make([]syncResult, len(tree.Policies))
+	sources := make(map[string]string, len(tree.Policies))
+	var stale []int
+	for i, path := range tree.Policies {
+		result := &results[i]
+		result.path = path
+		if result.policy, err = loadGemaraPolicy(path); err != nil {
+			if !syncKeepGoing {
+				return fmt.Errorf("%s: %w", path, err)
+			}
+			result.status, result.err = syncFailed, err
+			continue
+		}
+
+		result.id = result.policy.Metadata.Id
+		if policySet {
+			result.id = ampel.DefaultPolicySetID(result.policy)
+		}
+		if other, ok := sources[result.id]; ok {
+			return fmt.Errorf("%s and %s both generate %s", other, path, result.id)
+		}
+		sources[result.id] = path
+
+		inputs, err := manifestInputs(ws, path)
+		if err != nil {
+			return err
+		}
+		result.reasons = ws.StaleReasons(manifest.Entry(result.id), inputs)
+		if len(result.reasons) == 0 && !syncAll {
+			result.status = syncUpToDate
+			continue
+		}
+		stale = append(stale, i)
+	}
+
+	fmt.Printf("Syncing %d policies from %s into %s: %d stale\n", len(results), sourceDir, ws.Path, len(stale))
+
+	// Convert the stale policies, printing each report once complete
+	var (
+		printMu sync.Mutex
+		stop    atomic.Bool
+		wg      sync.WaitGroup
+	)
+	work := make(chan *syncResult)
+	for range min(syncJobs, len(stale)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for result := range work {
+				if stop.Load() {
+					result.status = syncSkipped
+					continue
+				}
+
+				var out, errOut bytes.Buffer
+				c := &console{out: &out, err: &errOut}
+				result.err = convertGemaraPolicy(c, result.path, result.policy, transformOpts, getDefaultOutputFilename(result.path))
+				var pending *pendingConflictsError
+				switch {
+				case errors.As(result.err, &pending):
+					result.status = syncConflicts
+				case result.err != nil:
+					result.status = syncFailed
+					if !syncKeepGoing {
+						stop.Store(true)
+					}
+				case dryRun:
+					result.status = syncStale
+				default:
+					result.status = syncRegenerated
+				}
+
+				printMu.Lock()
+				printSyncReport(result, &out, &errOut)
+				printMu.Unlock()
+			}
+		}()
+	}
+	for _, i := range stale {
+		work <- &results[i]
+	}
+	close(work)
+	wg.Wait()
+
+	// Write every regenerated policy or, when a policy failed, none of them
+	// unless --keep-going is set
+	counts := make(map[string]int)
+	for _, result := range results {
+		counts[result.status]++
+	}
+	var batchErr error
+	switch {
+	case counts[syncFailed] > 0 && !syncKeepGoing:
+		batchErr = fmt.Errorf("%d of %d policies failed to sync, no workspace file was written", counts[syncFailed], len(results))
+		for i := range results {
+			if results[i].status == syncRegenerated || results[i].status == syncConflicts {
+				results[i].status = syncDiscarded
+			}
+		}
+	case counts[syncConflicts] > 0:
+		batchErr = &pendingConflictsError{message: fmt.Sprintf("%d of %d policies have merge conflicts to resolve", counts[syncConflicts], len(results))}
+	}
+	if err := finishWorkspace(batchErr); err != batchErr {
+		return err
+	}
+
+	printSyncSummary(results)
+	if counts[syncFailed] > 0 && syncKeepGoing {
+		return fmt.Errorf("%d of %d policies failed to sync", counts[syncFailed], len(results))
+	}
+	return batchErr
+}
+
+// printSyncReport prints the conversion report of a policy under a header
+// naming it and why it was stale.
+func printSyncReport(result *syncResult, out, errOut *bytes.Buffer) {
+	fmt.Printf("\n==> %s (%s)\n", result.id, result.path)
+	if len(result.reasons) > 0 {
+		fmt.Printf("Stale: %s\n", strings.Join(result.reasons, "; "))
+	}
+	fmt.Print(out.String())
+	stdConsole.err.Write(errOut.Bytes())
+	if result.err != nil {
+		fmt.Fprintf(stdConsole.err, "Error: %v\n", result.err)
+	}
+}
+
+// printSyncSummary prints the outcome of every policy in source order.
+func printSyncSummary(results []syncResult) {
+	counts := make(map[string]int)
+	fmt.Println("\nSummary:")
+	for _, result := range results {
+		counts[result.status]++
+		name := result.id
+		if name == "" {
+			name = "-"
+		}
+		fmt.Printf("  %-12s %s (%s)\n", result.status, name, result.path)
+	}
+
+	changed := fmt.Sprintf("%d regenerated", counts[syncRegenerated])
+	if dryRun {
+		changed = fmt.Sprintf("%d stale", counts[syncStale])
+	}
+	fmt.Printf("Synced %d policies: %s, %d with conflicts, %d up to date, %d failed, %d skipped, %d discarded\n",
+		len(results), changed, counts[syncConflicts], counts[syncUpToDate], counts[syncFailed], counts[syncSkipped], counts[syncDiscarded])
+}
+
+// appendNewPaths appends to paths the added paths not already listed,
+// comparing absolute paths.
+func appendNewPaths(paths, added []string) []string {
+	seen := make(map[string]bool, len(paths))
+	for _, path := range paths {
+		if abs, err := filepath.Abs(path); err == nil {
+			seen[abs] = true
+		}
+	}
+	for _, path := range added {
+		abs, err := filepath.Abs(path)
+		if err == nil && seen[abs] {
+			continue
+		}
+		seen[abs] = true
+		paths = append(paths, path)
+	}
+	return paths
+}
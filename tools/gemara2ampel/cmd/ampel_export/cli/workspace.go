@@ -0,0 +1,104 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"gemara2ampel/go/ampel"
+)
+
+var (
+	// workspace is the --workspace directory opened by openWorkspace,
+	// shared by the conversions of a run, and workspaceTx the transaction
+	// staging their writes
+	workspace   *ampel.Workspace
+	workspaceTx *ampel.Transaction
+	workspaceMu sync.Mutex
+)
+
+// openWorkspace opens the --workspace directory, creating it unless in
+// --dry-run mode, which writes nothing. The conversions of a run share the
+// workspace and stage their writes in a transaction that finishWorkspace
+// commits, so that a failed run leaves every file unchanged.
+func openWorkspace() (*ampel.Workspace, error) {
+	workspaceMu.Lock()
+	defer workspaceMu.Unlock()
+	if workspace != nil {
+		return workspace, nil
+	}
+
+	if dryRun {
+		ws := &ampel.Workspace{Path: workspacePath}
+		if err := checkMigrated(ws); err != nil {
+			return nil, err
+		}
+		workspace = ws
+		return workspace, nil
+	}
+	ws, err := ampel.NewWorkspace(workspacePath, workspaceOptions()...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create workspace: %w", err)
+	}
+	tx, err := ws.Begin()
+	if err != nil {
+		return nil, err
+	}
+	if err := checkMigrated(ws); err != nil {
+		tx.Abort()
+		return nil, err
+	}
+	workspace, workspaceTx = ws, tx
+	return workspace, nil
+}
+
+// finishWorkspace ends the workspace transaction of a run that returned
+// err: the staged files are committed when err is nil or only reports merge
+// conflicts left to resolve, and discarded otherwise. Returns err, or the
+// commit error.
+func finishWorkspace(err error) error {
+	workspaceMu.Lock()
+	defer workspaceMu.Unlock()
+	if workspaceTx == nil {
+		return err
+	}
+	tx := workspaceTx
+	workspaceTx = nil
+
+	var pending *pendingConflictsError
+	if err != nil && !errors.As(err, &pending) {
+		tx.Abort()
+		return err
+	}
+	if _, commitErr := tx.Commit(); commitErr != nil {
+		return fmt.Errorf("failed to write workspace files: %w", commitErr)
+	}
+	return err
+}
+
+// abortWorkspace discards the files staged by a run that ends before
+// finishWorkspace, releasing the workspace lock.
+func abortWorkspace() {
+	workspaceMu.Lock()
+	defer workspaceMu.Unlock()
+	if workspaceTx != nil {
+		workspaceTx.Abort()
+		workspaceTx = nil
+	}
+}
+
+// workspaceOptions returns the workspace options of the lock flags.
+func workspaceOptions() []ampel.WorkspaceOption {
+	return []ampel.WorkspaceOption{ampel.WithLockTimeout(lockTimeout)}
+}
+
+// pendingConflictsError reports merge conflicts written to the workspace
+// for resolution. Unlike other errors, it does not discard the files of the
+// conversion.
+type pendingConflictsError struct {
+	message string
+}
+
+func (e *pendingConflictsError) Error() string {
+	return e.message
+}
@@ -0,0 +1,122 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"gemara2ampel/go/ampel"
+)
+
+// workspaceFile is a policy or PolicySet file of a workspace, with its
+// generation base, edited by the resolve and restore commands.
+type workspaceFile struct {
+	id            string
+	path          string
+	policy        *ampel.Policy
+	policySet     *ampel.PolicySet
+	base          *ampel.Policy
+	policySetBase *ampel.PolicySet
+}
+
+// loadWorkspaceFile reads the workspace file of a policy or PolicySet ID and
+// its generation base.
+func loadWorkspaceFile(ws *ampel.Workspace, id, output string) (*workspaceFile, error) {
+	file := &workspaceFile{id: id, path: workspacePolicyPath(ws, id, output)}
+	data, err := os.ReadFile(file.path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read policy: %w", err)
+	}
+
+	// PolicySets are told from policies by their member policies
+	var doc struct {
+		Policies json.RawMessage `json:"policies"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse policy JSON: %w", err)
+	}
+
+	if doc.Policies != nil {
+		if err := json.Unmarshal(data, &file.policySet); err != nil {
+			return nil, fmt.Errorf("failed to parse PolicySet JSON: %w", err)
+		}
+		if file.policySetBase, err = ws.LoadPolicySetBase(id); err != nil {
+			return nil, err
+		}
+		return file, nil
+	}
+
+	if err := json.Unmarshal(data, &file.policy); err != nil {
+		return nil, fmt.Errorf("failed to parse policy JSON: %w", err)
+	}
+	if file.base, err = ws.LoadBase(id); err != nil {
+		return nil, err
+	}
+	return file, nil
+}
+
+// resolveConflict resolves a merge conflict in the policy or member policy.
+func (f *workspaceFile) resolveConflict(conflict ampel.MergeConflict, value string) error {
+	if f.policySet != nil {
+		return ampel.ResolvePolicySetConflict(f.policySet, f.policySetBase, conflict, value)
+	}
+	return ampel.ResolveConflict(f.policy, f.base, conflict, value)
+}
+
+// restoreTenet adds an archived tenet back to the policy or member policy.
+func (f *workspaceFile) restoreTenet(archived ampel.ArchivedTenet) error {
+	if f.policySet != nil {
+		return ampel.RestorePolicySetArchivedTenet(f.policySet, archived)
+	}
+	return ampel.RestoreArchivedTenet(f.policy, archived)
+}
+
+// hasTenet reports whether the policy, or a member policy of the
+// PolicySet, has a tenet. An empty policyID matches any member policy.
+func (f *workspaceFile) hasTenet(policyID, tenetID string) bool {
+	policies := []*ampel.Policy{f.policy}
+	if f.policySet != nil {
+		policies = f.policySet.Policies
+	}
+	for _, policy := range policies {
+		if policyID != "" && f.policySet != nil && policy.GetId() != policyID {
+			continue
+		}
+		for _, tenet := range policy.GetTenets() {
+			if tenet.GetId() == tenetID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// save validates and writes the policy or PolicySet, and its base when one
+// is recorded.
+func (f *workspaceFile) save(ws *ampel.Workspace) error {
+	var document interface{} = f.policy
+	if f.policySet != nil {
+		if err := f.policySet.Validate(); err != nil {
+			return fmt.Errorf("PolicySet validation failed: %w", err)
+		}
+		document = f.policySet
+	} else if err := f.policy.Validate(); err != nil {
+		return fmt.Errorf("policy validation failed: %w", err)
+	}
+
+	data, err := json.MarshalIndent(document, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to serialize policy: %w", err)
+	}
+	if err := ws.WriteFile(f.path, data); err != nil {
+		return fmt.Errorf("failed to write policy: %w", err)
+	}
+
+	switch {
+	case f.policySetBase != nil:
+		return ws.SavePolicySetBase(f.id, f.policySetBase)
+	case f.base != nil:
+		return ws.SaveBase(f.id, f.base)
+	}
+	return nil
+}